@@ -0,0 +1,92 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the first file descriptor passed by systemd socket activation, see sd_listen_fds(3).
+const kListenFdsStart = 3
+
+var (
+	activationOnce      sync.Once
+	activationMutex     sync.Mutex
+	activationListeners []net.Listener
+)
+
+func loadActivationListeners() {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	// don't pass them to the child processes such as ProxyCommand
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	for i := 0; i < count; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(kListenFdsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(kListenFdsStart+i), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			debug("socket activation [%s] is not a listener: %v", name, err)
+			continue
+		}
+		debug("socket activation [%s] listen on '%s'", name, listener.Addr())
+		activationListeners = append(activationListeners, listener)
+	}
+}
+
+// takeActivationListeners returns the listeners passed by systemd which listen on the port.
+func takeActivationListeners(port string) (listeners []net.Listener) {
+	activationOnce.Do(loadActivationListeners)
+	activationMutex.Lock()
+	defer activationMutex.Unlock()
+	var rest []net.Listener
+	for _, listener := range activationListeners {
+		if addr, ok := listener.Addr().(*net.TCPAddr); ok && strconv.Itoa(addr.Port) == port {
+			listeners = append(listeners, listener)
+		} else {
+			rest = append(rest, listener)
+		}
+	}
+	activationListeners = rest
+	return
+}
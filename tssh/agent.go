@@ -27,8 +27,6 @@ SOFTWARE.
 
 import (
 	"fmt"
-	"io"
-	"net"
 	"os"
 	"strings"
 	"sync"
@@ -42,59 +40,124 @@ var (
 	agentClient agent.ExtendedAgent
 )
 
-func getAgentAddr(args *sshArgs) string {
-	if addr := getOptionConfig(args, "IdentityAgent"); addr != "" {
-		if strings.ToLower(addr) == "none" {
-			return ""
+// expandAgentAddr expands the environment variables such as `$SSH_AUTH_SOCK` or `${SSH_AUTH_SOCK}`,
+// and `SSH_AUTH_SOCK` alone means reading the socket address from the environment as OpenSSH does.
+func expandAgentAddr(addr string) string {
+	if addr == "SSH_AUTH_SOCK" {
+		return os.Getenv("SSH_AUTH_SOCK")
+	}
+	return resolveHomeDir(os.ExpandEnv(addr))
+}
+
+// getAgentAddrs returns the agent socket addresses in order,
+// e.g. `IdentityAgent ~/.gnupg/S.gpg-agent.ssh,$SSH_AUTH_SOCK` tries the gpg-agent first.
+func getAgentAddrs(args *sshArgs) []string {
+	if cfg := getOptionConfig(args, "IdentityAgent"); cfg != "" {
+		var addrs []string
+		for _, addr := range strings.Split(cfg, ",") {
+			addr = strings.TrimSpace(addr)
+			if strings.ToLower(addr) == "none" {
+				break
+			}
+			if addr = expandAgentAddr(addr); addr != "" && !containsString(addrs, addr) {
+				addrs = append(addrs, addr)
+			}
 		}
-		return addr
+		return addrs
 	}
 	if addr := os.Getenv("SSH_AUTH_SOCK"); addr != "" {
-		return addr
+		return []string{resolveHomeDir(addr)}
 	}
 	if addr := defaultAgentAddr; addr != "" && isFileExist(addr) {
-		return addr
+		return []string{addr}
+	}
+	return nil
+}
+
+// isAgentForwardEnabled returns whether to forward the agent to the destination. It is the same for a
+// direct connection, a connection via ProxyJump and a session via the control master, as the jump hosts
+// never get the agent. `-a` or `AllowForwardAgent no` of the destination turns it off even if `-A` is set.
+func isAgentForwardEnabled(args *sshArgs) bool {
+	if args.NoForwardAgent || strings.ToLower(getExOptionConfig(args, "AllowForwardAgent")) == "no" {
+		return false
+	}
+	if args.ForwardAgent {
+		return true
+	}
+	switch strings.ToLower(getOptionConfig(args, "ForwardAgent")) {
+	case "", "no":
+		return false
+	default:
+		return true
+	}
+}
+
+// getForwardAgentAddrs returns the agent socket addresses to forward,
+// `ForwardAgent` could be the socket path or the environment variable such as `$SSH_AUTH_SOCK`.
+func getForwardAgentAddrs(args *sshArgs) []string {
+	switch cfg := getOptionConfig(args, "ForwardAgent"); strings.ToLower(cfg) {
+	case "", "yes", "no":
+		return getAgentAddrs(args)
+	default:
+		if addr := expandAgentAddr(cfg); addr != "" {
+			return []string{addr}
+		}
+		return nil
+	}
+}
+
+func containsString(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
 	}
-	return ""
+	return false
 }
 
 func getAgentClient(args *sshArgs) agent.ExtendedAgent {
 	agentOnce.Do(func() {
-		addr := resolveHomeDir(getAgentAddr(args))
-		if addr == "" {
+		addrs := getAgentAddrs(args)
+		if len(addrs) == 0 {
 			debug("ssh agent address is not set")
 			return
 		}
 
-		conn, err := dialAgent(addr)
-		if err != nil {
-			debug("dial ssh agent [%s] failed: %v", addr, err)
-			return
-		}
+		for _, addr := range addrs {
+			conn, err := dialAgent(addr)
+			if err != nil {
+				debug("dial ssh agent [%s] failed: %v", addr, err)
+				continue
+			}
 
-		agentClient = agent.NewClient(conn)
-		debug("new ssh agent client [%s] success", addr)
+			pool := newAgentPool(addr, conn)
+			agentClient = pool
+			debug("new ssh agent client [%s] success", addr)
 
-		cleanupAfterLogined = append(cleanupAfterLogined, func() {
-			conn.Close()
-			agentClient = nil
-		})
+			cleanupAfterLogined = append(cleanupAfterLogined, func() {
+				pool.close()
+				agentClient = nil
+			})
+			return
+		}
 	})
 	return agentClient
 }
 
 const channelType = "auth-agent@openssh.com"
 
+// forwardToRemote forwards the agent without `session-bind@openssh.com`, as x/crypto/ssh doesn't expose
+// the host key signature of the exchange hash, which is also required by publickey-hostbound-v00@openssh.com.
 func forwardToRemote(client *ssh.Client, addr string) error {
-	channels := client.HandleChannelOpen(channelType)
-	if channels == nil {
-		return fmt.Errorf("agent: already have handler for %s", channelType)
-	}
 	conn, err := dialAgent(addr)
 	if err != nil {
 		return err
 	}
 	conn.Close()
+	channels := client.HandleChannelOpen(channelType)
+	if channels == nil {
+		return fmt.Errorf("agent: already have handler for %s", channelType)
+	}
 
 	go func() {
 		for ch := range channels {
@@ -118,14 +181,14 @@ func forwardAgentRequest(channel ssh.Channel, addr string) {
 	var wg sync.WaitGroup
 	wg.Add(2)
 	go func() {
-		_, _ = io.Copy(conn, channel)
-		if unixConn, ok := conn.(*net.UnixConn); ok {
-			_ = unixConn.CloseWrite()
+		_, _ = relayCopy(conn, channel)
+		if closer, ok := conn.(interface{ CloseWrite() error }); ok {
+			_ = closer.CloseWrite()
 		}
 		wg.Done()
 	}()
 	go func() {
-		_, _ = io.Copy(channel, conn)
+		_, _ = relayCopy(channel, conn)
 		_ = channel.CloseWrite()
 		wg.Done()
 	}()
@@ -0,0 +1,210 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const kMaxIdleAgentConns = 8
+
+type agentConn struct {
+	agent.ExtendedAgent
+	conn net.Conn
+}
+
+// agentPool dials more agent connections on demand, so concurrent signing requests
+// ( e.g., logging in to many jump hosts in parallel ) don't serialize on a single connection.
+type agentPool struct {
+	addr   string
+	mutex  sync.Mutex
+	idle   []*agentConn
+	conns  map[*agentConn]struct{}
+	closed bool
+}
+
+func newAgentPool(addr string, conn net.Conn) *agentPool {
+	c := &agentConn{agent.NewClient(conn), conn}
+	return &agentPool{addr: addr, idle: []*agentConn{c}, conns: map[*agentConn]struct{}{c: {}}}
+}
+
+func (p *agentPool) get() (*agentConn, error) {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return nil, fmt.Errorf("agent: pool closed")
+	}
+	if n := len(p.idle); n > 0 {
+		c := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mutex.Unlock()
+		return c, nil
+	}
+	p.mutex.Unlock()
+
+	conn, err := dialAgent(p.addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &agentConn{agent.NewClient(conn), conn}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		conn.Close()
+		return nil, fmt.Errorf("agent: pool closed")
+	}
+	p.conns[c] = struct{}{}
+	debug("new ssh agent connection [%s], total %d", p.addr, len(p.conns))
+	return c, nil
+}
+
+func (p *agentPool) put(c *agentConn, broken bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !broken && !p.closed && len(p.idle) < kMaxIdleAgentConns {
+		p.idle = append(p.idle, c)
+		return
+	}
+	delete(p.conns, c)
+	c.conn.Close()
+}
+
+func (p *agentPool) do(f func(agent.ExtendedAgent) error) error {
+	c, err := p.get()
+	if err != nil {
+		return err
+	}
+	err = f(c)
+	// the connection state is unknown after a failure, so don't reuse it.
+	p.put(c, err != nil)
+	return err
+}
+
+func (p *agentPool) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.closed = true
+	for c := range p.conns {
+		c.conn.Close()
+	}
+	p.idle = nil
+	p.conns = map[*agentConn]struct{}{}
+}
+
+func (p *agentPool) List() (keys []*agent.Key, err error) {
+	err = p.do(func(a agent.ExtendedAgent) error {
+		keys, err = a.List()
+		return err
+	})
+	return
+}
+
+func (p *agentPool) Sign(key ssh.PublicKey, data []byte) (sig *ssh.Signature, err error) {
+	err = p.do(func(a agent.ExtendedAgent) error {
+		sig, err = a.Sign(key, data)
+		return err
+	})
+	return
+}
+
+func (p *agentPool) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (sig *ssh.Signature, err error) {
+	err = p.do(func(a agent.ExtendedAgent) error {
+		sig, err = a.SignWithFlags(key, data, flags)
+		return err
+	})
+	return
+}
+
+func (p *agentPool) Add(key agent.AddedKey) error {
+	return p.do(func(a agent.ExtendedAgent) error { return a.Add(key) })
+}
+
+func (p *agentPool) Remove(key ssh.PublicKey) error {
+	return p.do(func(a agent.ExtendedAgent) error { return a.Remove(key) })
+}
+
+func (p *agentPool) RemoveAll() error {
+	return p.do(func(a agent.ExtendedAgent) error { return a.RemoveAll() })
+}
+
+func (p *agentPool) Lock(passphrase []byte) error {
+	return p.do(func(a agent.ExtendedAgent) error { return a.Lock(passphrase) })
+}
+
+func (p *agentPool) Unlock(passphrase []byte) error {
+	return p.do(func(a agent.ExtendedAgent) error { return a.Unlock(passphrase) })
+}
+
+func (p *agentPool) Extension(extensionType string, contents []byte) (resp []byte, err error) {
+	err = p.do(func(a agent.ExtendedAgent) error {
+		resp, err = a.Extension(extensionType, contents)
+		return err
+	})
+	return
+}
+
+// Signers returns signers bound to the pool rather than to a single connection.
+func (p *agentPool) Signers() ([]ssh.Signer, error) {
+	keys, err := p.List()
+	if err != nil {
+		return nil, err
+	}
+	signers := make([]ssh.Signer, 0, len(keys))
+	for _, key := range keys {
+		signers = append(signers, &agentPoolSigner{p, key})
+	}
+	return signers, nil
+}
+
+type agentPoolSigner struct {
+	pool *agentPool
+	pub  ssh.PublicKey
+}
+
+func (s *agentPoolSigner) PublicKey() ssh.PublicKey {
+	return s.pub
+}
+
+func (s *agentPoolSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.pool.Sign(s.pub, data)
+}
+
+func (s *agentPoolSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	switch algorithm {
+	case ssh.KeyAlgoRSASHA256:
+		return s.pool.SignWithFlags(s.pub, data, agent.SignatureFlagRsaSha256)
+	case ssh.KeyAlgoRSASHA512:
+		return s.pool.SignWithFlags(s.pub, data, agent.SignatureFlagRsaSha512)
+	default:
+		return s.Sign(rand, data)
+	}
+}
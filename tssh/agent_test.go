@@ -0,0 +1,76 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentForwardEnabled(t *testing.T) {
+	assert := assert.New(t)
+	assertEnabled := func(forward, noForward bool, forwardAgent, allowForwardAgent string, enabled bool) {
+		t.Helper()
+		args := &sshArgs{
+			ForwardAgent:   forward,
+			NoForwardAgent: noForward,
+			Option: sshOption{map[string][]string{
+				"forwardagent":      {forwardAgent},
+				"allowforwardagent": {allowForwardAgent},
+			}},
+		}
+		assert.Equal(enabled, isAgentForwardEnabled(args))
+	}
+
+	assertEnabled(false, false, "no", "yes", false)
+	assertEnabled(false, false, "yes", "yes", true)
+	assertEnabled(false, false, "Yes", "yes", true)
+	assertEnabled(false, false, "$SSH_AUTH_SOCK", "yes", true)
+	assertEnabled(true, false, "no", "yes", true)
+	assertEnabled(true, true, "yes", "yes", false)
+	assertEnabled(false, true, "yes", "yes", false)
+	assertEnabled(true, false, "yes", "no", false)
+	assertEnabled(false, false, "yes", "No", false)
+}
+
+func TestForwardAgentAddrs(t *testing.T) {
+	assert := assert.New(t)
+	t.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+	assertAddrs := func(forwardAgent string, expected ...string) {
+		t.Helper()
+		args := &sshArgs{Option: sshOption{map[string][]string{
+			"forwardagent":  {forwardAgent},
+			"identityagent": {"/tmp/identity.sock"},
+		}}}
+		assert.Equal(expected, getForwardAgentAddrs(args))
+	}
+
+	assertAddrs("yes", "/tmp/identity.sock")
+	assertAddrs("/tmp/forward.sock", "/tmp/forward.sock")
+	assertAddrs("$SSH_AUTH_SOCK", "/tmp/agent.sock")
+	assertAddrs("SSH_AUTH_SOCK", "/tmp/agent.sock")
+}
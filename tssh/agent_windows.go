@@ -27,6 +27,8 @@ SOFTWARE.
 
 import (
 	"net"
+	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/Microsoft/go-winio"
@@ -34,7 +36,32 @@ import (
 
 const defaultAgentAddr = `\\.\pipe\openssh-ssh-agent`
 
+func isNamedPipe(addr string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.ReplaceAll(addr, "/", `\`)), `\\.\pipe\`)
+}
+
+// convertCygwinPath converts the POSIX path such as `/tmp/ssh-XXX/agent.123`
+// set by the ssh-agent of Cygwin or MSYS2 to the Windows path.
+func convertCygwinPath(addr string) string {
+	if !strings.HasPrefix(addr, "/") {
+		return addr
+	}
+	out, err := exec.Command("cygpath", "-w", addr).Output()
+	if err != nil {
+		debug("cygpath [%s] failed: %v", addr, err)
+		return addr
+	}
+	return strings.TrimSpace(string(out))
+}
+
 func dialAgent(addr string) (net.Conn, error) {
-	timeout := time.Second
-	return winio.DialPipe(addr, &timeout)
+	if isNamedPipe(addr) {
+		timeout := time.Second
+		return winio.DialPipe(addr, &timeout)
+	}
+	path := convertCygwinPath(addr)
+	if isCygwinSocket(path) {
+		return dialCygwinSocket(path)
+	}
+	return net.DialTimeout("unix", path, time.Second)
 }
@@ -28,6 +28,8 @@ package tssh
 import (
 	"bytes"
 	"fmt"
+	"net"
+	"reflect"
 	"strings"
 )
 
@@ -48,40 +50,161 @@ type forwardArgs struct {
 }
 
 type sshArgs struct {
-	Ver            bool        `arg:"-V,--" help:"show program's version number and exit"`
-	Destination    string      `arg:"positional" help:"alias in ~/.ssh/config, or [user@]hostname[:port]"`
-	Command        string      `arg:"positional" help:"command to execute instead of a login shell"`
-	Argument       []string    `arg:"positional" help:"command arguments separated by spaces"`
-	ForwardAgent   bool        `arg:"-A,--" help:"enable forwarding the ssh agent connection"`
-	NoForwardAgent bool        `arg:"-a,--" help:"disable forwarding the ssh agent connection"`
-	DisableTTY     bool        `arg:"-T,--" help:"disable pseudo-terminal allocation"`
-	ForceTTY       bool        `arg:"-t,--" help:"force pseudo-terminal allocation"`
-	Gateway        bool        `arg:"-g,--" help:"forwarding allows remote hosts to connect"`
-	Background     bool        `arg:"-f,--" help:"run as a background process, implies -n"`
-	NoCommand      bool        `arg:"-N,--" help:"do not execute a remote command"`
-	Port           int         `arg:"-p,--" placeholder:"port" help:"port to connect to on the remote host"`
-	LoginName      string      `arg:"-l,--" placeholder:"login_name" help:"the user to log in as on the remote machine"`
-	Identity       multiStr    `arg:"-i,--" placeholder:"identity_file" help:"identity (private key) for public key auth"`
-	ConfigFile     string      `arg:"-F,--" placeholder:"configfile" help:"an alternative per-user configuration file"`
-	ProxyJump      string      `arg:"-J,--" placeholder:"destination" help:"jump hosts separated by comma characters"`
-	Option         sshOption   `arg:"-o,--" placeholder:"key=value" help:"options in the format used in ~/.ssh/config\ne.g., tssh -o ProxyCommand=\"ssh proxy nc %h %p\""`
-	StdioForward   string      `arg:"-W,--" placeholder:"host:port" help:"forward stdin and stdout to host on port"`
-	DynamicForward bindArgs    `arg:"-D,--" placeholder:"[bind_addr:]port" help:"dynamic port forwarding ( socks5 proxy )"`
-	LocalForward   forwardArgs `arg:"-L,--" placeholder:"[bind_addr:]port:host:hostport" help:"local port forwarding"`
-	RemoteForward  forwardArgs `arg:"-R,--" placeholder:"[bind_addr:]port:host:hostport" help:"remote port forwarding"`
-	Reconnect      bool        `arg:"--reconnect" help:"reconnect when background(-f) process exits"`
-	DragFile       bool        `arg:"--dragfile" help:"enable drag files and directories to upload"`
-	TraceLog       bool        `arg:"--tracelog" help:"enable trzsz detect trace logs for debugging"`
-	Relay          bool        `arg:"--relay" help:"force trzsz run as a relay on the jump server"`
-	Debug          bool        `arg:"--debug" help:"verbose mode for debugging, same as ssh's -vvv"`
-	Zmodem         bool        `arg:"--zmodem" help:"enable zmodem lrzsz ( rz / sz ) feature"`
-	NewHost        bool        `arg:"--new-host" help:"[tools] add new host to configuration"`
-	EncSecret      bool        `arg:"--enc-secret" help:"[tools] encode secret for configuration"`
-	InstallTrzsz   bool        `arg:"--install-trzsz" help:"[tools] install trzsz to the remote server"`
-	InstallPath    string      `arg:"--install-path" placeholder:"path" help:"[tools] install path, default: '~/.local/bin/'"`
-	TrzszVersion   string      `arg:"--trzsz-version" placeholder:"x.x.x" help:"[tools] install the specified version of trzsz"`
-	TrzszBinPath   string      `arg:"--trzsz-bin-path" placeholder:"path" help:"[tools] trzsz binary installation package path"`
-	originalDest   string
+	Ver             bool        `arg:"-V,--" help:"show program's version number and exit"`
+	Destination     string      `arg:"positional" help:"alias in ~/.ssh/config, or [user@]hostname[:port]"`
+	Command         string      `arg:"positional" help:"command to execute instead of a login shell"`
+	Argument        []string    `arg:"positional" help:"command arguments separated by spaces"`
+	ForwardAgent    bool        `arg:"-A,--" help:"enable forwarding the ssh agent connection"`
+	NoForwardAgent  bool        `arg:"-a,--" help:"disable forwarding the ssh agent connection"`
+	DisableTTY      bool        `arg:"-T,--" help:"disable pseudo-terminal allocation"`
+	ForceTTY        bool        `arg:"-t,--" help:"force pseudo-terminal allocation"`
+	Gateway         bool        `arg:"-g,--" help:"forwarding allows remote hosts to connect"`
+	Background      bool        `arg:"-f,--" help:"run as a background process, implies -n"`
+	NoCommand       bool        `arg:"-N,--" help:"do not execute a remote command"`
+	NoStdin         bool        `arg:"-n,--" help:"redirect stdin from /dev/null"`
+	Quiet           bool        `arg:"-q,--" help:"quiet mode, suppress warning and diagnostic messages"`
+	Syslog          bool        `arg:"-y,--" help:"send log information using the syslog"`
+	NoGSSAPI        bool        `arg:"-k,--" help:"disable forwarding of GSSAPI credentials"`
+	Compression     bool        `arg:"-C,--" help:"compression is not supported, accepted for compatibility"`
+	IPv4Only        bool        `arg:"-4,--" help:"use IPv4 addresses only"`
+	IPv6Only        bool        `arg:"-6,--" help:"use IPv6 addresses only"`
+	DumpConfig      bool        `arg:"-G,--" help:"print the effective configuration for the destination and exit"`
+	Tag             string      `arg:"-P,--" placeholder:"tag" help:"tag name for selecting configuration by Match tagged"`
+	CtlCmd          string      `arg:"-O,--" placeholder:"ctl_cmd" help:"control an active -N tunnel via its MetricsListen, supported: stats"`
+	Port            int         `arg:"-p,--" placeholder:"port" help:"port to connect to on the remote host"`
+	LoginName       string      `arg:"-l,--" placeholder:"login_name" help:"the user to log in as on the remote machine"`
+	Identity        multiStr    `arg:"-i,--" placeholder:"identity_file" help:"identity (private key) for public key auth"`
+	ConfigFile      string      `arg:"-F,--" placeholder:"configfile" help:"an alternative per-user configuration file"`
+	ProxyJump       string      `arg:"-J,--" placeholder:"destination" help:"jump hosts separated by comma characters"`
+	Option          sshOption   `arg:"-o,--" placeholder:"key=value" help:"options in the format used in ~/.ssh/config\ne.g., tssh -o ProxyCommand=\"ssh proxy nc %h %p\""`
+	StdioForward    string      `arg:"-W,--" placeholder:"host:port" help:"forward stdin and stdout to host on port"`
+	DynamicForward  bindArgs    `arg:"-D,--" placeholder:"[bind_addr:]port" help:"dynamic port forwarding ( socks5 proxy )"`
+	LocalForward    forwardArgs `arg:"-L,--" placeholder:"[bind_addr:]port:host:hostport" help:"local port forwarding"`
+	RemoteForward   forwardArgs `arg:"-R,--" placeholder:"[bind_addr:]port:host:hostport" help:"remote port forwarding"`
+	Reconnect       bool        `arg:"--reconnect" help:"reconnect when background(-f) process exits"`
+	DragFile        bool        `arg:"--dragfile" help:"enable drag files and directories to upload"`
+	TraceLog        bool        `arg:"--tracelog" help:"enable trzsz detect trace logs for debugging"`
+	Relay           bool        `arg:"--relay" help:"force trzsz run as a relay on the jump server"`
+	Debug           bool        `arg:"--debug" help:"verbose mode for debugging, same as ssh's -vvv"`
+	Explain         bool        `arg:"--explain" help:"explain the error code, likely cause and possible fix on failure"`
+	Zmodem          bool        `arg:"--zmodem" help:"enable zmodem lrzsz ( rz / sz ) feature"`
+	NewHost         bool        `arg:"--new-host" help:"[tools] add new host to configuration"`
+	EncSecret       bool        `arg:"--enc-secret" help:"[tools] encode secret for configuration"`
+	Probe           bool        `arg:"--probe" help:"[tools] probe the algorithms and auth methods of the server"`
+	PruneKnownHost  bool        `arg:"--prune-known-hosts" help:"[tools] remove the duplicate and corrupted entries of known_hosts"`
+	Check           bool        `arg:"--check" help:"[tools] check the connectivity of the hosts matching the destination pattern"`
+	CheckAuth       bool        `arg:"--check-auth" help:"[tools] also check the login in batch mode for --check"`
+	CheckJSON       bool        `arg:"--check-json" help:"[tools] print the result of --check in JSON"`
+	InstallTrzsz    bool        `arg:"--install-trzsz" help:"[tools] install trzsz to the remote server"`
+	InstallPath     string      `arg:"--install-path" placeholder:"path" help:"[tools] install path, default: '~/.local/bin/'"`
+	TrzszVersion    string      `arg:"--trzsz-version" placeholder:"x.x.x" help:"[tools] install the specified version of trzsz"`
+	TrzszBinPath    string      `arg:"--trzsz-bin-path" placeholder:"path" help:"[tools] trzsz binary installation package path"`
+	UploadFile      string      `arg:"--upload-file" placeholder:"local:remote" help:"[tools] upload a large file over parallel channels"`
+	DownloadFile    string      `arg:"--download-file" placeholder:"remote:local" help:"[tools] download a large file over parallel channels"`
+	CopyFrom        string      `arg:"--copy-from" placeholder:"host:path" help:"[tools] copy a file from another host to the destination"`
+	CopyTo          string      `arg:"--copy-to" placeholder:"path" help:"[tools] the path on the destination to copy to, default: '.'"`
+	Share           string      `arg:"--share" placeholder:"ro|rw" help:"share the interactive session with local tssh --attach"`
+	Attach          string      `arg:"--attach" placeholder:"pid" help:"[tools] attach to the session shared by another local tssh"`
+	Sudo            bool        `arg:"--sudo" help:"run the command with sudo, the password is piped to sudo -S"`
+	SpeedTest       bool        `arg:"--speedtest" help:"[tools] test the latency and throughput to the server"`
+	SpeedTestTime   uint        `arg:"--speedtest-time" placeholder:"seconds" help:"[tools] duration of each throughput test, default: 3"`
+	SpeedTestDir    string      `arg:"--speedtest-dir" placeholder:"up|down|both" help:"[tools] direction of the throughput test, default: both"`
+	originalDest    string
+	authWatchdog    *authWatchdog
+	pendingPassword string
+	connection      string
+	tcpConn         net.Conn
+	requestTTY      string
+	skipControl     bool
+}
+
+// getValueFlags returns the short and long flags of sshArgs which take a value
+func getValueFlags() (map[byte]struct{}, map[string]struct{}) {
+	shorts := make(map[byte]struct{})
+	longs := make(map[string]struct{})
+	t := reflect.TypeOf(sshArgs{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("arg")
+		if !ok || tag == "positional" || field.Type.Kind() == reflect.Bool {
+			continue
+		}
+		for _, name := range strings.Split(tag, ",") {
+			if strings.HasPrefix(name, "--") {
+				if len(name) > 2 {
+					longs[name[2:]] = struct{}{}
+				}
+			} else if strings.HasPrefix(name, "-") && len(name) == 2 {
+				shorts[name[1]] = struct{}{}
+			}
+		}
+	}
+	return shorts, longs
+}
+
+// getLongFlags returns the long flags of sshArgs, and whether they take a value
+func getLongFlags() map[string]bool {
+	longs := make(map[string]bool)
+	t := reflect.TypeOf(sshArgs{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("arg")
+		if !ok || tag == "positional" {
+			continue
+		}
+		for _, name := range strings.Split(tag, ",") {
+			if strings.HasPrefix(name, "--") && len(name) > 2 {
+				longs[name[2:]] = field.Type.Kind() != reflect.Bool
+			}
+		}
+	}
+	return longs
+}
+
+// preprocessArgs inserts "--" before the remote command, as OpenSSH stops parsing options there,
+// e.g. `tssh -tt host sudo -u root ls`, and returns the RequestTTY value of the last -t or -T,
+// a single -t is "yes", multiple -t are "force", and -T is "no".
+func preprocessArgs(argv []string) ([]string, string) {
+	shorts, longs := getValueFlags()
+	requestTTY := ""
+	hasDest := false
+	for i := 0; i < len(argv); i++ {
+		arg := argv[i]
+		switch {
+		case arg == "--":
+			return argv, requestTTY
+		case !strings.HasPrefix(arg, "-") || arg == "-":
+			if hasDest {
+				newArgs := append([]string{}, argv[:i]...)
+				return append(append(newArgs, "--"), argv[i:]...), requestTTY
+			}
+			hasDest = true
+		case strings.HasPrefix(arg, "--"):
+			if _, ok := longs[arg[2:]]; ok {
+				i++
+			}
+		default:
+			for j := 1; j < len(arg); j++ {
+				if _, ok := shorts[arg[j]]; ok {
+					if j == len(arg)-1 {
+						i++
+					}
+					break
+				}
+				switch arg[j] {
+				case 't':
+					if requestTTY == "yes" || requestTTY == "force" {
+						requestTTY = "force"
+					} else {
+						requestTTY = "yes"
+					}
+				case 'T':
+					requestTTY = "no"
+				}
+			}
+		}
+	}
+	return argv, requestTTY
 }
 
 func (sshArgs) Description() string {
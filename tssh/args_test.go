@@ -59,6 +59,17 @@ func TestSshArgs(t *testing.T) {
 	assertArgsEqual("-f", sshArgs{Background: true})
 	assertArgsEqual("-N", sshArgs{NoCommand: true})
 	assertArgsEqual("-gfN -T", sshArgs{Gateway: true, Background: true, NoCommand: true, DisableTTY: true})
+	assertArgsEqual("-n", sshArgs{NoStdin: true})
+	assertArgsEqual("-q", sshArgs{Quiet: true})
+	assertArgsEqual("-y", sshArgs{Syslog: true})
+	assertArgsEqual("-k", sshArgs{NoGSSAPI: true})
+	assertArgsEqual("-C", sshArgs{Compression: true})
+	assertArgsEqual("-4", sshArgs{IPv4Only: true})
+	assertArgsEqual("-6", sshArgs{IPv6Only: true})
+	assertArgsEqual("-P prod", sshArgs{Tag: "prod"})
+	assertArgsEqual("-G", sshArgs{DumpConfig: true})
+	assertArgsEqual("-nqy4 -ak", sshArgs{NoStdin: true, Quiet: true, Syslog: true, IPv4Only: true,
+		NoForwardAgent: true, NoGSSAPI: true})
 
 	assertArgsEqual("-p1022", sshArgs{Port: 1022})
 	assertArgsEqual("-p 2049", sshArgs{Port: 2049})
@@ -83,6 +94,7 @@ func TestSshArgs(t *testing.T) {
 
 	assertArgsEqual("--new-host", sshArgs{NewHost: true})
 	assertArgsEqual("--enc-secret", sshArgs{EncSecret: true})
+	assertArgsEqual("--probe", sshArgs{Probe: true})
 	assertArgsEqual("--install-trzsz", sshArgs{InstallTrzsz: true})
 	assertArgsEqual("--install-trzsz --install-path /bin", sshArgs{InstallTrzsz: true, InstallPath: "/bin"})
 	assertArgsEqual("--install-trzsz --trzsz-version 1.1.6", sshArgs{InstallTrzsz: true, TrzszVersion: "1.1.6"})
@@ -247,3 +259,86 @@ func TestMultiOptions(t *testing.T) {
 	assertSendEnvs([]string{"-oSendEnv=ABC 123", "-o", "SendEnv XYZ"}, "ABC 123", "XYZ")
 	assertSendEnvs([]string{"-o", "SendEnv ABC 123", "-oSendEnv = XYZ", "-oSendEnv m3"}, "ABC 123", "XYZ", "m3")
 }
+
+func TestPreprocessArgs(t *testing.T) {
+	assert := assert.New(t)
+	assertPreprocess := func(cmdline, expectedArgs, expectedTTY string) {
+		t.Helper()
+		argv, requestTTY := preprocessArgs(strings.Fields(cmdline))
+		assert.Equal(expectedArgs, strings.Join(argv, " "))
+		assert.Equal(expectedTTY, requestTTY)
+	}
+
+	assertPreprocess("", "", "")
+	assertPreprocess("host", "host", "")
+	assertPreprocess("-t host", "-t host", "yes")
+	assertPreprocess("-tt host", "-tt host", "force")
+	assertPreprocess("-t -t host", "-t -t host", "force")
+	assertPreprocess("-T host", "-T host", "no")
+	assertPreprocess("-tT host", "-tT host", "no")
+	assertPreprocess("-T -t host", "-T -t host", "yes")
+	assertPreprocess("-tt host sudo -u root ls", "-tt host -- sudo -u root ls", "force")
+	assertPreprocess("host ls -la", "host -- ls -la", "")
+	assertPreprocess("host -p 2222 ls -t", "host -p 2222 -- ls -t", "")
+	assertPreprocess("-l tt host", "-l tt host", "")
+	assertPreprocess("-ltt host", "-ltt host", "")
+	assertPreprocess("-At -o RequestTTY=no host", "-At -o RequestTTY=no host", "yes")
+	assertPreprocess("--upload-file a:b host", "--upload-file a:b host", "")
+	assertPreprocess("--debug host ls", "--debug host -- ls", "")
+	assertPreprocess("host -- ls -t", "host -- ls -t", "")
+}
+
+func TestParseCmdAndTTY(t *testing.T) {
+	assert := assert.New(t)
+	originalWarning := warning
+	defer func() {
+		warning = originalWarning
+	}()
+	warning = func(format string, a ...any) {}
+	originalIsTerminal := isTerminal
+	defer func() {
+		isTerminal = originalIsTerminal
+	}()
+
+	assertTTY := func(args *sshArgs, terminal bool, expectedCmd string, expectedTTY bool) {
+		t.Helper()
+		isTerminal = terminal
+		if args.Option.options == nil {
+			args.Option.options = map[string][]string{}
+		}
+		for key, value := range map[string]string{"remotecommand": "none", "requesttty": "auto"} {
+			if _, ok := args.Option.options[key]; !ok {
+				args.Option.options[key] = []string{value}
+			}
+		}
+		cmd, tty, err := parseCmdAndTTY(args)
+		assert.Nil(err)
+		assert.Equal(expectedCmd, cmd)
+		assert.Equal(expectedTTY, tty)
+	}
+
+	assertTTY(&sshArgs{}, true, "", true)
+	assertTTY(&sshArgs{}, false, "", false)
+	assertTTY(&sshArgs{Command: "ls"}, true, "ls", false)
+	assertTTY(&sshArgs{Command: "sudo", Argument: []string{"ls"}, requestTTY: "yes"}, true, "sudo ls", true)
+	assertTTY(&sshArgs{Command: "sudo", Argument: []string{"ls"}, requestTTY: "yes"}, false, "sudo ls", false)
+	assertTTY(&sshArgs{Command: "sudo", Argument: []string{"ls"}, requestTTY: "force"}, false, "sudo ls", true)
+	assertTTY(&sshArgs{ForceTTY: true, Command: "top"}, true, "top", true)
+	assertTTY(&sshArgs{DisableTTY: true}, true, "", false)
+	assertTTY(&sshArgs{requestTTY: "no", ForceTTY: true}, true, "", false)
+	assertTTY(&sshArgs{requestTTY: "force", NoCommand: true}, true, "", false)
+	assertTTY(&sshArgs{requestTTY: "yes", NoStdin: true}, true, "", false)
+	assertTTY(&sshArgs{requestTTY: "force", NoStdin: true}, true, "", true)
+
+	assertTTY(&sshArgs{Option: sshOption{map[string][]string{"requesttty": {"force"}}}}, false, "", true)
+	assertTTY(&sshArgs{Option: sshOption{map[string][]string{"requesttty": {"yes"}}}, Command: "ls"}, true, "ls", true)
+	assertTTY(&sshArgs{Option: sshOption{map[string][]string{"requesttty": {"no"}}}}, true, "", false)
+	assertTTY(&sshArgs{Option: sshOption{map[string][]string{"requesttty": {"no"}}}, requestTTY: "yes"}, true, "", true)
+	assertTTY(&sshArgs{Option: sshOption{map[string][]string{"remotecommand": {"tmux a"}, "requesttty": {"yes"}}}},
+		true, "tmux a", true)
+	assertTTY(&sshArgs{Option: sshOption{map[string][]string{"remotecommand": {"tmux a"}}}}, true, "tmux a", false)
+
+	_, _, err := parseCmdAndTTY(&sshArgs{Option: sshOption{map[string][]string{"remotecommand": {"none"},
+		"requesttty": {"maybe"}}}})
+	assert.NotNil(err)
+}
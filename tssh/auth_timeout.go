@@ -0,0 +1,156 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type namedAuthMethod struct {
+	name   string
+	method ssh.AuthMethod
+}
+
+// getConnectTimeout returns `ConnectTimeout`, or 10 seconds by default.
+func getConnectTimeout(args *sshArgs) time.Duration {
+	if value := getOptionConfig(args, "ConnectTimeout"); value != "" {
+		seconds, err := strconv.ParseUint(value, 10, 32)
+		if err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		warning("ConnectTimeout %s is invalid", value)
+	}
+	return 10 * time.Second
+}
+
+// getAuthMethodTimeout returns `AuthMethodTimeout`, 0 means no timeout, which is the default, as ConnectTimeout
+// is too short for the slow keyboard-interactive methods, e.g., waiting for the push of 2FA.
+func getAuthMethodTimeout(args *sshArgs) time.Duration {
+	value := getExOptionConfig(args, "AuthMethodTimeout")
+	if value == "" {
+		return 0
+	}
+	seconds, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		warning("AuthMethodTimeout %s is invalid: %v", value, err)
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// authWatchdog closes the connection if the server doesn't reply to an authentication request within the
+// timeout, e.g. a broken PAM or a slow LDAP, and records the hung method, so that it can be skipped.
+// It only counts the time waiting for the server, not the time the user is typing a password.
+type authWatchdog struct {
+	net.Conn
+	timeout time.Duration
+	mutex   sync.Mutex
+	waiting time.Time
+	method  string
+	hung    bool
+	stopped atomic.Bool
+	done    chan struct{}
+}
+
+func newAuthWatchdog(conn net.Conn, timeout time.Duration) *authWatchdog {
+	w := &authWatchdog{Conn: conn, timeout: timeout, done: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+			}
+			w.mutex.Lock()
+			w.hung = !w.waiting.IsZero() && time.Since(w.waiting) > w.timeout
+			hung, method := w.hung, w.method
+			w.mutex.Unlock()
+			if hung {
+				debug("auth method [%s] got no reply in %v", method, w.timeout)
+				_ = w.Conn.Close()
+				return
+			}
+		}
+	}()
+	return w
+}
+
+func (w *authWatchdog) Read(p []byte) (int, error) {
+	n, err := w.Conn.Read(p)
+	if n > 0 && !w.stopped.Load() {
+		w.mutex.Lock()
+		w.waiting = time.Time{}
+		w.mutex.Unlock()
+	}
+	return n, err
+}
+
+func (w *authWatchdog) Write(p []byte) (int, error) {
+	if !w.stopped.Load() {
+		w.mutex.Lock()
+		if w.waiting.IsZero() {
+			w.waiting = time.Now()
+		}
+		w.mutex.Unlock()
+	}
+	return w.Conn.Write(p)
+}
+
+// begin is called when an authentication method starts.
+func (w *authWatchdog) begin(method string) {
+	if w == nil {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if !w.hung {
+		w.method = method
+	}
+}
+
+func (w *authWatchdog) stop() {
+	if w.stopped.CompareAndSwap(false, true) {
+		close(w.done)
+	}
+}
+
+// hungMethod returns the method which hung, it's empty if not hung or hung before any method started.
+func (w *authWatchdog) hungMethod() (string, bool) {
+	if w == nil {
+		return "", false
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.method, w.hung
+}
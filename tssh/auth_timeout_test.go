@@ -0,0 +1,118 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestAuthWatchdog(t *testing.T) {
+	assert := assert.New(t)
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	assert.Nil(err)
+	_, userKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	userSigner, err := ssh.NewSignerFromKey(userKey)
+	assert.Nil(err)
+
+	// the public key authentication of the server hangs like a broken PAM
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			time.Sleep(3 * time.Second)
+			return nil, nil
+		},
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _, _, _ = ssh.NewServerConn(conn, serverConfig)
+			}()
+		}
+	}()
+
+	var watchdog *authWatchdog
+	login := func(auth ...ssh.AuthMethod) error {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		assert.Nil(err)
+		defer conn.Close()
+		watchdog = newAuthWatchdog(conn, 500*time.Millisecond)
+		defer watchdog.stop()
+		config := &ssh.ClientConfig{User: "test", Auth: auth, HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+		_, _, _, err = ssh.NewClientConn(watchdog, conn.RemoteAddr().String(), config)
+		return err
+	}
+	publicKey := ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		watchdog.begin("publickey")
+		return []ssh.Signer{userSigner}, nil
+	})
+	password := ssh.PasswordCallback(func() (string, error) {
+		watchdog.begin("password")
+		return "test", nil
+	})
+
+	beginTime := time.Now()
+	assert.NotNil(login(publicKey, password))
+	assert.Less(time.Since(beginTime), 2*time.Second)
+	method, hung := watchdog.hungMethod()
+	assert.True(hung)
+	assert.Equal("publickey", method)
+
+	assert.Nil(login(password))
+	method, hung = watchdog.hungMethod()
+	assert.False(hung)
+	assert.Equal("password", method)
+}
+
+func TestGetAuthMethodTimeout(t *testing.T) {
+	assert := assert.New(t)
+	newArgs := func(options map[string][]string) *sshArgs {
+		return &sshArgs{Destination: "test_auth_method_timeout", Option: sshOption{options}}
+	}
+	assert.Equal(time.Duration(0), getAuthMethodTimeout(newArgs(nil)))
+	assert.Equal(time.Duration(0), getAuthMethodTimeout(newArgs(map[string][]string{"connecttimeout": {"15"}})))
+	assert.Equal(5*time.Second, getAuthMethodTimeout(newArgs(map[string][]string{
+		"connecttimeout": {"15"}, "authmethodtimeout": {"5"}})))
+}
@@ -0,0 +1,102 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	kMotdQuietTime   = 300 * time.Millisecond
+	kMotdWaitTimeout = 3 * time.Second
+)
+
+func isBannerSuppressed(args *sshArgs) bool {
+	return strings.ToLower(getExOptionConfig(args, "SuppressBanner")) == "yes"
+}
+
+func isMotdSuppressed(args *sshArgs) bool {
+	return strings.ToLower(getExOptionConfig(args, "SuppressMotd")) == "yes"
+}
+
+// captureBanner appends the suppressed banner or motd to BannerLogFile if configured.
+func captureBanner(args *sshArgs, kind string, text []byte) {
+	path := getExOptionConfig(args, "BannerLogFile")
+	if path == "" || len(text) == 0 {
+		return
+	}
+	param, err := getLoginParam(args)
+	if err != nil {
+		warning("get login param for BannerLogFile failed: %v", err)
+		return
+	}
+	path = resolveHomeDir(expandTokens(path, args, param, "%hnprlLC"))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		warning("open BannerLogFile [%s] failed: %v", path, err)
+		return
+	}
+	defer file.Close()
+	fmt.Fprintf(file, "==> %s %s of %s <==\n", time.Now().Format("2006-01-02 15:04:05"), kind, args.Destination)
+	_, _ = file.Write(text)
+	if !bytes.HasSuffix(text, []byte("\n")) {
+		_, _ = file.Write([]byte("\n"))
+	}
+}
+
+// splitMotd splits the output at the last line, which is usually the shell prompt.
+func splitMotd(output []byte) (motd, prompt []byte) {
+	idx := bytes.LastIndexByte(output, '\n')
+	if idx < 0 {
+		return nil, output
+	}
+	return output[:idx+1], output[idx+1:]
+}
+
+// suppressMotd drops the output of the interactive shell before it settles down, such as the motd,
+// except the last line, which is usually the shell prompt. The dropped output is captured to BannerLogFile.
+func suppressMotd(args *sshArgs, serverOut io.Reader) io.Reader {
+	if !isMotdSuppressed(args) {
+		return serverOut
+	}
+
+	ch := readServerOutput(serverOut)
+	output, ok := waitOutputQuiet(ch, kMotdQuietTime, kMotdWaitTimeout)
+	if !ok {
+		// the shell exits too early, the output may tell why
+		return bytes.NewReader(output)
+	}
+
+	motd, prompt := splitMotd(output)
+	debug("suppressed the motd of %d bytes", len(motd))
+	captureBanner(args, "motd", motd)
+	return io.MultiReader(bytes.NewReader(prompt), &remoteRCReader{ch: ch})
+}
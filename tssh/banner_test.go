@@ -0,0 +1,85 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitMotd(t *testing.T) {
+	assert := assert.New(t)
+	assertSplit := func(output, motd, prompt string) {
+		t.Helper()
+		m, p := splitMotd([]byte(output))
+		assert.Equal(motd, string(m))
+		assert.Equal(prompt, string(p))
+	}
+
+	assertSplit("", "", "")
+	assertSplit("$ ", "", "$ ")
+	assertSplit("Welcome\r\n", "Welcome\r\n", "")
+	assertSplit("Welcome\r\nLast login: today\r\n[root@server ~]# ", "Welcome\r\nLast login: today\r\n", "[root@server ~]# ")
+}
+
+func TestSuppressMotd(t *testing.T) {
+	assert := assert.New(t)
+	logFile := filepath.Join(t.TempDir(), "banner.log")
+	args := &sshArgs{Destination: "test_suppress_motd", Option: sshOption{map[string][]string{
+		"suppressmotd": {"yes"}, "bannerlogfile": {logFile}}}}
+
+	reader := suppressMotd(args, strings.NewReader("Welcome\r\nexit\r\n"))
+	output, err := io.ReadAll(reader)
+	assert.Nil(err)
+	assert.Equal("Welcome\r\nexit\r\n", string(output))
+
+	serverOut, serverWriter := io.Pipe()
+	go func() {
+		_, _ = serverWriter.Write([]byte("Authorized access only!\r\nLast login: today\r\n"))
+		_, _ = serverWriter.Write([]byte("$ "))
+	}()
+	reader = suppressMotd(args, serverOut)
+	go func() {
+		_, _ = serverWriter.Write([]byte("ls\r\n"))
+		serverWriter.Close()
+	}()
+	output, err = io.ReadAll(reader)
+	assert.Nil(err)
+	assert.Equal("$ ls\r\n", string(output))
+
+	content, err := os.ReadFile(logFile)
+	assert.Nil(err)
+	assert.Contains(string(content), " motd of test_suppress_motd <==\nAuthorized access only!\r\nLast login: today\r\n")
+
+	args = &sshArgs{Destination: "test_suppress_motd", Option: sshOption{map[string][]string{"suppressmotd": {"no"}}}}
+	reader = strings.NewReader("Welcome\r\n$ ")
+	assert.Equal(reader, suppressMotd(args, reader))
+}
@@ -0,0 +1,56 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestBatchModePrompts(t *testing.T) {
+	assert := assert.New(t)
+	defer func() {
+		batchMode = false
+	}()
+	batchMode = true
+
+	secret, err := readSecret("root@server1's password: ")
+	assert.Nil(secret)
+	assert.EqualError(err, "prompt [root@server1's password] refused: BatchMode is enabled")
+
+	assert.False(askYesOrNo("Allow shared connection to server1? (yes/no) "))
+
+	pubKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	key, err := ssh.NewPublicKey(pubKey)
+	assert.Nil(err)
+	err = addHostKey("", "server1", nil, key, true)
+	assert.ErrorContains(err, "host key verification failed")
+}
@@ -0,0 +1,253 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// refresh the certificate a little earlier before it expires
+const kCertificateRefreshMargin = 30 * time.Second
+
+// kDefaultCASignatureAlgorithms is the default CASignatureAlgorithms of OpenSSH, without the SHA-1 ssh-rsa
+var kDefaultCASignatureAlgorithms = []string{
+	"ssh-ed25519", "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521",
+	"sk-ssh-ed25519@openssh.com", "sk-ecdsa-sha2-nistp256@openssh.com", "rsa-sha2-512", "rsa-sha2-256",
+}
+
+// parseAlgorithmList parses an algorithm list as OpenSSH does, the list starts with `+` is appended to the defaults,
+// the one starts with `-` is removed from the defaults, and the one starts with `^` is placed at the head of the defaults.
+func parseAlgorithmList(value string, defaults []string) []string {
+	split := func(list string) []string {
+		var algos []string
+		for _, algo := range strings.Split(list, ",") {
+			if algo = strings.TrimSpace(algo); algo != "" {
+				algos = append(algos, algo)
+			}
+		}
+		return algos
+	}
+	contains := func(algos []string, algo string) bool {
+		for _, a := range algos {
+			if a == algo {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case strings.HasPrefix(value, "+"):
+		algos := append([]string{}, defaults...)
+		for _, algo := range split(value[1:]) {
+			if !contains(algos, algo) {
+				algos = append(algos, algo)
+			}
+		}
+		return algos
+	case strings.HasPrefix(value, "-"):
+		var algos []string
+		for _, algo := range defaults {
+			if !matchPatternList(algo, value[1:]) {
+				algos = append(algos, algo)
+			}
+		}
+		return algos
+	case strings.HasPrefix(value, "^"):
+		algos := split(value[1:])
+		for _, algo := range defaults {
+			if !contains(algos, algo) {
+				algos = append(algos, algo)
+			}
+		}
+		return algos
+	default:
+		return split(value)
+	}
+}
+
+// getCASignatureAlgorithms returns the allowed signature algorithms of the CAs, or nil if not configured.
+func getCASignatureAlgorithms(args *sshArgs) []string {
+	value := getOptionConfig(args, "CASignatureAlgorithms")
+	if value == "" {
+		return nil
+	}
+	return parseAlgorithmList(value, kDefaultCASignatureAlgorithms)
+}
+
+// isCASignatureAllowed returns whether the certificate is signed by the CA in an allowed algorithm.
+func isCASignatureAllowed(cert *ssh.Certificate, algos []string) bool {
+	if algos == nil {
+		return true
+	}
+	if cert.Signature == nil {
+		return false
+	}
+	for _, algo := range algos {
+		if cert.Signature.Format == algo {
+			return true
+		}
+	}
+	return false
+}
+
+// filterCertSigners removes the certificates signed in the algorithms not allowed by CASignatureAlgorithms,
+// and offers the certificates before the plain keys, so that the strict servers won't reach MaxAuthTries early.
+func filterCertSigners(args *sshArgs, signers []ssh.Signer) []ssh.Signer {
+	algos := getCASignatureAlgorithms(args)
+	var certs, keys []ssh.Signer
+	for _, signer := range signers {
+		cert, ok := signer.PublicKey().(*ssh.Certificate)
+		if !ok {
+			keys = append(keys, signer)
+			continue
+		}
+		if !isCASignatureAllowed(cert, algos) {
+			format := ""
+			if cert.Signature != nil {
+				format = cert.Signature.Format
+			}
+			debug("skip certificate %s %s: CA signature algorithm [%s] is not in CASignatureAlgorithms",
+				cert.Type(), ssh.FingerprintSHA256(cert.Key), format)
+			continue
+		}
+		certs = append(certs, signer)
+	}
+	return append(certs, keys...)
+}
+
+func isCertificateValid(cert *ssh.Certificate) bool {
+	now := uint64(time.Now().Unix())
+	if now < cert.ValidAfter {
+		return false
+	}
+	if cert.ValidBefore == ssh.CertTimeInfinity {
+		return true
+	}
+	return now+uint64(kCertificateRefreshMargin/time.Second) < cert.ValidBefore
+}
+
+func parseCertificate(data []byte) (*ssh.Certificate, error) {
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(bytes.TrimSpace(data))
+	if err != nil {
+		return nil, err
+	}
+	cert, ok := pubKey.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("not a certificate")
+	}
+	return cert, nil
+}
+
+func runCertificateCommand(args *sshArgs, param *loginParam, command string) (*ssh.Certificate, error) {
+	argv, err := splitCommandLine(command)
+	if err != nil || len(argv) == 0 {
+		return nil, fmt.Errorf("split certificate command failed: %v", err)
+	}
+	cmd := exec.Command(argv[0], argv[1:]...)
+	if err := setupLocalEnv(args, param, cmd); err != nil {
+		return nil, err
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := parseCertificate(out)
+	if err != nil {
+		return nil, fmt.Errorf("parse the output failed: %v", err)
+	}
+	if !isCertificateValid(cert) {
+		return nil, fmt.Errorf("the certificate is expired or not yet valid")
+	}
+	return cert, nil
+}
+
+// getCommandCertificate obtains the user certificate by `CertificateCommand`, e.g. from Vault or step-ca,
+// the certificate is cached until it expires so that the command won't run for every login.
+func getCommandCertificate(args *sshArgs) *ssh.Certificate {
+	command := getExOptionConfig(args, "CertificateCommand")
+	if command == "" {
+		return nil
+	}
+	param, err := getLoginParam(args)
+	if err != nil {
+		warning("certificate command failed: %v", err)
+		return nil
+	}
+	command = resolveHomeDir(expandTokens(command, args, param, "%hnpr"))
+
+	cachePath := filepath.Join(userHomeDir, ".ssh", fmt.Sprintf(".tssh_cert_%x-cert.pub", sha256.Sum256([]byte(command))))
+	if data, err := os.ReadFile(cachePath); err == nil {
+		if cert, err := parseCertificate(data); err == nil && isCertificateValid(cert) {
+			debug("use the cached certificate: %s", cachePath)
+			return cert
+		}
+	}
+
+	debug("exec certificate command: %s", command)
+	cert, err := runCertificateCommand(args, param, command)
+	if err != nil {
+		warning("certificate command [%s] failed: %v", command, err)
+		return nil
+	}
+	if err := os.WriteFile(cachePath, ssh.MarshalAuthorizedKey(cert), 0600); err != nil {
+		debug("cache the certificate to [%s] failed: %v", cachePath, err)
+	}
+	return cert
+}
+
+// addCommandCertificate puts the certificate signer in front of the signers if one of them matches it.
+func addCommandCertificate(args *sshArgs, signers []ssh.Signer) []ssh.Signer {
+	cert := getCommandCertificate(args)
+	if cert == nil {
+		return signers
+	}
+	fingerprint := ssh.FingerprintSHA256(cert.Key)
+	for _, signer := range signers {
+		if ssh.FingerprintSHA256(signer.PublicKey()) != fingerprint {
+			continue
+		}
+		certSigner, err := ssh.NewCertSigner(cert, signer)
+		if err != nil {
+			warning("new certificate signer failed: %v", err)
+			return signers
+		}
+		debug("will attempt certificate: %s %s", cert.Type(), fingerprint)
+		return append([]ssh.Signer{certSigner}, signers...)
+	}
+	warning("the certificate from CertificateCommand doesn't match any identity: %s", fingerprint)
+	return signers
+}
@@ -0,0 +1,130 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestCommandCertificate(t *testing.T) {
+	assert := assert.New(t)
+	pubKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	caSigner, err := ssh.NewSignerFromKey(caKey)
+	assert.Nil(err)
+	sshPubKey, err := ssh.NewPublicKey(pubKey)
+	assert.Nil(err)
+
+	newCert := func(validAfter, validBefore uint64) *ssh.Certificate {
+		t.Helper()
+		cert := &ssh.Certificate{Key: sshPubKey, CertType: ssh.UserCert, ValidAfter: validAfter, ValidBefore: validBefore}
+		assert.Nil(cert.SignCert(rand.Reader, caSigner))
+		return cert
+	}
+	now := uint64(time.Now().Unix())
+
+	cert, err := parseCertificate(append(ssh.MarshalAuthorizedKey(newCert(now-60, now+3600)), '\n'))
+	assert.Nil(err)
+	assert.True(isCertificateValid(cert))
+	assert.Equal(ssh.FingerprintSHA256(sshPubKey), ssh.FingerprintSHA256(cert.Key))
+
+	assert.True(isCertificateValid(newCert(0, ssh.CertTimeInfinity)))
+	assert.False(isCertificateValid(newCert(now-3600, now-60)))
+	assert.False(isCertificateValid(newCert(now-3600, now+10)))
+	assert.False(isCertificateValid(newCert(now+3600, now+7200)))
+
+	_, err = parseCertificate(ssh.MarshalAuthorizedKey(sshPubKey))
+	assert.NotNil(err)
+	_, err = parseCertificate([]byte("invalid"))
+	assert.NotNil(err)
+}
+
+func TestParseAlgorithmList(t *testing.T) {
+	assert := assert.New(t)
+	defaults := []string{"ssh-ed25519", "ecdsa-sha2-nistp256", "rsa-sha2-512", "rsa-sha2-256"}
+	assertAlgos := func(value string, expected ...string) {
+		t.Helper()
+		assert.Equal(expected, parseAlgorithmList(value, defaults))
+	}
+
+	assertAlgos("ssh-ed25519", "ssh-ed25519")
+	assertAlgos("rsa-sha2-256, ssh-rsa", "rsa-sha2-256", "ssh-rsa")
+	assertAlgos("+ssh-rsa", "ssh-ed25519", "ecdsa-sha2-nistp256", "rsa-sha2-512", "rsa-sha2-256", "ssh-rsa")
+	assertAlgos("+ssh-ed25519", "ssh-ed25519", "ecdsa-sha2-nistp256", "rsa-sha2-512", "rsa-sha2-256")
+	assertAlgos("-rsa-*", "ssh-ed25519", "ecdsa-sha2-nistp256")
+	assertAlgos("-ssh-ed25519,ecdsa-sha2-nistp256", "rsa-sha2-512", "rsa-sha2-256")
+	assertAlgos("^rsa-sha2-256", "rsa-sha2-256", "ssh-ed25519", "ecdsa-sha2-nistp256", "rsa-sha2-512")
+	assertAlgos("^ssh-rsa,rsa-sha2-512", "ssh-rsa", "rsa-sha2-512", "ssh-ed25519", "ecdsa-sha2-nistp256", "rsa-sha2-256")
+}
+
+func TestFilterCertSigners(t *testing.T) {
+	assert := assert.New(t)
+	_, priKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	keySigner, err := ssh.NewSignerFromKey(priKey)
+	assert.Nil(err)
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	caSigner, err := ssh.NewSignerFromKey(caKey)
+	assert.Nil(err)
+
+	newCertSigner := func(format string) ssh.Signer {
+		t.Helper()
+		cert := &ssh.Certificate{Key: keySigner.PublicKey(), CertType: ssh.UserCert, ValidBefore: ssh.CertTimeInfinity}
+		assert.Nil(cert.SignCert(rand.Reader, caSigner))
+		if format != "" {
+			cert.Signature.Format = format
+		}
+		certSigner, err := ssh.NewCertSigner(cert, keySigner)
+		assert.Nil(err)
+		return certSigner
+	}
+	ed25519Cert := newCertSigner("")
+	sha1Cert := newCertSigner("ssh-rsa")
+
+	newArgs := func(algos string) *sshArgs {
+		return &sshArgs{Option: sshOption{map[string][]string{"casignaturealgorithms": {algos}}}}
+	}
+
+	signers := []ssh.Signer{keySigner, sha1Cert, ed25519Cert}
+	assert.Equal([]ssh.Signer{ed25519Cert, keySigner}, filterCertSigners(newArgs("-ssh-rsa"), signers))
+	assert.Equal([]ssh.Signer{ed25519Cert, keySigner}, filterCertSigners(newArgs("rsa-sha2-512,ssh-ed25519"), signers))
+	assert.Equal([]ssh.Signer{sha1Cert, ed25519Cert, keySigner}, filterCertSigners(newArgs("+ssh-rsa"), signers))
+	assert.Equal([]ssh.Signer{keySigner}, filterCertSigners(newArgs("rsa-sha2-512"), signers))
+	assert.Nil(filterCertSigners(newArgs("ssh-ed25519"), nil))
+
+	assert.True(isCASignatureAllowed(sha1Cert.PublicKey().(*ssh.Certificate), nil))
+	assert.False(isCASignatureAllowed(sha1Cert.PublicKey().(*ssh.Certificate), kDefaultCASignatureAlgorithms))
+	assert.True(isCASignatureAllowed(ed25519Cert.PublicKey().(*ssh.Certificate), kDefaultCASignatureAlgorithms))
+}
@@ -74,6 +74,9 @@ type tsshConfig struct {
 	defaultDownloadPath string
 	promptPageSize      uint8
 	promptDetailItems   string
+	promptWarmupHosts   uint8
+	promptWarmupBanner  bool
+	language            string
 	loadConfig          sync.Once
 	loadExConfig        sync.Once
 	loadHosts           sync.Once
@@ -135,6 +138,17 @@ func parseTsshConfig() {
 			}
 		case name == "promptdetailitems" && userConfig.promptDetailItems == "":
 			userConfig.promptDetailItems = value
+		case name == "promptwarmuphosts" && userConfig.promptWarmupHosts == 0:
+			warmupHosts, err := strconv.ParseUint(value, 10, 8)
+			if err != nil {
+				warning("PromptWarmupHosts %s is invalid: %v", value, err)
+			} else {
+				userConfig.promptWarmupHosts = uint8(warmupHosts)
+			}
+		case name == "promptwarmupbanner":
+			userConfig.promptWarmupBanner = strings.ToLower(value) == "yes"
+		case name == "language" && userConfig.language == "":
+			userConfig.language = value
 		}
 	}
 
@@ -156,6 +170,12 @@ func parseTsshConfig() {
 	if userConfig.promptDetailItems != "" {
 		debug("PromptDetailItems = %s", userConfig.promptDetailItems)
 	}
+	if userConfig.promptWarmupHosts != 0 {
+		debug("PromptWarmupHosts = %d", userConfig.promptWarmupHosts)
+	}
+	if userConfig.promptWarmupBanner {
+		debug("PromptWarmupBanner = yes")
+	}
 }
 
 func initUserConfig(configFile string) error {
@@ -185,6 +205,7 @@ func initUserConfig(configFile string) error {
 	}
 
 	parseTsshConfig()
+	setupLocale()
 
 	if userConfig.configPath == "" {
 		userConfig.configPath = filepath.Join(userHomeDir, ".ssh", "config")
@@ -203,25 +224,22 @@ func initUserConfig(configFile string) error {
 }
 
 func loadConfig(path string, system bool) *ssh_config.Config {
-	file, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		warning("open config [%s] failed: %v", path, err)
 		return nil
 	}
-	defer file.Close()
 	debug("open config [%s] success", path)
 
-	var config *ssh_config.Config
-	if system {
-		config, err = ssh_config.DecodeSystemConfig(file)
-	} else {
-		config, err = ssh_config.Decode(file)
-	}
+	loader := &configLoader{system: system}
+	loader.load(path, data, 0)
+	config, err := loader.decode()
 	if err != nil {
 		warning("decode config [%s] failed: %v", path, err)
 		return nil
 	}
 	debug("decode config [%s] success", path)
+	loader.checkUnknownOptions(config)
 	return config
 }
 
@@ -263,13 +281,13 @@ func getConfig(alias, key string) string {
 	userConfig.doLoadConfig()
 
 	if userConfig.config != nil {
-		if value, _ := userConfig.config.Get(alias, key); value != "" {
+		if value := lookupConfig(userConfig.config, alias, key); value != "" {
 			return value
 		}
 	}
 
 	if userConfig.sysConfig != nil {
-		if value, _ := userConfig.sysConfig.Get(alias, key); value != "" {
+		if value := lookupConfig(userConfig.sysConfig, alias, key); value != "" {
 			return value
 		}
 	}
@@ -282,12 +300,12 @@ func getAllConfig(alias, key string) []string {
 
 	var values []string
 	if userConfig.config != nil {
-		if vals, _ := userConfig.config.GetAll(alias, key); len(vals) > 0 {
+		if vals := lookupAllConfig(userConfig.config, alias, key); len(vals) > 0 {
 			values = append(values, vals...)
 		}
 	}
 	if userConfig.sysConfig != nil {
-		if vals, _ := userConfig.sysConfig.GetAll(alias, key); len(vals) > 0 {
+		if vals := lookupAllConfig(userConfig.sysConfig, alias, key); len(vals) > 0 {
 			values = append(values, vals...)
 		}
 	}
@@ -305,7 +323,7 @@ func getExConfig(alias, key string) string {
 	userConfig.doLoadExConfig()
 
 	if userConfig.exConfig != nil {
-		value, _ := userConfig.exConfig.Get(alias, key)
+		value := lookupConfig(userConfig.exConfig, alias, key)
 		if value != "" {
 			debug("get extended config [%s] for [%s] success", key, alias)
 			return value
@@ -326,7 +344,7 @@ func getAllExConfig(alias, key string) []string {
 
 	var values []string
 	if userConfig.exConfig != nil {
-		if vals, _ := userConfig.exConfig.GetAll(alias, key); len(vals) > 0 {
+		if vals := lookupAllConfig(userConfig.exConfig, alias, key); len(vals) > 0 {
 			values = append(values, vals...)
 		}
 	}
@@ -373,6 +391,12 @@ func recursiveGetHosts(cfgHosts []*ssh_config.Host) []*sshHost {
 
 func appendPromptHosts(hosts []*sshHost, cfgHosts ...*ssh_config.Host) []*sshHost {
 	for _, host := range cfgHosts {
+		if strings.TrimSpace(host.EOLComment) == kIncludeRestoreComment {
+			continue
+		}
+		if _, ok := getMatchCriteria(host); ok {
+			continue
+		}
 		for _, pattern := range host.Patterns {
 			alias := pattern.String()
 			if strings.ContainsRune(alias, '*') || strings.ContainsRune(alias, '?') {
@@ -383,7 +407,7 @@ func appendPromptHosts(hosts []*sshHost, cfgHosts ...*ssh_config.Host) []*sshHos
 			}
 			hosts = append(hosts, &sshHost{
 				Alias:         alias,
-				Host:          getConfig(alias, "HostName"),
+				Host:          expandHostName(getConfig(alias, "HostName"), alias),
 				Port:          getConfig(alias, "Port"),
 				User:          getConfig(alias, "User"),
 				IdentityFile:  getConfig(alias, "IdentityFile"),
@@ -433,6 +457,10 @@ func getExOptionConfig(args *sshArgs, option string) string {
 	return getExConfig(args.Destination, option)
 }
 
+func getAllExOptionConfig(args *sshArgs, option string) []string {
+	return append(args.Option.getAll(option), getAllExConfig(args.Destination, option)...)
+}
+
 var secretEncodeKey = []byte("THE_UNSAFE_KEY_FOR_ENCODING_ONLY")
 
 func encodeSecret(secret []byte) (string, error) {
@@ -0,0 +1,170 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/trzsz/ssh_config"
+)
+
+var kOpenSSHKeywords = func() map[string]struct{} {
+	keywords := make(map[string]struct{})
+	for _, keyword := range strings.Fields(`Host Match AddKeysToAgent AddressFamily BatchMode BindAddress
+		BindInterface CanonicalDomains CanonicalizeFallbackLocal CanonicalizeHostname CanonicalizeMaxDots
+		CanonicalizePermittedCNAMEs CASignatureAlgorithms CertificateFile ChannelTimeout CheckHostIP Ciphers
+		ClearAllForwardings Compression ConnectionAttempts ConnectTimeout ControlMaster ControlPath ControlPersist
+		DynamicForward EnableEscapeCommandline EnableSSHKeysign EscapeChar ExitOnForwardFailure FingerprintHash
+		ForkAfterAuthentication ForwardAgent ForwardX11 ForwardX11Timeout ForwardX11Trusted GatewayPorts
+		GlobalKnownHostsFile GSSAPIAuthentication GSSAPIDelegateCredentials HashKnownHosts
+		HostbasedAcceptedAlgorithms HostbasedAuthentication HostKeyAlgorithms HostKeyAlias Hostname
+		IdentitiesOnly IdentityAgent IdentityFile IgnoreUnknown Include IPQoS KbdInteractiveAuthentication
+		KbdInteractiveDevices KexAlgorithms KnownHostsCommand LocalCommand LocalForward LogLevel LogVerbose MACs
+		NoHostAuthenticationForLocalhost NumberOfPasswordPrompts ObscureKeystrokeTiming PasswordAuthentication
+		PermitLocalCommand PermitRemoteOpen PKCS11Provider Port PreferredAuthentications ProxyCommand ProxyJump
+		ProxyUseFdpass PubkeyAcceptedAlgorithms PubkeyAuthentication RekeyLimit RemoteCommand RemoteForward
+		RequestTTY RequiredRSASize RevokedHostKeys SecurityKeyProvider SendEnv ServerAliveCountMax
+		ServerAliveInterval SessionType SetEnv StdinNull StreamLocalBindMask StreamLocalBindUnlink
+		StrictHostKeyChecking SyslogFacility TCPKeepAlive Tag Tunnel TunnelDevice UpdateHostKeys User
+		UserKnownHostsFile VerifyHostKeyDNS VisualHostKey XAuthLocation
+		PubkeyAcceptedKeyTypes HostbasedKeyTypes ChallengeResponseAuthentication UseRoaming Protocol Cipher
+		RSAAuthentication RhostsRSAAuthentication UsePrivilegedPort CompressionLevel UseKeychain`) {
+		keywords[strings.ToLower(keyword)] = struct{}{}
+	}
+	return keywords
+}()
+
+var configErrorRegexp = regexp.MustCompile(`^\((\d+), (\d+)\): ([\s\S]*)$`)
+
+// decodeConfig decodes the ssh config tolerantly, the malformed lines are
+// reported with the file path and line number, and skipped instead of failing the whole file.
+func decodeConfig(path string, data []byte, system bool) (*ssh_config.Config, error) {
+	loader := &configLoader{system: system}
+	loader.load(path, data, 0)
+	return loader.decode()
+}
+
+func (l *configLoader) decode() (*ssh_config.Config, error) {
+	lines := l.lines
+	for i := 0; i <= len(lines); i++ {
+		var config *ssh_config.Config
+		var err error
+		if l.system {
+			config, err = ssh_config.DecodeSystemConfig(bytes.NewReader(bytes.Join(lines, []byte("\n"))))
+		} else {
+			config, err = ssh_config.DecodeBytes(bytes.Join(lines, []byte("\n")))
+		}
+		if err == nil {
+			return config, nil
+		}
+		match := configErrorRegexp.FindStringSubmatch(err.Error())
+		if match == nil {
+			return nil, err
+		}
+		line, _ := strconv.Atoi(match[1])
+		if line < 1 || line > len(lines) || len(bytes.TrimSpace(lines[line-1])) == 0 {
+			return nil, err
+		}
+		origin := l.origins[line-1]
+		warning("%s line %d: %s, skipped", origin.path, origin.line, strings.TrimSpace(match[3]))
+		lines[line-1] = nil
+	}
+	return nil, fmt.Errorf("too many errors")
+}
+
+func getIgnoreUnknownPatterns(config *ssh_config.Config) []*regexp.Regexp {
+	var patterns []*regexp.Regexp
+	for _, host := range config.Hosts {
+		for _, node := range host.Nodes {
+			kv, ok := node.(*ssh_config.KV)
+			if !ok || strings.ToLower(kv.Key) != "ignoreunknown" {
+				continue
+			}
+			for _, pattern := range strings.Split(kv.Value, ",") {
+				if pattern = strings.TrimSpace(pattern); pattern != "" {
+					patterns = append(patterns, regexp.MustCompile(quoteEnvPattern(strings.ToLower(pattern))))
+				}
+			}
+		}
+	}
+	return patterns
+}
+
+// isMalformedLine reports whether the line has no option name or value,
+// which would be silently skipped or shadow other values by the parser.
+func isMalformedLine(line string) bool {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "#!!") {
+		line = strings.TrimSpace(line[3:])
+	}
+	if line == "" || line[0] != '=' && !unicode.IsLetter(rune(line[0])) {
+		return false
+	}
+	pos := strings.IndexAny(line, " \t=")
+	return pos <= 0 || strings.TrimLeft(line[pos:], " \t=") == ""
+}
+
+// checkUnknownOptions reports the options unknown to OpenSSH, except the ones
+// matched by IgnoreUnknown and the extended configurations with the `#!!` prefix.
+func (l *configLoader) checkUnknownOptions(config *ssh_config.Config) {
+	if !enableDebugLogging {
+		return
+	}
+	lines := l.lines
+	patterns := getIgnoreUnknownPatterns(config)
+	for _, host := range config.Hosts {
+		for _, node := range host.Nodes {
+			kv, ok := node.(*ssh_config.KV)
+			if !ok {
+				continue
+			}
+			key := strings.ToLower(kv.Key)
+			if _, ok := kOpenSSHKeywords[key]; ok {
+				continue
+			}
+			line := kv.Pos().Line
+			if line > 0 && line <= len(lines) && bytes.HasPrefix(bytes.TrimSpace(lines[line-1]), []byte("#!!")) {
+				continue
+			}
+			ignored := false
+			for _, pattern := range patterns {
+				if pattern.MatchString(key) {
+					ignored = true
+					break
+				}
+			}
+			if !ignored && line > 0 && line <= len(lines) {
+				origin := l.origins[line-1]
+				debug("%s line %d: unknown option %s", origin.path, origin.line, kv.Key)
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeConfig(t *testing.T) {
+	assert := assert.New(t)
+	originalWarning := warning
+	defer func() {
+		warning = originalWarning
+	}()
+	var output []string
+	warning = func(format string, a ...any) {
+		output = append(output, fmt.Sprintf(format, a...))
+	}
+
+	data := []byte("Host a\n  Port 2022\n  Include [\nHost b\n  HostName 127.0.0.1\n")
+	config, err := decodeConfig("cfg", data, false)
+	assert.Nil(err)
+	assert.Equal([]string{"cfg line 3: invalid Include pattern [[]: syntax error in pattern"}, output)
+	port, _ := config.Get("a", "Port")
+	assert.Equal("2022", port)
+	hostname, _ := config.Get("b", "HostName")
+	assert.Equal("127.0.0.1", hostname)
+
+	output = nil
+	config, err = decodeConfig("cfg", []byte("Host a\n  Port\n  =22\n  # comment\n  #!!!!!!\n  #!! Password\n  User = \n  User root\n"), false)
+	assert.Nil(err)
+	assert.Equal([]string{
+		"cfg line 2: malformed line: Port, skipped",
+		"cfg line 3: malformed line: =22, skipped",
+		"cfg line 6: malformed line: #!! Password, skipped",
+		"cfg line 7: malformed line: User =, skipped",
+	}, output)
+	user, _ := config.Get("a", "User")
+	assert.Equal("root", user)
+}
+
+func TestIncludeConfig(t *testing.T) {
+	assert := assert.New(t)
+	originalWarning := warning
+	defer func() {
+		warning = originalWarning
+	}()
+	var output []string
+	warning = func(format string, a ...any) {
+		output = append(output, fmt.Sprintf(format, a...))
+	}
+	originalHomeDir := userHomeDir
+	defer func() {
+		userHomeDir = originalHomeDir
+	}()
+	userHomeDir = t.TempDir()
+
+	writeFile := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(userHomeDir, ".ssh", name)
+		assert.Nil(os.MkdirAll(filepath.Dir(path), 0700))
+		assert.Nil(os.WriteFile(path, []byte(content), 0600))
+	}
+	writeFile("config.d/10-a", "Host a\n  HostName 10.0.0.1\n  Port\n")
+	writeFile("config.d/20-b", "Host b\n  HostName 10.0.0.2\n  Include loop\n")
+	writeFile("loop", "User loop\nInclude config.d/20-b\n")
+	writeFile("common", "  User common\n")
+
+	config, err := decodeConfig("cfg", []byte("Host c\n  Include common\n  Include config.d/*\n  Port 2022\nHost *\n  Port 22\n"), false)
+	assert.Nil(err)
+	assert.Equal([]string{
+		filepath.Join(userHomeDir, ".ssh", "config.d/10-a") + " line 3: malformed line: Port, skipped",
+		filepath.Join(userHomeDir, ".ssh", "config.d/20-b") + ": Include cycle detected, skipped",
+	}, output)
+
+	assertConfig := func(alias, key, value string) {
+		t.Helper()
+		v, err := config.Get(alias, key)
+		assert.Nil(err)
+		assert.Equal(value, v)
+	}
+	assertConfig("a", "HostName", "10.0.0.1")
+	assertConfig("b", "HostName", "10.0.0.2")
+	assertConfig("b", "User", "loop")
+	assertConfig("c", "User", "common")
+	assertConfig("c", "Port", "2022")
+	assertConfig("a", "Port", "22")
+
+	// the lines after including a file with only Match blocks don't belong to the Match
+	writeFile("match", "Match host 10.0.0.*\n  User matched\n")
+	config, err = decodeConfig("cfg", []byte("Include match\nServerAliveInterval 60\nHost a\n  Include match\n  Port 2022\n"), false)
+	assert.Nil(err)
+	assert.Equal("60", lookupConfig(config, "a", "ServerAliveInterval"))
+	assert.Equal("2022", lookupConfig(config, "a", "Port"))
+	assert.Equal("", lookupConfig(config, "b", "Port"))
+}
+
+func TestMatchTagged(t *testing.T) {
+	assert := assert.New(t)
+	originalTag := cmdlineTag
+	defer func() {
+		cmdlineTag = originalTag
+	}()
+
+	config, err := decodeConfig("cfg", []byte(`Host web*
+  Tag prod
+Host db1
+  Tag dev
+Match tagged prod,staging
+  User deploy
+Match !tagged prod originalhost db*
+  User dba
+Match host 10.0.0.*
+  Port 2022
+Host db2
+  HostName 10.0.0.2
+Host *
+  User nobody
+`), false)
+	assert.Nil(err)
+	cmdlineTag = ""
+	assert.Equal("deploy", lookupConfig(config, "web1", "User"))
+	assert.Equal("dba", lookupConfig(config, "db1", "User"))
+	assert.Equal("dba", lookupConfig(config, "db2", "User"))
+	assert.Equal("nobody", lookupConfig(config, "app", "User"))
+	assert.Equal("2022", lookupConfig(config, "db2", "Port"))
+	assert.Equal("", lookupConfig(config, "db1", "Port"))
+	assert.Equal([]string{"deploy", "nobody"}, lookupAllConfig(config, "web2", "User"))
+	cmdlineTag = "staging"
+	assert.Equal("deploy", lookupConfig(config, "app", "User"))
+}
@@ -0,0 +1,159 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/trzsz/ssh_config"
+)
+
+var kMultiValueKeys = map[string]struct{}{
+	"identityfile": {}, "certificatefile": {}, "localforward": {}, "remoteforward": {}, "dynamicforward": {},
+	"sendenv": {}, "setenv": {}, "sendenvfile": {}, "localenv": {}, "websocketheader": {},
+	"questionmatchanswer": {}, "encquestionmatchanswer": {}, "questionmatchcommand": {}, "remoterc": {},
+	"hostkeyfingerprint": {}, "ctrlpassoptions": {}, "ctrlblockoptions": {},
+}
+
+var kSecretConfigKeys = map[string]struct{}{
+	"password": {}, "passphrase": {}, "sudopassword": {}, "lockpassword": {}, "questionmatchanswer": {},
+}
+
+// kSecretConfigRegexp matches the encoded secrets, the answers of the keyboard interactive questions
+// by index or by the hex code of the question, and the passwords sent by expect or by the control master expect.
+var kSecretConfigRegexp = regexp.MustCompile(`^(enc.+|questionanswer\d+|([0-9a-f]{2})+|(ctrl)?expect(case)?sendpass\d+)$`)
+
+func isSecretConfigKey(key string) bool {
+	if _, ok := kSecretConfigKeys[key]; ok {
+		return true
+	}
+	return kSecretConfigRegexp.MatchString(key)
+}
+
+// maskConfigValue masks the secrets in the value of the key, such as the passwords, the tokens in the headers
+// like `Authorization: Bearer ...`, and the credentials or the query of the url.
+func maskConfigValue(key, value string) string {
+	const mask = "********"
+	switch {
+	case isSecretConfigKey(key):
+		return mask
+	case key == "websocketheader":
+		if name, _, ok := strings.Cut(value, ":"); ok {
+			return name + ": " + mask
+		}
+		return mask
+	case key == "websocketurl":
+		if prefix, _, ok := strings.Cut(value, "?"); ok {
+			value = prefix + "?" + mask
+		}
+		if scheme, rest, ok := strings.Cut(value, "://"); ok {
+			host, path, hasPath := strings.Cut(rest, "/")
+			if at := strings.LastIndex(host, "@"); at >= 0 {
+				value = scheme + "://" + mask + host[at:]
+				if hasPath {
+					value += "/" + path
+				}
+			}
+		}
+		return value
+	}
+	return value
+}
+
+// dumpConfig prints the effective configuration for the destination like `ssh -G`,
+// the secrets such as passwords are masked.
+func dumpConfig(args *sshArgs, writer io.Writer) error {
+	param, err := getLoginParam(args)
+	if err != nil {
+		return err
+	}
+
+	userConfig.doLoadConfig()
+	userConfig.doLoadExConfig()
+	keys := make(map[string]struct{})
+	for key := range kOpenSSHKeywords {
+		keys[key] = struct{}{}
+	}
+	for _, config := range []*ssh_config.Config{userConfig.config, userConfig.sysConfig, userConfig.exConfig} {
+		collectConfigKeys(config, args.Destination, keys)
+	}
+	for key := range args.Option.options {
+		keys[key] = struct{}{}
+	}
+	for _, key := range []string{"host", "match", "include", "hostname", "user", "port", "proxyjump", "proxycommand"} {
+		delete(keys, key)
+	}
+
+	fmt.Fprintf(writer, "host %s\n", args.Destination)
+	fmt.Fprintf(writer, "hostname %s\n", param.host)
+	fmt.Fprintf(writer, "user %s\n", param.user)
+	fmt.Fprintf(writer, "port %s\n", param.port)
+	if len(param.proxy) > 0 {
+		fmt.Fprintf(writer, "proxyjump %s\n", strings.Join(param.proxy, ","))
+	}
+	if param.command != "" {
+		fmt.Fprintf(writer, "proxycommand %s\n", param.command)
+	}
+
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	for _, key := range sortedKeys {
+		_, openssh := kOpenSSHKeywords[key]
+		var values []string
+		if _, ok := kMultiValueKeys[key]; ok {
+			if openssh {
+				values = getAllOptionConfig(args, key)
+			} else {
+				values = getAllExOptionConfig(args, key)
+			}
+		} else {
+			var value string
+			if openssh {
+				value = getOptionConfig(args, key)
+			} else {
+				value = getExOptionConfig(args, key)
+			}
+			if value != "" {
+				values = []string{value}
+			}
+		}
+		for _, value := range values {
+			if value == "" {
+				continue
+			}
+			fmt.Fprintf(writer, "%s %s\n", key, maskConfigValue(key, value))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/shlex"
+)
+
+const kMaxIncludeDepth = 16
+
+// kIncludeRestoreComment marks the Host line restoring the enclosing block after the included content.
+const kIncludeRestoreComment = "tssh-include-restore"
+
+type configLine struct {
+	path string
+	line int
+}
+
+// configLoader inlines the Include directives, so that nested includes are parsed tolerantly
+// with cycle detection, and the errors are reported with the original file path and line number.
+type configLoader struct {
+	system  bool
+	lines   [][]byte
+	origins []configLine
+	stack   []string
+}
+
+func (l *configLoader) resolveInclude(pattern string) string {
+	pattern = resolveHomeDir(os.ExpandEnv(pattern))
+	if filepath.IsAbs(pattern) {
+		return pattern
+	}
+	if l.system {
+		return filepath.Join("/etc/ssh", pattern)
+	}
+	return filepath.Join(userHomeDir, ".ssh", pattern)
+}
+
+func (l *configLoader) appendLine(line []byte, path string, lineNo int) {
+	l.lines = append(l.lines, line)
+	l.origins = append(l.origins, configLine{path, lineNo})
+}
+
+func getConfigKeyword(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	pos := strings.IndexAny(line, " \t=")
+	if pos <= 0 {
+		return strings.ToLower(line), ""
+	}
+	return strings.ToLower(line[:pos]), strings.TrimSpace(strings.TrimLeft(line[pos:], " \t="))
+}
+
+func getRealPath(path string) string {
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+	return realPath
+}
+
+// load appends the lines of the config file, and returns whether it contains any Host or Match line.
+func (l *configLoader) load(path string, data []byte, depth int) bool {
+	realPath := getRealPath(path)
+	for _, p := range l.stack {
+		if p == realPath {
+			warning("%s: Include cycle detected, skipped", path)
+			return false
+		}
+	}
+	l.stack = append(l.stack, realPath)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+
+	hasHost := false
+	hostLine := ""
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if isMalformedLine(string(line)) {
+			warning("%s line %d: malformed line: %s, skipped", path, i+1, strings.TrimSpace(string(line)))
+			l.appendLine(nil, path, i+1)
+			continue
+		}
+		keyword, value := getConfigKeyword(string(line))
+		switch keyword {
+		case "host":
+			hasHost = true
+			if idx := strings.IndexByte(value, '#'); idx >= 0 {
+				value = strings.TrimSpace(value[:idx])
+			}
+			hostLine = "Host " + value
+		case "match":
+			hasHost = true
+			if idx := strings.IndexByte(value, '#'); idx >= 0 {
+				value = strings.TrimSpace(value[:idx])
+			}
+			hostLine = "Host " + kMatchHostPattern + " #" + kMatchComment + " " + value
+			l.appendLine([]byte(hostLine), path, i+1)
+			continue
+		case "include":
+			l.appendLine(nil, path, i+1)
+			if l.include(path, i+1, value, depth) {
+				hasHost = true
+				if strings.HasPrefix(hostLine, "Host "+kMatchHostPattern) {
+					l.appendLine([]byte(hostLine), path, i+1)
+				} else if hostLine == "" {
+					l.appendLine([]byte("Host * #"+kIncludeRestoreComment), path, i+1)
+				} else {
+					l.appendLine([]byte(hostLine+" #"+kIncludeRestoreComment), path, i+1)
+				}
+			}
+			continue
+		}
+		l.appendLine(line, path, i+1)
+	}
+	return hasHost
+}
+
+func (l *configLoader) include(path string, lineNo int, value string, depth int) bool {
+	if depth >= kMaxIncludeDepth {
+		warning("%s line %d: Include nested too deeply, skipped", path, lineNo)
+		return false
+	}
+	if idx := strings.IndexByte(value, '#'); idx >= 0 {
+		value = value[:idx]
+	}
+	patterns, err := shlex.Split(value)
+	if err != nil {
+		warning("%s line %d: invalid Include: %v", path, lineNo, err)
+		return false
+	}
+	hasHost := false
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(l.resolveInclude(pattern))
+		if err != nil {
+			warning("%s line %d: invalid Include pattern [%s]: %v", path, lineNo, pattern, err)
+			continue
+		}
+		if len(matches) == 0 {
+			debug("%s line %d: no file matches Include [%s]", path, lineNo, pattern)
+		}
+		for _, file := range matches {
+			if info, err := os.Stat(file); err != nil || info.IsDir() {
+				continue
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				warning("%s line %d: read Include [%s] failed: %v", path, lineNo, file, err)
+				continue
+			}
+			debug("include config [%s]", file)
+			if l.load(file, data, depth+1) {
+				hasHost = true
+			}
+		}
+	}
+	return hasHost
+}
@@ -0,0 +1,216 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"os/user"
+	"regexp"
+	"strings"
+
+	"github.com/trzsz/ssh_config"
+)
+
+// The Match lines are converted to Host lines with a pattern never used as an alias,
+// and the criteria are kept in the comment, so that they can be evaluated during lookups.
+const kMatchHostPattern = "__tssh_match__"
+const kMatchComment = "tssh-match"
+
+// cmdlineTag is the tag set by `-P tag` or `-o Tag=tag`.
+var cmdlineTag string
+
+func getMatchCriteria(host *ssh_config.Host) (string, bool) {
+	comment := strings.TrimSpace(host.EOLComment)
+	if !strings.HasPrefix(comment, kMatchComment+" ") {
+		return "", false
+	}
+	return strings.TrimSpace(comment[len(kMatchComment):]), true
+}
+
+// matchPatternList matches the comma-separated pattern list as OpenSSH does,
+// any negated pattern matched means not matched.
+func matchPatternList(str, patterns string) bool {
+	str = strings.ToLower(str)
+	matched := false
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		negated := strings.HasPrefix(pattern, "!")
+		if negated {
+			pattern = pattern[1:]
+		}
+		if pattern == "" {
+			continue
+		}
+		if regexp.MustCompile(quoteEnvPattern(pattern)).MatchString(str) {
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+func getLocalUsername() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+type configLookup struct {
+	config *ssh_config.Config
+	alias  string
+	tag    string
+	plain  bool
+}
+
+func (c *configLookup) get(key string) string {
+	lookup := &configLookup{config: c.config, alias: c.alias, plain: true}
+	if values := lookup.lookup(key, false); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c *configLookup) evalMatch(criteria string) bool {
+	fields := strings.Fields(criteria)
+	for i := 0; i < len(fields); i++ {
+		word := strings.ToLower(fields[i])
+		negated := strings.HasPrefix(word, "!")
+		if negated {
+			word = word[1:]
+		}
+		var matched bool
+		switch word {
+		case "all", "canonical", "final":
+			matched = true
+		case "tagged", "host", "originalhost", "user", "localuser", "exec":
+			if i+1 >= len(fields) {
+				debug("missing argument for Match %s", word)
+				return false
+			}
+			i++
+			arg := fields[i]
+			switch word {
+			case "tagged":
+				matched = matchPatternList(c.tag, arg)
+			case "host":
+				host := expandHostName(c.get("HostName"), c.alias)
+				if host == "" {
+					host = c.alias
+				}
+				matched = matchPatternList(host, arg)
+			case "originalhost":
+				matched = matchPatternList(c.alias, arg)
+			case "user":
+				u := c.get("User")
+				if u == "" {
+					u = getLocalUsername()
+				}
+				matched = matchPatternList(u, arg)
+			case "localuser":
+				matched = matchPatternList(getLocalUsername(), arg)
+			case "exec":
+				debug("Match exec is not supported: %s", arg)
+				return false
+			}
+		default:
+			debug("unsupported Match criteria: %s", fields[i])
+			return false
+		}
+		if matched == negated {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *configLookup) matches(host *ssh_config.Host) bool {
+	if criteria, ok := getMatchCriteria(host); ok {
+		return !c.plain && c.evalMatch(criteria)
+	}
+	return host.Matches(c.alias)
+}
+
+// lookup walks through the hosts in order, the first `Tag` obtained is used for `Match tagged`.
+func (c *configLookup) lookup(key string, all bool) []string {
+	lowerKey := strings.ToLower(key)
+	var values []string
+	for _, host := range c.config.Hosts {
+		if !c.matches(host) {
+			continue
+		}
+		for _, node := range host.Nodes {
+			kv, ok := node.(*ssh_config.KV)
+			if !ok {
+				continue
+			}
+			lkey := strings.ToLower(kv.Key)
+			if lkey == "tag" && c.tag == "" {
+				c.tag = kv.Value
+			}
+			if lkey == lowerKey {
+				if !all {
+					return []string{kv.Value}
+				}
+				values = append(values, kv.Value)
+			}
+		}
+	}
+	return values
+}
+
+func lookupConfig(config *ssh_config.Config, alias, key string) string {
+	lookup := &configLookup{config: config, alias: alias, tag: cmdlineTag}
+	if values := lookup.lookup(key, false); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func lookupAllConfig(config *ssh_config.Config, alias, key string) []string {
+	lookup := &configLookup{config: config, alias: alias, tag: cmdlineTag}
+	return lookup.lookup(key, true)
+}
+
+// collectConfigKeys returns the lower case keys of all the options matched for the alias.
+func collectConfigKeys(config *ssh_config.Config, alias string, keys map[string]struct{}) {
+	if config == nil {
+		return
+	}
+	lookup := &configLookup{config: config, alias: alias, tag: cmdlineTag}
+	lookup.lookup("Tag", false)
+	for _, host := range config.Hosts {
+		if !lookup.matches(host) {
+			continue
+		}
+		for _, node := range host.Nodes {
+			if kv, ok := node.(*ssh_config.KV); ok {
+				keys[strings.ToLower(kv.Key)] = struct{}{}
+			}
+		}
+	}
+}
@@ -170,12 +170,59 @@ func NewControlClientConn(c net.Conn) (ssh.Conn, <-chan ssh.NewChannel, <-chan *
 }
 
 const (
-	muxMsgHello = 0x00000001
-	muxCliProxy = 0x1000000f
-	muxSvrProxy = 0x8000000f
-	muxSFailure = 0x80000003
+	muxMsgHello    = 0x00000001
+	muxCliProxy    = 0x1000000f
+	muxSvrProxy    = 0x8000000f
+	muxSFailure    = 0x80000003
+	muxCAliveCheck = 0x10000004
+	muxSAlive      = 0x80000005
 )
 
+// checkControlAlive sends a mux ALIVE_CHECK to an OpenSSH ControlMaster socket,
+// and returns the pid of the master process if it's alive.
+func checkControlAlive(rw io.ReadWriter) (uint32, error) {
+	b := &controlBuffer{}
+	b.writeUint32(muxMsgHello)
+	b.writeUint32(4) // Protocol Version
+	if _, err := rw.Write(b.lengthPrefixedBytes()); err != nil {
+		return 0, fmt.Errorf("mux hello write failed: %v", err)
+	}
+
+	b.Reset()
+	b.writeUint32(muxCAliveCheck)
+	b.writeUint32(1) // Request ID
+	if _, err := rw.Write(b.lengthPrefixedBytes()); err != nil {
+		return 0, fmt.Errorf("mux alive check write failed: %v", err)
+	}
+
+	r := controlReader{rw}
+	m, err := r.next()
+	if err != nil {
+		return 0, fmt.Errorf("mux hello read failed: %v", err)
+	}
+	if m.messageType != muxMsgHello {
+		return 0, fmt.Errorf("mux reply not hello")
+	}
+	if v, err := m.readUint32(); err != nil || v != 4 {
+		return 0, fmt.Errorf("mux reply hello has bad protocol version")
+	}
+	m, err = r.next()
+	if err != nil {
+		return 0, fmt.Errorf("error reading mux alive: %v", err)
+	}
+	if m.messageType != muxSAlive {
+		return 0, fmt.Errorf("expected alive response got %d", m.messageType)
+	}
+	var reply struct {
+		RequestID uint32
+		Pid       uint32
+	}
+	if err := binary.Read(&m.body, binary.BigEndian, &reply); err != nil {
+		return 0, fmt.Errorf("error reading mux alive pid: %v", err)
+	}
+	return reply.Pid, nil
+}
+
 // handshakeControlProxy attempts to establish a transport connection with an
 // OpenSSH ControlMaster socket in proxy mode. For details see:
 // https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.mux
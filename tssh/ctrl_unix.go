@@ -30,6 +30,7 @@ package tssh
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -37,6 +38,8 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -50,6 +53,7 @@ import (
 type controlMaster struct {
 	path      string
 	args      []string
+	socket    string
 	cmd       *exec.Cmd
 	ptmx      *os.File
 	stdout    io.ReadCloser
@@ -58,14 +62,29 @@ type controlMaster struct {
 	exited    atomic.Bool
 }
 
-func (c *controlMaster) handleStderr() {
+// handleStderr mirrors the stderr of the control master to the terminal while logging in,
+// and after that, writes it to CtrlStderrFile if configured, or else to the debug log.
+func (c *controlMaster) handleStderr(logFile *os.File) {
 	go func() {
 		defer c.stderr.Close()
+		if logFile != nil {
+			defer logFile.Close()
+		}
 		buf := make([]byte, 100)
-		for c.loggingIn.Load() {
+		for {
 			n, err := c.stderr.Read(buf)
 			if n > 0 {
-				fmt.Fprintf(os.Stderr, "%s", string(buf[:n]))
+				if c.loggingIn.Load() {
+					fmt.Fprintf(os.Stderr, "%s", string(buf[:n]))
+				} else if logFile != nil {
+					_, _ = logFile.Write(buf[:n])
+				} else {
+					for _, line := range strings.Split(string(buf[:n]), "\n") {
+						if line = strings.TrimSpace(line); line != "" {
+							debug("control master stderr: %s", line)
+						}
+					}
+				}
 			}
 			if err != nil {
 				break
@@ -93,6 +112,23 @@ func (c *controlMaster) handleStdout() <-chan error {
 	return doneCh
 }
 
+// waitSocket waits for the control socket of a master running without a command to be alive.
+func (c *controlMaster) waitSocket() <-chan error {
+	doneCh := make(chan error, 1)
+	go func() {
+		defer close(doneCh)
+		for !c.exited.Load() {
+			if isFileExist(c.socket) && isControlSocketAlive(c.socket) {
+				doneCh <- nil
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		doneCh <- fmt.Errorf("control master process exited")
+	}()
+	return doneCh
+}
+
 func (c *controlMaster) fillPassword(args *sshArgs, expectCount uint32) (cancel context.CancelFunc) {
 	var ctx context.Context
 	if expectTimeout := getExpectTimeout(args, "Ctrl"); expectTimeout > 0 {
@@ -125,9 +161,12 @@ func (c *controlMaster) checkExit() <-chan struct{} {
 	return exitCh
 }
 
-func (c *controlMaster) start(args *sshArgs) error {
+func (c *controlMaster) start(args *sshArgs, param *loginParam) error {
 	var err error
 	c.cmd = exec.Command(c.path, c.args...)
+	if err := setupLocalEnv(args, param, c.cmd); err != nil {
+		return err
+	}
 	expectCount := getExpectCount(args, "Ctrl")
 	if expectCount > 0 {
 		c.cmd.SysProcAttr = &syscall.SysProcAttr{
@@ -150,7 +189,17 @@ func (c *controlMaster) start(args *sshArgs) error {
 	if c.stderr, err = c.cmd.StderrPipe(); err != nil {
 		return fmt.Errorf("stderr pipe failed: %v", err)
 	}
+	var logFile *os.File
+	if path := getExOptionConfig(args, "CtrlStderrFile"); path != "" {
+		path = resolveHomeDir(path)
+		if logFile, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+			warning("open control master stderr file [%s] failed: %v", path, err)
+		}
+	}
 	if err := c.cmd.Start(); err != nil {
+		if logFile != nil {
+			logFile.Close()
+		}
 		return fmt.Errorf("control master start failed: %v", err)
 	}
 
@@ -160,9 +209,14 @@ func (c *controlMaster) start(args *sshArgs) error {
 	signal.Notify(intCh, os.Interrupt)
 	defer func() { signal.Stop(intCh); close(intCh) }()
 
-	c.handleStderr()
+	c.handleStderr(logFile)
 	exitCh := c.checkExit()
-	doneCh := c.handleStdout()
+	var doneCh <-chan error
+	if c.socket != "" {
+		doneCh = c.waitSocket()
+	} else {
+		doneCh = c.handleStdout()
+	}
 
 	defer func() {
 		c.loggingIn.Store(false)
@@ -198,39 +252,193 @@ func (c *controlMaster) quit(exit <-chan struct{}) {
 	timer.Stop()
 }
 
-func getRealPath(path string) string {
-	realPath, err := filepath.EvalSymlinks(path)
+func isOpenSSH(path string) error {
+	tsshPath, err := os.Executable()
 	if err != nil {
-		return path
+		return err
+	}
+	if getRealPath(tsshPath) == getRealPath(path) {
+		return fmt.Errorf("%s is the current program", path)
+	}
+	out, err := exec.Command(path, "-V").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s -V failed: %v", path, err)
+	}
+	if !bytes.Contains(out, []byte("OpenSSH")) {
+		return fmt.Errorf("%s is not openssh: %s", path, strings.TrimSpace(string(out)))
 	}
-	return realPath
+	return nil
 }
 
-func getOpenSSH() (string, error) {
-	sshPath := "/usr/bin/ssh"
-	tsshPath, err := os.Executable()
+var openSSHVersionRegexp = regexp.MustCompile(`OpenSSH_(\d+)\.(\d+)`)
+
+// parseOpenSSHVersion returns the major and minor version in the output of `ssh -V`, such as `OpenSSH_9.6p1`.
+func parseOpenSSHVersion(out string) (int, int, bool) {
+	match := openSSHVersionRegexp.FindStringSubmatch(out)
+	if match == nil {
+		return 0, 0, false
+	}
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	return major, minor, true
+}
+
+// isOpenSSHTagSupported returns whether the openssh supports Tag and Match tagged, which are added in OpenSSH 9.2.
+func isOpenSSHTagSupported(path string) bool {
+	out, err := exec.Command(path, "-V").CombinedOutput()
 	if err != nil {
-		return "", err
+		return false
 	}
-	if getRealPath(tsshPath) == getRealPath(sshPath) {
-		return "", fmt.Errorf("%s is the current program", sshPath)
+	major, minor, ok := parseOpenSSHVersion(string(out))
+	return ok && (major > 9 || major == 9 && minor >= 2)
+}
+
+// getOpenSSH returns CtrlSshPath if configured, or else /usr/bin/ssh,
+// or else the ssh found in PATH, such as the one installed by Homebrew or Nix.
+func getOpenSSH(args *sshArgs) (string, error) {
+	if sshPath := getExOptionConfig(args, "CtrlSshPath"); sshPath != "" {
+		sshPath = resolveHomeDir(sshPath)
+		if err := isOpenSSH(sshPath); err != nil {
+			return "", err
+		}
+		return sshPath, nil
 	}
-	return sshPath, nil
+
+	var errs []string
+	sshPath := "/usr/bin/ssh"
+	if isFileExist(sshPath) {
+		err := isOpenSSH(sshPath)
+		if err == nil {
+			return sshPath, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	if path, err := exec.LookPath("ssh"); err == nil && getRealPath(path) != getRealPath(sshPath) {
+		err := isOpenSSH(path)
+		if err == nil {
+			return path, nil
+		}
+		errs = append(errs, err.Error())
+	}
+	if len(errs) == 0 {
+		return "", fmt.Errorf("ssh not found")
+	}
+	return "", fmt.Errorf("%s", strings.Join(errs, "; "))
 }
 
-func startControlMaster(args *sshArgs) error {
-	sshPath, err := getOpenSSH()
-	if err != nil {
-		return fmt.Errorf("can't find openssh program: %v", err)
+// getCtrlKeywords returns the lowercase keywords separated by spaces or commas of CtrlPassOptions or CtrlBlockOptions.
+func getCtrlKeywords(args *sshArgs, option string) map[string]struct{} {
+	keywords := make(map[string]struct{})
+	for _, value := range getAllExOptionConfig(args, option) {
+		for _, key := range strings.FieldsFunc(value, func(c rune) bool { return c == ',' || c == ' ' || c == '\t' }) {
+			keywords[strings.ToLower(key)] = struct{}{}
+		}
 	}
+	return keywords
+}
 
-	cmdArgs := []string{"-T", "-oRemoteCommand=none", "-oConnectTimeout=5"}
+// getCtrlDefaultOptions returns the LogLevel, NumberOfPasswordPrompts for the openssh master,
+// configured by CtrlLogLevel, CtrlBanner and CtrlNumberOfPasswordPrompts.
+func getCtrlDefaultOptions(args *sshArgs) []string {
+	var options []string
+	logLevel := getExOptionConfig(args, "CtrlLogLevel")
+	if logLevel == "" && strings.ToLower(getExOptionConfig(args, "CtrlBanner")) == "no" {
+		// openssh prints the banner only if LogLevel is INFO or more verbose
+		logLevel = "ERROR"
+	}
+	if logLevel != "" && !args.Debug && !args.Quiet {
+		switch strings.ToUpper(logLevel) {
+		case "QUIET", "FATAL", "ERROR", "INFO", "VERBOSE", "DEBUG", "DEBUG1", "DEBUG2", "DEBUG3":
+			options = append(options, "LogLevel="+logLevel)
+		default:
+			warning("CtrlLogLevel %s is invalid", logLevel)
+		}
+	}
+	if prompts := getExOptionConfig(args, "CtrlNumberOfPasswordPrompts"); prompts != "" {
+		if n, err := strconv.Atoi(prompts); err == nil && n >= 0 {
+			options = append(options, "NumberOfPasswordPrompts="+prompts)
+		} else {
+			warning("CtrlNumberOfPasswordPrompts %s is invalid", prompts)
+		}
+	}
+	return options
+}
+
+// getCtrlOptions returns the -o options passed to the openssh master. The tssh extended options are not passed
+// unless they are listed in CtrlPassOptions, e.g., the options of a newer openssh, and the ones listed in
+// CtrlBlockOptions are never passed. The defaults are given after the -o options, which take precedence.
+func getCtrlOptions(args *sshArgs) []string {
+	pass := getCtrlKeywords(args, "CtrlPassOptions")
+	block := getCtrlKeywords(args, "CtrlBlockOptions")
+	isBlocked := func(key string) bool {
+		if _, ok := block[key]; ok {
+			debug("option %s is blocked for the openssh master", key)
+			return true
+		}
+		return false
+	}
+
+	keys := make([]string, 0, len(args.Option.options))
+	for key := range args.Option.options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var options []string
+	passed := make(map[string]struct{})
+	for _, key := range keys {
+		_, known := kOpenSSHKeywords[key]
+		_, passThrough := pass[key]
+		if !known && !passThrough {
+			// the tssh extended options are unknown to openssh
+			continue
+		}
+		switch key {
+		case "remotecommand", "identityagent", "tag":
+			continue
+		}
+		if isBlocked(key) {
+			continue
+		}
+		for _, value := range args.Option.options[key] {
+			options = append(options, fmt.Sprintf("-o%s=%s", key, value))
+		}
+		passed[key] = struct{}{}
+	}
+
+	for _, option := range getCtrlDefaultOptions(args) {
+		key := strings.ToLower(option[:strings.IndexByte(option, '=')])
+		if _, ok := passed[key]; ok || isBlocked(key) {
+			continue
+		}
+		options = append(options, "-o"+option)
+	}
+	return options
+}
+
+// getOpenSSHArgs returns the openssh arguments for the same destination, with or without the forwards.
+func getOpenSSHArgs(args *sshArgs, sshPath string, forward bool) []string {
+	var cmdArgs []string
 
 	if args.Debug {
 		cmdArgs = append(cmdArgs, "-v")
 	}
-	if !args.NoForwardAgent && args.ForwardAgent {
+	if args.Quiet {
+		cmdArgs = append(cmdArgs, "-q")
+	}
+	if args.IPv4Only {
+		cmdArgs = append(cmdArgs, "-4")
+	}
+	if args.IPv6Only {
+		cmdArgs = append(cmdArgs, "-6")
+	}
+	if args.NoGSSAPI {
+		cmdArgs = append(cmdArgs, "-k")
+	}
+	if isAgentForwardEnabled(args) {
 		cmdArgs = append(cmdArgs, "-A")
+	} else if args.NoForwardAgent {
+		cmdArgs = append(cmdArgs, "-a")
 	}
 	if args.LoginName != "" {
 		cmdArgs = append(cmdArgs, "-l", args.LoginName)
@@ -248,27 +456,45 @@ func startControlMaster(args *sshArgs) error {
 	for _, identity := range args.Identity.values {
 		cmdArgs = append(cmdArgs, "-i", identity)
 	}
-	for _, b := range args.DynamicForward.binds {
-		cmdArgs = append(cmdArgs, "-D", b.argument)
-	}
-	for _, f := range args.LocalForward.cfgs {
-		cmdArgs = append(cmdArgs, "-L", f.argument)
+	if forward {
+		for _, b := range args.DynamicForward.binds {
+			cmdArgs = append(cmdArgs, "-D", b.argument)
+		}
+		for _, f := range args.LocalForward.cfgs {
+			cmdArgs = append(cmdArgs, "-L", f.argument)
+		}
+		for _, f := range args.RemoteForward.cfgs {
+			cmdArgs = append(cmdArgs, "-R", f.argument)
+		}
+	} else {
+		cmdArgs = append(cmdArgs, "-oClearAllForwardings=yes")
 	}
-	for _, f := range args.RemoteForward.cfgs {
-		cmdArgs = append(cmdArgs, "-R", f.argument)
+
+	// the tag of -P or -o Tag, which is rejected by the openssh before 9.2
+	if cmdlineTag != "" {
+		if isOpenSSHTagSupported(sshPath) {
+			cmdArgs = append(cmdArgs, "-oTag="+cmdlineTag)
+		} else {
+			warning("%s doesn't support Tag, the tag [%s] is not passed to the control master", sshPath, cmdlineTag)
+		}
 	}
 
-	for key, values := range args.Option.options {
-		switch key {
-		case "remotecommand":
-			break
-		case "enabletrzsz", "enabledragfile":
-			break
-		default:
-			for _, value := range values {
-				cmdArgs = append(cmdArgs, fmt.Sprintf("-o%s=%s", key, value))
+	cmdArgs = append(cmdArgs, getCtrlOptions(args)...)
+
+	// openssh doesn't support multiple agents, so pass the first available one
+	if agent := getOptionConfig(args, "IdentityAgent"); strings.Contains(agent, ",") || args.Option.get("IdentityAgent") != "" {
+		addrs := getAgentAddrs(args)
+		addr := "none"
+		if len(addrs) > 0 {
+			addr = addrs[0]
+		}
+		for _, a := range addrs {
+			if isFileExist(a) {
+				addr = a
+				break
 			}
 		}
+		cmdArgs = append(cmdArgs, fmt.Sprintf("-oIdentityAgent=%s", addr))
 	}
 
 	if args.originalDest != "" {
@@ -276,6 +502,18 @@ func startControlMaster(args *sshArgs) error {
 	} else {
 		cmdArgs = append(cmdArgs, args.Destination)
 	}
+	return cmdArgs
+}
+
+func startControlMaster(args *sshArgs, param *loginParam) error {
+	sshPath, err := getOpenSSH(args)
+	if err != nil {
+		return fmt.Errorf("can't find openssh program: %v", err)
+	}
+
+	// the forwards are left to the delegated forward master if CtrlDelegateForward is enabled
+	cmdArgs := []string{"-T", "-oRemoteCommand=none", "-oConnectTimeout=5"}
+	cmdArgs = append(cmdArgs, getOpenSSHArgs(args, sshPath, !isForwardDelegated(args))...)
 	// 10 seconds is enough for tssh to connect
 	cmdArgs = append(cmdArgs, "echo ok; sleep 10")
 
@@ -284,13 +522,110 @@ func startControlMaster(args *sshArgs) error {
 	}
 
 	ctrlMaster := &controlMaster{path: sshPath, args: cmdArgs}
-	if err := ctrlMaster.start(args); err != nil {
+	if err := ctrlMaster.start(args, param); err != nil {
 		return err
 	}
 	debug("start control master success")
 	return nil
 }
 
+// startForwardMaster starts an openssh master without any session to do all the forwards for tssh,
+// and it's stopped when tssh exits, so the forwards are torn down along with the tssh session.
+func startForwardMaster(args *sshArgs) error {
+	sshPath, err := getOpenSSH(args)
+	if err != nil {
+		return fmt.Errorf("can't find openssh program: %v", err)
+	}
+	param, err := getLoginParam(args)
+	if err != nil {
+		return err
+	}
+
+	socket := filepath.Join(userHomeDir, ".ssh", fmt.Sprintf(".tssh_fwd_%d.sock", os.Getpid()))
+	cmdArgs := []string{"-N", "-T", "-oRemoteCommand=none", "-oConnectTimeout=5",
+		"-oControlMaster=yes", "-oControlPersist=no", "-oControlPath=" + socket}
+	cmdArgs = append(cmdArgs, getOpenSSHArgs(args, sshPath, true)...)
+
+	if enableDebugLogging {
+		debug("forward master: %s %s", sshPath, strings.Join(cmdArgs, " "))
+	}
+
+	forwardMaster := &controlMaster{path: sshPath, args: cmdArgs, socket: socket}
+	if err := forwardMaster.start(args, param); err != nil {
+		return err
+	}
+	debug("start forward master success, socket: %s", socket)
+	return nil
+}
+
+// confirmControlMaster asks for confirmation before attaching to an existing master
+// via SSH_ASKPASS as OpenSSH does, or via the terminal if SSH_ASKPASS is not set.
+func confirmControlMaster(args *sshArgs, param *loginParam) bool {
+	prompt := fmt.Sprintf(tr("Allow shared connection to %s? "), args.Destination)
+	if batchMode {
+		warning("%v", refusePrompt(prompt))
+		return false
+	}
+	askpass := os.Getenv("SSH_ASKPASS")
+	require := os.Getenv("SSH_ASKPASS_REQUIRE")
+	if askpass != "" && (require == "force" || require != "never" && !isTerminal) {
+		cmd := exec.Command(askpass, prompt)
+		cmd.Env = append(os.Environ(), "SSH_ASKPASS_PROMPT=confirm")
+		if err := setupLocalEnv(args, param, cmd); err != nil {
+			warning("askpass [%s] local env failed: %v", askpass, err)
+			return false
+		}
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			debug("askpass [%s] failed: %v", askpass, err)
+			return false
+		}
+		answer := strings.ToLower(strings.TrimSpace(string(out)))
+		return answer == "" || answer == "yes"
+	}
+	if !isTerminal {
+		return false
+	}
+	return askYesOrNo(prompt + "(yes/no) ")
+}
+
+// probeControlSocket checks whether the control master behind the socket is alive. The socket is stale only if
+// nothing is listening on it, while a live master that is busy, slow or of another version only fails the check.
+func probeControlSocket(socket string) (alive, stale bool) {
+	conn, err := net.DialTimeout("unix", socket, time.Second)
+	if err != nil {
+		debug("dial control socket [%s] failed: %v", socket, err)
+		return false, errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+	pid, err := checkControlAlive(conn)
+	if err != nil {
+		debug("control socket [%s] alive check failed: %v", socket, err)
+		return false, false
+	}
+	debug("control master [%s] is alive, pid: %d", socket, pid)
+	return true, false
+}
+
+func isControlSocketAlive(socket string) bool {
+	alive, _ := probeControlSocket(socket)
+	return alive
+}
+
+func removeStaleControlSocket(socket string) {
+	info, err := os.Lstat(socket)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	if err := os.Remove(socket); err != nil {
+		debug("remove stale control socket [%s] failed: %v", socket, err)
+		return
+	}
+	debug("removed stale control socket [%s]", socket)
+}
+
 func connectViaControl(args *sshArgs, param *loginParam) *ssh.Client {
 	ctrlMaster := getOptionConfig(args, "ControlMaster")
 	ctrlPath := getOptionConfig(args, "ControlPath")
@@ -300,21 +635,44 @@ func connectViaControl(args *sshArgs, param *loginParam) *ssh.Client {
 		return nil
 	}
 
-	socket := resolveHomeDir(expandTokens(ctrlPath, args, param, "%CdhikLlnpru"))
+	socket := expandPath(ctrlPath, args, param, "%CdhikLlnpru")
+
+	if isFileExist(socket) {
+		if alive, stale := probeControlSocket(socket); stale {
+			removeStaleControlSocket(socket)
+		} else if !alive {
+			debug("control master [%s] doesn't respond, fallback to a fresh connection", socket)
+			return nil
+		}
+	}
 
+	existing := isFileExist(socket)
 	switch strings.ToLower(ctrlMaster) {
 	case "yes", "ask":
-		if isFileExist(socket) {
+		if existing {
 			warning("control socket [%s] already exists, disabling multiplexing", socket)
 			return nil
 		}
 		fallthrough
 	case "auto", "autoask":
-		if err := startControlMaster(args); err != nil {
+		if err := startControlMaster(args, param); err != nil {
 			warning("start control master failed: %v", err)
 		}
 	}
 
+	switch strings.ToLower(ctrlMaster) {
+	case "ask", "autoask":
+		if existing && !confirmControlMaster(args, param) {
+			debug("attaching to control master [%s] is not allowed, fallback to a fresh connection", socket)
+			return nil
+		}
+	}
+
+	if !isFileExist(socket) {
+		debug("control socket [%s] doesn't exist, fallback to a fresh connection", socket)
+		return nil
+	}
+
 	debug("login to [%s], socket: %s", args.Destination, socket)
 
 	conn, err := net.DialTimeout("unix", socket, time.Second)
@@ -323,11 +681,14 @@ func connectViaControl(args *sshArgs, param *loginParam) *ssh.Client {
 		return nil
 	}
 
+	_ = conn.SetDeadline(time.Now().Add(3 * time.Second))
 	ncc, chans, reqs, err := NewControlClientConn(conn)
 	if err != nil {
+		conn.Close()
 		warning("new conn from control socket [%s] failed: %v", socket, err)
 		return nil
 	}
+	_ = conn.SetDeadline(time.Time{})
 
 	debug("login to [%s] success", args.Destination)
 	return ssh.NewClient(ncc, chans, reqs)
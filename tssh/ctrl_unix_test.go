@@ -0,0 +1,152 @@
+//go:build !windows
+
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCtrlOptions(t *testing.T) {
+	assert := assert.New(t)
+	originalWarning := warning
+	defer func() { warning = originalWarning }()
+	var warnings []string
+	warning = func(format string, a ...any) { warnings = append(warnings, format) }
+
+	assertOptions := func(options map[string][]string, expected []string) {
+		t.Helper()
+		args := &sshArgs{Option: sshOption{options}}
+		assert.Equal(expected, getCtrlOptions(args))
+	}
+
+	assertOptions(nil, nil)
+	assertOptions(map[string][]string{"user": {"root"}, "port": {"2022"}, "expectcount": {"1"},
+		"remotecommand": {"ls"}, "identityagent": {"none"}}, []string{"-oport=2022", "-ouser=root"})
+	assertOptions(map[string][]string{"sendenv": {"A", "B"}}, []string{"-osendenv=A", "-osendenv=B"})
+
+	assertOptions(map[string][]string{"newopenssh": {"yes"}, "ctrlpassoptions": {"NewOpenSSH"}},
+		[]string{"-onewopenssh=yes"})
+	assertOptions(map[string][]string{"user": {"root"}, "loglevel": {"DEBUG"},
+		"ctrlblockoptions": {"LogLevel, ServerAliveInterval"}, "serveraliveinterval": {"10"}},
+		[]string{"-ouser=root"})
+
+	assertOptions(map[string][]string{"ctrlloglevel": {"VERBOSE"}, "ctrlnumberofpasswordprompts": {"1"}},
+		[]string{"-oLogLevel=VERBOSE", "-oNumberOfPasswordPrompts=1"})
+	assertOptions(map[string][]string{"ctrlbanner": {"no"}}, []string{"-oLogLevel=ERROR"})
+	assertOptions(map[string][]string{"ctrlbanner": {"no"}, "ctrlloglevel": {"INFO"}}, []string{"-oLogLevel=INFO"})
+	assertOptions(map[string][]string{"ctrlbanner": {"no"}, "loglevel": {"QUIET"}}, []string{"-ologlevel=QUIET"})
+	assertOptions(map[string][]string{"ctrlbanner": {"no"}, "ctrlblockoptions": {"loglevel"}}, nil)
+
+	assert.Empty(warnings)
+	assertOptions(map[string][]string{"ctrlloglevel": {"LOUD"}, "ctrlnumberofpasswordprompts": {"x"}}, nil)
+	assert.Equal([]string{"CtrlLogLevel %s is invalid", "CtrlNumberOfPasswordPrompts %s is invalid"}, warnings)
+
+	args := &sshArgs{Debug: true, Option: sshOption{map[string][]string{"ctrlloglevel": {"ERROR"}}}}
+	assert.Nil(getCtrlOptions(args))
+}
+
+func TestConfirmControlMasterAskpassEnv(t *testing.T) {
+	assert := assert.New(t)
+	askpass := filepath.Join(t.TempDir(), "askpass")
+	assert.Nil(os.WriteFile(askpass, []byte("#!/bin/sh\n"+
+		"[ \"$TSSH_HOSTNAME\" = example.com ] && [ \"$SSH_ASKPASS_PROMPT\" = confirm ] && echo yes || echo no\n"), 0700))
+	t.Setenv("SSH_ASKPASS", askpass)
+	t.Setenv("SSH_ASKPASS_REQUIRE", "force")
+
+	args := &sshArgs{Destination: "server"}
+	assert.True(confirmControlMaster(args, &loginParam{host: "example.com", port: "22", user: "root"}))
+	assert.False(confirmControlMaster(args, &loginParam{host: "other.com", port: "22", user: "root"}))
+}
+
+func TestParseOpenSSHVersion(t *testing.T) {
+	assert := assert.New(t)
+	assertVersion := func(out string, major, minor int, ok bool) {
+		t.Helper()
+		ma, mi, o := parseOpenSSHVersion(out)
+		assert.Equal(ok, o)
+		assert.Equal(major, ma)
+		assert.Equal(minor, mi)
+	}
+	assertVersion("OpenSSH_9.6p1 Ubuntu-3ubuntu13, OpenSSL 3.0.13 30 Jan 2024", 9, 6, true)
+	assertVersion("OpenSSH_8.9p1, LibreSSL 3.3.6", 8, 9, true)
+	assertVersion("OpenSSH_10.0p2 Debian-5, OpenSSL 3.5.0 8 Apr 2025", 10, 0, true)
+	assertVersion("Dropbear v2022.83", 0, 0, false)
+}
+
+func TestProbeControlSocket(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	alive, stale := probeControlSocket(filepath.Join(dir, "missing.sock"))
+	assert.False(alive)
+	assert.True(stale)
+
+	// nothing is listening on the socket left behind
+	deadSocket := filepath.Join(dir, "dead.sock")
+	listener, err := net.Listen("unix", deadSocket)
+	if !assert.Nil(err) {
+		return
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = listener.Close()
+	alive, stale = probeControlSocket(deadSocket)
+	assert.False(alive)
+	assert.True(stale)
+
+	// a live master that doesn't answer the alive check in time
+	busySocket := filepath.Join(dir, "busy.sock")
+	listener, err = net.Listen("unix", busySocket)
+	if !assert.Nil(err) {
+		return
+	}
+	defer func() { _ = listener.Close() }()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+		}
+	}()
+	alive, stale = probeControlSocket(busySocket)
+	assert.False(alive)
+	assert.False(stale)
+
+	args := &sshArgs{Destination: "test_probe_control", Option: sshOption{map[string][]string{"controlpath": {busySocket}}}}
+	assert.Nil(connectViaControl(args, &loginParam{host: "127.0.0.1", port: "22", user: "test"}))
+	assert.True(isFileExist(busySocket))
+	args.Option.options["controlpath"] = []string{deadSocket}
+	assert.Nil(connectViaControl(args, &loginParam{host: "127.0.0.1", port: "22", user: "test"}))
+	assert.False(isFileExist(deadSocket))
+}
@@ -26,6 +26,7 @@ SOFTWARE.
 package tssh
 
 import (
+	"fmt"
 	"strings"
 
 	"golang.org/x/crypto/ssh"
@@ -48,3 +49,7 @@ func connectViaControl(args *sshArgs, param *loginParam) *ssh.Client {
 	warning("ControlPath is not supported on Windows")
 	return nil
 }
+
+func startForwardMaster(args *sshArgs) error {
+	return fmt.Errorf("CtrlDelegateForward is not supported on Windows")
+}
@@ -0,0 +1,130 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// kCygwinSocketPrefix is the content prefix of the AF_UNIX socket files emulated by Cygwin and MSYS2,
+// e.g. `!<socket >49152 s 2A6B3C4D-5E6F7081-92A3B4C5-D6E7F809`.
+const kCygwinSocketPrefix = "!<socket >"
+
+type cygwinSocket struct {
+	port   int
+	secret [16]byte
+}
+
+func parseCygwinSocket(content []byte) (*cygwinSocket, error) {
+	text := string(bytes.TrimRight(content, "\x00\r\n"))
+	if !strings.HasPrefix(text, kCygwinSocketPrefix) {
+		return nil, fmt.Errorf("not a cygwin socket: %s", text)
+	}
+	var port int
+	var kind string
+	var key [4]uint32
+	if _, err := fmt.Sscanf(text[len(kCygwinSocketPrefix):], "%d %s %08x-%08x-%08x-%08x",
+		&port, &kind, &key[0], &key[1], &key[2], &key[3]); err != nil {
+		return nil, fmt.Errorf("invalid cygwin socket [%s]: %v", text, err)
+	}
+	if kind != "s" {
+		return nil, fmt.Errorf("unsupported cygwin socket type: %s", kind)
+	}
+	if port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid cygwin socket port: %d", port)
+	}
+	sock := &cygwinSocket{port: port}
+	for i, k := range key {
+		binary.LittleEndian.PutUint32(sock.secret[i*4:], k)
+	}
+	return sock, nil
+}
+
+func isCygwinSocket(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	buf := make([]byte, len(kCygwinSocketPrefix))
+	if _, err := file.Read(buf); err != nil {
+		return false
+	}
+	return string(buf) == kCygwinSocketPrefix
+}
+
+// dialCygwinSocket connects to the loopback port behind the emulated socket,
+// exchanges the secret and then the credentials (pid, uid, gid) as Cygwin does.
+func dialCygwinSocket(path string) (net.Conn, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sock, err := parseCygwinSocket(content)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", sock.port), time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	handshake := func() error {
+		_ = conn.SetDeadline(time.Now().Add(time.Second))
+		defer func() { _ = conn.SetDeadline(time.Time{}) }()
+		if _, err := conn.Write(sock.secret[:]); err != nil {
+			return err
+		}
+		var secret [16]byte
+		if _, err := io.ReadFull(conn, secret[:]); err != nil {
+			return err
+		}
+		if secret != sock.secret {
+			return fmt.Errorf("secret mismatch")
+		}
+		var cred [12]byte
+		binary.LittleEndian.PutUint32(cred[0:], uint32(os.Getpid()))
+		binary.LittleEndian.PutUint32(cred[4:], uint32(os.Getuid()))
+		binary.LittleEndian.PutUint32(cred[8:], uint32(os.Getgid()))
+		if _, err := conn.Write(cred[:]); err != nil {
+			return err
+		}
+		_, err := io.ReadFull(conn, cred[:])
+		return err
+	}
+	if err := handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cygwin socket [%s] handshake failed: %v", path, err)
+	}
+	return conn, nil
+}
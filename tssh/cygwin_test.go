@@ -0,0 +1,59 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCygwinSocket(t *testing.T) {
+	assert := assert.New(t)
+	assertSocket := func(content string, port int, secret []byte) {
+		t.Helper()
+		sock, err := parseCygwinSocket([]byte(content))
+		assert.Nil(err)
+		assert.Equal(port, sock.port)
+		assert.Equal(secret, sock.secret[:])
+	}
+	assertError := func(content, errMsg string) {
+		t.Helper()
+		_, err := parseCygwinSocket([]byte(content))
+		assert.NotNil(err)
+		assert.Contains(err.Error(), errMsg)
+	}
+
+	assertSocket("!<socket >49152 s 2A6B3C4D-5E6F7081-92A3B4C5-D6E7F809\x00", 49152, []byte{
+		0x4D, 0x3C, 0x6B, 0x2A, 0x81, 0x70, 0x6F, 0x5E, 0xC5, 0xB4, 0xA3, 0x92, 0x09, 0xF8, 0xE7, 0xD6})
+	assertSocket("!<socket >22 s 00000001-00000002-00000003-00000004", 22, []byte{
+		1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 4, 0, 0, 0})
+
+	assertError("SSH_AUTH_SOCK", "not a cygwin socket")
+	assertError("!<socket >49152 d 2A6B3C4D-5E6F7081-92A3B4C5-D6E7F809", "unsupported cygwin socket type")
+	assertError("!<socket >0 s 2A6B3C4D-5E6F7081-92A3B4C5-D6E7F809", "invalid cygwin socket port")
+	assertError("!<socket >49152 s 2A6B3C4D", "invalid cygwin socket")
+}
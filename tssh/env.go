@@ -26,9 +26,15 @@ SOFTWARE.
 package tssh
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/google/shlex"
@@ -40,39 +46,78 @@ type sshEnv struct {
 	value string
 }
 
-func getSendEnvs(args *sshArgs) ([]*sshEnv, error) {
-	envSet := make(map[string]struct{})
-	for _, envCfg := range getAllOptionConfig(args, "SendEnv") {
+func quoteEnvPattern(pattern string) string {
+	var buf strings.Builder
+	buf.WriteString("(^")
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			buf.WriteString(".*")
+		case '?':
+			buf.WriteRune('.')
+		case '(', ')', '[', ']', '{', '}', '.', '+', ',', '-', '^', '$', '|', '\\':
+			buf.WriteRune('\\')
+			buf.WriteRune(c)
+		default:
+			buf.WriteRune(c)
+		}
+	}
+	buf.WriteString("$)")
+	return buf.String()
+}
+
+// getSendEnvPatterns returns the SendEnv patterns in order.
+// Like OpenSSH, a pattern prefixed with '-' clears the previously listed patterns which match it.
+func getSendEnvPatterns(envCfgs []string) ([]string, error) {
+	var patterns []string
+	for _, envCfg := range envCfgs {
 		for _, env := range strings.Fields(envCfg) {
-			if len(env) > 0 {
-				envSet[env] = struct{}{}
+			if strings.HasPrefix(env, "-") {
+				re, err := regexp.Compile(quoteEnvPattern(env[1:]))
+				if err != nil {
+					return nil, fmt.Errorf("compile SendEnv regexp failed: %v", err)
+				}
+				var remains []string
+				for _, pattern := range patterns {
+					if re.MatchString(pattern) {
+						debug("send env pattern [%s] is cleared by [%s]", pattern, env)
+						continue
+					}
+					remains = append(remains, pattern)
+				}
+				patterns = remains
+				continue
+			}
+			exists := false
+			for _, pattern := range patterns {
+				if pattern == env {
+					exists = true
+					break
+				}
+			}
+			if !exists {
+				patterns = append(patterns, env)
 			}
 		}
 	}
-	if len(envSet) == 0 {
+	return patterns, nil
+}
+
+func getSendEnvs(args *sshArgs) ([]*sshEnv, error) {
+	patterns, err := getSendEnvPatterns(getAllOptionConfig(args, "SendEnv"))
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
 		return nil, nil
 	}
 
 	var buf strings.Builder
-	for env := range envSet {
+	for _, pattern := range patterns {
 		if buf.Len() > 0 {
 			buf.WriteRune('|')
 		}
-		buf.WriteString("(^")
-		for _, c := range env {
-			switch c {
-			case '*':
-				buf.WriteString(".*")
-			case '?':
-				buf.WriteRune('.')
-			case '(', ')', '[', ']', '{', '}', '.', '+', ',', '-', '^', '$', '|', '\\':
-				buf.WriteRune('\\')
-				buf.WriteRune(c)
-			default:
-				buf.WriteRune(c)
-			}
-		}
-		buf.WriteString("$)")
+		buf.WriteString(quoteEnvPattern(pattern))
 	}
 	expr := buf.String()
 	debug("send env regexp: %s", expr)
@@ -103,7 +148,63 @@ func getSendEnvs(args *sshArgs) ([]*sshEnv, error) {
 	return envs, nil
 }
 
-func getSetEnvs(args *sshArgs) ([]*sshEnv, error) {
+func parseEnvFile(reader io.Reader) ([]*sshEnv, error) {
+	var envs []*sshEnv
+	scanner := bufio.NewScanner(reader)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		pos := strings.IndexRune(line, '=')
+		if pos <= 0 {
+			return nil, fmt.Errorf("invalid env at line %d: %s", lineNo, line)
+		}
+		name := strings.TrimSpace(line[:pos])
+		value := strings.TrimSpace(line[pos+1:])
+		if name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid env name at line %d: %s", lineNo, name)
+		}
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			v, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid env value at line %d: %s", lineNo, value)
+			}
+			value = v
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		envs = append(envs, &sshEnv{name, value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return envs, nil
+}
+
+func getSendEnvFileEnvs(args *sshArgs) ([]*sshEnv, error) {
+	var envs []*sshEnv
+	for _, path := range getAllExOptionConfig(args, "SendEnvFile") {
+		path = resolveHomeDir(path)
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("open SendEnvFile [%s] failed: %v", path, err)
+		}
+		fileEnvs, err := parseEnvFile(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("parse SendEnvFile [%s] failed: %v", path, err)
+		}
+		debug("load %d envs from SendEnvFile [%s]", len(fileEnvs), path)
+		envs = append(envs, fileEnvs...)
+	}
+	return envs, nil
+}
+
+func getSetEnvs(args *sshArgs, param *loginParam) ([]*sshEnv, error) {
 	envCfg := getOptionConfig(args, "SetEnv")
 	if envCfg == "" {
 		return nil, nil
@@ -123,11 +224,112 @@ func getSetEnvs(args *sshArgs) ([]*sshEnv, error) {
 			return nil, fmt.Errorf("invalid SetEnv: %s", envCfg)
 		}
 		value := strings.TrimSpace(token[pos+1:])
+		if param != nil {
+			value = expandTokens(value, args, param, "%hnprjlLC")
+		}
 		envs = append(envs, &sshEnv{name, value})
 	}
 	return envs, nil
 }
 
+func getLocalEnvs(args *sshArgs, param *loginParam) ([]*sshEnv, error) {
+	var envs []*sshEnv
+	for _, envCfg := range getAllExOptionConfig(args, "LocalEnv") {
+		tokens, err := shlex.Split(envCfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LocalEnv: %s", envCfg)
+		}
+		for _, token := range tokens {
+			pos := strings.IndexRune(token, '=')
+			if pos <= 0 {
+				return nil, fmt.Errorf("invalid LocalEnv: %s", envCfg)
+			}
+			name := strings.TrimSpace(token[:pos])
+			value := strings.TrimSpace(token[pos+1:])
+			if param != nil {
+				value = expandTokens(value, args, param, "%hnpr")
+			}
+			envs = append(envs, &sshEnv{name, resolveHomeDir(value)})
+		}
+	}
+	return envs, nil
+}
+
+// getForceLocale returns the ForceLocale option, which overrides the locale sent by SendEnv.
+func getForceLocale(args *sshArgs) string {
+	locale := getExOptionConfig(args, "ForceLocale")
+	if locale == "" {
+		return ""
+	}
+	if strings.ContainsAny(locale, " \t'\"") {
+		warning("invalid ForceLocale option: %s", locale)
+		return ""
+	}
+	return locale
+}
+
+// getForceLocaleEnvs returns LANG and LC_ALL of ForceLocale, the explicit SetEnv still takes precedence.
+func getForceLocaleEnvs(args *sshArgs) []*sshEnv {
+	locale := getForceLocale(args)
+	if locale == "" {
+		return nil
+	}
+	return []*sshEnv{{"LANG", locale}, {"LC_ALL", locale}}
+}
+
+// formatConnection formats the addresses like SSH_CONNECTION: client_ip client_port server_ip server_port.
+func formatConnection(conn net.Conn) string {
+	localHost, localPort, err := net.SplitHostPort(conn.LocalAddr().String())
+	if err != nil {
+		return ""
+	}
+	remoteHost, remotePort, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s %s %s %s", localHost, localPort, remoteHost, remotePort)
+}
+
+// getConnectionEnvs returns the details of the connection for the local child process.
+func getConnectionEnvs(args *sshArgs, param *loginParam) []*sshEnv {
+	if param == nil {
+		return nil
+	}
+	envs := []*sshEnv{
+		{"TSSH_HOST", args.Destination},
+		{"TSSH_HOSTNAME", param.host},
+		{"TSSH_PORT", param.port},
+		{"TSSH_USER", param.user},
+	}
+	if len(param.proxy) > 0 {
+		envs = append(envs, &sshEnv{"TSSH_JUMP", strings.Join(param.proxy, ",")})
+	}
+	if args.connection != "" {
+		envs = append(envs, &sshEnv{"TSSH_CONNECTION", args.connection})
+	}
+	return envs
+}
+
+// setupLocalEnv sets the connection details and the LocalEnv variables for the local child process.
+func setupLocalEnv(args *sshArgs, param *loginParam, cmd *exec.Cmd) error {
+	localEnvs, err := getLocalEnvs(args, param)
+	if err != nil {
+		return err
+	}
+	envs := append(getConnectionEnvs(args, param), localEnvs...)
+	if len(envs) == 0 {
+		return nil
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	for _, env := range envs {
+		debug("local env for [%s]: %s = \"%s\"", filepath.Base(cmd.Path), env.name, env.value)
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", env.name, env.value))
+	}
+	return nil
+}
+
 func sendAndSetEnv(args *sshArgs, session *ssh.Session) error {
 	envs, err := getSendEnvs(args)
 	if err != nil {
@@ -141,7 +343,31 @@ func sendAndSetEnv(args *sshArgs, session *ssh.Session) error {
 		}
 	}
 
-	envs, err = getSetEnvs(args)
+	envs, err = getSendEnvFileEnvs(args)
+	if err != nil {
+		return err
+	}
+	for _, env := range envs {
+		if err := session.Setenv(env.name, env.value); err != nil {
+			debug("send env file failed: %s", env.name)
+		} else {
+			debug("send env file success: %s", env.name)
+		}
+	}
+
+	for _, env := range getForceLocaleEnvs(args) {
+		if err := session.Setenv(env.name, env.value); err != nil {
+			debug("force locale failed: %s = \"%s\"", env.name, env.value)
+		} else {
+			debug("force locale success: %s = \"%s\"", env.name, env.value)
+		}
+	}
+
+	param, err := getLoginParam(args)
+	if err != nil {
+		return err
+	}
+	envs, err = getSetEnvs(args, param)
 	if err != nil {
 		return err
 	}
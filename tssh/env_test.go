@@ -0,0 +1,140 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendEnvPatterns(t *testing.T) {
+	assert := assert.New(t)
+	assertPatterns := func(envCfgs []string, patterns []string) {
+		t.Helper()
+		result, err := getSendEnvPatterns(envCfgs)
+		assert.Nil(err)
+		assert.Equal(patterns, result)
+	}
+
+	assertPatterns(nil, nil)
+	assertPatterns([]string{"LANG LC_*"}, []string{"LANG", "LC_*"})
+	assertPatterns([]string{"LANG", "LC_*", "LANG"}, []string{"LANG", "LC_*"})
+	assertPatterns([]string{"LANG LC_* XMODIFIERS", "-LC_*"}, []string{"LANG", "XMODIFIERS"})
+	assertPatterns([]string{"LANG LC_* XMODIFIERS -L*"}, []string{"XMODIFIERS"})
+	assertPatterns([]string{"LANG LC_ALL", "-LC_?LL", "TERM_*"}, []string{"LANG", "TERM_*"})
+	assertPatterns([]string{"LANG", "-*", "TZ"}, []string{"TZ"})
+	assertPatterns([]string{"-LANG", "LANG"}, []string{"LANG"})
+	assertPatterns([]string{"LC_*", "-LC_ALL"}, []string{"LC_*"})
+}
+
+func TestParseEnvFile(t *testing.T) {
+	assert := assert.New(t)
+	assertEnvs := func(content string, envs []*sshEnv) {
+		t.Helper()
+		result, err := parseEnvFile(strings.NewReader(content))
+		assert.Nil(err)
+		assert.Equal(envs, result)
+	}
+
+	assertEnvs("", nil)
+	assertEnvs("# comment\n\n", nil)
+	assertEnvs("A=1\nB = 2 \n", []*sshEnv{{"A", "1"}, {"B", "2"}})
+	assertEnvs("export A=1\n  # comment\nB=\n", []*sshEnv{{"A", "1"}, {"B", ""}})
+	assertEnvs("A=\"x y\\tz\"\nB='x \"y\" z'\nC=a=b\n", []*sshEnv{{"A", "x y\tz"}, {"B", "x \"y\" z"}, {"C", "a=b"}})
+
+	assertEnvError := func(content, errMsg string) {
+		t.Helper()
+		_, err := parseEnvFile(strings.NewReader(content))
+		assert.NotNil(err)
+		assert.Contains(err.Error(), errMsg)
+	}
+
+	assertEnvError("A", "invalid env at line 1: A")
+	assertEnvError("A=1\n=2", "invalid env at line 2: =2")
+	assertEnvError("A B=1", "invalid env name at line 1: A B")
+	assertEnvError("A=\"x\"y\"", "invalid env value at line 1")
+}
+
+func TestConnectionEnvs(t *testing.T) {
+	assert := assert.New(t)
+	assertEnvs := func(args *sshArgs, param *loginParam, expected []*sshEnv) {
+		t.Helper()
+		assert.Equal(expected, getConnectionEnvs(args, param))
+	}
+
+	assertEnvs(&sshArgs{Destination: "dest"}, nil, nil)
+	assertEnvs(&sshArgs{Destination: "dest"}, &loginParam{host: "127.0.0.1", port: "22", user: "penny"}, []*sshEnv{
+		{"TSSH_HOST", "dest"},
+		{"TSSH_HOSTNAME", "127.0.0.1"},
+		{"TSSH_PORT", "22"},
+		{"TSSH_USER", "penny"},
+	})
+	assertEnvs(&sshArgs{Destination: "dest", connection: "::1 5000 ::1 2022"},
+		&loginParam{host: "::1", port: "2022", user: "penny", proxy: []string{"jump1", "jump2"}}, []*sshEnv{
+			{"TSSH_HOST", "dest"},
+			{"TSSH_HOSTNAME", "::1"},
+			{"TSSH_PORT", "2022"},
+			{"TSSH_USER", "penny"},
+			{"TSSH_JUMP", "jump1,jump2"},
+			{"TSSH_CONNECTION", "::1 5000 ::1 2022"},
+		})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(err) {
+		return
+	}
+	defer listener.Close()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if !assert.Nil(err) {
+		return
+	}
+	defer conn.Close()
+	_, port, _ := net.SplitHostPort(conn.LocalAddr().String())
+	_, remotePort, _ := net.SplitHostPort(listener.Addr().String())
+	assert.Equal("127.0.0.1 "+port+" 127.0.0.1 "+remotePort, formatConnection(conn))
+}
+
+func TestForceLocaleEnvs(t *testing.T) {
+	assert := assert.New(t)
+	originalWarning := warning
+	defer func() {
+		warning = originalWarning
+	}()
+	warning = func(format string, a ...any) {}
+
+	assertEnvs := func(locale string, expected []*sshEnv) {
+		t.Helper()
+		args := &sshArgs{Option: sshOption{map[string][]string{"forcelocale": {locale}}}}
+		assert.Equal(expected, getForceLocaleEnvs(args))
+	}
+
+	assertEnvs("en_US.UTF-8", []*sshEnv{{"LANG", "en_US.UTF-8"}, {"LC_ALL", "en_US.UTF-8"}})
+	assertEnvs("C.UTF-8", []*sshEnv{{"LANG", "C.UTF-8"}, {"LC_ALL", "C.UTF-8"}})
+	assertEnvs("en_US UTF-8", nil)
+}
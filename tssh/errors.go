@@ -0,0 +1,179 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// errorCategory is the category of a connection error, `CategorizedExitCodes yes` exits with its status.
+type errorCategory struct {
+	name   string
+	status int
+}
+
+var (
+	kErrorUnknown    = errorCategory{"unknown", kExitConnectionError}
+	kErrorDNS        = errorCategory{"dns", 201}
+	kErrorTCP        = errorCategory{"tcp", 202}
+	kErrorHostKey    = errorCategory{"hostkey", 203}
+	kErrorAuth       = errorCategory{"auth", 204}
+	kErrorChannel    = errorCategory{"channel", 205}
+	kErrorForwarding = errorCategory{"forwarding", 206}
+)
+
+// errorKind is a classified connection error, the code is stable and never reused.
+type errorKind struct {
+	code     int
+	category errorCategory
+	patterns []string
+	cause    string
+	fix      string
+}
+
+// kErrorKinds is in order of matching, the more specific messages come first,
+// e.g. the host key and auth errors are wrapped in the handshake or proxy errors.
+var kErrorKinds = []*errorKind{
+	{3001, kErrorHostKey, []string{"knownhosts: key mismatch"},
+		"The host key of the server has changed, it may be reinstalled or someone is doing something nasty.",
+		"Verify the new host key with the administrator, then remove the old one from known_hosts."},
+	{3002, kErrorHostKey, []string{"knownhosts: key is unknown", "host key verification failed", "host key not trusted"},
+		"The host key of the server is unknown and not trusted.",
+		"Verify the fingerprint and accept it interactively, or set StrictHostKeyChecking to accept-new."},
+	{3003, kErrorHostKey, []string{"does not match the HostKeyFingerprint", "host certificate ", "host key "},
+		"The host key does not match HostKeyFingerprint, or is refused by RequiredRSASize or CASignatureAlgorithms.",
+		"Check the HostKeyFingerprint, RequiredRSASize and CASignatureAlgorithms of the host."},
+	{4003, kErrorAuth, []string{"passphrase incorrect"},
+		"The passphrase of the private key is incorrect.",
+		"Type the passphrase again, or check the Passphrase configuration of the key."},
+	{4002, kErrorAuth, []string{"for all auth methods"},
+		"The server got no reply for all the auth methods, e.g. a hung keyboard-interactive or agent.",
+		"Increase AuthTimeout, or restrict PreferredAuthentications to the working methods."},
+	{4001, kErrorAuth, []string{"unable to authenticate", "no supported methods remain"},
+		"All the auth methods are denied by the server.",
+		"Check the user, IdentityFile, password and PreferredAuthentications, run with --debug to see the tried methods."},
+	{1001, kErrorDNS, []string{"no such host"},
+		"The host name could not be resolved.",
+		"Check the spelling of HostName, or the DNS and /etc/hosts of the local machine."},
+	{1002, kErrorDNS, []string{"server misbehaving", "lookup "},
+		"The DNS server failed or timed out when resolving the host name.",
+		"Check the DNS server of the local machine, or use the IP address as HostName."},
+	{6001, kErrorForwarding, []string{"stdio forward failed", "forward specification", "forward config", "bind specification"},
+		"The port forwarding failed, or the forwarding specification is invalid.",
+		"Check the -L -R -D -W arguments, and whether AllowTcpForwarding is enabled on the server."},
+	{5002, kErrorChannel, []string{"request pty failed"},
+		"The server refused to allocate a pseudo-terminal.",
+		"Check PermitTTY on the server, or run with -T to disable the pseudo-terminal."},
+	{5001, kErrorChannel, []string{"new session failed"},
+		"The server refused to open a session channel, e.g. MaxSessions is reached.",
+		"Check MaxSessions and the restrictions of the authorized key on the server."},
+	{5003, kErrorChannel, []string{"start command", "start shell failed"},
+		"The server failed to start the command or the shell.",
+		"Check the login shell of the user and the ForceCommand on the server."},
+	{2004, kErrorTCP, []string{"proxy [", "proxy command ["},
+		"The connection through the ProxyJump or ProxyCommand failed.",
+		"Login to the jump host directly to check it, or run the ProxyCommand in the shell."},
+	{2001, kErrorTCP, []string{"connection refused"},
+		"Nothing is listening on the port of the server.",
+		"Check the Port of the host, and whether sshd is running on the server."},
+	{2003, kErrorTCP, []string{"network is unreachable", "no route to host", "host is down"},
+		"The server is unreachable from the local network.",
+		"Check the network, VPN and route of the local machine."},
+	{2002, kErrorTCP, []string{"timeout", "timed out"},
+		"The connection timed out, the server may be down or dropped by a firewall.",
+		"Check the firewall and the server, or increase ConnectTimeout."},
+	{2005, kErrorTCP, []string{"dial tcp", "new conn ["},
+		"The TCP connection to the server failed or was closed in the handshake.",
+		"Check the HostName and Port, and the MaxStartups and logs of sshd on the server."},
+}
+
+// classifyError returns the kind of the connection error, or nil if it's unknown.
+// The errors are mostly wrapped by message, so the messages are matched as well as the error types.
+func classifyError(err error) *errorKind {
+	if err == nil {
+		return nil
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound {
+			return getErrorKind(1001)
+		}
+		return getErrorKind(1002)
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return getErrorKind(2001)
+	}
+	if errors.Is(err, syscall.ENETUNREACH) || errors.Is(err, syscall.EHOSTUNREACH) {
+		return getErrorKind(2003)
+	}
+	msg := strings.ToLower(err.Error())
+	for _, kind := range kErrorKinds {
+		for _, pattern := range kind.patterns {
+			if strings.Contains(msg, strings.ToLower(pattern)) {
+				return kind
+			}
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return getErrorKind(2002)
+	}
+	return nil
+}
+
+func getErrorKind(code int) *errorKind {
+	for _, kind := range kErrorKinds {
+		if kind.code == code {
+			return kind
+		}
+	}
+	return nil
+}
+
+// getErrorExitStatus returns the exit status of the connection error,
+// which is 255 as ssh unless `CategorizedExitCodes yes` is configured.
+func getErrorExitStatus(args *sshArgs, kind *errorKind) int {
+	if kind == nil || strings.ToLower(getExOptionConfig(args, "CategorizedExitCodes")) != "yes" {
+		return kExitConnectionError
+	}
+	return kind.category.status
+}
+
+// explainError writes the code, likely cause and possible fix of the connection error for --explain.
+func explainError(w io.Writer, kind *errorKind) {
+	if kind == nil {
+		fmt.Fprint(w, tr("No explanation for this error, run with --debug for more details.\r\n"))
+		return
+	}
+	fmt.Fprintf(w, tr("Error code: %d (%s)\r\n"), kind.code, kind.category.name)
+	fmt.Fprintf(w, tr("Likely cause: %s\r\n"), tr(kind.cause))
+	fmt.Fprintf(w, tr("Possible fix: %s\r\n"), tr(kind.fix))
+}
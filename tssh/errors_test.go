@@ -0,0 +1,106 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	assert := assert.New(t)
+	assertCode := func(code int, err error) {
+		t.Helper()
+		kind := classifyError(err)
+		if code == 0 {
+			assert.Nil(kind)
+			return
+		}
+		if assert.NotNil(kind) {
+			assert.Equal(code, kind.code)
+		}
+	}
+
+	assertCode(0, nil)
+	assertCode(0, fmt.Errorf("unknown RequestTTY option: maybe"))
+
+	assertCode(1001, &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true})
+	assertCode(1001, fmt.Errorf("dial tcp [example.invalid:22] failed: dial tcp: lookup example.invalid: no such host"))
+	assertCode(1002, fmt.Errorf("dial tcp [example.com:22] failed: dial tcp: lookup example.com on 127.0.0.53:53: server misbehaving"))
+
+	assertCode(2001, &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)})
+	assertCode(2001, fmt.Errorf("dial tcp [127.0.0.1:22] failed: dial tcp 127.0.0.1:22: connect: connection refused"))
+	assertCode(2002, fmt.Errorf("dial tcp [10.0.0.1:22] failed: dial tcp 10.0.0.1:22: i/o timeout"))
+	assertCode(2003, fmt.Errorf("dial tcp [10.0.0.1:22] failed: dial tcp 10.0.0.1:22: connect: network is unreachable"))
+	assertCode(2004, fmt.Errorf("proxy [jump] dial tcp [10.0.0.1:22] failed: dial [10.0.0.1:22] timeout"))
+	assertCode(2004, fmt.Errorf("exec proxy command [nc %%h %%p] failed: exec: \"nc\": executable file not found in $PATH"))
+	assertCode(2005, fmt.Errorf("new conn [127.0.0.1:22] failed: ssh: handshake failed: EOF"))
+
+	assertCode(3001, fmt.Errorf("new conn [127.0.0.1:22] failed: ssh: handshake failed: knownhosts: key mismatch"))
+	assertCode(3002, fmt.Errorf("new conn [127.0.0.1:22] failed: ssh: handshake failed: knownhosts: key is unknown"))
+	assertCode(3002, fmt.Errorf("new conn [127.0.0.1:22] failed: ssh: handshake failed: host key not trusted"))
+	assertCode(3003, fmt.Errorf("new conn [127.0.0.1:22] failed: ssh: handshake failed: "+
+		"host key ssh-ed25519 SHA256:abc does not match the HostKeyFingerprint of server"))
+
+	assertCode(4001, fmt.Errorf("proxy [jump] new conn [10.0.0.1:22] failed: ssh: handshake failed: "+
+		"ssh: unable to authenticate, attempted methods [none publickey], no supported methods remain"))
+	assertCode(4002, fmt.Errorf("new conn [127.0.0.1:22] failed: i/o timeout: no reply in 10s for all auth methods"))
+	assertCode(4003, fmt.Errorf("passphrase incorrect"))
+
+	assertCode(5001, fmt.Errorf("ssh new session failed: ssh: rejected: administratively prohibited"))
+	assertCode(5002, fmt.Errorf("request pty failed: EOF"))
+	assertCode(5003, fmt.Errorf("start shell failed: EOF"))
+
+	assertCode(6001, fmt.Errorf("stdio forward failed: ssh: rejected: connect failed"))
+	assertCode(6001, fmt.Errorf("invalid forward specification: 8080"))
+}
+
+func TestErrorKinds(t *testing.T) {
+	assert := assert.New(t)
+	codes := make(map[int]bool)
+	for _, kind := range kErrorKinds {
+		assert.False(codes[kind.code], "duplicate error code %d", kind.code)
+		codes[kind.code] = true
+		assert.Equal(kind.category.status-200, kind.code/1000, "category of error code %d", kind.code)
+		assert.Contains(kZhCNMessages, kind.cause)
+		assert.Contains(kZhCNMessages, kind.fix)
+	}
+}
+
+func TestGetErrorExitStatus(t *testing.T) {
+	assert := assert.New(t)
+	kind := classifyError(errors.New("dial tcp [127.0.0.1:22] failed: connect: connection refused"))
+	assert.Equal(kExitConnectionError, getErrorExitStatus(&sshArgs{}, kind))
+	args := &sshArgs{Option: sshOption{map[string][]string{"categorizedexitcodes": {"yes"}}}}
+	assert.Equal(202, getErrorExitStatus(args, kind))
+	assert.Equal(kExitConnectionError, getErrorExitStatus(args, nil))
+}
@@ -0,0 +1,95 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// kExitConnectionError is the exit status of tssh if an error occurred, the same as ssh.
+const kExitConnectionError = 255
+
+// kExitOnIdle is the exit status of the -N process closed by ExitOnIdle under the --reconnect monitor,
+// which tells the monitor not to reconnect.
+const kExitOnIdle = 254
+
+// getRemoteExitStatus returns the exit status of the remote command as ssh does,
+// or false if the error is not about the remote command but the connection.
+func getRemoteExitStatus(err error) (int, bool) {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		if exitErr.Signal() != "" {
+			debug("remote command killed by signal %s: %s", exitErr.Signal(), exitErr.Msg())
+			return kExitConnectionError, true
+		}
+		return exitErr.ExitStatus(), true
+	}
+	var missingErr *ssh.ExitMissingError
+	if errors.As(err, &missingErr) {
+		debug("remote command exited without exit status or exit signal")
+		return kExitConnectionError, true
+	}
+	return 0, false
+}
+
+var kForwardSignals = map[os.Signal]ssh.Signal{
+	os.Interrupt:    ssh.SIGINT,
+	syscall.SIGTERM: ssh.SIGTERM,
+	syscall.SIGHUP:  ssh.SIGHUP,
+}
+
+// forwardSignals sends the local SIGINT, SIGTERM and SIGHUP to the remote command without a tty.
+// If the server ignores the signal request, the session is closed on the second signal.
+func forwardSignals(session *ssh.Session) func() {
+	sigCh := make(chan os.Signal, 1)
+	for sig := range kForwardSignals {
+		signal.Notify(sigCh, sig)
+	}
+	go func() {
+		received := make(map[os.Signal]bool)
+		for sig := range sigCh {
+			if received[sig] {
+				debug("received %v again, close the session", sig)
+				_ = session.Close()
+				return
+			}
+			received[sig] = true
+			debug("forward signal %v to the remote command", sig)
+			if err := session.Signal(kForwardSignals[sig]); err != nil {
+				debug("forward signal %v failed: %v", sig, err)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigCh)
+		close(sigCh)
+	}
+}
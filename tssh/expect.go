@@ -133,9 +133,9 @@ func (c *caseSendList) addCaseSendPass(config string) error {
 	}
 	pass, err := decodeSecret(secret)
 	if err != nil {
-		return fmt.Errorf("decode secret [%s] failed: %v", secret, err)
+		return fmt.Errorf("decode secret [%s] failed: %v", maskSecret(secret), err)
 	}
-	c.addCase(re, pattern, strings.Repeat("*", len(pass))+"\\r", pass+"\r")
+	c.addCase(re, pattern, maskSecret(pass)+"\\r", pass+"\r")
 	return nil
 }
 
@@ -245,7 +245,9 @@ func (e *sshExpect) waitForPattern(pattern string, caseSends *caseSendList) erro
 		case buf = <-e.err:
 		}
 		output := strconv.QuoteToASCII(string(buf))
-		debug("expect output: %s", output)
+		if !memoryOnlySecrets {
+			debug("expect output: %s", output)
+		}
 		caseSends.handleOutput(output[1 : len(output)-1])
 		builder.WriteString(output[1 : len(output)-1])
 		if re.MatchString(builder.String()) {
@@ -258,7 +260,9 @@ func (e *sshExpect) waitForPattern(pattern string, caseSends *caseSendList) erro
 				default:
 					return nil
 				}
-				debug("expect output: %s", strconv.QuoteToASCII(string(buf)))
+				if !memoryOnlySecrets {
+					debug("expect output: %s", strconv.QuoteToASCII(string(buf)))
+				}
 			}
 		} else {
 			debug("expect not match: %s", pattern)
@@ -294,10 +298,10 @@ func (e *sshExpect) execInteractions(alias string, writer io.Writer, expectCount
 		if secret != "" {
 			pass, err := decodeSecret(secret)
 			if err != nil {
-				warning("decode secret [%s] failed: %v", secret, err)
+				warning("decode secret [%s] failed: %v", maskSecret(secret), err)
 				return
 			}
-			debug("expect send %d: %s\\r", i, strings.Repeat("*", len(pass)))
+			debug("expect send %d: %s\\r", i, maskSecret(pass))
 			input = pass + "\r"
 		} else {
 			text := getExConfig(alias, fmt.Sprintf("%sExpectSendText%d", e.pre, i))
@@ -337,6 +341,10 @@ func getExpectTimeout(args *sshArgs, prefix string) uint32 {
 		warning("Invalid ExpectTimeout [%s]: %v", expectCount, err)
 		return kDefaultExpectTimeout
 	}
+	if count == 0 && batchMode {
+		// never wait for the patterns forever in batch mode
+		return kDefaultExpectTimeout
+	}
 	return uint32(count)
 }
 
@@ -348,7 +356,6 @@ func execExpectInteractions(args *sshArgs, serverIn io.Writer,
 	}
 
 	outReader, outWriter := io.Pipe()
-	errReader, errWriter := io.Pipe()
 
 	var ctx context.Context
 	var cancel context.CancelFunc
@@ -362,10 +369,17 @@ func execExpectInteractions(args *sshArgs, serverIn io.Writer,
 	expect := &sshExpect{
 		ctx: ctx,
 		out: make(chan []byte, 10),
-		err: make(chan []byte, 10),
 	}
 	go expect.wrapOutput(serverOut, outWriter, expect.out)
-	go expect.wrapOutput(serverErr, errWriter, expect.err)
+
+	// the console server has no stderr
+	var errReader io.Reader
+	if serverErr != nil {
+		var errWriter *io.PipeWriter
+		errReader, errWriter = io.Pipe()
+		expect.err = make(chan []byte, 10)
+		go expect.wrapOutput(serverErr, errWriter, expect.err)
+	}
 
 	expect.execInteractions(args.Destination, serverIn, expectCount)
 
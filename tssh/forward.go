@@ -27,15 +27,19 @@ package tssh
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
+	"os/signal"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/armon/go-socks5"
@@ -197,10 +201,17 @@ func parseForwardArg(s string) (*forwardCfg, error) {
 }
 
 func isGatewayPorts(args *sshArgs) bool {
-	return args.Gateway || strings.ToLower(getConfig(args.Destination, "GatewayPorts")) == "yes"
+	return args.Gateway || strings.ToLower(getOptionConfig(args, "GatewayPorts")) == "yes"
 }
 
 func listenOnLocal(args *sshArgs, addr *string, port string) (listeners []net.Listener) {
+	if listeners = takeActivationListeners(port); len(listeners) > 0 {
+		for _, listener := range listeners {
+			debug("forward listen on local '%s' by socket activation", listener.Addr())
+			addForwardListener(listener)
+		}
+		return
+	}
 	listen := func(network, address string) {
 		listener, err := net.Listen(network, address)
 		if err != nil {
@@ -208,6 +219,7 @@ func listenOnLocal(args *sshArgs, addr *string, port string) (listeners []net.Li
 		} else {
 			debug("forward listen on local '%s' success", address)
 			listeners = append(listeners, listener)
+			addForwardListener(listener)
 		}
 	}
 	if addr == nil && isGatewayPorts(args) || addr != nil && (*addr == "" || *addr == "*") {
@@ -224,17 +236,17 @@ func listenOnLocal(args *sshArgs, addr *string, port string) (listeners []net.Li
 	return
 }
 
-func listenOnRemote(args *sshArgs, client *ssh.Client, addr *string, port string) (listeners []net.Listener) {
+func listenOnRemote(gatewayPorts bool, client *ssh.Client, addr *string, port string) (listeners []net.Listener) {
 	listen := func(network, address string) {
 		listener, err := client.Listen(network, address)
 		if err != nil {
 			debug("forward listen on remote '%s' failed: %v", address, err)
-		} else {
+		} else if addForwardListener(listener) {
 			debug("forward listen on remote '%s' success", address)
 			listeners = append(listeners, listener)
 		}
 	}
-	if addr == nil && isGatewayPorts(args) || addr != nil && (*addr == "" || *addr == "*") {
+	if addr == nil && gatewayPorts || addr != nil && (*addr == "" || *addr == "*") {
 		listen("tcp4", joinHostPort("0.0.0.0", port))
 		listen("tcp6", joinHostPort("::", port))
 		return
@@ -260,12 +272,12 @@ func stdioForward(client *ssh.Client, addr string) (*sync.WaitGroup, error) {
 
 	done := make(chan struct{}, 2)
 	go func() {
-		_, _ = io.Copy(conn, os.Stdin)
+		_, _ = relayCopy(conn, os.Stdin)
 		done <- struct{}{}
 		wg.Done()
 	}()
 	go func() {
-		_, _ = io.Copy(os.Stdout, conn)
+		_, _ = relayCopy(os.Stdout, conn)
 		done <- struct{}{}
 		wg.Done()
 	}()
@@ -280,33 +292,232 @@ func (d sshResolver) Resolve(ctx context.Context, name string) (context.Context,
 	return ctx, []byte{}, nil
 }
 
+var (
+	forwardListenersMutex  sync.Mutex
+	forwardListeners       []net.Listener
+	forwardListenersClosed bool
+	activeForwards         atomic.Int64
+	lastForwardActivity    atomic.Int64
+)
+
+// errExitOnIdle is returned when the connection of -N is closed by ExitOnIdle.
+var errExitOnIdle = errors.New("all forwarded channels have been idle")
+
+func touchForwardActivity() {
+	lastForwardActivity.Store(time.Now().UnixNano())
+}
+
+// idleConn records the time of the latest traffic of a forwarded connection for ExitOnIdle.
+type idleConn struct {
+	net.Conn
+}
+
+func (c *idleConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		touchForwardActivity()
+	}
+	return n, err
+}
+
+func (c *idleConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		touchForwardActivity()
+	}
+	return n, err
+}
+
+// addForwardListener returns false and closes the listener if the forward listeners have been closed.
+func addForwardListener(listener net.Listener) bool {
+	forwardListenersMutex.Lock()
+	defer forwardListenersMutex.Unlock()
+	if forwardListenersClosed {
+		_ = listener.Close()
+		return false
+	}
+	forwardListeners = append(forwardListeners, listener)
+	return true
+}
+
+func isForwardListenersClosed() bool {
+	forwardListenersMutex.Lock()
+	defer forwardListenersMutex.Unlock()
+	return forwardListenersClosed
+}
+
+func closeForwardListeners() {
+	forwardListenersMutex.Lock()
+	defer forwardListenersMutex.Unlock()
+	for _, listener := range forwardListeners {
+		_ = listener.Close()
+	}
+	forwardListeners = nil
+	forwardListenersClosed = true
+}
+
+func getRemoteForwardRetryInterval(args *sshArgs) time.Duration {
+	interval := 10 * time.Second
+	if value := getExOptionConfig(args, "RemoteForwardRetryInterval"); value != "" {
+		if seconds, err := strconv.ParseUint(value, 10, 32); err != nil {
+			warning("RemoteForwardRetryInterval %s is invalid: %v", value, err)
+		} else {
+			interval = time.Duration(seconds) * time.Second
+		}
+	}
+	return interval
+}
+
+func getForwardDrainTimeout(args *sshArgs) time.Duration {
+	timeout := 30 * time.Second
+	if value := getExOptionConfig(args, "ForwardDrainTimeout"); value != "" {
+		if seconds, err := strconv.ParseUint(value, 10, 32); err != nil {
+			warning("ForwardDrainTimeout %s is invalid: %v", value, err)
+		} else {
+			timeout = time.Duration(seconds) * time.Second
+		}
+	}
+	return timeout
+}
+
+// getExitOnIdle returns the seconds of ExitOnIdle, 0 means never exit on idle.
+func getExitOnIdle(args *sshArgs) time.Duration {
+	value := getExOptionConfig(args, "ExitOnIdle")
+	if value == "" {
+		return 0
+	}
+	seconds, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		warning("ExitOnIdle %s is invalid: %v", value, err)
+		return 0
+	}
+	if seconds > 0 && isForwardDelegated(args) {
+		warning("ExitOnIdle is not supported with CtrlDelegateForward, the forwards are done by openssh")
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// watchForwardIdle closes the returned channel when there is no traffic on any forwarded connection
+// for the idle duration, or returns nil which blocks forever if idle is 0.
+func watchForwardIdle(idle time.Duration, exitCh <-chan struct{}) <-chan struct{} {
+	if idle <= 0 {
+		return nil
+	}
+	touchForwardActivity()
+	idleCh := make(chan struct{})
+	interval := time.Second
+	if idle < 2*interval {
+		interval = idle / 2
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-exitCh:
+				return
+			case <-ticker.C:
+				if time.Since(time.Unix(0, lastForwardActivity.Load())) >= idle {
+					close(idleCh)
+					return
+				}
+			}
+		}
+	}()
+	return idleCh
+}
+
+// waitTunnelExit waits for the connection of -N to exit. On SIGTERM, it stops accepting new
+// forwarded connections, and waits for the active ones to finish until the timeout.
+// It closes the connection and returns errExitOnIdle if all forwarded channels have been idle.
+func waitTunnelExit(client *ssh.Client, timeout, idle time.Duration) error {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	exitCh := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(exitCh)
+	}()
+
+	select {
+	case <-exitCh:
+		return nil
+	case <-watchForwardIdle(idle, exitCh):
+		audit("no traffic on the forwarded channels for %v, closing the connection", idle)
+		closeForwardListeners()
+		client.Close()
+		return errExitOnIdle
+	case <-sigCh:
+	}
+
+	audit("received SIGTERM, draining %d forwarded connections in %v", activeForwards.Load(), timeout)
+	closeForwardListeners()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+	for activeForwards.Load() > 0 {
+		select {
+		case <-exitCh:
+			return nil
+		case <-deadline:
+			debug("drain timeout, %d forwarded connections left", activeForwards.Load())
+			client.Close()
+			return nil
+		case <-ticker.C:
+		}
+	}
+	client.Close()
+	return nil
+}
+
 func dynamicForward(client *ssh.Client, b *bindCfg, args *sshArgs) {
+	rules, err := getDynamicForwardRules(args)
+	if err != nil {
+		warning("dynamic forward failed: %v", err)
+		return
+	}
+	resolver, err := getDynamicForwardResolver(args)
+	if err != nil {
+		warning("dynamic forward failed: %v", err)
+		return
+	}
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialWithTimeout(client, network, addr, 10*time.Second)
+	}
 	server, err := socks5.New(&socks5.Config{
-		Resolver: &sshResolver{},
-		Dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return dialWithTimeout(client, network, addr, 10*time.Second)
-		},
-		Logger: log.New(io.Discard, "", log.LstdFlags),
+		Rules:    rules,
+		Resolver: resolver,
+		Dial:     dial,
+		Logger:   log.New(io.Discard, "", log.LstdFlags),
 	})
 	if err != nil {
 		warning("dynamic forward failed: %v", err)
 		return
 	}
+	forwarder := &dynamicForwarder{server: server, rules: rules, resolver: resolver, dial: dial}
 
+	metrics := newForwardMetrics("dynamic", b.argument)
+	keepAlive := getTCPKeepAlive(args)
 	for _, listener := range listenOnLocal(args, b.addr, strconv.Itoa(b.port)) {
 		go func(listener net.Listener) {
 			defer listener.Close()
 			for {
 				conn, err := listener.Accept()
-				if err == io.EOF {
+				if err == io.EOF || errors.Is(err, net.ErrClosed) {
 					break
 				}
 				if err != nil {
 					debug("dynamic forward accept failed: %v", err)
 					continue
 				}
+				setupTCPKeepAlive(conn, keepAlive)
+				conn = metrics.wrap(conn)
 				go func() {
-					if err := server.ServeConn(conn); err != nil {
+					if err := forwarder.serve(conn); err != nil {
 						debug("dynamic forward serve failed: %v", err)
 					}
 				}()
@@ -316,16 +527,21 @@ func dynamicForward(client *ssh.Client, b *bindCfg, args *sshArgs) {
 }
 
 func netForward(local, remote net.Conn) {
+	activeForwards.Add(1)
+	defer activeForwards.Add(-1)
 	defer local.Close()
 	defer remote.Close()
+	touchForwardActivity()
+	defer touchForwardActivity()
+	local = &idleConn{local}
 
 	done := make(chan struct{}, 2)
 	go func() {
-		_, _ = io.Copy(local, remote)
+		_, _ = relayCopy(local, remote)
 		done <- struct{}{}
 	}()
 	go func() {
-		_, _ = io.Copy(remote, local)
+		_, _ = relayCopy(remote, local)
 		done <- struct{}{}
 	}()
 	<-done
@@ -333,12 +549,14 @@ func netForward(local, remote net.Conn) {
 
 func localForward(client *ssh.Client, f *forwardCfg, args *sshArgs) {
 	remoteAddr := joinHostPort(f.destHost, strconv.Itoa(f.destPort))
+	metrics := newForwardMetrics("local", f.argument)
+	keepAlive := getTCPKeepAlive(args)
 	for _, listener := range listenOnLocal(args, f.bindAddr, strconv.Itoa(f.bindPort)) {
 		go func(listener net.Listener) {
 			defer listener.Close()
 			for {
 				local, err := listener.Accept()
-				if err == io.EOF {
+				if err == io.EOF || errors.Is(err, net.ErrClosed) {
 					break
 				}
 				if err != nil {
@@ -351,7 +569,8 @@ func localForward(client *ssh.Client, f *forwardCfg, args *sshArgs) {
 					local.Close()
 					continue
 				}
-				go netForward(local, remote)
+				setupTCPKeepAlive(local, keepAlive)
+				go netForward(metrics.wrap(local), remote)
 			}
 		}(listener)
 	}
@@ -359,28 +578,122 @@ func localForward(client *ssh.Client, f *forwardCfg, args *sshArgs) {
 
 func remoteForward(client *ssh.Client, f *forwardCfg, args *sshArgs) {
 	localAddr := joinHostPort(f.destHost, strconv.Itoa(f.destPort))
-	for _, listener := range listenOnRemote(args, client, f.bindAddr, strconv.Itoa(f.bindPort)) {
-		go func(listener net.Listener) {
-			defer listener.Close()
-			for {
-				remote, err := listener.Accept()
-				if err == io.EOF {
-					break
-				}
-				if err != nil {
-					debug("remote forward accept failed: %v", err)
-					continue
+	metrics := newForwardMetrics("remote", f.argument)
+	keepAlive := getTCPKeepAlive(args)
+	gatewayPorts := isGatewayPorts(args)
+	interval := getRemoteForwardRetryInterval(args)
+
+	serve := func(listener net.Listener, wg *sync.WaitGroup) {
+		defer wg.Done()
+		defer listener.Close()
+		for {
+			remote, err := listener.Accept()
+			if err == io.EOF || errors.Is(err, net.ErrClosed) {
+				break
+			}
+			if err != nil {
+				debug("remote forward accept failed: %v", err)
+				continue
+			}
+			local, err := net.DialTimeout("tcp", localAddr, 10*time.Second)
+			if err != nil {
+				debug("remote forward dial [%s] failed: %v", localAddr, err)
+				remote.Close()
+				continue
+			}
+			setupTCPKeepAlive(local, keepAlive)
+			go netForward(metrics.wrap(local), remote)
+		}
+	}
+	listen := func() *sync.WaitGroup {
+		listeners := listenOnRemote(gatewayPorts, client, f.bindAddr, strconv.Itoa(f.bindPort))
+		if len(listeners) == 0 {
+			return nil
+		}
+		var wg sync.WaitGroup
+		for _, listener := range listeners {
+			wg.Add(1)
+			go serve(listener, &wg)
+		}
+		return &wg
+	}
+
+	var wg *sync.WaitGroup
+	reason := ""
+	preflight := strings.ToLower(getExOptionConfig(args, "RemoteForwardPreflight")) == "yes"
+	if f.bindPort != 0 && preflight {
+		reason = getRemotePortInUseReason(client, f.bindPort)
+	}
+	if reason == "" {
+		if wg = listen(); wg == nil {
+			reason = getRemoteForwardFailedReason(client, f.bindPort, preflight)
+		}
+	}
+	if interval == 0 {
+		if wg == nil {
+			warning("remote forward [%s] failed%s", f.argument, reason)
+		}
+		return
+	}
+	// re-establish the remote listeners, which may fail to bind for the port is temporarily taken
+	closed := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(closed)
+	}()
+	go func() {
+		for retried := false; ; {
+			if wg != nil {
+				wg.Wait()
+				// the listeners are closed a moment before the connection
+				select {
+				case <-closed:
+					return
+				case <-time.After(100 * time.Millisecond):
 				}
-				local, err := net.DialTimeout("tcp", localAddr, 10*time.Second)
-				if err != nil {
-					debug("remote forward dial [%s] failed: %v", localAddr, err)
-					remote.Close()
-					continue
+				if isForwardListenersClosed() {
+					return
 				}
-				go netForward(local, remote)
+				warning("remote forward [%s] lost, retry every %v", f.argument, interval)
+				retried = true
+			} else if !retried {
+				warning("remote forward [%s] failed%s, retry every %v", f.argument, reason, interval)
+				retried = true
 			}
-		}(listener)
+			select {
+			case <-closed:
+				return
+			case <-time.After(interval):
+			}
+			if isForwardListenersClosed() {
+				return
+			}
+			if wg = listen(); wg != nil {
+				warning("remote forward [%s] re-established", f.argument)
+			}
+		}
+	}()
+}
+
+// isForwardDelegated returns whether all the forwards are delegated to an openssh master
+func isForwardDelegated(args *sshArgs) bool {
+	return strings.ToLower(getExOptionConfig(args, "CtrlDelegateForward")) == "yes"
+}
+
+// hasForwards returns whether any forward is specified in the arguments or the config
+func hasForwards(args *sshArgs) bool {
+	if strings.ToLower(getOptionConfig(args, "ClearAllForwardings")) == "yes" {
+		return false
+	}
+	if len(args.DynamicForward.binds) > 0 || len(args.LocalForward.cfgs) > 0 || len(args.RemoteForward.cfgs) > 0 {
+		return true
+	}
+	for _, key := range []string{"DynamicForward", "LocalForward", "RemoteForward"} {
+		if len(getAllOptionConfig(args, key)) > 0 {
+			return true
+		}
 	}
+	return false
 }
 
 func sshForward(client *ssh.Client, args *sshArgs) error {
@@ -0,0 +1,200 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/armon/go-socks5"
+)
+
+// dynamicForwardRule matches the destination of the SOCKS requests, configured as
+// `<host,...> [port,...]` where the host is a CIDR, an IP or a hostname pattern,
+// and the port is a number or a range like `8000-8999`, any port if omitted.
+type dynamicForwardRule struct {
+	nets     []*net.IPNet
+	patterns []string
+	ports    [][2]int
+}
+
+func parseDynamicForwardRule(rule string) (*dynamicForwardRule, error) {
+	fields := strings.Fields(rule)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid rule [%s]", rule)
+	}
+	r := &dynamicForwardRule{}
+	for _, host := range strings.Split(fields[0], ",") {
+		if host == "" {
+			return nil, fmt.Errorf("invalid rule [%s]: empty host", rule)
+		}
+		if strings.Contains(host, "/") {
+			_, ipNet, err := net.ParseCIDR(host)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rule [%s]: %v", rule, err)
+			}
+			r.nets = append(r.nets, ipNet)
+		} else if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			r.nets = append(r.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		} else {
+			r.patterns = append(r.patterns, host)
+		}
+	}
+	if len(fields) < 2 {
+		return r, nil
+	}
+	for _, port := range strings.Split(fields[1], ",") {
+		low, high, found := strings.Cut(port, "-")
+		if !found {
+			high = low
+		}
+		begin, err := strconv.ParseUint(low, 10, 16)
+		if err != nil || begin == 0 {
+			return nil, fmt.Errorf("invalid rule [%s]: invalid port [%s]", rule, port)
+		}
+		end, err := strconv.ParseUint(high, 10, 16)
+		if err != nil || end < begin {
+			return nil, fmt.Errorf("invalid rule [%s]: invalid port [%s]", rule, port)
+		}
+		r.ports = append(r.ports, [2]int{int(begin), int(end)})
+	}
+	return r, nil
+}
+
+func (r *dynamicForwardRule) matchPort(port int) bool {
+	if len(r.ports) == 0 {
+		return true
+	}
+	for _, p := range r.ports {
+		if port >= p[0] && port <= p[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// match checks the destination, the hostname resolved on the server is never matched by the CIDR.
+func (r *dynamicForwardRule) match(dest *socks5.AddrSpec) bool {
+	if !r.matchPort(dest.Port) {
+		return false
+	}
+	ip := dest.IP
+	if len(ip) == 0 {
+		ip = net.ParseIP(dest.FQDN)
+	}
+	if len(ip) > 0 {
+		for _, ipNet := range r.nets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	host := dest.FQDN
+	if host == "" {
+		host = ip.String()
+	}
+	for _, pattern := range r.patterns {
+		if matchPatternList(host, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// dynamicForwardRules allows the destinations matched by `DynamicForwardAllow` if configured,
+// except the destinations matched by `DynamicForwardDeny`.
+type dynamicForwardRules struct {
+	allow []*dynamicForwardRule
+	deny  []*dynamicForwardRule
+}
+
+// mayResolveInto returns whether the hostname resolved on the server may be in the CIDR of the rule.
+func (r *dynamicForwardRule) mayResolveInto(dest *socks5.AddrSpec) bool {
+	return len(r.nets) > 0 && isUnresolvedHost(dest) && r.matchPort(dest.Port)
+}
+
+func isUnresolvedHost(dest *socks5.AddrSpec) bool {
+	return len(dest.IP) == 0 && dest.FQDN != "" && net.ParseIP(dest.FQDN) == nil
+}
+
+func (d *dynamicForwardRules) Allow(ctx context.Context, req *socks5.Request) (context.Context, bool) {
+	if req.Command != socks5.ConnectCommand || req.DestAddr == nil {
+		return ctx, false
+	}
+	for _, rule := range d.deny {
+		if rule.match(req.DestAddr) {
+			debug("dynamic forward to [%s] denied", req.DestAddr.Address())
+			return ctx, false
+		}
+		// fail closed, as the CIDR can't be checked until the hostname is resolved
+		if rule.mayResolveInto(req.DestAddr) {
+			debug("dynamic forward to [%s] denied, the hostname can't be checked by the CIDR of DynamicForwardDeny "+
+				"unless DynamicForwardResolve local", req.DestAddr.Address())
+			return ctx, false
+		}
+	}
+	if len(d.allow) == 0 {
+		return ctx, true
+	}
+	for _, rule := range d.allow {
+		if rule.match(req.DestAddr) {
+			return ctx, true
+		}
+	}
+	if isUnresolvedHost(req.DestAddr) {
+		debug("dynamic forward to [%s] not allowed, the hostname is never matched by the CIDR of DynamicForwardAllow "+
+			"unless DynamicForwardResolve local", req.DestAddr.Address())
+	} else {
+		debug("dynamic forward to [%s] not allowed", req.DestAddr.Address())
+	}
+	return ctx, false
+}
+
+func getDynamicForwardRules(args *sshArgs) (*dynamicForwardRules, error) {
+	rules := &dynamicForwardRules{}
+	for _, s := range getAllExOptionConfig(args, "DynamicForwardAllow") {
+		rule, err := parseDynamicForwardRule(s)
+		if err != nil {
+			return nil, fmt.Errorf("DynamicForwardAllow %v", err)
+		}
+		rules.allow = append(rules.allow, rule)
+	}
+	for _, s := range getAllExOptionConfig(args, "DynamicForwardDeny") {
+		rule, err := parseDynamicForwardRule(s)
+		if err != nil {
+			return nil, fmt.Errorf("DynamicForwardDeny %v", err)
+		}
+		rules.deny = append(rules.deny, rule)
+	}
+	return rules, nil
+}
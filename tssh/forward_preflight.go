@@ -0,0 +1,112 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// kRemotePortCheckCommand lists the listeners of the port by ss, lsof or netstat, whichever is available.
+const kRemotePortCheckCommand = "if command -v ss >/dev/null 2>&1; then ss -Hltnp 'sport = :%[1]d'; " +
+	"elif command -v lsof >/dev/null 2>&1; then lsof -nP -iTCP:%[1]d -sTCP:LISTEN; " +
+	"else netstat -ltnp 2>/dev/null | grep -E '[:.]%[1]d[[:space:]]'; fi"
+
+var (
+	ssUsersRegexp    = regexp.MustCompile(`users:\(\("([^"]+)",pid=(\d+)`)
+	netstatPidRegexp = regexp.MustCompile(`\s(\d+)/(\S+)\s*$`)
+)
+
+// parseRemotePortHolder returns the process which holds the port from the output of kRemotePortCheckCommand,
+// or an empty string if the process is unknown, e.g. it is owned by another user.
+func parseRemotePortHolder(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if match := ssUsersRegexp.FindStringSubmatch(line); match != nil {
+			return fmt.Sprintf("%s (pid %s)", match[1], match[2])
+		}
+		if match := netstatPidRegexp.FindStringSubmatch(line); match != nil {
+			return fmt.Sprintf("%s (pid %s)", match[2], match[1])
+		}
+		if fields := strings.Fields(line); len(fields) > 2 && fields[0] != "COMMAND" && strings.Contains(line, "(LISTEN)") {
+			return fmt.Sprintf("%s (pid %s)", fields[0], fields[1])
+		}
+	}
+	return ""
+}
+
+// isRemotePortBound checks whether the port is bound on the server, and which process holds it.
+func isRemotePortBound(client *ssh.Client, port int) (bool, string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return false, "", err
+	}
+	defer session.Close()
+	output, _ := session.Output(fmt.Sprintf(kRemotePortCheckCommand, port))
+	if strings.TrimSpace(string(output)) == "" {
+		return false, "", nil
+	}
+	return true, parseRemotePortHolder(string(output)), nil
+}
+
+// getRemotePortInUseReason returns the reason if the port is already in use on the server.
+func getRemotePortInUseReason(client *ssh.Client, port int) string {
+	bound, holder, err := isRemotePortBound(client, port)
+	if err != nil {
+		debug("check remote port %d failed: %v", port, err)
+		return ""
+	}
+	if !bound {
+		return ""
+	}
+	if holder == "" {
+		holder = "another process"
+	}
+	return fmt.Sprintf(": remote port %d is already in use by %s, stop it or choose another port", port, holder)
+}
+
+// getRemoteForwardFailedReason explains why the server refused to listen on the port. The port is checked
+// on the server only with `RemoteForwardPreflight yes`, which runs a command in a new session of the server.
+func getRemoteForwardFailedReason(client *ssh.Client, port int, preflight bool) string {
+	if port == 0 {
+		return ""
+	}
+	if preflight {
+		if reason := getRemotePortInUseReason(client, port); reason != "" {
+			return reason
+		}
+	}
+	if port < 1024 {
+		return fmt.Sprintf(": remote port %d is privileged, which requires logging in as root", port)
+	}
+	return ": the server refused, which may be forbidden by AllowTcpForwarding, PermitListen or GatewayPorts"
+}
@@ -26,8 +26,13 @@ SOFTWARE.
 package tssh
 
 import (
+	"context"
+	"io"
+	"net"
 	"testing"
+	"time"
 
+	"github.com/armon/go-socks5"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -210,3 +215,217 @@ func TestParseForwardArg(t *testing.T) {
 	assertArgError("127.0.0.1:8000:[::1]]:9000", "invalid forward specification: 127.0.0.1:8000:[::1]]:9000")
 	assertArgError("127.0.0.1:8000:[:\t:1]:9000", "invalid forward specification: 127.0.0.1:8000:[:\t:1]:9000")
 }
+
+func TestDynamicForwardRules(t *testing.T) {
+	assert := assert.New(t)
+	newRule := func(rule string) *dynamicForwardRule {
+		t.Helper()
+		r, err := parseDynamicForwardRule(rule)
+		assert.Nil(err)
+		return r
+	}
+	rules := &dynamicForwardRules{
+		allow: []*dynamicForwardRule{newRule("10.0.0.0/8,*.dev.example.com 22,80,8000-8999"), newRule("192.168.1.1")},
+		deny:  []*dynamicForwardRule{newRule("10.1.0.0/16"), newRule("db.dev.example.com")},
+	}
+	assertResolved := func(host, ip string, port int, expected bool) {
+		t.Helper()
+		dest := &socks5.AddrSpec{Port: port, FQDN: host, IP: net.ParseIP(ip)}
+		if net.ParseIP(host) != nil {
+			dest.FQDN = ""
+		}
+		_, allowed := rules.Allow(context.Background(), &socks5.Request{Command: socks5.ConnectCommand, DestAddr: dest})
+		assert.Equal(expected, allowed)
+	}
+	assertAllowed := func(host string, port int, expected bool) {
+		t.Helper()
+		assertResolved(host, host, port, expected)
+	}
+
+	assertAllowed("10.2.3.4", 22, true)
+	assertAllowed("10.2.3.4", 8080, true)
+	assertAllowed("10.2.3.4", 443, false)
+	assertAllowed("10.1.3.4", 22, false)
+	assertAllowed("db.dev.example.com", 80, false)
+	assertAllowed("www.example.com", 80, false)
+	assertAllowed("192.168.1.1", 3306, true)
+	assertAllowed("192.168.1.2", 22, false)
+
+	// the hostname resolved on the server may be in the CIDR of DynamicForwardDeny
+	assertAllowed("web.dev.example.com", 80, false)
+	// the hostname resolved locally by DynamicForwardResolve local
+	assertResolved("web.dev.example.com", "10.2.3.4", 80, true)
+	assertResolved("web.dev.example.com", "10.1.3.4", 80, false)
+
+	// the CIDR of DynamicForwardDeny for other ports
+	rules = &dynamicForwardRules{deny: []*dynamicForwardRule{newRule("10.0.0.0/8 22"), newRule("*.internal")}}
+	assertAllowed("web.example.com", 80, true)
+	assertAllowed("web.example.com", 22, false)
+	assertAllowed("db.internal", 80, false)
+	assertAllowed("10.0.0.1", 80, true)
+
+	// the hostname resolved on the server is never matched by the CIDR of DynamicForwardAllow
+	rules = &dynamicForwardRules{allow: []*dynamicForwardRule{newRule("10.0.0.0/8")}}
+	assertAllowed("web.example.com", 80, false)
+	assertAllowed("10.0.0.1", 80, true)
+	assertResolved("web.example.com", "10.0.0.1", 80, true)
+
+	for _, rule := range []string{"", "10.0.0.0/33", "host 0", "host 80-22", "host 65536", "a b c", ",host"} {
+		_, err := parseDynamicForwardRule(rule)
+		assert.NotNil(err, rule)
+	}
+}
+
+func TestSocks4Forward(t *testing.T) {
+	assert := assert.New(t)
+	var dialed string
+	forwarder := &dynamicForwarder{
+		rules:    &dynamicForwardRules{deny: []*dynamicForwardRule{{patterns: []string{"denied.example.com"}}}},
+		resolver: &sshResolver{},
+		dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = addr
+			local, remote := net.Pipe()
+			go func() {
+				buf := make([]byte, 5)
+				if _, err := io.ReadFull(remote, buf); err == nil {
+					_, _ = remote.Write(buf)
+				}
+				remote.Close()
+			}()
+			return local, nil
+		},
+	}
+	request := func(req []byte) []byte {
+		t.Helper()
+		client, server := net.Pipe()
+		defer client.Close()
+		go func() { _ = forwarder.serve(server) }()
+		_, err := client.Write(req)
+		assert.Nil(err)
+		resp := make([]byte, 8)
+		_, err = io.ReadFull(client, resp)
+		assert.Nil(err)
+		if resp[1] == 90 {
+			_, err = client.Write([]byte("hello"))
+			assert.Nil(err)
+			echo := make([]byte, 5)
+			_, err = io.ReadFull(client, echo)
+			assert.Nil(err)
+			assert.Equal("hello", string(echo))
+		}
+		return resp
+	}
+
+	resp := request([]byte{4, 1, 0, 22, 10, 0, 0, 1, 'u', 0})
+	assert.Equal([]byte{0, 90, 0, 0, 0, 0, 0, 0}, resp)
+	assert.Equal("10.0.0.1:22", dialed)
+
+	resp = request(append([]byte{4, 1, 0, 80, 0, 0, 0, 1, 0}, "www.example.com\x00"...))
+	assert.Equal(byte(90), resp[1])
+	assert.Equal("www.example.com:80", dialed)
+
+	dialed = ""
+	resp = request(append([]byte{4, 1, 0, 80, 0, 0, 0, 1, 0}, "denied.example.com\x00"...))
+	assert.Equal(byte(91), resp[1])
+	assert.Equal("", dialed)
+
+	resp = request([]byte{4, 2, 0, 22, 10, 0, 0, 1, 0})
+	assert.Equal(byte(91), resp[1])
+}
+
+func TestParseBufferSize(t *testing.T) {
+	assert := assert.New(t)
+	assertSize := func(value string, expected int) {
+		t.Helper()
+		size, err := parseBufferSize(value)
+		assert.Nil(err)
+		assert.Equal(expected, size)
+	}
+	assertSize("1024", 1024)
+	assertSize("256k", 256*1024)
+	assertSize("1M", 1024*1024)
+	assertSize("16M", 16*1024*1024)
+
+	for _, value := range []string{"", "1023", "17M", "1G", "-1K", "abc"} {
+		_, err := parseBufferSize(value)
+		assert.NotNil(err, value)
+	}
+}
+
+func TestParseRemotePortHolder(t *testing.T) {
+	assert := assert.New(t)
+	assertHolder := func(output, holder string) {
+		t.Helper()
+		assert.Equal(holder, parseRemotePortHolder(output))
+	}
+
+	assertHolder("", "")
+	assertHolder(`LISTEN 0      511          0.0.0.0:8080      0.0.0.0:*    users:(("nginx",pid=1234,fd=6),("nginx",pid=1235,fd=6))`+"\n",
+		"nginx (pid 1234)")
+	assertHolder("LISTEN 0      4096       127.0.0.1:8080      0.0.0.0:*\n", "")
+	assertHolder("COMMAND   PID  USER   FD   TYPE DEVICE SIZE/OFF NODE NAME\n"+
+		"python3 4321 penny    3u  IPv4  12345      0t0  TCP *:8080 (LISTEN)\n", "python3 (pid 4321)")
+	assertHolder("tcp        0      0 0.0.0.0:8080            0.0.0.0:*               LISTEN      5678/node\n", "node (pid 5678)")
+	assertHolder("tcp        0      0 0.0.0.0:8080            0.0.0.0:*               LISTEN      -\n", "")
+}
+
+func TestGetRemoteForwardFailedReason(t *testing.T) {
+	assert := assert.New(t)
+	// without the preflight, no command is run on the server, so the nil client is never used
+	assert.Equal("", getRemoteForwardFailedReason(nil, 0, false))
+	assert.Equal(": remote port 80 is privileged, which requires logging in as root", getRemoteForwardFailedReason(nil, 80, false))
+	assert.Equal(": the server refused, which may be forbidden by AllowTcpForwarding, PermitListen or GatewayPorts",
+		getRemoteForwardFailedReason(nil, 8080, false))
+}
+
+func TestHasForwards(t *testing.T) {
+	assert := assert.New(t)
+
+	newArgs := func(options map[string][]string) *sshArgs {
+		if _, ok := options["clearallforwardings"]; !ok {
+			options["clearallforwardings"] = []string{"no"}
+		}
+		return &sshArgs{Destination: "test_has_forwards", Option: sshOption{options}}
+	}
+
+	assert.False(hasForwards(newArgs(map[string][]string{})))
+	assert.True(hasForwards(newArgs(map[string][]string{"dynamicforward": {"1080"}})))
+	assert.True(hasForwards(newArgs(map[string][]string{"localforward": {"8080 127.0.0.1:80"}})))
+	assert.True(hasForwards(newArgs(map[string][]string{"remoteforward": {"8080 127.0.0.1:80"}})))
+	assert.False(hasForwards(newArgs(map[string][]string{"clearallforwardings": {"yes"}, "dynamicforward": {"1080"}})))
+
+	args := newArgs(map[string][]string{})
+	args.LocalForward.cfgs = []*forwardCfg{{argument: "8080:127.0.0.1:80"}}
+	assert.True(hasForwards(args))
+	args.Option.options["clearallforwardings"] = []string{"yes"}
+	assert.False(hasForwards(args))
+}
+
+func TestWatchForwardIdle(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(watchForwardIdle(0, nil))
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	conn := &idleConn{local}
+	go func() { _, _ = io.Copy(io.Discard, remote) }()
+
+	exitCh := make(chan struct{})
+	defer close(exitCh)
+	idleCh := watchForwardIdle(200*time.Millisecond, exitCh)
+	for i := 0; i < 5; i++ {
+		time.Sleep(100 * time.Millisecond)
+		_, err := conn.Write([]byte("x"))
+		assert.Nil(err)
+		select {
+		case <-idleCh:
+			assert.Fail("should not be idle while there is traffic")
+		default:
+		}
+	}
+	select {
+	case <-idleCh:
+	case <-time.After(time.Second):
+		assert.Fail("should be idle without traffic")
+	}
+}
@@ -0,0 +1,226 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// gitMode is enabled when tssh is used as GIT_SSH / GIT_SSH_COMMAND,
+// stdout belongs to the git protocol, and nothing else could be written to it.
+var gitMode bool
+
+// kOpenSSHOptions is the getopt option string of OpenSSH
+const kOpenSSHOptions = "1246ab:c:e:fgi:kl:m:no:p:qstvxAB:CD:E:F:GI:J:KL:MNO:P:Q:R:S:TVw:W:XYy"
+
+// kGitRemoteCommands are the remote commands that git and git-lfs run over ssh
+var kGitRemoteCommands = []string{"git-upload-pack", "git-receive-pack", "git-upload-archive",
+	"git-lfs-authenticate", "git-lfs-transfer"}
+
+// isGitRemoteCommand returns true if the command is run by git over ssh, e.g., git-upload-pack 'repo.git'
+func isGitRemoteCommand(command []string) bool {
+	if len(command) == 0 {
+		return false
+	}
+	fields := strings.Fields(command[0])
+	if len(fields) == 0 {
+		return false
+	}
+	name := strings.Trim(fields[0], `'"`)
+	for _, cmd := range kGitRemoteCommands {
+		if name == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+// translateOpenSSHOption translates an OpenSSH option to the equivalent tssh arguments.
+func translateOpenSSHOption(opt byte, value string) ([]string, error) {
+	option := func(options ...string) []string {
+		var args []string
+		for _, opt := range options {
+			args = append(args, "-o", opt)
+		}
+		return args
+	}
+	switch opt {
+	case '4', '6', 'A', 'a', 'C', 'f', 'G', 'g', 'k', 'N', 'n', 'q', 'T', 't', 'V', 'y':
+		return []string{"-" + string(opt)}, nil
+	case 'D', 'F', 'i', 'J', 'L', 'l', 'O', 'o', 'P', 'p', 'R', 'W':
+		return []string{"-" + string(opt), value}, nil
+	case 'v':
+		return []string{"--debug"}, nil
+	case '2':
+		return nil, nil
+	case 'x':
+		return option("ForwardX11=no"), nil
+	case 'X':
+		return option("ForwardX11=yes"), nil
+	case 'Y':
+		return option("ForwardX11=yes", "ForwardX11Trusted=yes"), nil
+	case 'K':
+		return option("GSSAPIAuthentication=yes", "GSSAPIDelegateCredentials=yes"), nil
+	case 'b':
+		return option("BindAddress=" + value), nil
+	case 'B':
+		return option("BindInterface=" + value), nil
+	case 'c':
+		return option("Ciphers=" + value), nil
+	case 'm':
+		return option("MACs=" + value), nil
+	case 'e':
+		return option("EscapeChar=" + value), nil
+	case 'I':
+		return option("PKCS11Provider=" + value), nil
+	case 'S':
+		return option("ControlPath=" + value), nil
+	case '1':
+		return nil, fmt.Errorf("SSH protocol v.1 is no longer supported")
+	default:
+		return nil, fmt.Errorf("option -%c is not supported", opt)
+	}
+}
+
+// parseOpenSSHArgs parses the arguments the same way as OpenSSH does, and translates them to tssh arguments.
+//
+// The options are allowed both before and after the destination, and the command starts at the second non-option.
+// The tssh long options such as `--debug`, which OpenSSH doesn't have, are passed through.
+func parseOpenSSHArgs(argv []string) (tsshArgv []string, command []string, err error) {
+	dest := ""
+	masters := 0
+	longs := getLongFlags()
+	// keep parsing after an error, to find out the command for the git mode detection
+	fail := func(format string, a ...any) {
+		if err == nil {
+			err = fmt.Errorf(format, a...)
+		}
+	}
+	for i := 0; i < len(argv); i++ {
+		arg := argv[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			if arg == "--" {
+				i++
+			}
+			if i >= len(argv) {
+				break
+			}
+			if dest != "" {
+				command = argv[i:]
+				break
+			}
+			dest = argv[i]
+			continue
+		}
+		if strings.HasPrefix(arg, "--") {
+			name, _, hasValue := strings.Cut(arg[2:], "=")
+			takesValue, ok := longs[name]
+			if !ok {
+				fail("unknown option -- %s", name)
+				continue
+			}
+			tsshArgv = append(tsshArgv, arg)
+			if takesValue && !hasValue {
+				if i+1 >= len(argv) {
+					fail("option requires an argument -- %s", name)
+					continue
+				}
+				i++
+				tsshArgv = append(tsshArgv, argv[i])
+			}
+			continue
+		}
+		for j := 1; j < len(arg); j++ {
+			opt := arg[j]
+			pos := strings.IndexByte(kOpenSSHOptions, opt)
+			if pos < 0 || opt == ':' {
+				fail("unknown option -- %c", opt)
+				continue
+			}
+			if opt == 'M' {
+				masters++
+				continue
+			}
+			value := ""
+			hasValue := pos+1 < len(kOpenSSHOptions) && kOpenSSHOptions[pos+1] == ':'
+			if hasValue {
+				value = arg[j+1:]
+				if value == "" {
+					if i+1 >= len(argv) {
+						fail("option requires an argument -- %c", opt)
+						break
+					}
+					i++
+					value = argv[i]
+				}
+			}
+			args, e := translateOpenSSHOption(opt, value)
+			if e != nil {
+				fail("%v", e)
+			}
+			tsshArgv = append(tsshArgv, args...)
+			if hasValue {
+				break
+			}
+		}
+	}
+
+	switch {
+	case masters == 1:
+		tsshArgv = append(tsshArgv, "-o", "ControlMaster=yes")
+	case masters > 1:
+		tsshArgv = append(tsshArgv, "-o", "ControlMaster=ask")
+	}
+	if dest != "" {
+		tsshArgv = append(tsshArgv, dest)
+	}
+	if len(command) > 0 {
+		tsshArgv = append(append(tsshArgv, "--"), command...)
+	}
+	return tsshArgv, command, err
+}
+
+// setupGitMode enables the git mode if it's forced by the env `TSSH_GIT_MODE`,
+// or the remote command is run by git, and returns the arguments translated from OpenSSH.
+func setupGitMode(argv []string) ([]string, error) {
+	switch strings.ToLower(os.Getenv("TSSH_GIT_MODE")) {
+	case "no":
+		return argv, nil
+	case "yes":
+		gitMode = true
+	}
+	tsshArgv, command, err := parseOpenSSHArgs(argv)
+	if !gitMode && !isGitRemoteCommand(command) {
+		return argv, nil
+	}
+	gitMode = true
+	if err != nil {
+		return nil, err
+	}
+	return tsshArgv, nil
+}
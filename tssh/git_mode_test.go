@@ -0,0 +1,122 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOpenSSHArgs(t *testing.T) {
+	assert := assert.New(t)
+	assertArgs := func(cmdline string, expectedArgv []string, expectedCommand []string) {
+		t.Helper()
+		argv, command, err := parseOpenSSHArgs(strings.Split(cmdline, " "))
+		assert.Nil(err)
+		assert.Equal(expectedArgv, argv)
+		assert.Equal(expectedCommand, command)
+	}
+	assertError := func(cmdline, errMsg string) {
+		t.Helper()
+		_, _, err := parseOpenSSHArgs(strings.Split(cmdline, " "))
+		assert.NotNil(err)
+		assert.Contains(err.Error(), errMsg)
+	}
+
+	assertArgs("host", []string{"host"}, nil)
+	assertArgs("-o SendEnv=GIT_PROTOCOL host git-upload-pack",
+		[]string{"-o", "SendEnv=GIT_PROTOCOL", "host", "--", "git-upload-pack"}, []string{"git-upload-pack"})
+	assertArgs("-p 2222 -4 host git-receive-pack 'repo.git'",
+		[]string{"-p", "2222", "-4", "host", "--", "git-receive-pack", "'repo.git'"},
+		[]string{"git-receive-pack", "'repo.git'"})
+	assertArgs("host -p2222 -lgit ls -l", []string{"-p", "2222", "-l", "git", "host", "--", "ls", "-l"},
+		[]string{"ls", "-l"})
+	assertArgs("-4Tp 22 host", []string{"-4", "-T", "-p", "22", "host"}, nil)
+	assertArgs("-vv -2 host", []string{"--debug", "--debug", "host"}, nil)
+	assertArgs("-x -Y -K host", []string{"-o", "ForwardX11=no", "-o", "ForwardX11=yes", "-o", "ForwardX11Trusted=yes",
+		"-o", "GSSAPIAuthentication=yes", "-o", "GSSAPIDelegateCredentials=yes", "host"}, nil)
+	assertArgs("-c aes128-ctr -m hmac-sha2-256 -S none host", []string{"-o", "Ciphers=aes128-ctr",
+		"-o", "MACs=hmac-sha2-256", "-o", "ControlPath=none", "host"}, nil)
+	assertArgs("-M host", []string{"-o", "ControlMaster=yes", "host"}, nil)
+	assertArgs("-MM host", []string{"-o", "ControlMaster=ask", "host"}, nil)
+	assertArgs("-- host -p 22", []string{"-p", "22", "host"}, nil)
+	assertArgs("host -- -p 22", []string{"host", "--", "-p", "22"}, []string{"-p", "22"})
+
+	// the tssh long options are passed through
+	assertArgs("--debug host git-upload-pack", []string{"--debug", "host", "--", "git-upload-pack"},
+		[]string{"git-upload-pack"})
+	assertArgs("-p 22 host --reconnect --install-path /opt/bin git-receive-pack",
+		[]string{"-p", "22", "--reconnect", "--install-path", "/opt/bin", "host", "--", "git-receive-pack"},
+		[]string{"git-receive-pack"})
+	assertArgs("--share=ro host", []string{"--share=ro", "host"}, nil)
+
+	assertError("-Z host", "unknown option -- Z")
+	assertError("--unknown host", "unknown option -- unknown")
+	assertError("host --install-path", "option requires an argument -- install-path")
+	assertError("host -p", "option requires an argument -- p")
+	assertError("-1 host", "no longer supported")
+	assertError("-s host sftp", "option -s is not supported")
+
+	_, command, err := parseOpenSSHArgs([]string{"-Z", "host", "git-upload-pack 'repo.git'"})
+	assert.NotNil(err)
+	assert.Equal([]string{"git-upload-pack 'repo.git'"}, command)
+}
+
+func TestIsGitRemoteCommand(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(isGitRemoteCommand([]string{"git-upload-pack '/repo.git'"}))
+	assert.True(isGitRemoteCommand([]string{"git-receive-pack", "'repo.git'"}))
+	assert.True(isGitRemoteCommand([]string{"'git-upload-archive' 'repo.git'"}))
+	assert.True(isGitRemoteCommand([]string{"git-lfs-authenticate 'repo.git' download"}))
+	assert.False(isGitRemoteCommand(nil))
+	assert.False(isGitRemoteCommand([]string{""}))
+	assert.False(isGitRemoteCommand([]string{"git", "status"}))
+	assert.False(isGitRemoteCommand([]string{"ls git-upload-pack"}))
+}
+
+func TestSetupGitMode(t *testing.T) {
+	assert := assert.New(t)
+	t.Setenv("TSSH_GIT_MODE", "")
+	defer func(mode bool) { gitMode = mode }(gitMode)
+
+	gitMode = false
+	argv, err := setupGitMode([]string{"--debug", "host", "ls", "-l"})
+	assert.Nil(err)
+	assert.Equal([]string{"--debug", "host", "ls", "-l"}, argv)
+	assert.False(gitMode)
+
+	argv, err = setupGitMode([]string{"--debug", "-p", "2222", "git@host", "git-upload-pack 'repo.git'"})
+	assert.Nil(err)
+	assert.Equal([]string{"--debug", "-p", "2222", "git@host", "--", "git-upload-pack 'repo.git'"}, argv)
+	assert.True(gitMode)
+
+	gitMode = false
+	_, err = setupGitMode([]string{"--unknown", "git@host", "git-upload-pack 'repo.git'"})
+	assert.EqualError(err, "unknown option -- unknown")
+	assert.True(gitMode)
+}
@@ -0,0 +1,202 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"os"
+	"strings"
+)
+
+const (
+	kLocaleEnUS = "en-US"
+	kLocaleZhCN = "zh-CN"
+)
+
+// localeMessages is the message bundle of the current locale, nil means en-US.
+var localeMessages map[string]string
+
+// kLocaleBundles maps the English messages to the translations, the format verbs must be kept in order.
+var kLocaleBundles = map[string]map[string]string{
+	kLocaleZhCN: kZhCNMessages,
+}
+
+var kZhCNMessages = map[string]string{
+	// the host key warnings
+	kHostKeyChangedWarning: "\033[0;31m@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@\r\n" +
+		"@           警告：远程主机的身份标识已经改变！            @\r\n" +
+		"@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@\r\n" +
+		"有人可能正在做坏事！\r\n" +
+		"有人可能正在窃听你的连接（中间人攻击）！\033[0m\r\n" +
+		"也有可能是主机公钥刚刚被更换了。\r\n" +
+		"远程主机发送的 %s 公钥的指纹是\r\n" +
+		"%s\r\n" +
+		"请联系系统管理员。\r\n" +
+		"在 %s 中添加正确的主机公钥可以消除这个消息。\r\n",
+	// the prompts and warnings
+	"Warning:":                    "警告:",
+	"Please type 'yes' or 'no': ": "请输入 'yes' 或 'no'：",
+	"The authenticity of host '%s' can't be established.\r\n%s key fingerprint is %s.\r\n": "无法确认主机 '%s' 的真实性。\r\n%s 公钥的指纹是 %s。\r\n",
+	"Are you sure you want to continue connecting (yes/no/[fingerprint])? ":                "确定要继续连接吗（yes/no/[指纹]）？",
+	"Please type 'yes', 'no' or the fingerprint: ":                                         "请输入 'yes'、'no' 或者指纹：",
+	"Offending %s key in %s:%d\r\n":                                                        "冲突的 %s 公钥位于 %s:%d\r\n",
+	"Enter passphrase for key '%s': ":                                                      "请输入私钥 '%s' 的密码：",
+	"Add key %s (%s) to agent? ":                                                           "是否将私钥 %s（ %s ）添加到 agent？",
+	"%s@%s's password: ":                                                                   "%s@%s 的密码：",
+	"Permission denied, please try again.\r\n":                                             "认证失败，请重试。\r\n",
+	"%s@%s's password (%d attempts left): ":                                                "%s@%s 的密码（还可以尝试 %d 次）：",
+	"The password of %s@%s has expired and must be changed.\r\n":                           "%s@%s 的密码已过期，必须修改。\r\n",
+	"The new password was rejected by the server, please choose another one.\r\n":          "新密码被服务器拒绝，请换一个新密码。\r\n",
+	"New password: ":                                      "新密码：",
+	"Retype new password: ":                               "再次输入新密码：",
+	"Sorry, passwords do not match.\r\n":                  "两次输入的密码不一致。\r\n",
+	"Update the password configuration of %s? (yes/no): ": "是否更新 %s 的密码配置？(yes/no)：",
+	"[sudo] password for %s: ":                            "[sudo] %s 的密码：",
+	"Allow shared connection to %s? ":                     "是否允许共享到 %s 的连接？",
+	"The terminal type '%s' is unknown on the remote host.\r\nUpload the terminfo entry via tic (yes/no)? ": "远程主机不支持终端类型 '%s'。\r\n是否通过 tic 上传 terminfo（yes/no）？",
+	"The session is shared ( %s ), attach to it by: tssh --attach %d":                                       "会话已共享（ %s ），加入共享会话：tssh --attach %d",
+	"The session to %s is locked after %v of inactivity.":                                                   "到 %s 的会话在 %v 没有操作后已锁定。",
+	"Incorrect lock password.": "锁定密码错误。",
+	"Shortcuts:":               "快捷键：",
+	"Use ← ↓ ↑ → h j k l to navigate, / toggles search, ? toggles help": "使用 ← ↓ ↑ → h j k l 移动，/ 切换搜索，? 切换帮助",
+	"SSH Alias": "SSH 别名",
+	"Permanently added '%s' (%s) to the list of known hosts.":                                 "已将 '%s'（%s）永久添加到已知主机列表中。",
+	"Failed to add the host to the list of known hosts (%s): %v":                              "添加主机到已知主机列表（%s）失败：%v",
+	"Failed to obtain the home directory. Using the current directory as the home directory.": "获取用户主目录失败，使用当前目录作为主目录。",
+	"Pseudo-terminal will not be allocated because stdin is not a terminal.":                  "标准输入不是终端，不会分配伪终端。",
+	"skip the password configuration for %s, which was incorrect before":                      "跳过 %s 的密码配置，它之前被服务器拒绝过",
+	"the password configuration for %s is incorrect, it won't be tried again until changed":   "%s 的密码配置不正确，修改之前不会再尝试",
+	"the password of %s has been changed, please update the password configuration manually":  "%s 的密码已修改，请手动更新密码配置",
+	"!!! [%s] negotiated WEAK algorithms: %s, please upgrade the server !!!":                  "!!! [%s] 协商使用了弱算法：%s，请升级服务器 !!!",
+	"auth method [%s] got no reply in %v, reconnect and skip it":                              "认证方式 [%s] 在 %v 内没有响应，重新连接并跳过它",
+	"the control master of [%s] reaches the MaxSessions limit, open an additional connection": "[%s] 的共享连接已达到 MaxSessions 限制，建立额外的连接",
+	"remote forward [%s] lost, retry every %v":                                                "远程转发 [%s] 已断开，每隔 %v 重试",
+	"remote forward [%s] re-established":                                                      "远程转发 [%s] 已恢复",
+	"only the interactive session could be shared":                                            "只有交互式会话才能共享",
+	"get ssh agent signers failed: %v":                                                        "获取 ssh-agent 的公钥失败：%v",
+	"expect timeout":                                                                          "expect 超时",
+	"SessionLockTimeout requires LockPassword or encLockPassword to unlock the session":       "SessionLockTimeout 需要配置 LockPassword 或 encLockPassword 用于解锁会话",
+	// the error explanations
+	"No explanation for this error, run with --debug for more details.\r\n": "这个错误没有解释，使用 --debug 运行可以查看更多细节。\r\n",
+	"Error code: %d (%s)\r\n": "错误码：%d（%s）\r\n",
+	"Likely cause: %s\r\n":    "可能原因：%s\r\n",
+	"Possible fix: %s\r\n":    "解决方法：%s\r\n",
+	"The host key of the server has changed, it may be reinstalled or someone is doing something nasty.":              "服务器的主机公钥已经改变，可能是重装了系统，也可能有人正在做坏事。",
+	"Verify the new host key with the administrator, then remove the old one from known_hosts.":                       "与管理员确认新的主机公钥，然后从 known_hosts 中删除旧的公钥。",
+	"The host key of the server is unknown and not trusted.":                                                          "服务器的主机公钥是未知的，不受信任。",
+	"Verify the fingerprint and accept it interactively, or set StrictHostKeyChecking to accept-new.":                 "核对指纹后交互式地接受它，或者将 StrictHostKeyChecking 设置为 accept-new。",
+	"The host key does not match HostKeyFingerprint, or is refused by RequiredRSASize or CASignatureAlgorithms.":      "主机公钥与 HostKeyFingerprint 不匹配，或者被 RequiredRSASize 或 CASignatureAlgorithms 拒绝。",
+	"Check the HostKeyFingerprint, RequiredRSASize and CASignatureAlgorithms of the host.":                            "检查该主机的 HostKeyFingerprint、RequiredRSASize 和 CASignatureAlgorithms 配置。",
+	"The passphrase of the private key is incorrect.":                                                                 "私钥的密码不正确。",
+	"Type the passphrase again, or check the Passphrase configuration of the key.":                                    "重新输入密码，或者检查该私钥的 Passphrase 配置。",
+	"The server got no reply for all the auth methods, e.g. a hung keyboard-interactive or agent.":                    "所有认证方式都没有收到服务器的响应，例如 keyboard-interactive 或 ssh-agent 卡住了。",
+	"Increase AuthTimeout, or restrict PreferredAuthentications to the working methods.":                              "增大 AuthTimeout，或者将 PreferredAuthentications 限制为可用的认证方式。",
+	"All the auth methods are denied by the server.":                                                                  "所有认证方式都被服务器拒绝了。",
+	"Check the user, IdentityFile, password and PreferredAuthentications, run with --debug to see the tried methods.": "检查用户名、IdentityFile、密码和 PreferredAuthentications，使用 --debug 运行可以查看尝试过的认证方式。",
+	"The host name could not be resolved.":                                                                            "无法解析主机名。",
+	"Check the spelling of HostName, or the DNS and /etc/hosts of the local machine.":                                 "检查 HostName 是否拼写正确，或者检查本机的 DNS 和 /etc/hosts 配置。",
+	"The DNS server failed or timed out when resolving the host name.":                                                "解析主机名时 DNS 服务器出错或者超时。",
+	"Check the DNS server of the local machine, or use the IP address as HostName.":                                   "检查本机的 DNS 服务器，或者使用 IP 地址作为 HostName。",
+	"The port forwarding failed, or the forwarding specification is invalid.":                                         "端口转发失败，或者转发参数不正确。",
+	"Check the -L -R -D -W arguments, and whether AllowTcpForwarding is enabled on the server.":                       "检查 -L -R -D -W 参数，以及服务器是否开启了 AllowTcpForwarding。",
+	"The server refused to allocate a pseudo-terminal.":                                                               "服务器拒绝分配伪终端。",
+	"Check PermitTTY on the server, or run with -T to disable the pseudo-terminal.":                                   "检查服务器的 PermitTTY 配置，或者使用 -T 禁止分配伪终端。",
+	"The server refused to open a session channel, e.g. MaxSessions is reached.":                                      "服务器拒绝打开会话通道，例如达到了 MaxSessions 限制。",
+	"Check MaxSessions and the restrictions of the authorized key on the server.":                                     "检查服务器的 MaxSessions 配置，以及授权公钥的限制选项。",
+	"The server failed to start the command or the shell.":                                                            "服务器启动命令或 shell 失败。",
+	"Check the login shell of the user and the ForceCommand on the server.":                                           "检查用户的登录 shell 以及服务器的 ForceCommand 配置。",
+	"The connection through the ProxyJump or ProxyCommand failed.":                                                    "通过 ProxyJump 或 ProxyCommand 连接失败。",
+	"Login to the jump host directly to check it, or run the ProxyCommand in the shell.":                              "直接登录跳板机进行检查，或者在 shell 中运行 ProxyCommand。",
+	"Nothing is listening on the port of the server.":                                                                 "服务器的端口上没有程序在监听。",
+	"Check the Port of the host, and whether sshd is running on the server.":                                          "检查该主机的 Port 配置，以及服务器上的 sshd 是否在运行。",
+	"The server is unreachable from the local network.":                                                               "本机网络无法到达服务器。",
+	"Check the network, VPN and route of the local machine.":                                                          "检查本机的网络、VPN 和路由。",
+	"The connection timed out, the server may be down or dropped by a firewall.":                                      "连接超时，服务器可能宕机了，或者被防火墙拦截了。",
+	"Check the firewall and the server, or increase ConnectTimeout.":                                                  "检查防火墙和服务器，或者增大 ConnectTimeout。",
+	"The TCP connection to the server failed or was closed in the handshake.":                                         "到服务器的 TCP 连接失败，或者在握手时被关闭。",
+	"Check the HostName and Port, and the MaxStartups and logs of sshd on the server.":                                "检查 HostName 和 Port，以及服务器上 sshd 的 MaxStartups 配置和日志。",
+	// the lock screen
+	kSessionLockPrompt: "请输入锁定密码以解锁：",
+	// the shortcuts of the picker, aligned by the display width
+	"Confirm  ": "确认并登录",
+	"Quit/Exit": "取消并退出",
+	"Move Prev": "往上移光标",
+	"Move Next": "往下移光标",
+	"Page   Up": "往上翻一页",
+	"Page Down": "往下翻一页",
+	"Goto Home": "跳到第一行",
+	"Goto  End": "跳到最尾行",
+	"EraseKeys": "擦除关键字",
+	"TglSearch": "切换搜索  ",
+	"Tgl  Help": "切换帮助  ",
+	"TglSelect": "切换选中  ",
+	"SelectAll": "全选当前页",
+	"SelectOpp": "反选当前页",
+	"Actions  ": "批量操作  ",
+	"Open Wins": "新窗口登录",
+	"Open Tabs": "新标签登录",
+	"Open Pane": "分屏登录  ",
+}
+
+// normalizeLocale returns the supported locale of the value such as `zh_CN.UTF-8`, `zh-cn` or `en`.
+func normalizeLocale(value string) (string, bool) {
+	locale := strings.ToLower(strings.ReplaceAll(value, "_", "-"))
+	if idx := strings.IndexAny(locale, ".@"); idx >= 0 {
+		locale = locale[:idx]
+	}
+	switch {
+	case locale == "zh" || locale == "zh-cn" || locale == "zh-hans" || locale == "zh-sg":
+		return kLocaleZhCN, true
+	case locale == "en" || strings.HasPrefix(locale, "en-") || locale == "c" || locale == "posix":
+		return kLocaleEnUS, true
+	}
+	return "", false
+}
+
+// setupLocale selects the language of the messages by the env `TSSH_LANG`, or `Language` in ~/.tssh.conf.
+func setupLocale() {
+	value := os.Getenv("TSSH_LANG")
+	if value == "" {
+		value = userConfig.language
+	}
+	if value == "" {
+		return
+	}
+	locale, ok := normalizeLocale(value)
+	if !ok {
+		warning("unsupported language [%s], should be %s or %s", value, kLocaleEnUS, kLocaleZhCN)
+		return
+	}
+	debug("Language = %s", locale)
+	localeMessages = kLocaleBundles[locale]
+}
+
+// tr translates the message to the current locale, or returns it as is if there is no translation.
+func tr(message string) string {
+	if translated, ok := localeMessages[message]; ok {
+		return translated
+	}
+	return message
+}
@@ -0,0 +1,71 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeLocale(t *testing.T) {
+	assert := assert.New(t)
+	assertLocale := func(value, expected string) {
+		t.Helper()
+		locale, ok := normalizeLocale(value)
+		assert.Equal(expected != "", ok)
+		assert.Equal(expected, locale)
+	}
+	assertLocale("zh-CN", kLocaleZhCN)
+	assertLocale("zh_CN.UTF-8", kLocaleZhCN)
+	assertLocale("zh", kLocaleZhCN)
+	assertLocale("zh-Hans", kLocaleZhCN)
+	assertLocale("en-US", kLocaleEnUS)
+	assertLocale("en_GB.UTF-8", kLocaleEnUS)
+	assertLocale("C", kLocaleEnUS)
+	assertLocale("ja_JP.UTF-8", "")
+	assertLocale("zh-TW", "")
+}
+
+func TestTranslate(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { localeMessages = nil }()
+
+	assert.Equal("New password: ", tr("New password: "))
+	localeMessages = kLocaleBundles[kLocaleZhCN]
+	assert.Equal("新密码：", tr("New password: "))
+	assert.Equal("not translated yet", tr("not translated yet"))
+
+	// the translations must keep the same format verbs in the same order
+	verbs := regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+	for locale, bundle := range kLocaleBundles {
+		for message, translated := range bundle {
+			assert.Equal(verbs.FindAllString(message, -1), verbs.FindAllString(translated, -1),
+				"%s: %s => %s", locale, message, translated)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// kDefaultIPQoS is the default of OpenSSH: af21 for interactive sessions and cs1 for bulk traffic.
+const kDefaultIPQoS = "af21 cs1"
+
+// kIPQoSNone means not to set the type of service.
+const kIPQoSNone = -1
+
+var ipQoSValues = map[string]int{
+	"af11": 0x28, "af12": 0x30, "af13": 0x38,
+	"af21": 0x48, "af22": 0x50, "af23": 0x58,
+	"af31": 0x68, "af32": 0x70, "af33": 0x78,
+	"af41": 0x88, "af42": 0x90, "af43": 0x98,
+	"cs0": 0x00, "cs1": 0x20, "cs2": 0x40, "cs3": 0x60,
+	"cs4": 0x80, "cs5": 0xa0, "cs6": 0xc0, "cs7": 0xe0,
+	"ef": 0xb8, "le": 0x04,
+	"lowdelay": 0x10, "throughput": 0x08, "reliability": 0x04,
+	"none": kIPQoSNone,
+}
+
+func parseIPQoSValue(value string) (int, error) {
+	if tos, ok := ipQoSValues[strings.ToLower(value)]; ok {
+		return tos, nil
+	}
+	tos, err := strconv.ParseUint(value, 0, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid IPQoS value: %s", value)
+	}
+	return int(tos), nil
+}
+
+// parseIPQoS parses `IPQoS interactive [bulk]`, the bulk is the same as the interactive if omitted.
+func parseIPQoS(option string) (int, int, error) {
+	fields := strings.Fields(option)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, 0, fmt.Errorf("invalid IPQoS: %s", option)
+	}
+	interactive, err := parseIPQoSValue(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(fields) == 1 {
+		return interactive, interactive, nil
+	}
+	bulk, err := parseIPQoSValue(fields[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return interactive, bulk, nil
+}
+
+// setupIPQoS marks the connection as OpenSSH does, interactive for the sessions with a tty, and bulk for the others
+// such as -N tunnels and file transfers. Only the direct TCP connection is marked, not the one via the proxy.
+func setupIPQoS(args *sshArgs, interactive bool) {
+	conn := unwrapTCPConn(args.tcpConn)
+	if conn == nil {
+		return
+	}
+	option := getOptionConfig(args, "IPQoS")
+	if option == "" {
+		option = kDefaultIPQoS
+	}
+	interactiveTOS, bulkTOS, err := parseIPQoS(option)
+	if err != nil {
+		warning("%v", err)
+		return
+	}
+	tos := bulkTOS
+	if interactive {
+		tos = interactiveTOS
+	}
+	if tos == kIPQoSNone {
+		return
+	}
+	if err := setSocketTOS(conn, tos); err != nil {
+		debug("set IPQoS 0x%02x failed: %v", tos, err)
+		return
+	}
+	debug("set IPQoS 0x%02x, interactive: %v", tos, interactive)
+}
@@ -0,0 +1,60 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIPQoS(t *testing.T) {
+	assert := assert.New(t)
+	assertIPQoS := func(option string, interactive, bulk int) {
+		t.Helper()
+		i, b, err := parseIPQoS(option)
+		assert.Nil(err)
+		assert.Equal(interactive, i)
+		assert.Equal(bulk, b)
+	}
+	assertError := func(option string) {
+		t.Helper()
+		_, _, err := parseIPQoS(option)
+		assert.NotNil(err)
+	}
+
+	assertIPQoS(kDefaultIPQoS, 0x48, 0x20)
+	assertIPQoS("ef", 0xb8, 0xb8)
+	assertIPQoS("lowdelay throughput", 0x10, 0x08)
+	assertIPQoS("AF41 CS0", 0x88, 0x00)
+	assertIPQoS("none cs1", kIPQoSNone, 0x20)
+	assertIPQoS("184 0x20", 0xb8, 0x20)
+
+	assertError("")
+	assertError("af21 cs1 ef")
+	assertError("af99")
+	assertError("ef 256")
+}
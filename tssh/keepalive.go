@@ -0,0 +1,98 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type tcpKeepAlive struct {
+	enabled  bool
+	idle     time.Duration
+	interval time.Duration
+	count    int
+}
+
+// getTCPKeepAlive returns nil if nothing is configured, which keeps the default of Go, i.e., 15 seconds.
+func getTCPKeepAlive(args *sshArgs) *tcpKeepAlive {
+	getValue := func(option string) int {
+		value := getExOptionConfig(args, option)
+		if value == "" {
+			return 0
+		}
+		n, err := strconv.ParseUint(value, 10, 31)
+		if err != nil {
+			warning("%s %s is invalid: %v", option, value, err)
+			return 0
+		}
+		return int(n)
+	}
+
+	enabled := getOptionConfig(args, "TCPKeepAlive")
+	ka := &tcpKeepAlive{
+		enabled:  strings.ToLower(enabled) != "no",
+		idle:     time.Duration(getValue("TCPKeepAliveIdle")) * time.Second,
+		interval: time.Duration(getValue("TCPKeepAliveInterval")) * time.Second,
+		count:    getValue("TCPKeepAliveCount"),
+	}
+	if enabled == "" && ka.idle == 0 && ka.interval == 0 && ka.count == 0 {
+		return nil
+	}
+	return ka
+}
+
+// setupTCPKeepAlive detects the half-open connections by the TCP keepalive probes, which are sent after the
+// connection is idle for TCPKeepAliveIdle, every TCPKeepAliveInterval, and gives up after TCPKeepAliveCount.
+func setupTCPKeepAlive(conn net.Conn, ka *tcpKeepAlive) {
+	if ka == nil {
+		return
+	}
+	tcpConn := unwrapTCPConn(conn)
+	if tcpConn == nil {
+		return
+	}
+	if err := tcpConn.SetKeepAlive(ka.enabled); err != nil {
+		debug("set tcp keepalive failed: %v", err)
+		return
+	}
+	if !ka.enabled {
+		return
+	}
+	if ka.idle > 0 {
+		// it sets the interval to the same as the idle as well
+		if err := tcpConn.SetKeepAlivePeriod(ka.idle); err != nil {
+			debug("set tcp keepalive idle failed: %v", err)
+		}
+	}
+	if ka.interval > 0 || ka.count > 0 {
+		if err := setKeepAliveProbes(tcpConn, ka); err != nil {
+			debug("set tcp keepalive probes failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTCPKeepAlive(t *testing.T) {
+	assert := assert.New(t)
+	originalWarning := warning
+	defer func() {
+		warning = originalWarning
+	}()
+	warning = func(format string, a ...any) {}
+
+	assertKeepAlive := func(enabled, idle, interval, count string, expected *tcpKeepAlive) {
+		t.Helper()
+		args := &sshArgs{Option: sshOption{map[string][]string{
+			"tcpkeepalive":         {enabled},
+			"tcpkeepaliveidle":     {idle},
+			"tcpkeepaliveinterval": {interval},
+			"tcpkeepalivecount":    {count},
+		}}}
+		assert.Equal(expected, getTCPKeepAlive(args))
+	}
+
+	assertKeepAlive("yes", "0", "0", "0", &tcpKeepAlive{enabled: true})
+	assertKeepAlive("no", "0", "0", "0", &tcpKeepAlive{enabled: false})
+	assertKeepAlive("yes", "10", "3", "4", &tcpKeepAlive{true, 10 * time.Second, 3 * time.Second, 4})
+	assertKeepAlive("yes", "30", "x", "-1", &tcpKeepAlive{true, 30 * time.Second, 0, 0})
+}
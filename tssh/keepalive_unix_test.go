@@ -0,0 +1,87 @@
+//go:build !windows && !openbsd
+
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestSetupTCPKeepAlive(t *testing.T) {
+	assert := assert.New(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(err) {
+		return
+	}
+	defer func() { _ = listener.Close() }()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+		}
+	}()
+
+	getSockOpt := func(conn *net.TCPConn, level, opt int) int {
+		t.Helper()
+		rawConn, err := conn.SyscallConn()
+		assert.Nil(err)
+		var value int
+		assert.Nil(rawConn.Control(func(fd uintptr) {
+			value, err = unix.GetsockoptInt(int(fd), level, opt)
+		}))
+		assert.Nil(err)
+		return value
+	}
+
+	for _, warmup := range []bool{false, true} {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if !assert.Nil(err) {
+			return
+		}
+		tcpConn := conn.(*net.TCPConn)
+		if warmup {
+			conn = &warmupConn{Conn: conn, since: time.Now()}
+		}
+		// wrapped as the direct connection in sshConnect
+		setupTCPKeepAlive(&connWithTimeout{conn, time.Second, true}, &tcpKeepAlive{true, 0, 7 * time.Second, 5})
+		assert.NotEqual(0, getSockOpt(tcpConn, unix.SOL_SOCKET, unix.SO_KEEPALIVE))
+		assert.Equal(7, getSockOpt(tcpConn, unix.IPPROTO_TCP, unix.TCP_KEEPINTVL))
+		assert.Equal(5, getSockOpt(tcpConn, unix.IPPROTO_TCP, unix.TCP_KEEPCNT))
+
+		setupTCPKeepAlive(&connWithTimeout{conn, time.Second, true}, &tcpKeepAlive{enabled: false})
+		assert.Equal(0, getSockOpt(tcpConn, unix.SOL_SOCKET, unix.SO_KEEPALIVE))
+		_ = conn.Close()
+	}
+}
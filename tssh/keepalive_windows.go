@@ -0,0 +1,64 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"net"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// setKeepAliveProbes sets the interval by SIO_KEEPALIVE_VALS, and the count is always 10 on Windows.
+func setKeepAliveProbes(conn *net.TCPConn, ka *tcpKeepAlive) error {
+	if ka.interval <= 0 {
+		debug("TCPKeepAliveCount is not supported on Windows")
+		return nil
+	}
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	idle := ka.idle
+	if idle <= 0 {
+		idle = 15 * time.Second
+	}
+	keepalive := windows.TCPKeepalive{
+		OnOff:    1,
+		Time:     uint32(idle.Milliseconds()),
+		Interval: uint32(ka.interval.Milliseconds()),
+	}
+	var sockErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		var bytesReturned uint32
+		sockErr = windows.WSAIoctl(windows.Handle(fd), windows.SIO_KEEPALIVE_VALS, (*byte)(unsafe.Pointer(&keepalive)),
+			uint32(unsafe.Sizeof(keepalive)), nil, 0, &bytesReturned, nil, 0)
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,79 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// the same default as OpenSSH
+const kDefaultRequiredRSASize = 1024
+
+func getRequiredRSASize(args *sshArgs) int {
+	if value := getOptionConfig(args, "RequiredRSASize"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err == nil && size >= kDefaultRequiredRSASize {
+			return size
+		}
+		warning("RequiredRSASize %s is invalid, the minimum is %d", value, kDefaultRequiredRSASize)
+	}
+	return kDefaultRequiredRSASize
+}
+
+// checkKeyStrength refuses the RSA keys which are smaller than the required size.
+func checkKeyStrength(key ssh.PublicKey, requiredSize int) error {
+	if cert, ok := key.(*ssh.Certificate); ok {
+		key = cert.Key
+	}
+	// the keys of ssh-agent such as *agent.Key are only the wire format
+	if _, ok := key.(ssh.CryptoPublicKey); !ok {
+		if parsed, err := ssh.ParsePublicKey(key.Marshal()); err == nil {
+			key = parsed
+		}
+		if cert, ok := key.(*ssh.Certificate); ok {
+			key = cert.Key
+		}
+	}
+	if key.Type() != ssh.KeyAlgoRSA {
+		return nil
+	}
+	cryptoKey, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil
+	}
+	rsaKey, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey)
+	if !ok {
+		return nil
+	}
+	if size := rsaKey.N.BitLen(); size < requiredSize {
+		return fmt.Errorf("RSA key length %d is less than RequiredRSASize %d", size, requiredSize)
+	}
+	return nil
+}
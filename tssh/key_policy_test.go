@@ -0,0 +1,82 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestCheckKeyStrength(t *testing.T) {
+	assert := assert.New(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.Nil(err)
+	rsaPubKey, err := ssh.NewPublicKey(&rsaKey.PublicKey)
+	assert.Nil(err)
+	edPubKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	edSSHPubKey, err := ssh.NewPublicKey(edPubKey)
+	assert.Nil(err)
+
+	assert.Nil(checkKeyStrength(rsaPubKey, 1024))
+	assert.EqualError(checkKeyStrength(rsaPubKey, 2048), "RSA key length 1024 is less than RequiredRSASize 2048")
+	assert.Nil(checkKeyStrength(edSSHPubKey, 4096))
+
+	assert.EqualError(checkKeyStrength(&ssh.Certificate{Key: rsaPubKey}, 3072),
+		"RSA key length 1024 is less than RequiredRSASize 3072")
+
+	keyring := agent.NewKeyring()
+	assert.Nil(keyring.Add(agent.AddedKey{PrivateKey: rsaKey}))
+	agentKeys, err := keyring.List()
+	assert.Nil(err)
+	assert.Len(agentKeys, 1)
+	assert.Nil(checkKeyStrength(agentKeys[0], 1024))
+	assert.EqualError(checkKeyStrength(agentKeys[0], 2048), "RSA key length 1024 is less than RequiredRSASize 2048")
+	agentSigners, err := keyring.Signers()
+	assert.Nil(err)
+	assert.Len(agentSigners, 1)
+	assert.EqualError(checkKeyStrength(agentSigners[0].PublicKey(), 2048),
+		"RSA key length 1024 is less than RequiredRSASize 2048")
+
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	caSigner, err := ssh.NewSignerFromKey(caKey)
+	assert.Nil(err)
+	cert := &ssh.Certificate{Key: rsaPubKey, CertType: ssh.UserCert, ValidBefore: ssh.CertTimeInfinity}
+	assert.Nil(cert.SignCert(rand.Reader, caSigner))
+	keyring = agent.NewKeyring()
+	assert.Nil(keyring.Add(agent.AddedKey{PrivateKey: rsaKey, Certificate: cert}))
+	agentKeys, err = keyring.List()
+	assert.Nil(err)
+	assert.Len(agentKeys, 1)
+	assert.EqualError(checkKeyStrength(agentKeys[0], 2048), "RSA key length 1024 is less than RequiredRSASize 2048")
+}
@@ -0,0 +1,308 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/skeema/knownhosts"
+	"golang.org/x/crypto/ssh"
+)
+
+// knownHostsMutex serializes the goroutines, the lock file serializes the processes.
+var knownHostsMutex sync.Mutex
+
+// lockKnownHosts locks the sidecar lock file, as the known_hosts file is replaced on rewriting.
+func lockKnownHosts(path string) (func(), error) {
+	knownHostsMutex.Lock()
+	file, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		knownHostsMutex.Unlock()
+		return nil, fmt.Errorf("open lock file failed: %v", err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		knownHostsMutex.Unlock()
+		return nil, fmt.Errorf("lock [%s] failed: %v", file.Name(), err)
+	}
+	return func() {
+		_ = unlockFile(file)
+		file.Close()
+		knownHostsMutex.Unlock()
+	}, nil
+}
+
+// rewriteFileAtomically writes data to a temporary file and then renames it to the path.
+func rewriteFileAtomically(path string, data []byte) error {
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	tmpPath := file.Name()
+	defer os.Remove(tmpPath)
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// resolveKnownHostsPath follows the symbolic link, so that the link is not replaced on rewriting.
+func resolveKnownHostsPath(path string) string {
+	if realPath, err := filepath.EvalSymlinks(path); err == nil {
+		return realPath
+	}
+	return path
+}
+
+// parseKnownHostsEntry returns the identity of the entry, or false if the line is corrupted.
+// The keys of unknown types are not parsed, so that they will not be treated as corrupted.
+func parseKnownHostsEntry(line string) (string, bool) {
+	fields := strings.Fields(line)
+	marker := ""
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "@") {
+		marker, fields = fields[0], fields[1:]
+	}
+	if len(fields) < 3 {
+		return "", false
+	}
+	keyType, keyData := fields[1], fields[2]
+	blob, err := base64.StdEncoding.DecodeString(keyData)
+	if err != nil || len(blob) < 4 {
+		return "", false
+	}
+	length := binary.BigEndian.Uint32(blob)
+	if uint32(len(blob)-4) < length || string(blob[4:4+length]) != keyType {
+		return "", false
+	}
+	return strings.Join([]string{marker, fields[0], keyType, keyData}, " "), true
+}
+
+// dedupKnownHosts removes the duplicate and corrupted entries, keeps the comments and the first entries.
+func dedupKnownHosts(data []byte) ([]byte, int, int) {
+	var buf bytes.Buffer
+	seen := make(map[string]struct{})
+	duplicate, corrupted := 0, 0
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			if line != "" {
+				buf.WriteString(line)
+				buf.WriteByte('\n')
+			}
+			continue
+		}
+		entry, ok := parseKnownHostsEntry(trimmed)
+		if !ok {
+			corrupted++
+			continue
+		}
+		if _, ok := seen[entry]; ok {
+			duplicate++
+			continue
+		}
+		seen[entry] = struct{}{}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), duplicate, corrupted
+}
+
+// writeKnownHost appends the host key to the known_hosts file unless it's already added by others.
+func writeKnownHost(path, host string, remote net.Addr, key ssh.PublicKey) error {
+	path = resolveKnownHostsPath(path)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	unlock, err := lockKnownHosts(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var line bytes.Buffer
+	if err := knownhosts.WriteKnownHost(&line, host, remote, key); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if newEntry, ok := parseKnownHostsEntry(line.String()); ok {
+		for _, oldLine := range strings.Split(string(data), "\n") {
+			if entry, ok := parseKnownHostsEntry(oldLine); ok && entry == newEntry {
+				debug("the host key of [%s] is already added to [%s]", host, path)
+				return nil
+			}
+		}
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	return rewriteFileAtomically(path, append(data, line.Bytes()...))
+}
+
+// pruneKnownHosts removes the duplicate and corrupted entries of the known_hosts file.
+func pruneKnownHosts(path string) (int, int, error) {
+	path = resolveKnownHostsPath(path)
+	unlock, err := lockKnownHosts(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	pruned, duplicate, corrupted := dedupKnownHosts(data)
+	if duplicate == 0 && corrupted == 0 {
+		return 0, 0, nil
+	}
+	if err := rewriteFileAtomically(path, pruned); err != nil {
+		return 0, 0, err
+	}
+	return duplicate, corrupted, nil
+}
+
+func execPruneKnownHosts(args *sshArgs) (int, bool) {
+	code := 0
+	for _, path := range getKnownHostsFiles(args, "UserKnownHostsFile") {
+		if !isFileExist(path) {
+			continue
+		}
+		duplicate, corrupted, err := pruneKnownHosts(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "prune [%s] failed: %v\r\n", path, err)
+			code = 10
+			continue
+		}
+		fmt.Printf("%s: removed %d duplicate and %d corrupted entries\r\n", path, duplicate, corrupted)
+	}
+	return code, true
+}
+
+// parseHostKeyFingerprint splits the pinned fingerprint like `ssh-ed25519 SHA256:...` into the optional key type
+// and the fingerprint.
+func parseHostKeyFingerprint(pinned string) (string, string) {
+	fields := strings.Fields(pinned)
+	if len(fields) == 2 {
+		return fields[0], fields[1]
+	}
+	return "", strings.TrimSpace(pinned)
+}
+
+// matchHostKeyFingerprint returns whether the host key matches the fingerprint like `SHA256:...` or `MD5:aa:bb:...`,
+// which could be prefixed with the key type like `ssh-ed25519 SHA256:...`.
+func matchHostKeyFingerprint(key ssh.PublicKey, fingerprint string) (bool, error) {
+	keyType, fingerprint := parseHostKeyFingerprint(fingerprint)
+	keys := []ssh.PublicKey{key}
+	if cert, ok := key.(*ssh.Certificate); ok {
+		keys = append(keys, cert.Key)
+	}
+	if keyType != "" {
+		if keys[len(keys)-1].Type() != keyType {
+			return false, nil
+		}
+		keys = keys[len(keys)-1:]
+	}
+	var format func(ssh.PublicKey) string
+	switch {
+	case strings.HasPrefix(fingerprint, "SHA256:"):
+		fingerprint = strings.TrimRight(fingerprint, "=")
+		format = ssh.FingerprintSHA256
+	case strings.HasPrefix(strings.ToUpper(fingerprint), "MD5:"):
+		fingerprint = strings.ToLower(fingerprint[4:])
+		format = ssh.FingerprintLegacyMD5
+	default:
+		return false, fmt.Errorf("unsupported fingerprint [%s], should be SHA256:... or MD5:...", fingerprint)
+	}
+	for _, k := range keys {
+		if format(k) == fingerprint {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getPinnedHostKeyAlgorithms returns the host key algorithms of the key types of the pinned fingerprints, so that
+// the server doesn't negotiate another host key of it, e.g., ECDSA before the pinned ed25519. It returns nil if
+// any pinned fingerprint has no key type, as the host key of which could be of any type.
+func getPinnedHostKeyAlgorithms(args *sshArgs) []string {
+	var keyTypes []string
+	for _, fingerprint := range getAllExOptionConfig(args, "HostKeyFingerprint") {
+		keyType, _ := parseHostKeyFingerprint(fingerprint)
+		if keyType == "" {
+			return nil
+		}
+		keyTypes = append(keyTypes, keyType)
+	}
+	return expandHostKeyAlgorithms(keyTypes)
+}
+
+// checkPinnedHostKey checks the host key against the `HostKeyFingerprint` pinned in the config, which overrides
+// the known_hosts files. It returns false if there is no fingerprint pinned.
+func checkPinnedHostKey(args *sshArgs, key ssh.PublicKey) (bool, error) {
+	fingerprints := getAllExOptionConfig(args, "HostKeyFingerprint")
+	if len(fingerprints) == 0 {
+		return false, nil
+	}
+	for _, fingerprint := range fingerprints {
+		matched, err := matchHostKeyFingerprint(key, fingerprint)
+		if err != nil {
+			warning("HostKeyFingerprint %v", err)
+			continue
+		}
+		if matched {
+			debug("host key %s %s matches the pinned fingerprint %s", key.Type(), ssh.FingerprintSHA256(key), fingerprint)
+			return true, nil
+		}
+	}
+	return true, fmt.Errorf("host key %s %s does not match the HostKeyFingerprint of %s",
+		key.Type(), ssh.FingerprintSHA256(key), args.Destination)
+}
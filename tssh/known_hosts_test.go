@@ -0,0 +1,238 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/skeema/knownhosts"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestDedupKnownHosts(t *testing.T) {
+	assert := assert.New(t)
+	line1 := "host1 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl"
+	line2 := "@cert-authority *.example.com ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl"
+	unknown := "host2 ssh-unknown AAAAC3NzaC11bmtub3du"
+	data := strings.Join([]string{
+		"# comment",
+		line1,
+		"",
+		line2,
+		line1 + " comment",
+		"host3 ssh-ed25519 AAAAC3NzaC1lZhost4 ssh-rsa AAAAB3NzaC1yc2E",
+		"host5 ssh-rsa AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl",
+		"host6",
+		unknown,
+	}, "\n")
+	pruned, duplicate, corrupted := dedupKnownHosts([]byte(data))
+	assert.Equal(1, duplicate)
+	assert.Equal(3, corrupted)
+	assert.Equal(strings.Join([]string{"# comment", line1, line2, unknown, ""}, "\n"), string(pruned))
+}
+
+func TestWriteKnownHostConcurrently(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	var keys []ssh.PublicKey
+	for i := 0; i < 10; i++ {
+		pubKey, _, err := ed25519.GenerateKey(rand.Reader)
+		assert.Nil(err)
+		key, err := ssh.NewPublicKey(pubKey)
+		assert.Nil(err)
+		keys = append(keys, key)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			host := fmt.Sprintf("host%d:22", i%10)
+			remote := &net.TCPAddr{IP: net.IPv4(127, 0, 0, byte(i%10+1)), Port: 22}
+			assert.Nil(writeKnownHost(path, host, remote, keys[i%10]))
+		}(i)
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	assert.Nil(err)
+	assert.Equal(10, strings.Count(string(data), "\n"))
+	_, duplicate, corrupted := dedupKnownHosts(data)
+	assert.Equal(0, duplicate)
+	assert.Equal(0, corrupted)
+
+	kh, err := knownhosts.New(path)
+	assert.Nil(err)
+	for i := 0; i < 10; i++ {
+		remote := &net.TCPAddr{IP: net.IPv4(127, 0, 0, byte(i+1)), Port: 22}
+		assert.Nil(kh(fmt.Sprintf("host%d:22", i), remote, keys[i]))
+	}
+}
+
+func TestGetKnownHostsFiles(t *testing.T) {
+	assert := assert.New(t)
+	assertFiles := func(value string, expected ...string) {
+		t.Helper()
+		args := &sshArgs{Option: sshOption{map[string][]string{"globalknownhostsfile": {value}}}}
+		assert.Equal(expected, getKnownHostsFiles(args, "GlobalKnownHostsFile"))
+	}
+	assertFiles("none")
+	assertFiles("/etc/ssh/ssh_known_hosts", "/etc/ssh/ssh_known_hosts")
+	assertFiles("/etc/ssh/team_hosts  /etc/ssh/ssh_known_hosts", "/etc/ssh/team_hosts", "/etc/ssh/ssh_known_hosts")
+	assertFiles(`"/data/team hosts" /etc/ssh/ssh_known_hosts`, "/data/team hosts", "/etc/ssh/ssh_known_hosts")
+}
+
+func TestCheckPinnedHostKey(t *testing.T) {
+	assert := assert.New(t)
+	pubKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	key, err := ssh.NewPublicKey(pubKey)
+	assert.Nil(err)
+	sha256 := ssh.FingerprintSHA256(key)
+	md5 := ssh.FingerprintLegacyMD5(key)
+
+	newArgs := func(fingerprints ...string) *sshArgs {
+		return &sshArgs{Destination: "server1", Option: sshOption{map[string][]string{"hostkeyfingerprint": fingerprints}}}
+	}
+	assertPinned := func(matched bool, fingerprints ...string) {
+		t.Helper()
+		pinned, err := checkPinnedHostKey(newArgs(fingerprints...), key)
+		assert.True(pinned)
+		if matched {
+			assert.Nil(err)
+		} else {
+			assert.NotNil(err)
+		}
+	}
+
+	pinned, err := checkPinnedHostKey(newArgs(), key)
+	assert.False(pinned)
+	assert.Nil(err)
+
+	assertPinned(true, sha256)
+	assertPinned(true, sha256+"=")
+	assertPinned(true, "MD5:"+strings.ToUpper(md5))
+	assertPinned(true, "SHA256:rotatedKeyFingerprint", sha256)
+	assertPinned(false, "SHA256:anotherKeyFingerprint")
+	assertPinned(false, md5)
+	assertPinned(true, "ssh-ed25519 "+sha256)
+	assertPinned(true, "ssh-rsa SHA256:rotatedKeyFingerprint", " ssh-ed25519  MD5:"+md5)
+	assertPinned(false, "ecdsa-sha2-nistp256 "+sha256)
+
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	caSigner, err := ssh.NewSignerFromKey(caKey)
+	assert.Nil(err)
+	cert := &ssh.Certificate{Key: key, CertType: ssh.HostCert}
+	assert.Nil(cert.SignCert(rand.Reader, caSigner))
+	matched, err := matchHostKeyFingerprint(cert, sha256)
+	assert.True(matched)
+	assert.Nil(err)
+	matched, err = matchHostKeyFingerprint(cert, "ssh-ed25519 "+sha256)
+	assert.True(matched)
+	assert.Nil(err)
+}
+
+func TestPinnedHostKeyAlgorithms(t *testing.T) {
+	assert := assert.New(t)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(err)
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	var hostKeys []ssh.PublicKey
+	for _, key := range []any{edKey, ecKey, rsaKey} {
+		signer, err := ssh.NewSignerFromKey(key)
+		assert.Nil(err)
+		serverConfig.AddHostKey(signer)
+		hostKeys = append(hostKeys, signer.PublicKey())
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(err) {
+		return
+	}
+	defer func() { _ = listener.Close() }()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				_, _, _, _ = ssh.NewServerConn(conn, serverConfig)
+			}()
+		}
+	}()
+
+	connect := func(fingerprints ...string) error {
+		t.Helper()
+		args := &sshArgs{Destination: "server1", Option: sshOption{map[string][]string{"hostkeyfingerprint": fingerprints}}}
+		config := &ssh.ClientConfig{
+			User:              "test",
+			HostKeyAlgorithms: getPinnedHostKeyAlgorithms(args),
+			HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+				_, err := checkPinnedHostKey(args, key)
+				return err
+			},
+		}
+		client, err := ssh.Dial("tcp", listener.Addr().String(), config)
+		if err == nil {
+			_ = client.Close()
+		}
+		return err
+	}
+
+	edFingerprint := ssh.FingerprintSHA256(hostKeys[0])
+	assert.Nil(connect(ssh.KeyAlgoED25519 + " " + edFingerprint))
+	assert.Nil(connect(ssh.KeyAlgoRSA+" "+ssh.FingerprintSHA256(hostKeys[2]), ssh.KeyAlgoED25519+" "+edFingerprint))
+	assert.Nil(connect(ssh.KeyAlgoECDSA256 + " " + ssh.FingerprintSHA256(hostKeys[1])))
+	assert.Nil(connect(ssh.KeyAlgoRSA + " " + ssh.FingerprintSHA256(hostKeys[2])))
+	// the default order of the host key algorithms prefers ECDSA over the pinned ed25519 without the key type
+	assert.NotNil(connect(edFingerprint))
+	assert.NotNil(connect(ssh.KeyAlgoED25519 + " " + ssh.FingerprintSHA256(hostKeys[1])))
+
+	assert.Nil(getPinnedHostKeyAlgorithms(&sshArgs{}))
+	assert.Equal([]string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA, ssh.KeyAlgoED25519},
+		getPinnedHostKeyAlgorithms(&sshArgs{Option: sshOption{map[string][]string{"hostkeyfingerprint": {
+			"ssh-rsa SHA256:rsa", "ssh-ed25519 MD5:aa:bb"}}}}))
+}
@@ -29,6 +29,7 @@ import (
 	"bufio"
 	"crypto/x509"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -44,24 +45,51 @@ import (
 	"github.com/skeema/knownhosts"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
+	xknownhosts "golang.org/x/crypto/ssh/knownhosts"
 	"golang.org/x/term"
 )
 
 var enableDebugLogging bool = false
 var envbleWarningLogging bool = true
 
+type sysLogger interface {
+	Debug(m string) error
+	Info(m string) error
+	Warning(m string) error
+}
+
+// syslogWriter is set by `-y` to send log information using the syslog, or the Windows Event Log
+var syslogWriter sysLogger
+
 func debug(format string, a ...any) {
 	if !enableDebugLogging {
 		return
 	}
+	if syslogWriter != nil {
+		_ = syslogWriter.Debug(fmt.Sprintf(format, a...))
+		return
+	}
 	fmt.Fprintf(os.Stderr, fmt.Sprintf("\033[0;36mdebug:\033[0m %s\r\n", format), a...)
 }
 
+// audit records the important events such as login and logout in the syslog
+func audit(format string, a ...any) {
+	if syslogWriter != nil {
+		_ = syslogWriter.Info(fmt.Sprintf(format, a...))
+		return
+	}
+	debug(format, a...)
+}
+
 var warning = func(format string, a ...any) {
 	if !envbleWarningLogging {
 		return
 	}
-	fmt.Fprintf(os.Stderr, fmt.Sprintf("\033[0;33mWarning: %s\033[0m\r\n", format), a...)
+	if syslogWriter != nil {
+		_ = syslogWriter.Warning(fmt.Sprintf(tr(format), a...))
+		return
+	}
+	fmt.Fprintf(os.Stderr, fmt.Sprintf("\033[0;33m%s %s\033[0m\r\n", tr("Warning:"), tr(format)), a...)
 }
 
 type loginParam struct {
@@ -115,7 +143,7 @@ func getLoginParam(args *sshArgs) (*loginParam, error) {
 	// login host
 	hostName := getConfig(destHost, "HostName")
 	if hostName != "" {
-		param.host = hostName
+		param.host = expandHostName(hostName, destHost)
 	} else {
 		param.host = destHost
 	}
@@ -171,7 +199,7 @@ func getLoginParam(args *sshArgs) (*loginParam, error) {
 	} else {
 		proxy := getConfig(destHost, "ProxyJump")
 		if proxy != "" {
-			param.proxy = strings.Split(proxy, ",")
+			param.proxy = strings.Split(expandTokens(proxy, args, param, "%hnpr"), ",")
 		} else {
 			command := getConfig(destHost, "ProxyCommand")
 			if command != "" {
@@ -183,11 +211,44 @@ func getLoginParam(args *sshArgs) (*loginParam, error) {
 	return param, nil
 }
 
+func askYesOrNo(prompt string) bool {
+	if batchMode {
+		warning("%v", refusePrompt(prompt))
+		return false
+	}
+	stdin, closer, err := getKeyboardInput()
+	if err != nil {
+		debug("get keyboard input failed: %v", err)
+		return false
+	}
+	defer closer()
+
+	reader := bufio.NewReader(stdin)
+	fmt.Fprint(os.Stderr, prompt)
+	for {
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		switch strings.ToLower(strings.TrimSpace(input)) {
+		case "yes", "y":
+			return true
+		case "no", "n":
+			return false
+		}
+		fmt.Fprint(os.Stderr, tr("Please type 'yes' or 'no': "))
+	}
+}
+
 func addHostKey(path, host string, remote net.Addr, key ssh.PublicKey, ask bool) error {
 	if ask {
 		fingerprint := ssh.FingerprintSHA256(key)
-		fmt.Fprintf(os.Stderr, "The authenticity of host '%s' can't be established.\r\n"+
-			"%s key fingerprint is %s.\r\n", host, key.Type(), fingerprint)
+		if batchMode {
+			return fmt.Errorf("host key verification failed: no known key of '%s' (%s %s) and BatchMode is enabled",
+				host, key.Type(), fingerprint)
+		}
+		fmt.Fprintf(os.Stderr, tr("The authenticity of host '%s' can't be established.\r\n"+
+			"%s key fingerprint is %s.\r\n"), host, key.Type(), fingerprint)
 
 		stdin, closer, err := getKeyboardInput()
 		if err != nil {
@@ -196,7 +257,7 @@ func addHostKey(path, host string, remote net.Addr, key ssh.PublicKey, ask bool)
 		defer closer()
 
 		reader := bufio.NewReader(stdin)
-		fmt.Fprintf(os.Stderr, "Are you sure you want to continue connecting (yes/no/[fingerprint])? ")
+		fmt.Fprint(os.Stderr, tr("Are you sure you want to continue connecting (yes/no/[fingerprint])? "))
 		for {
 			input, err := reader.ReadString('\n')
 			if err != nil {
@@ -212,20 +273,11 @@ func addHostKey(path, host string, remote net.Addr, key ssh.PublicKey, ask bool)
 			} else if input == "no" {
 				return fmt.Errorf("host key not trusted")
 			}
-			fmt.Fprintf(os.Stderr, "Please type 'yes', 'no' or the fingerprint: ")
-		}
-	}
-
-	writeKnownHost := func() error {
-		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
-		if err != nil {
-			return err
+			fmt.Fprint(os.Stderr, tr("Please type 'yes', 'no' or the fingerprint: "))
 		}
-		defer file.Close()
-		return knownhosts.WriteKnownHost(file, host, remote, key)
 	}
 
-	if err := writeKnownHost(); err != nil {
+	if err := writeKnownHost(path, host, remote, key); err != nil {
 		warning("Failed to add the host to the list of known hosts (%s): %v", path, err)
 		return nil
 	}
@@ -234,34 +286,56 @@ func addHostKey(path, host string, remote net.Addr, key ssh.PublicKey, ask bool)
 	return nil
 }
 
+// getKnownHostsFiles returns the paths of UserKnownHostsFile or GlobalKnownHostsFile,
+// multiple paths are separated by spaces, and the paths with spaces can be quoted.
+func getKnownHostsFiles(args *sshArgs, option string) []string {
+	value := getOptionConfig(args, option)
+	if value == "" || strings.ToLower(value) == "none" {
+		return nil
+	}
+	paths, err := splitCommandLine(value)
+	if err != nil {
+		warning("split %s [%s] failed: %v", option, value, err)
+		paths = strings.Fields(value)
+	}
+	for i, path := range paths {
+		paths[i] = resolveHomeDir(path)
+	}
+	return paths
+}
+
+// kHostKeyChangedWarning is the same as OpenSSH, warns that the host key does not match the known_hosts.
+const kHostKeyChangedWarning = "\033[0;31m@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@\r\n" +
+	"@    WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED!     @\r\n" +
+	"@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@\r\n" +
+	"IT IS POSSIBLE THAT SOMEONE IS DOING SOMETHING NASTY!\r\n" +
+	"Someone could be eavesdropping on you right now (man-in-the-middle attack)!\033[0m\r\n" +
+	"It is also possible that a host key has just been changed.\r\n" +
+	"The fingerprint for the %s key sent by the remote host is\r\n" +
+	"%s\r\n" +
+	"Please contact your system administrator.\r\n" +
+	"Add correct host key in %s to get rid of this message.\r\n"
+
 func getHostKeyCallback(args *sshArgs) (ssh.HostKeyCallback, knownhosts.HostKeyCallback, error) {
 	primaryPath := ""
 	var files []string
-	userFile := getOptionConfig(args, "UserKnownHostsFile")
-	if userFile != "" && strings.ToLower(userFile) != "none" {
-		for _, path := range strings.Fields(userFile) {
-			path = resolveHomeDir(path)
-			if primaryPath == "" {
-				primaryPath = path
-			}
-			if isFileExist(path) {
-				files = append(files, path)
-				debug("add UserKnownHostsFile: %s", path)
-			} else {
-				debug("UserKnownHostsFile [%s] does not exist", path)
-			}
+	for _, path := range getKnownHostsFiles(args, "UserKnownHostsFile") {
+		if primaryPath == "" {
+			primaryPath = path
+		}
+		if isFileExist(path) {
+			files = append(files, path)
+			debug("add UserKnownHostsFile: %s", path)
+		} else {
+			debug("UserKnownHostsFile [%s] does not exist", path)
 		}
 	}
-	globalFile := getOptionConfig(args, "GlobalKnownHostsFile")
-	if globalFile != "" {
-		for _, path := range strings.Fields(globalFile) {
-			path = resolveHomeDir(path)
-			if isFileExist(path) {
-				files = append(files, path)
-				debug("add GlobalKnownHostsFile: %s", path)
-			} else {
-				debug("GlobalKnownHostsFile [%s] does not exist", path)
-			}
+	for _, path := range getKnownHostsFiles(args, "GlobalKnownHostsFile") {
+		if isFileExist(path) {
+			files = append(files, path)
+			debug("add GlobalKnownHostsFile: %s", path)
+		} else {
+			debug("GlobalKnownHostsFile [%s] does not exist", path)
 		}
 	}
 
@@ -270,7 +344,19 @@ func getHostKeyCallback(args *sshArgs) (ssh.HostKeyCallback, knownhosts.HostKeyC
 		return nil, nil, fmt.Errorf("new knownhosts failed: %v", err)
 	}
 
+	requiredRSASize := getRequiredRSASize(args)
+	caSignatureAlgos := getCASignatureAlgorithms(args)
 	cb := func(host string, remote net.Addr, key ssh.PublicKey) error {
+		if err := checkKeyStrength(key, requiredRSASize); err != nil {
+			return fmt.Errorf("host key %s %s refused: %v", key.Type(), ssh.FingerprintSHA256(key), err)
+		}
+		if cert, ok := key.(*ssh.Certificate); ok && !isCASignatureAllowed(cert, caSignatureAlgos) {
+			return fmt.Errorf("host certificate %s %s refused: CA signature algorithm is not in CASignatureAlgorithms",
+				key.Type(), ssh.FingerprintSHA256(cert.Key))
+		}
+		if pinned, err := checkPinnedHostKey(args, key); pinned {
+			return err
+		}
 		err := kh(host, remote, key)
 		strictHostKeyChecking := strings.ToLower(getOptionConfig(args, "StrictHostKeyChecking"))
 		if knownhosts.IsHostKeyChanged(err) {
@@ -278,17 +364,14 @@ func getHostKeyCallback(args *sshArgs) (ssh.HostKeyCallback, knownhosts.HostKeyC
 			if path == "" {
 				path = "~/.ssh/known_hosts"
 			}
-			fmt.Fprintf(os.Stderr, "\033[0;31m@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@\r\n"+
-				"@    WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED!     @\r\n"+
-				"@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@\r\n"+
-				"IT IS POSSIBLE THAT SOMEONE IS DOING SOMETHING NASTY!\r\n"+
-				"Someone could be eavesdropping on you right now (man-in-the-middle attack)!\033[0m\r\n"+
-				"It is also possible that a host key has just been changed.\r\n"+
-				"The fingerprint for the %s key sent by the remote host is\r\n"+
-				"%s\r\n"+
-				"Please contact your system administrator.\r\n"+
-				"Add correct host key in %s to get rid of this message.\r\n",
+			fmt.Fprintf(os.Stderr, tr(kHostKeyChangedWarning),
 				key.Type(), ssh.FingerprintSHA256(key), path)
+			var keyErr *xknownhosts.KeyError
+			if errors.As(err, &keyErr) {
+				for _, want := range keyErr.Want {
+					fmt.Fprintf(os.Stderr, tr("Offending %s key in %s:%d\r\n"), want.Key.Type(), want.Filename, want.Line)
+				}
+			}
 		} else if knownhosts.IsHostUnknown(err) && primaryPath != "" {
 			ask := true
 			switch strictHostKeyChecking {
@@ -311,10 +394,14 @@ func getHostKeyCallback(args *sshArgs) (ssh.HostKeyCallback, knownhosts.HostKeyC
 }
 
 type sshSigner struct {
-	path   string
-	priKey []byte
-	pubKey ssh.PublicKey
-	signer ssh.Signer
+	path     string
+	priKey   []byte
+	pubKey   ssh.PublicKey
+	signer   ssh.Signer
+	cache    bool
+	cacheTTL time.Duration
+	// addToAgent is the AddKeysToAgent for the key after it's decrypted
+	addToAgent *addKeysToAgent
 }
 
 func (s *sshSigner) PublicKey() ssh.PublicKey {
@@ -325,7 +412,14 @@ func (s *sshSigner) initSigner() error {
 	if s.signer != nil {
 		return nil
 	}
-	prompt := fmt.Sprintf("Enter passphrase for key '%s': ", s.path)
+	if s.cache {
+		if signer := getCachedSigner(s.pubKey); signer != nil {
+			debug("use the cached decrypted key: %s", s.path)
+			s.signer = signer
+			return nil
+		}
+	}
+	prompt := fmt.Sprintf(tr("Enter passphrase for key '%s': "), s.path)
 	for i := 0; i < 3; i++ {
 		secret, err := readSecret(prompt)
 		if err != nil {
@@ -334,13 +428,21 @@ func (s *sshSigner) initSigner() error {
 		if len(secret) == 0 {
 			continue
 		}
-		s.signer, err = ssh.ParsePrivateKeyWithPassphrase(s.priKey, secret)
+		rawKey, err := parseRawPrivateKeyWithPassphrase(s.priKey, secret)
+		zeroBytes(secret)
 		if err == x509.IncorrectPasswordError {
 			continue
 		}
 		if err != nil {
 			return err
 		}
+		if s.signer, err = ssh.NewSignerFromKey(rawKey); err != nil {
+			return err
+		}
+		if s.cache {
+			cacheSigner(s.pubKey, s.signer, s.cacheTTL)
+		}
+		addKeyToAgent(s.addToAgent, s.path, s.pubKey, rawKey)
 		return nil
 	}
 	return fmt.Errorf("passphrase incorrect")
@@ -372,6 +474,35 @@ func (s *sshSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm str
 	return s.signer.Sign(rand, data)
 }
 
+// getCertSigner returns the signer of the certificate if the certificate file exists.
+func getCertSigner(signer *sshSigner, certPath string) *sshSigner {
+	if !isFileExist(certPath) {
+		return nil
+	}
+	certData, err := os.ReadFile(certPath)
+	if err != nil {
+		warning("read certificate [%s] failed: %v", certPath, err)
+		return nil
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(certData)
+	if err != nil {
+		warning("parse certificate [%s] failed: %v", certPath, err)
+		return nil
+	}
+	cert, ok := pubKey.(*ssh.Certificate)
+	if !ok {
+		warning("parse certificate [%s] failed: not a certificate", certPath)
+		return nil
+	}
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		warning("new certificate signer [%s] failed: %v", certPath, err)
+		return nil
+	}
+	debug("found certificate: %s", certPath)
+	return &sshSigner{path: certPath, pubKey: certSigner.PublicKey(), signer: certSigner}
+}
+
 func newPassphraseSigner(path string, priKey []byte, err *ssh.PassphraseMissingError) *sshSigner {
 	pubKey := err.PublicKey
 	if pubKey == nil {
@@ -404,13 +535,18 @@ func getSigner(dest string, path string) *sshSigner {
 		warning("read private key [%s] failed: %v", path, err)
 		return nil
 	}
-	signer, err := ssh.ParsePrivateKey(privateKey)
+	signer, err := parsePrivateKey(privateKey)
 	if err != nil {
 		if e, ok := err.(*ssh.PassphraseMissingError); ok {
 			if passphrase := getSecretConfig(dest, "Passphrase"); passphrase != "" {
-				signer, err = ssh.ParsePrivateKeyWithPassphrase(privateKey, []byte(passphrase))
+				signer, err = parsePrivateKeyWithPassphrase(privateKey, []byte(passphrase))
 			} else {
-				return newPassphraseSigner(path, privateKey, e)
+				signer := newPassphraseSigner(path, privateKey, e)
+				if signer != nil {
+					signer.cache, signer.cacheTTL = getPassphraseCacheTTL(dest)
+					signer.addToAgent = getAddKeysToAgent(dest)
+				}
+				return signer
 			}
 		}
 		if err != nil {
@@ -422,6 +558,9 @@ func getSigner(dest string, path string) *sshSigner {
 }
 
 func readSecret(prompt string) (secret []byte, err error) {
+	if batchMode {
+		return nil, refusePrompt(prompt)
+	}
 	fmt.Fprintf(os.Stderr, "%s", prompt)
 	defer fmt.Fprintf(os.Stderr, "\r\n")
 
@@ -431,7 +570,9 @@ func readSecret(prompt string) (secret []byte, err error) {
 	}
 	defer closer()
 
-	return term.ReadPassword(int(stdin.Fd()))
+	secret, err = term.ReadPassword(int(stdin.Fd()))
+	lockSecretBuffer(secret)
+	return secret, err
 }
 
 func getPasswordAuthMethod(args *sshArgs, host, user string) ssh.AuthMethod {
@@ -441,24 +582,49 @@ func getPasswordAuthMethod(args *sshArgs, host, user string) ssh.AuthMethod {
 	}
 
 	idx := 0
-	rememberPassword := false
+	maxAttempts := getPasswordPrompts(args)
+	storedPassword := getSecretConfig(args.Destination, "Password")
+	skippedStored := storedPassword != "" && isBadPassword(args.Destination, storedPassword)
+	if skippedStored {
+		storedPassword = ""
+	}
+	maxTries := maxAttempts
+	if storedPassword != "" {
+		// the stored password doesn't take a prompt, and it's retried only if rejected, not on partial success
+		maxTries++
+	}
+	triedStored := false
 	return ssh.RetryableAuthMethod(ssh.PasswordCallback(func() (string, error) {
-		idx++
-		if idx == 1 {
-			if password := getSecretConfig(args.Destination, "Password"); password != "" {
-				rememberPassword = true
+		beginAuthMethod(args, "password")
+		if skippedStored {
+			skippedStored = false
+			warning("skip the password configuration for %s, which was incorrect before", args.Destination)
+		}
+		if storedPassword != "" {
+			if !triedStored {
+				triedStored = true
+				args.pendingPassword = storedPassword
 				debug("trying the password configuration for %s", args.Destination)
-				return password, nil
+				return storedPassword, nil
 			}
-		} else if idx == 2 && rememberPassword {
-			debug("the password configuration for %s is incorrect", args.Destination)
+			if args.pendingPassword != "" {
+				rejectPendingPassword(args)
+			}
+		}
+		idx++
+		prompt := fmt.Sprintf(tr("%s@%s's password: "), user, host)
+		if idx > 1 {
+			fmt.Fprint(os.Stderr, tr("Permission denied, please try again.\r\n"))
+			passwordRetryDelay(idx - 1)
+			prompt = fmt.Sprintf(tr("%s@%s's password (%d attempts left): "), user, host, maxAttempts-idx+1)
 		}
-		secret, err := readSecret(fmt.Sprintf("%s@%s's password: ", user, host))
+		secret, err := readSecret(prompt)
 		if err != nil {
 			return "", err
 		}
+		defer zeroBytes(secret)
 		return string(secret), nil
-	}), 3)
+	}), maxTries)
 }
 
 func readQuestionAnswerConfig(dest string, idx int, question string) string {
@@ -485,14 +651,33 @@ func getKeyboardInteractiveAuthMethod(args *sshArgs, host, user string) ssh.Auth
 
 	idx := 0
 	questionSet := make(map[string]struct{})
+	changer := &passwordChanger{args: args, user: user, host: host}
+	matchers := getQuestionMatchers(args)
 	return ssh.RetryableAuthMethod(ssh.KeyboardInteractive(
 		func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			beginAuthMethod(args, "keyboard-interactive")
 			var answers []string
 			for _, question := range questions {
 				idx++
+				answer, ok, err := changer.answer(question)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					answers = append(answers, answer)
+					continue
+				}
 				if _, ok := questionSet[question]; !ok {
 					questionSet[question] = struct{}{}
-					answer := readQuestionAnswerConfig(args.Destination, idx, question)
+					answer, ok, err := matchQuestionAnswer(args, matchers, question)
+					if err != nil {
+						return nil, err
+					}
+					if ok {
+						answers = append(answers, answer)
+						continue
+					}
+					answer = readQuestionAnswerConfig(args.Destination, idx, question)
 					if answer != "" {
 						answers = append(answers, answer)
 						continue
@@ -503,9 +688,10 @@ func getKeyboardInteractiveAuthMethod(args *sshArgs, host, user string) ssh.Auth
 					return nil, err
 				}
 				answers = append(answers, string(secret))
+				zeroBytes(secret)
 			}
 			return answers, nil
-		}), 3)
+		}), getPasswordPrompts(args))
 }
 
 var getDefaultSigners = func() func() []*sshSigner {
@@ -513,12 +699,17 @@ var getDefaultSigners = func() func() []*sshSigner {
 	var signers []*sshSigner
 	return func() []*sshSigner {
 		once.Do(func() {
-			for _, name := range []string{"id_rsa", "id_ecdsa", "id_ecdsa_sk", "id_ed25519", "id_ed25519_sk", "identity"} {
+			// the same order as OpenSSH
+			for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa", "id_ed25519_sk", "id_ecdsa_sk", "id_dsa"} {
 				path := filepath.Join(userHomeDir, ".ssh", name)
 				if !isFileExist(path) {
 					continue
 				}
+				debug("found default identity: %s", path)
 				if signer := getSigner(name, path); signer != nil {
+					if certSigner := getCertSigner(signer, path+"-cert.pub"); certSigner != nil {
+						signers = append(signers, certSigner)
+					}
 					signers = append(signers, signer)
 				}
 			}
@@ -527,7 +718,28 @@ var getDefaultSigners = func() func() []*sshSigner {
 	}
 }()
 
-func getPublicKeysAuthMethod(args *sshArgs) ssh.AuthMethod {
+// getIdentitySigners returns the signers of the identity files, or the default identities if none is configured.
+func getIdentitySigners(args *sshArgs, param *loginParam) ([]*sshSigner, []string) {
+	var fileSigners []*sshSigner
+	var identities []string
+	for _, identity := range append(args.Identity.values, getAllOptionConfig(args, "IdentityFile")...) {
+		identities = append(identities, expandPath(identity, args, param, "%CdhijkLlnpru"))
+	}
+	if len(identities) == 0 {
+		return getDefaultSigners(), identities
+	}
+	for _, identity := range identities {
+		if signer := getSigner(args.Destination, identity); signer != nil {
+			if certSigner := getCertSigner(signer, resolveHomeDir(identity)+"-cert.pub"); certSigner != nil {
+				fileSigners = append(fileSigners, certSigner)
+			}
+			fileSigners = append(fileSigners, signer)
+		}
+	}
+	return fileSigners, identities
+}
+
+func getPublicKeysAuthMethod(args *sshArgs, param *loginParam) ssh.AuthMethod {
 	if strings.ToLower(getOptionConfig(args, "PubkeyAuthentication")) == "no" {
 		debug("disable auth method: public key authentication")
 		return nil
@@ -535,8 +747,13 @@ func getPublicKeysAuthMethod(args *sshArgs) ssh.AuthMethod {
 
 	var pubKeySigners []ssh.Signer
 	fingerprints := make(map[string]struct{})
+	requiredRSASize := getRequiredRSASize(args)
 	addPubKeySigners := func(signers []*sshSigner) {
 		for _, signer := range signers {
+			if err := checkKeyStrength(signer.PublicKey(), requiredRSASize); err != nil {
+				warning("skip identity [%s]: %v", signer.path, err)
+				continue
+			}
 			fingerprint := ssh.FingerprintSHA256(signer.PublicKey())
 			if _, ok := fingerprints[fingerprint]; !ok {
 				if enableDebugLogging {
@@ -548,47 +765,72 @@ func getPublicKeysAuthMethod(args *sshArgs) ssh.AuthMethod {
 		}
 	}
 
+	fileSigners, identities := getIdentitySigners(args, param)
+
+	// only the agent keys which match the identity files are used if IdentitiesOnly is set
+	identitiesOnly := strings.ToLower(getOptionConfig(args, "IdentitiesOnly")) == "yes"
+	identityFingerprints := make(map[string]struct{})
+	for _, signer := range fileSigners {
+		identityFingerprints[ssh.FingerprintSHA256(signer.PublicKey())] = struct{}{}
+	}
+	if identitiesOnly {
+		// the identity file could be a public key, whose private key is held by the agent
+		for _, identity := range identities {
+			for _, path := range []string{resolveHomeDir(identity), resolveHomeDir(identity) + ".pub"} {
+				if data, err := os.ReadFile(path); err == nil {
+					if pubKey, _, _, _, err := ssh.ParseAuthorizedKey(data); err == nil {
+						identityFingerprints[ssh.FingerprintSHA256(pubKey)] = struct{}{}
+					}
+				}
+			}
+		}
+	}
+
 	if agentClient := getAgentClient(args); agentClient != nil {
 		signers, err := agentClient.Signers()
 		if err != nil {
 			warning("get ssh agent signers failed: %v", err)
 		} else {
 			for _, signer := range signers {
+				if identitiesOnly {
+					if _, ok := identityFingerprints[ssh.FingerprintSHA256(signer.PublicKey())]; !ok {
+						debug("skip agent key for IdentitiesOnly: %s %s", signer.PublicKey().Type(),
+							ssh.FingerprintSHA256(signer.PublicKey()))
+						continue
+					}
+				}
 				addPubKeySigners([]*sshSigner{{path: "ssh-agent", pubKey: signer.PublicKey(), signer: signer}})
 			}
 		}
 	}
 
-	identities := append(args.Identity.values, getAllOptionConfig(args, "IdentityFile")...)
-	if len(identities) == 0 {
-		addPubKeySigners(getDefaultSigners())
-	} else {
-		for _, identity := range identities {
-			if signer := getSigner(args.Destination, identity); signer != nil {
-				addPubKeySigners([]*sshSigner{signer})
-			}
-		}
-	}
+	addPubKeySigners(getCommandSigners(args, param))
+	addPubKeySigners(fileSigners)
+	pubKeySigners = filterCertSigners(args, addCommandCertificate(args, pubKeySigners))
 
 	if len(pubKeySigners) == 0 {
 		return nil
 	}
-	return ssh.PublicKeys(pubKeySigners...)
+	return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		beginAuthMethod(args, "publickey")
+		return pubKeySigners, nil
+	})
 }
 
-func getAuthMethods(args *sshArgs, host, user string) []ssh.AuthMethod {
-	var authMethods []ssh.AuthMethod
-	if authMethod := getPublicKeysAuthMethod(args); authMethod != nil {
+func getAuthMethods(args *sshArgs, param *loginParam) []namedAuthMethod {
+	host, user := param.host, param.user
+	var authMethods []namedAuthMethod
+	if authMethod := getPublicKeysAuthMethod(args, param); authMethod != nil {
 		debug("add auth method: public key authentication")
-		authMethods = append(authMethods, authMethod)
+		authMethods = append(authMethods, namedAuthMethod{"publickey", authMethod})
 	}
 	if authMethod := getKeyboardInteractiveAuthMethod(args, host, user); authMethod != nil {
 		debug("add auth method: keyboard interactive authentication")
-		authMethods = append(authMethods, authMethod)
+		authMethods = append(authMethods, namedAuthMethod{"keyboard-interactive", authMethod})
 	}
 	if authMethod := getPasswordAuthMethod(args, host, user); authMethod != nil {
 		debug("add auth method: password authentication")
-		authMethods = append(authMethods, authMethod)
+		authMethods = append(authMethods, namedAuthMethod{"password", authMethod})
 	}
 	return authMethods
 }
@@ -662,6 +904,9 @@ func execProxyCommand(args *sshArgs, param *loginParam) (net.Conn, string, error
 		}
 	}
 	cmd := exec.Command(argv[0], argv[1:]...)
+	if err := setupLocalEnv(args, param, cmd); err != nil {
+		return nil, command, err
+	}
 
 	cmdIn, err := cmd.StdinPipe()
 	if err != nil {
@@ -718,6 +963,40 @@ func (c *connWithTimeout) Read(b []byte) (n int, err error) {
 	return
 }
 
+// unwrapTCPConn returns the TCP connection under the wrappers, or nil if it's not a TCP connection.
+func unwrapTCPConn(conn net.Conn) *net.TCPConn {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c
+		case *connWithTimeout:
+			conn = c.Conn
+		case *warmupConn:
+			conn = c.Conn
+		default:
+			return nil
+		}
+	}
+}
+
+// getDialNetwork returns tcp4 or tcp6 if restricted by `-4`, `-6` or AddressFamily.
+func getDialNetwork(args *sshArgs) string {
+	if args.IPv4Only {
+		return "tcp4"
+	}
+	if args.IPv6Only {
+		return "tcp6"
+	}
+	switch strings.ToLower(getOptionConfig(args, "AddressFamily")) {
+	case "inet":
+		return "tcp4"
+	case "inet6":
+		return "tcp6"
+	default:
+		return "tcp"
+	}
+}
+
 func setupLogLevel(args *sshArgs) func() {
 	previousDebug := enableDebugLogging
 	previousWarning := envbleWarningLogging
@@ -730,6 +1009,11 @@ func setupLogLevel(args *sshArgs) func() {
 		envbleWarningLogging = true
 		return reset
 	}
+	if args.Quiet {
+		enableDebugLogging = false
+		envbleWarningLogging = false
+		return reset
+	}
 	switch strings.ToLower(getOptionConfig(args, "LogLevel")) {
 	case "quiet", "fatal", "error":
 		enableDebugLogging = false
@@ -755,34 +1039,75 @@ func sshConnect(args *sshArgs, client *ssh.Client, proxy string) (*ssh.Client, b
 	resetLogLevel := setupLogLevel(args)
 	defer resetLogLevel()
 
-	if client := connectViaControl(args, param); client != nil {
-		return client, true, nil
+	if !args.skipControl {
+		if client := connectViaControl(args, param); client != nil {
+			return client, true, nil
+		}
 	}
 
-	authMethods := getAuthMethods(args, param.host, param.user)
+	authMethods := getAuthMethods(args, param)
 	cb, kh, err := getHostKeyCallback(args)
 	if err != nil {
 		return nil, false, err
 	}
+	hostKeyAlgos := kh.HostKeyAlgorithms(param.addr)
+	if pinnedAlgos := getPinnedHostKeyAlgorithms(args); len(pinnedAlgos) > 0 {
+		debug("host key algorithms of the pinned fingerprints: %v", pinnedAlgos)
+		hostKeyAlgos = pinnedAlgos
+	}
 	config := &ssh.ClientConfig{
 		User:              param.user,
-		Auth:              authMethods,
-		Timeout:           10 * time.Second,
+		Timeout:           getConnectTimeout(args),
 		HostKeyCallback:   cb,
-		HostKeyAlgorithms: kh.HostKeyAlgorithms(param.addr),
+		HostKeyAlgorithms: hostKeyAlgos,
 		BannerCallback: func(banner string) error {
+			if isBannerSuppressed(args) {
+				debug("suppressed the banner of %d bytes", len(banner))
+				captureBanner(args, "banner", []byte(banner))
+				return nil
+			}
+			if !envbleWarningLogging {
+				return nil
+			}
 			_, err := fmt.Fprint(os.Stderr, strings.ReplaceAll(banner, "\n", "\r\n"))
 			return err
 		},
 	}
 
+	weakPolicy := getWeakAlgorithmsPolicy(args)
+	applyWeakAlgorithmsPolicy(weakPolicy, config)
+
+	authTimeout := getAuthMethodTimeout(args)
+	newClientConn := func(conn net.Conn) (ssh.Conn, <-chan ssh.NewChannel, <-chan *ssh.Request, error) {
+		args.connection = formatConnection(conn)
+		args.tcpConn = conn
+		setupTCPKeepAlive(conn, getTCPKeepAlive(args))
+		var sniffer *kexInitSniffer
+		if weakPolicy == kWeakAlgorithmsWarn {
+			sniffer = &kexInitSniffer{Conn: conn}
+			conn = sniffer
+		}
+		if authTimeout > 0 {
+			args.authWatchdog = newAuthWatchdog(conn, authTimeout)
+			defer args.authWatchdog.stop()
+			conn = args.authWatchdog
+		}
+		ncc, chans, reqs, err := ssh.NewClientConn(conn, param.addr, config)
+		resolvePendingPassword(args, err)
+		if err == nil && sniffer != nil {
+			reportWeakAlgorithms(args, param, config, sniffer)
+		}
+		return ncc, chans, reqs, err
+	}
+
 	proxyConnect := func(client *ssh.Client, proxy string) (*ssh.Client, bool, error) {
+		execPreConnect(args, param, client)
 		debug("login to [%s], addr: %s", args.Destination, param.addr)
 		conn, err := dialWithTimeout(client, "tcp", param.addr, 10*time.Second)
 		if err != nil {
 			return nil, false, fmt.Errorf("proxy [%s] dial tcp [%s] failed: %v", proxy, param.addr, err)
 		}
-		ncc, chans, reqs, err := ssh.NewClientConn(&connWithTimeout{conn, config.Timeout, true}, param.addr, config)
+		ncc, chans, reqs, err := newClientConn(&connWithTimeout{conn, config.Timeout, true})
 		if err != nil {
 			return nil, false, fmt.Errorf("proxy [%s] new conn [%s] failed: %v", proxy, param.addr, err)
 		}
@@ -790,50 +1115,173 @@ func sshConnect(args *sshArgs, client *ssh.Client, proxy string) (*ssh.Client, b
 		return ssh.NewClient(ncc, chans, reqs), false, nil
 	}
 
-	// has parent client
-	if client != nil {
-		return proxyConnect(client, proxy)
-	}
+	connect := func() (*ssh.Client, bool, error) {
+		// has parent client
+		if client != nil {
+			return proxyConnect(client, proxy)
+		}
 
-	// proxy command
-	if param.command != "" {
-		debug("login to [%s], addr: %s", args.Destination, param.addr)
-		conn, cmd, err := execProxyCommand(args, param)
-		if err != nil {
-			return nil, false, fmt.Errorf("exec proxy command [%s] failed: %v", cmd, err)
+		// proxy command
+		if param.command != "" {
+			execPreConnect(args, param, nil)
+			debug("login to [%s], addr: %s", args.Destination, param.addr)
+			conn, cmd, err := execProxyCommand(args, param)
+			if err != nil {
+				return nil, false, fmt.Errorf("exec proxy command [%s] failed: %v", cmd, err)
+			}
+			ncc, chans, reqs, err := newClientConn(conn)
+			if err != nil {
+				return nil, false, fmt.Errorf("proxy command [%s] new conn [%s] failed: %v", cmd, param.addr, err)
+			}
+			debug("login to [%s] success", args.Destination)
+			return ssh.NewClient(ncc, chans, reqs), false, nil
 		}
-		ncc, chans, reqs, err := ssh.NewClientConn(conn, param.addr, config)
+
+		// no proxy
+		if len(param.proxy) == 0 {
+			var conn net.Conn
+			if isWebSocketTransport(args) {
+				debug("login to [%s], addr: %s, transport: websocket", args.Destination, param.addr)
+				conn, err = dialWebSocket(args, param, config.Timeout)
+				if err != nil {
+					return nil, false, err
+				}
+			} else {
+				network := getDialNetwork(args)
+				if conn = takeWarmupConn(network, param.addr); conn != nil {
+					debug("login to [%s], addr: %s, warm up connection", args.Destination, param.addr)
+				} else {
+					execPreConnect(args, param, nil)
+					debug("login to [%s], addr: %s", args.Destination, param.addr)
+					conn, err = dialByProxyAutoConfig(args, network, param.addr, config.Timeout)
+					if err != nil {
+						return nil, false, fmt.Errorf("dial tcp [%s] failed: %v", param.addr, err)
+					}
+				}
+			}
+			ncc, chans, reqs, err := newClientConn(&connWithTimeout{conn, config.Timeout, true})
+			if err != nil {
+				return nil, false, fmt.Errorf("new conn [%s] failed: %v", param.addr, err)
+			}
+			debug("login to [%s] success", args.Destination)
+			return ssh.NewClient(ncc, chans, reqs), false, nil
+		}
+
+		// has proxies
+		proxyClient, proxy, err := connectProxies(param.proxy)
 		if err != nil {
-			return nil, false, fmt.Errorf("proxy command [%s] new conn [%s] failed: %v", cmd, param.addr, err)
+			return nil, false, err
 		}
-		debug("login to [%s] success", args.Destination)
-		return ssh.NewClient(ncc, chans, reqs), false, nil
+		return proxyConnect(proxyClient, proxy)
 	}
 
-	// no proxy
-	if len(param.proxy) == 0 {
-		debug("login to [%s], addr: %s", args.Destination, param.addr)
-		conn, err := net.DialTimeout("tcp", param.addr, config.Timeout)
-		if err != nil {
-			return nil, false, fmt.Errorf("dial tcp [%s] failed: %v", param.addr, err)
+	// skip the auth methods which got no reply from the server, and reconnect
+	skipped := make(map[string]bool)
+	for {
+		config.Auth = nil
+		for _, m := range authMethods {
+			if !skipped[m.name] {
+				config.Auth = append(config.Auth, m.method)
+			}
 		}
-		ncc, chans, reqs, err := ssh.NewClientConn(&connWithTimeout{conn, config.Timeout, true}, param.addr, config)
-		if err != nil {
-			return nil, false, fmt.Errorf("new conn [%s] failed: %v", param.addr, err)
+		args.authWatchdog = nil
+		client, control, err := connect()
+		method, hung := args.authWatchdog.hungMethod()
+		if err == nil || !hung {
+			return client, control, err
 		}
-		debug("login to [%s] success", args.Destination)
-		return ssh.NewClient(ncc, chans, reqs), false, nil
+		if method == "" {
+			// hung before any auth method is tried, e.g., in the key exchange, no method is to be blamed
+			return nil, false, fmt.Errorf("%v: connect timeout, no reply in %v", err, authTimeout)
+		}
+		skipped[method] = true
+		if len(skipped) >= len(authMethods) {
+			return nil, false, fmt.Errorf("%v: no reply in %v for all auth methods", err, authTimeout)
+		}
+		warning("auth method [%s] got no reply in %v, reconnect and skip it", method, authTimeout)
 	}
+}
 
-	// has proxies
-	var proxyClient *ssh.Client
-	for _, proxy = range param.proxy {
-		proxyClient, _, err = sshConnect(&sshArgs{Destination: proxy}, proxyClient, proxy)
+type jumpClient struct {
+	ready  chan struct{}
+	client *ssh.Client
+	err    error
+}
+
+var (
+	jumpClientsMutex sync.Mutex
+	jumpClients      = make(map[string]*jumpClient)
+)
+
+// getJumpClient shares the jump host connection of the same proxy chain within the process,
+// so that many destinations behind the same bastion just open more direct-tcpip channels.
+func getJumpClient(chain string, connect func() (*ssh.Client, error)) (*ssh.Client, error) {
+	jumpClientsMutex.Lock()
+	if jc, ok := jumpClients[chain]; ok {
+		jumpClientsMutex.Unlock()
+		<-jc.ready
+		if jc.err == nil {
+			debug("reuse jump host connection [%s]", chain)
+		}
+		return jc.client, jc.err
+	}
+	jc := &jumpClient{ready: make(chan struct{})}
+	jumpClients[chain] = jc
+	jumpClientsMutex.Unlock()
+
+	jc.client, jc.err = connect()
+	close(jc.ready)
+
+	removeClient := func() {
+		jumpClientsMutex.Lock()
+		defer jumpClientsMutex.Unlock()
+		if jumpClients[chain] == jc {
+			delete(jumpClients, chain)
+		}
+	}
+	if jc.err != nil {
+		removeClient()
+		return nil, jc.err
+	}
+	go func() {
+		_ = jc.client.Wait()
+		removeClient()
+	}()
+	return jc.client, nil
+}
+
+// closeJumpClients closes the shared jump host connections, when all the destinations behind them are done.
+func closeJumpClients() {
+	jumpClientsMutex.Lock()
+	clients := jumpClients
+	jumpClients = make(map[string]*jumpClient)
+	jumpClientsMutex.Unlock()
+	for chain, jc := range clients {
+		<-jc.ready
+		if jc.client != nil {
+			debug("close jump host connection [%s]", chain)
+			_ = jc.client.Close()
+		}
+	}
+}
+
+func connectProxies(proxies []string) (proxyClient *ssh.Client, proxy string, err error) {
+	for i := range proxies {
+		parent := proxyClient
+		proxy = proxies[i]
+		proxyClient, err = getJumpClient(strings.Join(proxies[:i+1], ","), func() (*ssh.Client, error) {
+			args := &sshArgs{Destination: proxy}
+			client, _, err := sshConnect(args, parent, proxy)
+			if err == nil {
+				afterPasswordChanged(args)
+			}
+			return client, err
+		})
 		if err != nil {
-			return nil, false, err
+			return
 		}
 	}
-	return proxyConnect(proxyClient, proxy)
+	return
 }
 
 func keepAlive(client *ssh.Client, args *sshArgs) {
@@ -859,6 +1307,7 @@ func keepAlive(client *ssh.Client, args *sshArgs) {
 		defer t.Stop()
 		n := 0
 		for range t.C {
+			beginTime := time.Now()
 			if _, _, err := client.SendRequest("keepalive@trzsz-ssh", true, nil); err != nil {
 				n++
 				if n >= serverAliveCountMax {
@@ -867,22 +1316,52 @@ func keepAlive(client *ssh.Client, args *sshArgs) {
 				}
 			} else {
 				n = 0
+				keepAliveRTT.Store(int64(time.Since(beginTime)))
 			}
 		}
 	}()
 }
 
-func sshAgentForward(args *sshArgs, client *ssh.Client, session *ssh.Session) {
-	if args.NoForwardAgent || !args.ForwardAgent && strings.ToLower(getOptionConfig(args, "ForwardAgent")) != "yes" {
+// isMaxSessionsError returns whether the session channel is refused as the MaxSessions of the server is reached,
+// sshd refuses it with "open failed" of connect failed, and some other servers refuse it as prohibited.
+func isMaxSessionsError(err error) bool {
+	var openErr *ssh.OpenChannelError
+	if !errors.As(err, &openErr) {
+		return false
+	}
+	return openErr.Reason == ssh.Prohibited || openErr.Reason == ssh.ConnectionFailed && openErr.Message == "open failed"
+}
+
+func sshAgentForward(args *sshArgs, client *ssh.Client, session *ssh.Session, control bool) {
+	if !isAgentForwardEnabled(args) {
 		return
 	}
-	addr := resolveHomeDir(getAgentAddr(args))
-	if addr == "" {
+	if control {
+		// the agent channels opened by the server are handled by the control master,
+		// which forwards them only if it was started with agent forwarding enabled.
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			warning("request agent forwarding via control master failed: %v", err)
+			return
+		}
+		debug("request ssh agent forwarding via control master success")
+		return
+	}
+	addrs := getForwardAgentAddrs(args)
+	if len(addrs) == 0 {
 		warning("forward agent but the socket address is not set")
 		return
 	}
-	if err := forwardToRemote(client, addr); err != nil {
-		warning("forward to agent [%s] failed: %v", addr, err)
+	forwarded := false
+	for _, addr := range addrs {
+		if err := forwardToRemote(client, addr); err != nil {
+			debug("forward to agent [%s] failed: %v", addr, err)
+			continue
+		}
+		forwarded = true
+		break
+	}
+	if !forwarded {
+		warning("forward to agent %v failed", addrs)
 		return
 	}
 	if err := agent.RequestAgentForwarding(session); err != nil {
@@ -915,34 +1394,72 @@ func sshLogin(args *sshArgs, tty bool) (client *ssh.Client, session *ssh.Session
 	if err != nil {
 		return
 	}
+	audit("login to [%s] success", args.Destination)
+	afterPasswordChanged(args)
+
+	// open an additional connection if the control master reaches the MaxSessions limit of the server
+	needSession := args.StdioForward == "" && !args.NoCommand &&
+		args.UploadFile == "" && args.DownloadFile == "" && args.CopyFrom == "" && !args.SpeedTest
+	if control && needSession {
+		session, err = client.NewSession()
+		if err != nil {
+			if !isMaxSessionsError(err) {
+				err = fmt.Errorf("ssh new session failed: %v", err)
+				return
+			}
+			warning("the control master of [%s] reaches the MaxSessions limit, open an additional connection", args.Destination)
+			client.Close()
+			args.skipControl = true
+			if client, control, err = sshConnect(args, nil, ""); err != nil {
+				return
+			}
+			session = nil
+		}
+	}
 
 	// keep alive
 	if !control {
 		keepAlive(client, args)
 	}
 
+	// buffer size of the forwards
+	initForwardBuffer(args)
+
 	// stdio forward
 	if args.StdioForward != "" {
 		return
 	}
 
+	// metrics for tunnels
+	if args.NoCommand && !control {
+		startMetricsServer(args)
+	}
+
 	// ssh forward
-	if !control {
+	if isForwardDelegated(args) {
+		if hasForwards(args) {
+			if err := startForwardMaster(args); err != nil {
+				warning("delegate forwards to openssh failed: %v", err)
+			}
+		}
+	} else if !control {
 		if err = sshForward(client, args); err != nil {
 			return
 		}
 	}
 
-	// no command
-	if args.NoCommand {
+	// no command or parallel file transfer or speed test
+	if args.NoCommand || args.UploadFile != "" || args.DownloadFile != "" || args.CopyFrom != "" || args.SpeedTest {
 		return
 	}
 
 	// new session
-	session, err = client.NewSession()
-	if err != nil {
-		err = fmt.Errorf("ssh new session failed: %v", err)
-		return
+	if session == nil {
+		session, err = client.NewSession()
+		if err != nil {
+			err = fmt.Errorf("ssh new session failed: %v", err)
+			return
+		}
 	}
 
 	// send and set env
@@ -968,22 +1485,24 @@ func sshLogin(args *sshArgs, tty bool) (client *ssh.Client, session *ssh.Session
 	}
 
 	// ssh agent forward
-	if !control {
-		sshAgentForward(args, client, session)
-	}
+	sshAgentForward(args, client, session, control)
 
-	// not terminal or not tty
-	if !isTerminal || !tty {
+	// not tty
+	if !tty {
 		return
 	}
 
-	// request pty session
-	width, height, err := getTerminalSize()
-	if err != nil {
-		err = fmt.Errorf("get terminal size failed: %v", err)
-		return
+	// request pty session, in the default size if it's forced by -tt without a local terminal
+	width, height := 80, 24
+	if isTerminal {
+		width, height, err = getTerminalSize()
+		if err != nil {
+			err = fmt.Errorf("get terminal size failed: %v", err)
+			return
+		}
 	}
-	if err = session.RequestPty("xterm-256color", height, width, ssh.TerminalModes{}); err != nil {
+	width, height = getWindowSize(args, width, height)
+	if err = session.RequestPty(getTerminalType(args, client), height, width, ssh.TerminalModes{}); err != nil {
 		err = fmt.Errorf("request pty failed: %v", err)
 		return
 	}
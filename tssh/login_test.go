@@ -26,9 +26,14 @@ SOFTWARE.
 package tssh
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestParseDestination(t *testing.T) {
@@ -69,3 +74,65 @@ func TestParseDestination(t *testing.T) {
 	assertDestEqual("[fe80::6358:bbae:26f8:7859]:1022", "", "fe80::6358:bbae:26f8:7859", "1022")
 	assertDestEqual("user@[fe80::6358:bbae:26f8:7859]:1022", "user", "fe80::6358:bbae:26f8:7859", "1022")
 }
+
+func TestIsMaxSessionsError(t *testing.T) {
+	assert := assert.New(t)
+	assert.False(isMaxSessionsError(nil))
+	assert.False(isMaxSessionsError(fmt.Errorf("EOF")))
+	assert.True(isMaxSessionsError(&ssh.OpenChannelError{Reason: ssh.ConnectionFailed, Message: "open failed"}))
+	assert.True(isMaxSessionsError(&ssh.OpenChannelError{Reason: ssh.Prohibited, Message: "no more sessions"}))
+	assert.True(isMaxSessionsError(fmt.Errorf("wrapped: %w", &ssh.OpenChannelError{Reason: ssh.Prohibited})))
+	assert.False(isMaxSessionsError(&ssh.OpenChannelError{Reason: ssh.ConnectionFailed, Message: "connect refused"}))
+	assert.False(isMaxSessionsError(&ssh.OpenChannelError{Reason: ssh.UnknownChannelType, Message: "unknown"}))
+}
+
+func TestCloseJumpClients(t *testing.T) {
+	assert := assert.New(t)
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	assert.Nil(err)
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(hostSigner)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					_ = newChannel.Reject(ssh.Prohibited, "no channel")
+				}
+			}()
+		}
+	}()
+
+	connect := func() (*ssh.Client, error) {
+		return ssh.Dial("tcp", listener.Addr().String(),
+			&ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	}
+	client1, err := getJumpClient("test_jump1", connect)
+	assert.Nil(err)
+	client2, err := getJumpClient("test_jump1", connect)
+	assert.Nil(err)
+	assert.Same(client1, client2)
+	client3, err := getJumpClient("test_jump1,test_jump2", connect)
+	assert.Nil(err)
+	assert.NotSame(client1, client3)
+
+	closeJumpClients()
+	assert.NotNil(client1.Wait())
+	assert.NotNil(client3.Wait())
+	jumpClientsMutex.Lock()
+	assert.Empty(jumpClients)
+	jumpClientsMutex.Unlock()
+}
@@ -27,6 +27,7 @@ package tssh
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
@@ -74,11 +75,11 @@ func background(args *sshArgs, dest string) (bool, error) {
 	}
 
 	sleepTime := time.Duration(0)
-	for {
+	for count := 0; ; count++ {
 		cmd := exec.Cmd{
 			Path:   os.Args[0],
 			Args:   newArgs,
-			Env:    env,
+			Env:    append(env, fmt.Sprintf("TRZSZ-SSH-RECONNECT-COUNT=%d", count)),
 			Stderr: os.Stderr,
 		}
 
@@ -91,6 +92,9 @@ func background(args *sshArgs, dest string) (bool, error) {
 
 		beginTime := time.Now()
 		_ = cmd.Wait()
+		if cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == kExitOnIdle {
+			return true, nil
+		}
 		if time.Since(beginTime) < 10*time.Second {
 			if sleepTime < 10*time.Second {
 				sleepTime += time.Second
@@ -145,43 +149,112 @@ func parseCmdAndTTY(args *sshArgs) (cmd string, tty bool, err error) {
 		return
 	}
 
-	if args.DisableTTY && args.ForceTTY {
-		err = fmt.Errorf("cannot specify -t with -T")
-		return
+	requestTTY := args.requestTTY
+	if requestTTY == "" {
+		switch {
+		case args.DisableTTY:
+			requestTTY = "no"
+		case args.ForceTTY:
+			requestTTY = "yes"
+		default:
+			requestTTY = strings.ToLower(getOptionConfig(args, "RequestTTY"))
+		}
 	}
-	if args.DisableTTY {
+	switch requestTTY {
+	case "", "auto":
+		tty = cmd == ""
+	case "no":
 		tty = false
+	case "yes", "force":
+		tty = true
+	default:
+		err = fmt.Errorf("unknown RequestTTY option: %s", requestTTY)
 		return
 	}
-	if args.ForceTTY {
-		tty = true
+
+	// no session for -N and -W
+	if args.NoCommand || args.StdioForward != "" {
+		tty = false
 		return
 	}
 
-	requestTTY := getConfig(args.Destination, "RequestTTY")
-	switch strings.ToLower(requestTTY) {
-	case "", "auto":
-		tty = isTerminal && (cmd == "")
-	case "no":
+	// only force allocates a pty without a local terminal, such as `tssh -tt host sudo ls < /dev/null`
+	if tty && (!isTerminal || args.NoStdin) && requestTTY != "force" {
+		if requestTTY == "yes" {
+			warning("Pseudo-terminal will not be allocated because stdin is not a terminal.")
+		}
 		tty = false
-	case "force":
-		tty = true
-	case "yes":
-		tty = isTerminal
-	default:
-		err = fmt.Errorf("unknown RequestTTY option: %s", requestTTY)
 	}
 	return
 }
 
+// redirectStdinToDevNull redirects stdin from /dev/null for -n, or -f which implies -n.
+func redirectStdinToDevNull() {
+	if devNull, err := os.Open(os.DevNull); err == nil {
+		os.Stdin = devNull
+		isTerminal = false
+	}
+}
+
 func TsshMain() int {
 	var args sshArgs
-	parser := arg.MustParse(&args)
+	argv, e := setupGitMode(os.Args[1:])
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "%v\r\n", e)
+		return kExitConnectionError
+	}
+	argv, requestTTY := preprocessArgs(argv)
+	// stdout belongs to git in git mode, print the usage and errors to stderr
+	parserOut := os.Stdout
+	if gitMode {
+		parserOut = os.Stderr
+	}
+	parser, e := arg.NewParser(arg.Config{Out: parserOut}, &args)
+	if e != nil {
+		fmt.Fprintln(parserOut, e)
+		return -1
+	}
+	parser.MustParse(argv)
+	args.requestTTY = requestTTY
 
 	// debug log
 	if args.Debug {
 		enableDebugLogging = true
 	}
+	if gitMode {
+		debug("git mode is enabled, the arguments are parsed as OpenSSH: %q", argv)
+	}
+
+	// tag for Match tagged
+	if args.Tag != "" {
+		cmdlineTag = args.Tag
+	} else {
+		cmdlineTag = args.Option.get("Tag")
+	}
+
+	// quiet mode
+	if args.Quiet && !args.Debug {
+		envbleWarningLogging = false
+	}
+
+	// send log information using the syslog
+	if args.Syslog {
+		if writer, err := openSyslog(args.Option.get("SyslogFacility")); err != nil {
+			warning("open syslog failed: %v", err)
+		} else {
+			syslogWriter = writer
+		}
+	}
+
+	// redirect stdin from /dev/null
+	if args.NoStdin {
+		redirectStdinToDevNull()
+	}
+
+	// compression is not supported yet
+	if args.Compression {
+		warning("compression is not supported, -C is ignored")
+	}
 
 	// cleanup on exit
 	defer cleanupOnExit()
@@ -211,15 +284,31 @@ func TsshMain() int {
 		return code
 	}
 
+	// print the effective configuration
+	if args.DumpConfig {
+		if args.Destination == "" {
+			parser.WriteHelp(os.Stderr)
+			return 3
+		}
+		args.originalDest = args.Destination
+		if err = dumpConfig(&args, os.Stdout); err != nil {
+			return 7
+		}
+		return 0
+	}
+
 	// choose ssh alias
 	dest := ""
 	quit := false
+	batchMode = strings.ToLower(args.Option.get("BatchMode")) == "yes"
 	if args.Destination == "" {
-		if !isTerminal {
+		if !isTerminal || batchMode || gitMode {
 			parser.WriteHelp(os.Stderr)
 			return 3
 		}
 		dest, quit, err = chooseAlias("")
+	} else if batchMode || gitMode {
+		dest = args.Destination
 	} else {
 		dest, quit, err = predictDestination(args.Destination)
 	}
@@ -231,6 +320,26 @@ func TsshMain() int {
 		return 4
 	}
 
+	// probe the server and exit
+	if args.Probe {
+		args.Destination = dest
+		args.originalDest = dest
+		if err = execProbe(&args, os.Stdout); err != nil {
+			return 8
+		}
+		return 0
+	}
+
+	// send the control command to the tunnel and exit
+	if args.CtlCmd != "" {
+		args.Destination = dest
+		args.originalDest = dest
+		if err = execControlCommand(&args, os.Stdout); err != nil {
+			return 9
+		}
+		return 0
+	}
+
 	// run as background
 	if args.Background {
 		var parent bool
@@ -241,18 +350,78 @@ func TsshMain() int {
 		if parent {
 			return 0
 		}
+		// -f implies -n, the picker and the prompts before are still on the terminal
+		args.NoStdin = true
+		redirectStdinToDevNull()
 	}
 	args.Destination = dest
 	args.originalDest = dest
+	batchMode = isBatchMode(&args)
+
+	// keep the secrets off the disk and out of the logs
+	setupMemoryOnlySecrets(&args)
+
+	// send log information using the configured syslog facility
+	setupSyslog(&args)
 
 	// start ssh program
 	if err = sshStart(&args); err != nil {
-		return 6
+		if err == errExitOnIdle {
+			err = nil
+			audit("connection to [%s] closed on idle", args.Destination)
+			if os.Getenv("TRZSZ-SSH-BG-MONITOR") == "TRUE" {
+				return kExitOnIdle
+			}
+			return 0
+		}
+		if status, ok := getRemoteExitStatus(err); ok {
+			err = nil
+			audit("connection to [%s] closed, exit status %d", args.Destination, status)
+			return status
+		}
+		kind := classifyError(err)
+		if kind != nil {
+			audit("connection to [%s] failed with error code %d: %v", args.Destination, kind.code, err)
+		} else {
+			audit("connection to [%s] failed: %v", args.Destination, err)
+		}
+		if args.Explain {
+			fmt.Fprintf(os.Stderr, "%v\r\n", err)
+			err = nil
+			explainError(os.Stderr, kind)
+		}
+		return getErrorExitStatus(&args, kind)
 	}
+	audit("connection to [%s] closed", args.Destination)
 	return 0
 }
 
+// setupSyslog opens the syslog of `SyslogFacility` for -y, or for the background process whose stderr is lost.
+func setupSyslog(args *sshArgs) {
+	if syslogWriter != nil && args.Option.get("SyslogFacility") != "" {
+		return
+	}
+	facility := getOptionConfig(args, "SyslogFacility")
+	if facility == "" {
+		return
+	}
+	if !args.Syslog && os.Getenv("TRZSZ-SSH-BACKGROUND") != "TRUE" {
+		return
+	}
+	writer, err := openSyslog(facility)
+	if err != nil {
+		warning("open syslog failed: %v", err)
+		return
+	}
+	syslogWriter = writer
+}
+
 func sshStart(args *sshArgs) error {
+	// console server
+	if addr := getExOptionConfig(args, "ProxyTelnet"); addr != "" {
+		return telnetStart(args, addr)
+	}
+
 	// parse cmd and tty
 	command, tty, err := parseCmdAndTTY(args)
 	if err != nil {
@@ -260,15 +429,20 @@ func sshStart(args *sshArgs) error {
 	}
 
 	// ssh login
+	loginBegin := time.Now()
 	client, session, serverIn, serverOut, serverErr, err := sshLogin(args, tty)
 	if err != nil {
 		return err
 	}
+	loginTime := time.Since(loginBegin)
 	defer client.Close()
 	if session != nil {
 		defer session.Close()
 	}
 
+	// mark the traffic as interactive or bulk
+	setupIPQoS(args, tty && session != nil)
+
 	// stdio forward
 	if args.StdioForward != "" {
 		var wg *sync.WaitGroup
@@ -281,29 +455,114 @@ func sshStart(args *sshArgs) error {
 		return nil
 	}
 
+	// parallel file transfer
+	if args.UploadFile != "" {
+		return execUploadFile(args, client)
+	}
+	if args.DownloadFile != "" {
+		return execDownloadFile(args, client)
+	}
+	if args.CopyFrom != "" {
+		return execRemoteCopy(args, client)
+	}
+
+	// latency and throughput test
+	if args.SpeedTest {
+		return execSpeedTest(args, client, loginTime)
+	}
+
 	// no command
 	if args.NoCommand {
+		timeout := getForwardDrainTimeout(args)
+		idle := getExitOnIdle(args)
 		cleanupForGC()
-		_ = client.Wait()
-		return nil
+		return waitTunnelExit(client, timeout, idle)
 	}
 
 	// execute remote tools if necessary
 	execRemoteTools(args, client)
 
+	// roaming session via mosh
+	if command == "" && isTerminal && tty && isMoshEnabled(args) {
+		session.Close()
+		cleanupForGC()
+		return moshStart(args, client)
+	}
+
+	// probe trzsz on the remote in parallel with the shell setup
+	trzszProbe := startTrzszProbe(args, client, tty)
+
 	// run command or start shell
 	if command != "" {
-		if err := session.Start(command); err != nil {
+		sudoCommand, sudoPassword, err := setupSudo(args, command, tty)
+		if err != nil {
+			return err
+		}
+		if err := session.Start(sudoCommand); err != nil {
 			return fmt.Errorf("start command [%s] failed: %v", command, err)
 		}
+		if sudoPassword != nil {
+			if err := writeSudoPassword(serverIn, sudoPassword); err != nil {
+				return fmt.Errorf("write sudo password failed: %v", err)
+			}
+		}
 	} else {
 		if err := session.Shell(); err != nil {
 			return fmt.Errorf("start shell failed: %v", err)
 		}
 	}
 
-	// execute expect interactions if necessary
-	serverOut, serverErr = execExpectInteractions(args, serverIn, serverOut, serverErr)
+	// forward the local signals to the remote command
+	if !tty {
+		defer forwardSignals(session)()
+	}
+
+	// hide the motd of the interactive shell, before the expect interactions see it
+	if command == "" && tty {
+		serverOut = suppressMotd(args, serverOut)
+	}
+
+	// execute expect interactions if necessary, but never in git mode, which would corrupt the git protocol
+	if !gitMode {
+		serverOut, serverErr = execExpectInteractions(args, serverIn, serverOut, serverErr)
+	}
+
+	// run the RemoteRC commands in the interactive shell before handing over to the user
+	if command == "" && tty {
+		serverOut = execRemoteRC(args, serverIn, serverOut)
+	}
+
+	// track the terminal modes, to restore them for the attached clients, and to reset them if the session drops
+	var modes *terminalModes
+	if isTerminal && tty {
+		modes = newTerminalModes()
+		serverOut = io.TeeReader(serverOut, modes)
+		if strings.ToLower(getExOptionConfig(args, "ResetTerminalModes")) != "no" {
+			defer func() {
+				if seq := modes.resetSequence(); seq != "" {
+					debug("reset the terminal modes left by the remote: %q", seq)
+					fmt.Fprint(os.Stdout, seq)
+				}
+			}()
+		}
+	}
+
+	// share the session with other local tssh
+	if args.Share != "" {
+		if isTerminal && tty {
+			serverIn, serverOut, err = shareSession(args, serverIn, serverOut, modes)
+			if err != nil {
+				return err
+			}
+		} else {
+			warning("only the interactive session could be shared")
+		}
+	}
+
+	// lock the session after a period of inactivity
+	if isTerminal && tty {
+		serverIn, serverOut = lockSession(args, serverIn, serverOut, modes, redrawRemoteScreen(session))
+	}
 
 	// make stdin raw
 	if isTerminal && tty {
@@ -315,15 +574,15 @@ func sshStart(args *sshArgs) error {
 	}
 
 	// enable trzsz
-	if err := enableTrzsz(args, client, session, serverIn, serverOut, serverErr, tty); err != nil {
+	if err := enableTrzsz(args, client, session, trzszProbe, serverIn, serverOut, serverErr, tty); err != nil {
 		return err
 	}
 
 	// cleanup and wait for exit
 	cleanupForGC()
-	_ = session.Wait()
+	err = session.Wait()
 	if args.Background {
 		_ = client.Wait()
 	}
-	return nil
+	return err
 }
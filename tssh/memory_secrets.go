@@ -0,0 +1,63 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import "strings"
+
+// memoryOnlySecrets is set by `MemoryOnlySecrets yes`, in which mode the passwords, passphrases and
+// decrypted keys are kept off the disk as far as possible: the core dump is disabled, the memory is locked
+// on Unix (see lockProcessMemory), the secrets are neither logged nor written to the configuration, and the
+// buffers of the entered secrets are wiped after use. The string copies of the secrets, e.g., passed to the
+// ssh library, and the decrypted keys could not be wiped, and are locked only if all the memory is locked.
+var memoryOnlySecrets bool
+
+func setupMemoryOnlySecrets(args *sshArgs) {
+	if strings.ToLower(getExOptionConfig(args, "MemoryOnlySecrets")) != "yes" {
+		return
+	}
+	memoryOnlySecrets = true
+	if err := lockProcessMemory(); err != nil {
+		warning("lock the memory for MemoryOnlySecrets failed, nothing is locked: %v", err)
+		return
+	}
+	debug("memory-only mode for secrets is enabled")
+}
+
+// zeroBytes wipes the secret buffer once it's no longer needed, which doesn't wipe the copies of it, e.g., by string().
+func zeroBytes(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+	unlockSecretBuffer(buf)
+}
+
+// maskSecret returns the placeholder of the secret for logging, which doesn't reveal the length in memory-only mode.
+func maskSecret(secret string) string {
+	if memoryOnlySecrets {
+		return "******"
+	}
+	return strings.Repeat("*", len(secret))
+}
@@ -0,0 +1,81 @@
+//go:build !windows
+
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// memoryAllLocked is set once all the current and future memory of the process is locked by mlockall.
+var memoryAllLocked bool
+
+// lockProcessMemory disables the core dump, and locks all the memory of the process if RLIMIT_MEMLOCK allows,
+// i.e., it's unlimited or we are root. Under a limited RLIMIT_MEMLOCK, e.g., the default 8 MiB for the normal
+// users, mlockall would fail with ENOMEM, so only the buffers of the entered secrets are locked by lockSecretBuffer.
+func lockProcessMemory() error {
+	var rlimit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_CORE, &rlimit); err != nil {
+		return fmt.Errorf("get core dump limit failed: %v", err)
+	}
+	rlimit.Cur = 0
+	if err := unix.Setrlimit(unix.RLIMIT_CORE, &rlimit); err != nil {
+		return fmt.Errorf("disable core dump failed: %v", err)
+	}
+
+	if err := unix.Getrlimit(unix.RLIMIT_MEMLOCK, &rlimit); err == nil && (rlimit.Cur >= 1<<40 || unix.Geteuid() == 0) {
+		err := unix.Mlockall(unix.MCL_CURRENT | unix.MCL_FUTURE)
+		if err == nil {
+			memoryAllLocked = true
+			return nil
+		}
+		debug("mlockall failed: %v", err)
+	}
+	warning("the memory of the process is not locked as RLIMIT_MEMLOCK is limited, MemoryOnlySecrets only locks " +
+		"the buffers of the entered secrets, the other copies may be swapped out, run `ulimit -l unlimited` to lock all")
+	return nil
+}
+
+// lockSecretBuffer locks the buffer of the entered secret into the memory, unless all the memory is locked already.
+func lockSecretBuffer(buf []byte) {
+	if !memoryOnlySecrets || memoryAllLocked || len(buf) == 0 {
+		return
+	}
+	if err := unix.Mlock(buf); err != nil {
+		warning("lock the secret buffer failed, it may be swapped out: %v", err)
+	}
+}
+
+// unlockSecretBuffer unlocks the buffer locked by lockSecretBuffer after it's wiped.
+func unlockSecretBuffer(buf []byte) {
+	if !memoryOnlySecrets || memoryAllLocked || len(buf) == 0 {
+		return
+	}
+	_ = unix.Munlock(buf)
+}
@@ -0,0 +1,78 @@
+//go:build !windows
+
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockSecretBuffer(t *testing.T) {
+	assert := assert.New(t)
+	originalWarning := warning
+	originalMemoryOnlySecrets, originalMemoryAllLocked := memoryOnlySecrets, memoryAllLocked
+	defer func() {
+		warning = originalWarning
+		memoryOnlySecrets, memoryAllLocked = originalMemoryOnlySecrets, originalMemoryAllLocked
+	}()
+	var warnings []string
+	warning = func(format string, a ...any) { warnings = append(warnings, fmt.Sprintf(format, a...)) }
+	memoryOnlySecrets, memoryAllLocked = true, false
+
+	getLockedKB := func() int {
+		status, err := os.ReadFile("/proc/self/status")
+		if err != nil {
+			return -1
+		}
+		match := regexp.MustCompile(`VmLck:\s+(\d+) kB`).FindSubmatch(status)
+		if match == nil {
+			return -1
+		}
+		kb, _ := strconv.Atoi(string(match[1]))
+		return kb
+	}
+
+	before := getLockedKB()
+	secret := []byte("secret password")
+	lockSecretBuffer(secret)
+	assert.Empty(warnings)
+	if runtime.GOOS == "linux" && before >= 0 {
+		assert.Greater(getLockedKB(), before)
+	}
+	zeroBytes(secret)
+	assert.Equal(make([]byte, len(secret)), secret)
+	if runtime.GOOS == "linux" && before >= 0 {
+		assert.Equal(before, getLockedKB())
+	}
+}
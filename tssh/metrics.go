@@ -0,0 +1,268 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type forwardMetrics struct {
+	kind     string
+	forward  string
+	sent     atomic.Int64
+	received atomic.Int64
+	active   atomic.Int64
+	total    atomic.Int64
+	mutex    sync.Mutex
+	channels map[*metricsConn]struct{}
+}
+
+// metricsConn counts the bytes of the local side of a forwarded connection.
+type metricsConn struct {
+	net.Conn
+	metrics  *forwardMetrics
+	id       int64
+	begin    time.Time
+	sent     atomic.Int64
+	received atomic.Int64
+	closed   atomic.Bool
+}
+
+func (c *metricsConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.sent.Add(int64(n))
+	c.metrics.sent.Add(int64(n))
+	return n, err
+}
+
+func (c *metricsConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.received.Add(int64(n))
+	c.metrics.received.Add(int64(n))
+	return n, err
+}
+
+func (c *metricsConn) Close() error {
+	if c.closed.CompareAndSwap(false, true) {
+		c.metrics.active.Add(-1)
+		c.metrics.mutex.Lock()
+		delete(c.metrics.channels, c)
+		c.metrics.mutex.Unlock()
+	}
+	return c.Conn.Close()
+}
+
+var (
+	metricsEnabled   bool
+	metricsMutex     sync.Mutex
+	allForwards      []*forwardMetrics
+	keepAliveRTT     atomic.Int64
+	reconnectCount   int
+	metricsStartTime = time.Now()
+)
+
+// newForwardMetrics returns nil if the metrics endpoint is not enabled.
+func newForwardMetrics(kind, forward string) *forwardMetrics {
+	if !metricsEnabled {
+		return nil
+	}
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	for _, m := range allForwards {
+		if m.kind == kind && m.forward == forward {
+			return m
+		}
+	}
+	m := &forwardMetrics{kind: kind, forward: forward, channels: make(map[*metricsConn]struct{})}
+	allForwards = append(allForwards, m)
+	return m
+}
+
+func (m *forwardMetrics) wrap(conn net.Conn) net.Conn {
+	if m == nil {
+		return conn
+	}
+	m.active.Add(1)
+	c := &metricsConn{Conn: conn, metrics: m, id: m.total.Add(1), begin: time.Now()}
+	m.mutex.Lock()
+	m.channels[c] = struct{}{}
+	m.mutex.Unlock()
+	return c
+}
+
+func escapeMetricsLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func writeMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	var b strings.Builder
+	writeHeader := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metricsMutex.Lock()
+	forwards := append([]*forwardMetrics(nil), allForwards...)
+	metricsMutex.Unlock()
+
+	writeForwards := func(name, kind, help string, value func(m *forwardMetrics) int64) {
+		writeHeader(name, kind, help)
+		for _, m := range forwards {
+			fmt.Fprintf(&b, "%s{type=\"%s\",forward=\"%s\"} %d\n", name, m.kind, escapeMetricsLabel(m.forward), value(m))
+		}
+	}
+	writeForwards("tssh_forward_sent_bytes_total", "counter", "Bytes sent from the local side of the forward.",
+		func(m *forwardMetrics) int64 { return m.sent.Load() })
+	writeForwards("tssh_forward_received_bytes_total", "counter", "Bytes received by the local side of the forward.",
+		func(m *forwardMetrics) int64 { return m.received.Load() })
+	writeForwards("tssh_forward_active_channels", "gauge", "Active forwarded connections.",
+		func(m *forwardMetrics) int64 { return m.active.Load() })
+	writeForwards("tssh_forward_channels_total", "counter", "Forwarded connections since started.",
+		func(m *forwardMetrics) int64 { return m.total.Load() })
+
+	writeHeader("tssh_reconnects_total", "counter", "Reconnect times of the background process.")
+	fmt.Fprintf(&b, "tssh_reconnects_total %d\n", reconnectCount)
+	writeHeader("tssh_keepalive_rtt_seconds", "gauge", "Round trip time of the last keepalive.")
+	fmt.Fprintf(&b, "tssh_keepalive_rtt_seconds %g\n", time.Duration(keepAliveRTT.Load()).Seconds())
+	writeHeader("tssh_uptime_seconds", "gauge", "Seconds since the connection started.")
+	fmt.Fprintf(&b, "tssh_uptime_seconds %g\n", time.Since(metricsStartTime).Seconds())
+
+	_, _ = w.Write([]byte(b.String()))
+}
+
+func formatBytes(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value, idx := float64(n), 0
+	for value >= 1024 && idx < len(units)-1 {
+		value, idx = value/1024, idx+1
+	}
+	if idx == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[idx])
+}
+
+// writeStats writes the traffic of each forward and each active channel in a human readable format.
+func writeStats(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	metricsMutex.Lock()
+	forwards := append([]*forwardMetrics(nil), allForwards...)
+	metricsMutex.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "uptime %v, reconnects %d, keepalive rtt %v\n",
+		time.Since(metricsStartTime).Round(time.Second), reconnectCount, time.Duration(keepAliveRTT.Load()))
+	for _, m := range forwards {
+		fmt.Fprintf(&b, "%s %s: %d active, %d total, sent %s, received %s\n", m.kind, m.forward,
+			m.active.Load(), m.total.Load(), formatBytes(m.sent.Load()), formatBytes(m.received.Load()))
+		m.mutex.Lock()
+		channels := make([]*metricsConn, 0, len(m.channels))
+		for c := range m.channels {
+			channels = append(channels, c)
+		}
+		m.mutex.Unlock()
+		sort.Slice(channels, func(i, j int) bool { return channels[i].id < channels[j].id })
+		for _, c := range channels {
+			fmt.Fprintf(&b, "  #%d %s, %v, sent %s, received %s\n", c.id, c.RemoteAddr(),
+				time.Since(c.begin).Round(time.Second), formatBytes(c.sent.Load()), formatBytes(c.received.Load()))
+		}
+	}
+	_, _ = w.Write([]byte(b.String()))
+}
+
+func getMetricsListenAddr(args *sshArgs) string {
+	addr := getExOptionConfig(args, "MetricsListen")
+	if portOnlyRegexp.MatchString(addr) {
+		addr = joinHostPort("127.0.0.1", addr)
+	}
+	return addr
+}
+
+// execControlCommand runs the command of -O on the tunnel of the destination via its `MetricsListen`.
+// The tunnel doesn't serve the stats on the control socket or an escape console, only on `MetricsListen`.
+func execControlCommand(args *sshArgs, writer io.Writer) error {
+	if args.CtlCmd != "stats" {
+		return fmt.Errorf("unsupported control command: %s, only stats is supported", args.CtlCmd)
+	}
+	addr := getMetricsListenAddr(args)
+	if addr == "" {
+		return fmt.Errorf("-O stats requires MetricsListen of %s, the -N tunnel only serves the stats on it, "+
+			"not on the control socket", args.Destination)
+	}
+	if host, port, err := net.SplitHostPort(addr); err == nil && (host == "" || host == "0.0.0.0" || host == "::") {
+		addr = joinHostPort("127.0.0.1", port)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("http://%s/stats", addr))
+	if err != nil {
+		return fmt.Errorf("get stats from [%s] failed, is the -N tunnel running? %v", addr, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get stats from [%s] failed: %s", addr, resp.Status)
+	}
+	_, err = io.Copy(writer, resp.Body)
+	return err
+}
+
+// startMetricsServer serves the Prometheus metrics on `MetricsListen` for -N tunnels.
+func startMetricsServer(args *sshArgs) {
+	addr := getMetricsListenAddr(args)
+	if addr == "" {
+		return
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		warning("metrics listen on [%s] failed: %v", addr, err)
+		return
+	}
+	debug("metrics listen on [%s] success", addr)
+	metricsEnabled = true
+	metricsStartTime = time.Now()
+	if count, err := strconv.Atoi(os.Getenv("TRZSZ-SSH-RECONNECT-COUNT")); err == nil {
+		reconnectCount = count
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", writeMetrics)
+	mux.HandleFunc("/stats", writeStats)
+	go func() {
+		server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		if err := server.Serve(listener); err != nil {
+			debug("metrics server exited: %v", err)
+		}
+	}()
+}
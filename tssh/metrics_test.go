@@ -0,0 +1,79 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardStats(t *testing.T) {
+	assert := assert.New(t)
+	defer func() {
+		metricsEnabled = false
+		allForwards = nil
+	}()
+	metricsEnabled = true
+
+	metrics := newForwardMetrics("local", "8080:localhost:80")
+	local, peer := net.Pipe()
+	conn := metrics.wrap(local)
+	go func() {
+		_, _ = peer.Write([]byte("hello"))
+		buf := make([]byte, 2048)
+		_, _ = peer.Read(buf)
+	}()
+	buf := make([]byte, 5)
+	_, err := conn.Read(buf)
+	assert.Nil(err)
+	_, err = conn.Write(make([]byte, 2048))
+	assert.Nil(err)
+
+	recorder := httptest.NewRecorder()
+	writeStats(recorder, nil)
+	assert.Contains(recorder.Body.String(), "local 8080:localhost:80: 1 active, 1 total, sent 5 B, received 2.0 KB\n")
+	assert.Contains(recorder.Body.String(), "  #1 pipe, 0s, sent 5 B, received 2.0 KB\n")
+
+	conn.Close()
+	recorder = httptest.NewRecorder()
+	writeStats(recorder, nil)
+	assert.Contains(recorder.Body.String(), "local 8080:localhost:80: 0 active, 1 total, sent 5 B, received 2.0 KB\n")
+	assert.NotContains(recorder.Body.String(), "#1")
+}
+
+func TestExecControlCommand(t *testing.T) {
+	assert := assert.New(t)
+	var output strings.Builder
+	assert.EqualError(execControlCommand(&sshArgs{Destination: "server", CtlCmd: "exit"}, &output),
+		"unsupported control command: exit, only stats is supported")
+	assert.EqualError(execControlCommand(&sshArgs{Destination: "server", CtlCmd: "stats"}, &output),
+		"-O stats requires MetricsListen of server, the -N tunnel only serves the stats on it, not on the control socket")
+	assert.Empty(output.String())
+}
@@ -0,0 +1,125 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var moshConnectRegexp = regexp.MustCompile(`MOSH CONNECT (\d+) (\S+)`)
+
+func isMoshEnabled(args *sshArgs) bool {
+	return strings.ToLower(getExOptionConfig(args, "Mosh")) == "yes"
+}
+
+func parseMoshConnect(output string) (string, string, error) {
+	match := moshConnectRegexp.FindStringSubmatch(output)
+	if match == nil {
+		return "", "", fmt.Errorf("mosh connect not found: %s", strings.TrimSpace(output))
+	}
+	return match[1], match[2], nil
+}
+
+func startMoshServer(args *sshArgs, client *ssh.Client) (string, string, error) {
+	command := getExOptionConfig(args, "MoshServer")
+	if command == "" {
+		command = "mosh-server"
+	}
+	command += " new -s -c 256"
+	if port := getExOptionConfig(args, "MoshPort"); port != "" {
+		command += " -p " + port
+	}
+	if locale := getForceLocale(args); locale != "" {
+		command += " -l LANG=" + locale + " -l LC_ALL=" + locale
+	} else if lang := os.Getenv("LANG"); lang != "" {
+		command += " -l LANG=" + lang
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", "", fmt.Errorf("new session for mosh server failed: %v", err)
+	}
+	defer session.Close()
+	debug("start mosh server: %s", command)
+	output, err := session.CombinedOutput(command)
+	if err != nil {
+		return "", "", fmt.Errorf("start mosh server [%s] failed: %v: %s", command, err, strings.TrimSpace(string(output)))
+	}
+	return parseMoshConnect(string(output))
+}
+
+// moshStart starts mosh-server over the established ssh connection,
+// and hands the terminal over to the local mosh-client, so the session survives roaming.
+func moshStart(args *sshArgs, client *ssh.Client) error {
+	param, err := getLoginParam(args)
+	if err != nil {
+		return err
+	}
+	host := getExOptionConfig(args, "MoshHost")
+	if host == "" {
+		host = param.host
+	}
+	ip, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return fmt.Errorf("resolve mosh host [%s] failed: %v", host, err)
+	}
+
+	port, key, err := startMoshServer(args, client)
+	if err != nil {
+		return err
+	}
+	debug("mosh server listening on port %s", port)
+
+	path := getExOptionConfig(args, "MoshClient")
+	if path == "" {
+		path = "mosh-client"
+	}
+	cmd := exec.Command(resolveHomeDir(path), ip.String(), port)
+	if err := setupLocalEnv(args, param, cmd); err != nil {
+		return err
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, "MOSH_KEY="+key)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	debug("exec mosh client: %s %s %s", path, ip.String(), port)
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return fmt.Errorf("exec mosh client [%s] failed: %v", path, err)
+		}
+	}
+	return nil
+}
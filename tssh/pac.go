@@ -0,0 +1,260 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robertkrimen/otto"
+)
+
+// pacScript is a compiled proxy auto-config file, evaluated by the otto JavaScript engine with the
+// PAC functions listed in pacBuiltins.
+type pacScript struct {
+	program *otto.Script
+}
+
+// pacTimeout limits the time of one evaluation, so that an endless loop in the PAC file won't hang the login.
+var pacTimeout = 3 * time.Second
+
+type pacTimeoutError struct{}
+
+func parsePacScript(src string) (*pacScript, error) {
+	program, err := otto.New().Compile("proxy.pac", src)
+	if err != nil {
+		return nil, err
+	}
+	return &pacScript{program: program}, nil
+}
+
+// findProxy calls the FindProxyForURL function in a fresh VM.
+func (s *pacScript) findProxy(url, host string) (result string, err error) {
+	vm := otto.New()
+	for name, builtin := range pacBuiltins {
+		fn := builtin
+		if err := vm.Set(name, func(call otto.FunctionCall) otto.Value {
+			args := make([]string, len(call.ArgumentList))
+			for i, arg := range call.ArgumentList {
+				args[i] = arg.String()
+			}
+			result := fn(args)
+			if result == nil {
+				return otto.NullValue()
+			}
+			value, err := vm.ToValue(result)
+			if err != nil {
+				panic(vm.MakeCustomError("Error", err.Error()))
+			}
+			return value
+		}); err != nil {
+			return "", err
+		}
+	}
+
+	vm.Interrupt = make(chan func(), 1)
+	timer := time.AfterFunc(pacTimeout, func() {
+		vm.Interrupt <- func() { panic(pacTimeoutError{}) }
+	})
+	defer timer.Stop()
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(pacTimeoutError); !ok {
+				panic(r)
+			}
+			err = fmt.Errorf("FindProxyForURL timeout in %v", pacTimeout)
+		}
+	}()
+
+	if _, err := vm.Run(s.program); err != nil {
+		return "", err
+	}
+	fn, err := vm.Get("FindProxyForURL")
+	if err != nil {
+		return "", err
+	}
+	if !fn.IsFunction() {
+		return "", fmt.Errorf("FindProxyForURL is not defined")
+	}
+	value, err := fn.Call(otto.NullValue(), url, host)
+	if err != nil {
+		return "", err
+	}
+	return value.String(), nil
+}
+
+func pacResolve(host string) net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip
+		}
+	}
+	if len(ips) > 0 {
+		return ips[0]
+	}
+	return nil
+}
+
+// pacNow returns the current time, in UTC if the last argument is "GMT", and the other arguments.
+func pacNow(args []string) (time.Time, []string) {
+	if len(args) > 0 && args[len(args)-1] == "GMT" {
+		return time.Now().UTC(), args[:len(args)-1]
+	}
+	return time.Now(), args
+}
+
+var pacBuiltins = map[string]func(args []string) interface{}{
+	"isPlainHostName": func(args []string) interface{} {
+		return len(args) > 0 && !strings.Contains(args[0], ".")
+	},
+	"dnsDomainIs": func(args []string) interface{} {
+		return len(args) > 1 && strings.HasSuffix(strings.ToLower(args[0]), strings.ToLower(args[1]))
+	},
+	"localHostOrDomainIs": func(args []string) interface{} {
+		if len(args) < 2 {
+			return false
+		}
+		host, domain := strings.ToLower(args[0]), strings.ToLower(args[1])
+		return host == domain || !strings.Contains(host, ".") && strings.HasPrefix(domain, host+".")
+	},
+	"isResolvable": func(args []string) interface{} {
+		return len(args) > 0 && pacResolve(args[0]) != nil
+	},
+	"dnsResolve": func(args []string) interface{} {
+		if len(args) > 0 {
+			if ip := pacResolve(args[0]); ip != nil {
+				return ip.String()
+			}
+		}
+		return nil
+	},
+	"myIpAddress": func(args []string) interface{} {
+		if addrs, err := net.InterfaceAddrs(); err == nil {
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+					return ipNet.IP.String()
+				}
+			}
+		}
+		return "127.0.0.1"
+	},
+	"isInNet": func(args []string) interface{} {
+		if len(args) < 3 {
+			return false
+		}
+		ip, pattern, mask := pacResolve(args[0]).To4(), net.ParseIP(args[1]).To4(), net.ParseIP(args[2]).To4()
+		if ip == nil || pattern == nil || mask == nil {
+			return false
+		}
+		return ip.Mask(net.IPMask(mask)).Equal(pattern.Mask(net.IPMask(mask)))
+	},
+	"dnsDomainLevels": func(args []string) interface{} {
+		if len(args) == 0 {
+			return float64(0)
+		}
+		return float64(strings.Count(args[0], "."))
+	},
+	"shExpMatch": func(args []string) interface{} {
+		if len(args) < 2 {
+			return false
+		}
+		expr := regexp.QuoteMeta(args[1])
+		expr = strings.ReplaceAll(strings.ReplaceAll(expr, `\*`, ".*"), `\?`, ".")
+		re, err := regexp.Compile("^" + expr + "$")
+		return err == nil && re.MatchString(args[0])
+	},
+	"weekdayRange": func(args []string) interface{} {
+		now, args := pacNow(args)
+		days := []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+		indexOf := func(day string) int {
+			for i, d := range days {
+				if strings.EqualFold(d, day) {
+					return i
+				}
+			}
+			return -1
+		}
+		if len(args) == 0 {
+			return false
+		}
+		begin, end, today := indexOf(args[0]), indexOf(args[0]), int(now.Weekday())
+		if len(args) > 1 {
+			end = indexOf(args[1])
+		}
+		if begin < 0 || end < 0 {
+			return false
+		}
+		if begin <= end {
+			return begin <= today && today <= end
+		}
+		return today >= begin || today <= end
+	},
+	"timeRange": func(args []string) interface{} {
+		now, args := pacNow(args)
+		values := make([]int, len(args))
+		for i, arg := range args {
+			v, err := strconv.Atoi(arg)
+			if err != nil {
+				return false
+			}
+			values[i] = v
+		}
+		// the omitted minutes and seconds are 0, as the browsers do
+		var begin, end int
+		switch len(values) {
+		case 1:
+			return now.Hour() == values[0]
+		case 2:
+			begin, end = values[0]*3600, values[1]*3600
+		case 4:
+			begin, end = values[0]*3600+values[1]*60, values[2]*3600+values[3]*60
+		case 6:
+			begin, end = values[0]*3600+values[1]*60+values[2], values[3]*3600+values[4]*60+values[5]
+		default:
+			return false
+		}
+		current := now.Hour()*3600 + now.Minute()*60 + now.Second()
+		if begin <= end {
+			return begin <= current && current <= end
+		}
+		return current >= begin || current <= end
+	},
+	"alert": func(args []string) interface{} {
+		debug("pac alert: %s", strings.Join(args, " "))
+		return nil
+	},
+}
@@ -0,0 +1,127 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPacScript(t *testing.T) {
+	assert := assert.New(t)
+	script, err := parsePacScript(`
+		/* corporate proxies */
+		var proxy = "PROXY proxy.corp.com:3128";
+		function isCorp(host) {
+			return dnsDomainIs(host, ".corp.com") || shExpMatch(host, "*.internal.*");
+		}
+		function FindProxyForURL(url, host) {
+			host = host.toLowerCase();
+			if (isPlainHostName(host) || isCorp(host))
+				return "DIRECT";
+			if (isInNet(host, "10.0.0.0", "255.0.0.0")) {
+				return "SOCKS5 socks.corp.com:1080; DIRECT";
+			} else if (url.substring(0, 6) == "ssh://" && host.indexOf("github") >= 0) {
+				return proxy + "; " + "DIRECT";
+			}
+			// the default
+			return host == 'localhost' ? "DIRECT" : proxy;
+		}`)
+	assert.Nil(err)
+
+	assertProxy := func(host, expected string) {
+		t.Helper()
+		result, err := script.findProxy("ssh://"+host+":22/", host)
+		assert.Nil(err)
+		assert.Equal(expected, result)
+	}
+	assertProxy("server1", "DIRECT")
+	assertProxy("dev.corp.com", "DIRECT")
+	assertProxy("db.internal.example.com", "DIRECT")
+	assertProxy("10.1.2.3", "SOCKS5 socks.corp.com:1080; DIRECT")
+	assertProxy("GitHub.com", "PROXY proxy.corp.com:3128; DIRECT")
+	assertProxy("192.168.1.1", "PROXY proxy.corp.com:3128")
+
+	for _, src := range []string{
+		`function FindProxyForURL(url, host) { return "DIRECT"`,
+		`function FindProxyForURL(url, host) { return "DIRECT }`,
+	} {
+		_, err := parsePacScript(src)
+		assert.NotNil(err, src)
+	}
+
+	// the loops, switch, arrays, objects and regular expressions used by the real PAC files
+	script, err = parsePacScript(`
+		var direct = ["*.corp.com", "127.0.0.1"];
+		var proxies = { eu: "PROXY eu.corp.com:3128", us: "PROXY us.corp.com:3128" };
+		function FindProxyForURL(url, host) {
+			for (var i = 0; i < direct.length; i++) {
+				if (shExpMatch(host, direct[i])) return "DIRECT";
+			}
+			var n = 0;
+			while (n < 3) n++;
+			if (/^db\d+\./.test(host)) return "SOCKS5 socks.corp.com:1080";
+			switch (host.split(".").pop()) {
+			case "de":
+			case "fr":
+				return proxies.eu;
+			default:
+				return n == 3 && dnsResolve("") === null ? proxies.us : "DIRECT";
+			}
+		}`)
+	assert.Nil(err)
+	assertProxy("dev.corp.com", "DIRECT")
+	assertProxy("127.0.0.1", "DIRECT")
+	assertProxy("db01.example.com", "SOCKS5 socks.corp.com:1080")
+	assertProxy("shop.example.de", "PROXY eu.corp.com:3128")
+	assertProxy("shop.example.com", "PROXY us.corp.com:3128")
+
+	script, err = parsePacScript(`function FindProxyForURL(url, host) {
+		return weekdayRange("SUN", "SAT") && timeRange(0, 24) ? "DIRECT" : "PROXY proxy.corp.com:3128"; }`)
+	assert.Nil(err)
+	assertProxy("server1", "DIRECT")
+
+	// the runtime errors
+	script, err = parsePacScript(`function FindProxyForURL(url, host) { return undefinedFunction(host); }`)
+	assert.Nil(err)
+	_, err = script.findProxy("ssh://server1:22/", "server1")
+	assert.ErrorContains(err, "undefinedFunction")
+
+	script, err = parsePacScript(`var proxy = "DIRECT";`)
+	assert.Nil(err)
+	_, err = script.findProxy("ssh://server1:22/", "server1")
+	assert.EqualError(err, "FindProxyForURL is not defined")
+
+	// the endless loop is stopped
+	defer func(timeout time.Duration) { pacTimeout = timeout }(pacTimeout)
+	pacTimeout = 100 * time.Millisecond
+	script, err = parsePacScript(`function FindProxyForURL(url, host) { while (true) {} }`)
+	assert.Nil(err)
+	_, err = script.findProxy("ssh://server1:22/", "server1")
+	assert.ErrorContains(err, "FindProxyForURL timeout")
+}
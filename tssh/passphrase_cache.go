@@ -0,0 +1,236 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+type cachedSigner struct {
+	signer ssh.Signer
+	expire time.Time
+}
+
+var (
+	signerCacheMutex sync.Mutex
+	signerCache      = make(map[string]*cachedSigner)
+)
+
+// kDefaultPassphraseCacheTTL is how long the decrypted key is cached by default.
+const kDefaultPassphraseCacheTTL = 5 * time.Minute
+
+// getPassphraseCacheTTL returns whether to cache the decrypted key, and how long.
+func getPassphraseCacheTTL(dest string) (bool, time.Duration) {
+	value := getExConfig(dest, "PassphraseCacheTTL")
+	if value == "" {
+		return true, kDefaultPassphraseCacheTTL
+	}
+	seconds, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		warning("PassphraseCacheTTL %s is invalid: %v", value, err)
+		return true, kDefaultPassphraseCacheTTL
+	}
+	return seconds > 0, time.Duration(seconds) * time.Second
+}
+
+// addKeysToAgent is the `AddKeysToAgent` of OpenSSH, which adds the decrypted key to the ssh agent,
+// so that the other tssh or ssh processes don't ask for the passphrase again.
+type addKeysToAgent struct {
+	ask      bool
+	confirm  bool
+	lifetime time.Duration
+}
+
+// parseTimeInterval parses the time interval of OpenSSH like `300`, `5m` or `1h30m`.
+func parseTimeInterval(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	var total time.Duration
+	for value != "" {
+		i := strings.IndexFunc(value, func(r rune) bool { return r < '0' || r > '9' })
+		if i <= 0 {
+			return 0, fmt.Errorf("invalid time interval")
+		}
+		n, err := strconv.ParseUint(value[:i], 10, 32)
+		if err != nil {
+			return 0, err
+		}
+		unit, ok := map[byte]time.Duration{'s': time.Second, 'S': time.Second, 'm': time.Minute, 'M': time.Minute,
+			'h': time.Hour, 'H': time.Hour, 'd': 24 * time.Hour, 'D': 24 * time.Hour, 'w': 7 * 24 * time.Hour,
+			'W': 7 * 24 * time.Hour}[value[i]]
+		if !ok {
+			return 0, fmt.Errorf("invalid time unit %c", value[i])
+		}
+		total += time.Duration(n) * unit
+		value = value[i+1:]
+	}
+	return total, nil
+}
+
+// getAddKeysToAgent returns the `AddKeysToAgent` of the destination, or nil if it's not enabled. The values are
+// `yes`, `no`, `ask`, `confirm`, optionally followed by a time interval, or a time interval alone, as OpenSSH.
+// The lifetime of the key in the agent is the PassphraseCacheTTL if the time interval is not specified.
+func getAddKeysToAgent(dest string) *addKeysToAgent {
+	value := getConfig(dest, "AddKeysToAgent")
+	fields := strings.Fields(strings.ToLower(value))
+	if len(fields) == 0 || len(fields) > 2 || fields[0] == "no" {
+		return nil
+	}
+	add := &addKeysToAgent{}
+	interval := ""
+	switch fields[0] {
+	case "yes":
+	case "ask":
+		add.ask = true
+	case "confirm":
+		add.confirm = true
+	default:
+		if len(fields) > 1 {
+			warning("AddKeysToAgent %s is invalid", value)
+			return nil
+		}
+		interval = fields[0]
+	}
+	if len(fields) > 1 {
+		interval = fields[1]
+	}
+	if interval != "" {
+		lifetime, err := parseTimeInterval(interval)
+		if err != nil {
+			warning("AddKeysToAgent %s is invalid: %v", value, err)
+			return nil
+		}
+		add.lifetime = lifetime
+	} else if cache, ttl := getPassphraseCacheTTL(dest); cache {
+		add.lifetime = ttl
+	}
+	return add
+}
+
+// addKeyToAgent adds the decrypted key to the ssh agent, which is connected already.
+func addKeyToAgent(add *addKeysToAgent, path string, pubKey ssh.PublicKey, rawKey interface{}) {
+	if add == nil || rawKey == nil {
+		return
+	}
+	client := agentClient
+	if client == nil {
+		debug("no ssh agent to add the key: %s", path)
+		return
+	}
+	if add.ask && !askYesOrNo(fmt.Sprintf(tr("Add key %s (%s) to agent? "), path, ssh.FingerprintSHA256(pubKey))) {
+		return
+	}
+	key := agent.AddedKey{PrivateKey: rawKey, Comment: path, ConfirmBeforeUse: add.confirm,
+		LifetimeSecs: uint32(add.lifetime.Seconds())}
+	if err := client.Add(key); err != nil {
+		warning("add key [%s] to the ssh agent failed: %v", path, err)
+		return
+	}
+	debug("added key [%s] to the ssh agent, lifetime: %v, confirm: %v", path, add.lifetime, add.confirm)
+}
+
+// unlockSharedKeys asks for the passphrases of the encrypted keys of the hosts, and adds them to the ssh agent
+// by AddKeysToAgent, before opening the terminals for the hosts, which would each ask for the same passphrase.
+func unlockSharedKeys(hosts []*sshHost) {
+	unlocked := make(map[string]struct{})
+	for _, host := range hosts {
+		args := &sshArgs{Destination: host.Alias}
+		param, err := getLoginParam(args)
+		if err != nil {
+			continue
+		}
+		client := getAgentClient(args)
+		if client == nil {
+			continue
+		}
+		fileSigners, _ := getIdentitySigners(args, param)
+		for _, signer := range fileSigners {
+			if signer.signer != nil || signer.addToAgent == nil {
+				continue
+			}
+			fingerprint := ssh.FingerprintSHA256(signer.pubKey)
+			if _, ok := unlocked[fingerprint]; ok {
+				continue
+			}
+			unlocked[fingerprint] = struct{}{}
+			if isKeyInAgent(client, signer.pubKey) {
+				continue
+			}
+			if err := signer.initSigner(); err != nil {
+				warning("unlock key [%s] failed: %v", signer.path, err)
+			}
+		}
+	}
+}
+
+func isKeyInAgent(client agent.ExtendedAgent, pubKey ssh.PublicKey) bool {
+	keys, err := client.List()
+	if err != nil {
+		return false
+	}
+	for _, key := range keys {
+		if bytes.Equal(key.Marshal(), pubKey.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// getCachedSigner returns the decrypted signer of the same key, which avoid asking for the
+// passphrase again when multiple hosts ( e.g. the jump hosts ) share an encrypted key.
+func getCachedSigner(pubKey ssh.PublicKey) ssh.Signer {
+	fingerprint := ssh.FingerprintSHA256(pubKey)
+	signerCacheMutex.Lock()
+	defer signerCacheMutex.Unlock()
+	cached, ok := signerCache[fingerprint]
+	if !ok {
+		return nil
+	}
+	if !cached.expire.IsZero() && time.Now().After(cached.expire) {
+		delete(signerCache, fingerprint)
+		return nil
+	}
+	return cached.signer
+}
+
+func cacheSigner(pubKey ssh.PublicKey, signer ssh.Signer, ttl time.Duration) {
+	cached := &cachedSigner{signer: signer}
+	if ttl > 0 {
+		cached.expire = time.Now().Add(ttl)
+	}
+	signerCacheMutex.Lock()
+	defer signerCacheMutex.Unlock()
+	signerCache[ssh.FingerprintSHA256(pubKey)] = cached
+}
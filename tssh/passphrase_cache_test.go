@@ -0,0 +1,125 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestParseTimeInterval(t *testing.T) {
+	assert := assert.New(t)
+	assertInterval := func(value string, expected time.Duration) {
+		t.Helper()
+		interval, err := parseTimeInterval(value)
+		assert.Nil(err)
+		assert.Equal(expected, interval)
+	}
+	assertInterval("300", 300*time.Second)
+	assertInterval("5m", 5*time.Minute)
+	assertInterval("1h30m", 90*time.Minute)
+	assertInterval("1W2d10s", 9*24*time.Hour+10*time.Second)
+	for _, value := range []string{"m", "5x", "1h30", "-5"} {
+		_, err := parseTimeInterval(value)
+		assert.NotNil(err, value)
+	}
+}
+
+func TestAddKeysToAgent(t *testing.T) {
+	assert := assert.New(t)
+	originalConfig, originalWarning, originalAgentClient := userConfig, warning, agentClient
+	defer func() {
+		userConfig, warning, agentClient = originalConfig, originalWarning, originalAgentClient
+	}()
+	warning = func(format string, a ...any) {}
+	content := []byte(`Host ttl0
+  PassphraseCacheTTL 0
+Host yes
+  AddKeysToAgent yes
+Host yes_ttl
+  AddKeysToAgent yes
+  PassphraseCacheTTL 60
+Host confirm
+  AddKeysToAgent confirm 1h30m
+Host ask
+  AddKeysToAgent ask
+Host interval
+  AddKeysToAgent 600
+Host no
+  AddKeysToAgent no
+Host invalid
+  AddKeysToAgent maybe 5m
+`)
+	config, err := decodeConfig("cfg", content, false)
+	assert.Nil(err)
+	exConfig, err := decodeConfig("cfg", content, false)
+	assert.Nil(err)
+	userConfig = &tsshConfig{config: config, exConfig: exConfig}
+	userConfig.loadConfig.Do(func() {})
+	userConfig.loadExConfig.Do(func() {})
+
+	assertTTL := func(dest string, cache bool, ttl time.Duration) {
+		t.Helper()
+		c, d := getPassphraseCacheTTL(dest)
+		assert.Equal(cache, c)
+		assert.Equal(ttl, d)
+	}
+	assertTTL("default", true, kDefaultPassphraseCacheTTL)
+	assertTTL("ttl0", false, 0)
+	assertTTL("yes_ttl", true, time.Minute)
+
+	assert.Nil(getAddKeysToAgent("default"))
+	assert.Nil(getAddKeysToAgent("no"))
+	assert.Nil(getAddKeysToAgent("invalid"))
+	assert.Equal(&addKeysToAgent{lifetime: kDefaultPassphraseCacheTTL}, getAddKeysToAgent("yes"))
+	assert.Equal(&addKeysToAgent{lifetime: time.Minute}, getAddKeysToAgent("yes_ttl"))
+	assert.Equal(&addKeysToAgent{confirm: true, lifetime: 90 * time.Minute}, getAddKeysToAgent("confirm"))
+	assert.Equal(&addKeysToAgent{ask: true, lifetime: kDefaultPassphraseCacheTTL}, getAddKeysToAgent("ask"))
+	assert.Equal(&addKeysToAgent{lifetime: 10 * time.Minute}, getAddKeysToAgent("interval"))
+
+	_, priKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	signer, err := ssh.NewSignerFromKey(priKey)
+	assert.Nil(err)
+	keyring := agent.NewKeyring().(agent.ExtendedAgent)
+	agentClient = keyring
+	assert.False(isKeyInAgent(keyring, signer.PublicKey()))
+	addKeyToAgent(nil, "id_ed25519", signer.PublicKey(), priKey)
+	assert.False(isKeyInAgent(keyring, signer.PublicKey()))
+	addKeyToAgent(getAddKeysToAgent("yes_ttl"), "id_ed25519", signer.PublicKey(), priKey)
+	assert.True(isKeyInAgent(keyring, signer.PublicKey()))
+	keys, err := keyring.List()
+	assert.Nil(err)
+	if assert.Len(keys, 1) {
+		assert.Equal("id_ed25519", keys[0].Comment)
+	}
+}
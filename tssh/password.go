@@ -0,0 +1,131 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func getBadPasswordsPath() string {
+	return filepath.Join(userHomeDir, ".ssh", ".tssh_bad_passwords")
+}
+
+func getPasswordDigest(dest, password string) string {
+	digest := sha256.Sum256([]byte(dest + "\x00" + password))
+	return hex.EncodeToString(digest[:])
+}
+
+// isBadPassword returns whether the password configuration has been rejected by the server before,
+// so that an expired password won't be submitted again and again to lock the account.
+func isBadPassword(dest, password string) bool {
+	file, err := os.Open(getBadPasswordsPath())
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	digest := getPasswordDigest(dest, password)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == digest {
+			return true
+		}
+	}
+	return false
+}
+
+func recordBadPassword(dest, password string) {
+	if memoryOnlySecrets {
+		debug("don't record the bad password in memory-only mode")
+		return
+	}
+	if isBadPassword(dest, password) {
+		return
+	}
+	path := getBadPasswordsPath()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		debug("open [%s] failed: %v", path, err)
+		return
+	}
+	defer file.Close()
+	if _, err := fmt.Fprintf(file, "%s\n", getPasswordDigest(dest, password)); err != nil {
+		debug("write [%s] failed: %v", path, err)
+	}
+}
+
+// beginAuthMethod is called when an authentication method starts. The stored password is still pending
+// when another method starts only if it got a partial success, so it's not rejected.
+func beginAuthMethod(args *sshArgs, method string) {
+	args.authWatchdog.begin(method)
+	if method != "password" {
+		args.pendingPassword = ""
+	}
+}
+
+// rejectPendingPassword records the stored password which has been sent but rejected by the server.
+func rejectPendingPassword(args *sshArgs) {
+	recordBadPassword(args.Destination, args.pendingPassword)
+	warning("the password configuration for %s is incorrect, it won't be tried again until changed", args.Destination)
+	args.pendingPassword = ""
+}
+
+// resolvePendingPassword is called when the authentication ends. If it fails while the stored password is pending,
+// the server has closed the connection after rejecting the password, e.g. MaxAuthTries is reached,
+// unless the server got no reply in AuthTimeout.
+func resolvePendingPassword(args *sshArgs, err error) {
+	if _, hung := args.authWatchdog.hungMethod(); err != nil && !hung && args.pendingPassword != "" {
+		rejectPendingPassword(args)
+	}
+	args.pendingPassword = ""
+}
+
+func getPasswordPrompts(args *sshArgs) int {
+	if value := getOptionConfig(args, "NumberOfPasswordPrompts"); value != "" {
+		prompts, err := strconv.Atoi(value)
+		if err == nil && prompts > 0 {
+			return prompts
+		}
+		warning("NumberOfPasswordPrompts %s is invalid", value)
+	}
+	return 3
+}
+
+// passwordRetryDelay slows down the retries after failures.
+func passwordRetryDelay(failures int) {
+	delay := time.Duration(failures) * time.Second
+	if delay > 3*time.Second {
+		delay = 3 * time.Second
+	}
+	time.Sleep(delay)
+}
@@ -0,0 +1,254 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var newPasswordRegexp = regexp.MustCompile(`(?i)\bnew\b.*password`)
+var retypePasswordRegexp = regexp.MustCompile(`(?i)(retype|re-enter|reenter|again|repeat|confirm|verify)`)
+var currentPasswordRegexp = regexp.MustCompile(`(?i)(current|old)\b.*password`)
+
+var (
+	changedPasswordsMutex sync.Mutex
+	changedPasswords      = make(map[string]string)
+)
+
+// passwordChanger answers the password change dialog which is forced by the server via keyboard-interactive.
+type passwordChanger struct {
+	args        *sshArgs
+	user        string
+	host        string
+	newPassword string
+	// readSecret reads the new password, which is the readSecret of the terminal if nil
+	readSecret func(prompt string) ([]byte, error)
+}
+
+func isNewPasswordQuestion(question string) bool {
+	return newPasswordRegexp.MatchString(question)
+}
+
+func (c *passwordChanger) checkPolicy(password string) error {
+	if password == "" {
+		return fmt.Errorf("empty password")
+	}
+	policy := getExOptionConfig(c.args, "PasswordPolicy")
+	if policy == "" {
+		return nil
+	}
+	re, err := regexp.Compile(policy)
+	if err != nil {
+		warning("PasswordPolicy %s is invalid: %v", policy, err)
+		return nil
+	}
+	if !re.MatchString(password) {
+		return fmt.Errorf("the new password does not match the policy: %s", policy)
+	}
+	return nil
+}
+
+func (c *passwordChanger) readNewPassword() (string, error) {
+	read := c.readSecret
+	if read == nil {
+		read = readSecret
+	}
+	if c.newPassword == "" {
+		fmt.Fprintf(os.Stderr, tr("The password of %s@%s has expired and must be changed.\r\n"), c.user, c.host)
+	} else {
+		fmt.Fprint(os.Stderr, tr("The new password was rejected by the server, please choose another one.\r\n"))
+	}
+	for i := 0; i < 3; i++ {
+		password, err := read(tr("New password: "))
+		if err != nil {
+			return "", err
+		}
+		if err := c.checkPolicy(string(password)); err != nil {
+			zeroBytes(password)
+			fmt.Fprintf(os.Stderr, "%v\r\n", err)
+			continue
+		}
+		retype, err := read(tr("Retype new password: "))
+		if err != nil {
+			zeroBytes(password)
+			return "", err
+		}
+		matched := string(password) == string(retype)
+		newPassword := string(password)
+		zeroBytes(password)
+		zeroBytes(retype)
+		if !matched {
+			fmt.Fprint(os.Stderr, tr("Sorry, passwords do not match.\r\n"))
+			continue
+		}
+		return newPassword, nil
+	}
+	return "", fmt.Errorf("too many failures for the new password")
+}
+
+// answer returns the answer for the question of the password change dialog, or false if it's not.
+func (c *passwordChanger) answer(question string) (string, bool, error) {
+	if currentPasswordRegexp.MatchString(question) {
+		if password := getSecretConfig(c.args.Destination, "Password"); password != "" {
+			debug("answer the current password with the password configuration")
+			return password, true, nil
+		}
+		return "", false, nil
+	}
+	if !isNewPasswordQuestion(question) {
+		return "", false, nil
+	}
+	if retypePasswordRegexp.MatchString(question) && c.newPassword != "" {
+		return c.newPassword, true, nil
+	}
+	// asked for the new password again, which means the server rejected the last one, e.g., too weak or reused
+	password, err := c.readNewPassword()
+	if err != nil {
+		c.newPassword = ""
+		changedPasswordsMutex.Lock()
+		delete(changedPasswords, c.args.Destination)
+		changedPasswordsMutex.Unlock()
+		return "", true, err
+	}
+	c.newPassword = password
+	changedPasswordsMutex.Lock()
+	changedPasswords[c.args.Destination] = password
+	changedPasswordsMutex.Unlock()
+	return c.newPassword, true, nil
+}
+
+// updatePasswordLine replaces the value of the password configuration line, ok is false if it's not the line.
+func updatePasswordLine(line, oldValue, newEncoded string) (string, bool) {
+	content := strings.TrimSpace(line)
+	prefix := line[:strings.Index(line, content)]
+	if strings.HasPrefix(content, "#!!") {
+		prefix += "#!!"
+		content = strings.TrimSpace(content[3:])
+	}
+	key, value := getConfigKeyword(content)
+	if key != "password" && key != "encpassword" {
+		return "", false
+	}
+	if value != oldValue {
+		idx := strings.Index(value, "#")
+		if idx < 0 || strings.TrimSpace(value[:idx]) != oldValue {
+			return "", false
+		}
+	}
+	if strings.HasSuffix(prefix, "#!!") {
+		return fmt.Sprintf("%s encPassword %s", prefix, newEncoded), true
+	}
+	return fmt.Sprintf("%sencPassword %s", prefix, newEncoded), true
+}
+
+func updatePasswordConfig(dest, oldValue, newEncoded string) (string, error) {
+	var matchPath string
+	var matchLines []string
+	matchIndex := -1
+	for _, path := range []string{userConfig.exConfigPath, userConfig.configPath} {
+		if path == "" || !isFileExist(path) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		lines := strings.Split(string(data), "\n")
+		for i, line := range lines {
+			if _, ok := updatePasswordLine(strings.TrimRight(line, "\r"), oldValue, newEncoded); ok {
+				if matchIndex >= 0 {
+					return "", fmt.Errorf("the password configuration of %s is not unique", dest)
+				}
+				matchPath, matchLines, matchIndex = path, lines, i
+			}
+		}
+	}
+	if matchIndex < 0 {
+		return "", fmt.Errorf("the password configuration of %s is not found", dest)
+	}
+	line := matchLines[matchIndex]
+	newLine, _ := updatePasswordLine(strings.TrimRight(line, "\r"), oldValue, newEncoded)
+	if strings.HasSuffix(line, "\r") {
+		newLine += "\r"
+	}
+	matchLines[matchIndex] = newLine
+	info, err := os.Stat(matchPath)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(matchPath, []byte(strings.Join(matchLines, "\n")), info.Mode().Perm()); err != nil {
+		return "", err
+	}
+	return matchPath, nil
+}
+
+// afterPasswordChanged offers to update the password configuration after the password was changed.
+func afterPasswordChanged(args *sshArgs) {
+	changedPasswordsMutex.Lock()
+	password, ok := changedPasswords[args.Destination]
+	delete(changedPasswords, args.Destination)
+	changedPasswordsMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	oldValue := getExConfig(args.Destination, "encPassword")
+	if oldValue == "" {
+		oldValue = getExConfig(args.Destination, "Password")
+	}
+	if oldValue == "" {
+		return
+	}
+	if memoryOnlySecrets {
+		warning("the password of %s has been changed, please update the password configuration manually", args.Destination)
+		return
+	}
+	switch strings.ToLower(getExOptionConfig(args, "UpdateChangedPassword")) {
+	case "no":
+		return
+	case "yes":
+	default:
+		if !isTerminal || !askYesOrNo(fmt.Sprintf(tr("Update the password configuration of %s? (yes/no): "), args.Destination)) {
+			return
+		}
+	}
+
+	encoded, err := encodeSecret([]byte(password))
+	if err != nil {
+		warning("encode secret failed: %v", err)
+		return
+	}
+	path, err := updatePasswordConfig(args.Destination, oldValue, encoded)
+	if err != nil {
+		warning("update the password configuration failed: %v, please update it manually: encPassword %s", err, encoded)
+		return
+	}
+	debug("the password configuration of %s in [%s] is updated", args.Destination, path)
+}
@@ -0,0 +1,234 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestBadPassword(t *testing.T) {
+	assert := assert.New(t)
+	originalHomeDir := userHomeDir
+	defer func() {
+		userHomeDir = originalHomeDir
+	}()
+	userHomeDir = t.TempDir()
+	assert.Nil(os.Mkdir(filepath.Join(userHomeDir, ".ssh"), 0700))
+
+	assert.False(isBadPassword("server1", "expired"))
+	recordBadPassword("server1", "expired")
+	recordBadPassword("server1", "expired")
+	assert.True(isBadPassword("server1", "expired"))
+	assert.False(isBadPassword("server1", "changed"))
+	assert.False(isBadPassword("server2", "expired"))
+
+	data, err := os.ReadFile(getBadPasswordsPath())
+	assert.Nil(err)
+	assert.Equal(getPasswordDigest("server1", "expired")+"\n", string(data))
+	assert.NotContains(string(data), "expired")
+
+	memoryOnlySecrets = true
+	defer func() { memoryOnlySecrets = false }()
+	recordBadPassword("server2", "expired")
+	assert.False(isBadPassword("server2", "expired"))
+}
+
+func TestMaskSecret(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("****", maskSecret("pass"))
+	memoryOnlySecrets = true
+	defer func() { memoryOnlySecrets = false }()
+	assert.Equal("******", maskSecret("pass"))
+	assert.Equal("******", maskSecret("a long password"))
+
+	secret := []byte("secret")
+	zeroBytes(secret)
+	assert.Equal(make([]byte, 6), secret)
+}
+
+func TestUpdatePasswordLine(t *testing.T) {
+	assert := assert.New(t)
+	assertUpdated := func(line, oldValue, expected string) {
+		t.Helper()
+		newLine, ok := updatePasswordLine(line, oldValue, "a1b2")
+		assert.True(ok)
+		assert.Equal(expected, newLine)
+	}
+	assertUpdated("  Password old123", "old123", "  encPassword a1b2")
+	assertUpdated("\tencPassword = 0f0e", "0f0e", "\tencPassword a1b2")
+	assertUpdated("  #!! Password old123", "old123", "  #!! encPassword a1b2")
+	assertUpdated("  Password old123 # expired", "old123", "  encPassword a1b2")
+
+	assertNotUpdated := func(line, oldValue string) {
+		t.Helper()
+		_, ok := updatePasswordLine(line, oldValue, "a1b2")
+		assert.False(ok)
+	}
+	assertNotUpdated("  Password other", "old123")
+	assertNotUpdated("  User old123", "old123")
+	assertNotUpdated("", "old123")
+}
+
+func TestPasswordChangerAnswer(t *testing.T) {
+	assert := assert.New(t)
+	var inputs []string
+	changer := &passwordChanger{args: &sshArgs{Destination: "test_password_changer"}, user: "test", host: "server",
+		readSecret: func(prompt string) ([]byte, error) {
+			if len(inputs) == 0 {
+				return nil, fmt.Errorf("no more input")
+			}
+			input := inputs[0]
+			inputs = inputs[1:]
+			return []byte(input), nil
+		}}
+	defer func() {
+		changedPasswordsMutex.Lock()
+		delete(changedPasswords, "test_password_changer")
+		changedPasswordsMutex.Unlock()
+	}()
+	assertAnswer := func(question, expected string) {
+		t.Helper()
+		answer, ok, err := changer.answer(question)
+		assert.True(ok)
+		assert.Nil(err)
+		assert.Equal(expected, answer)
+	}
+
+	_, ok, err := changer.answer("Verification code: ")
+	assert.False(ok)
+	assert.Nil(err)
+
+	inputs = []string{"weak", "mismatch", "weak", "weak"}
+	assertAnswer("New password: ", "weak")
+	assertAnswer("Retype new password: ", "weak")
+	assert.Empty(inputs)
+	assert.Equal("weak", changedPasswords["test_password_changer"])
+
+	// the server rejected the weak password and asks again
+	inputs = []string{"Strong#Password1", "Strong#Password1"}
+	assertAnswer("New password: ", "Strong#Password1")
+	assertAnswer("Retype new password: ", "Strong#Password1")
+	assert.Empty(inputs)
+	assert.Equal("Strong#Password1", changedPasswords["test_password_changer"])
+
+	// the user gives up after the server rejected again
+	_, ok, err = changer.answer("New password: ")
+	assert.True(ok)
+	assert.NotNil(err)
+	assert.Equal("", changer.newPassword)
+	_, changed := changedPasswords["test_password_changer"]
+	assert.False(changed)
+}
+
+func TestRejectStoredPassword(t *testing.T) {
+	assert := assert.New(t)
+	originalHomeDir, originalConfig, originalBatchMode, originalWarning := userHomeDir, userConfig, batchMode, warning
+	defer func() {
+		userHomeDir, userConfig, batchMode, warning = originalHomeDir, originalConfig, originalBatchMode, originalWarning
+	}()
+	var warnings []string
+	warning = func(format string, a ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, a...))
+	}
+	batchMode = true
+	exConfig, err := decodeConfig("cfg", []byte("Host wrong\n  Password wrong\nHost right\n  Password right\n"), false)
+	assert.Nil(err)
+	userConfig = &tsshConfig{exConfig: exConfig}
+	userConfig.loadConfig.Do(func() {})
+	userConfig.loadExConfig.Do(func() {})
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	assert.Nil(err)
+	login := func(dest string, maxAuthTries int) error {
+		t.Helper()
+		serverConfig := &ssh.ServerConfig{
+			MaxAuthTries: maxAuthTries,
+			PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+				if string(password) == "right" {
+					return nil, nil
+				}
+				return nil, fmt.Errorf("wrong password")
+			},
+		}
+		serverConfig.AddHostKey(hostSigner)
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(err)
+		defer listener.Close()
+		go func() {
+			server, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer server.Close()
+			_, _, _, _ = ssh.NewServerConn(server, serverConfig)
+		}()
+		client, err := net.Dial("tcp", listener.Addr().String())
+		assert.Nil(err)
+		defer client.Close()
+		args := &sshArgs{Destination: dest, Option: sshOption{map[string][]string{"numberofpasswordprompts": {"1"}}}}
+		config := &ssh.ClientConfig{
+			User:            "test",
+			Auth:            []ssh.AuthMethod{getPasswordAuthMethod(args, "127.0.0.1", "test")},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		}
+		_, _, _, err = ssh.NewClientConn(client, listener.Addr().String(), config)
+		resolvePendingPassword(args, err)
+		return err
+	}
+
+	// rejected with NumberOfPasswordPrompts 1
+	userHomeDir = t.TempDir()
+	assert.Nil(os.MkdirAll(filepath.Join(userHomeDir, ".ssh"), 0700))
+	assert.NotNil(login("wrong", 0))
+	assert.True(isBadPassword("wrong", "wrong"))
+	assert.Equal([]string{"the password configuration for wrong is incorrect, it won't be tried again until changed"}, warnings)
+
+	// not submitted again
+	warnings = nil
+	assert.NotNil(login("wrong", 0))
+	assert.Equal([]string{"skip the password configuration for wrong, which was incorrect before"}, warnings)
+
+	// rejected and disconnected by the server
+	userHomeDir = t.TempDir()
+	assert.Nil(os.MkdirAll(filepath.Join(userHomeDir, ".ssh"), 0700))
+	assert.NotNil(login("wrong", 1))
+	assert.True(isBadPassword("wrong", "wrong"))
+
+	// accepted
+	assert.Nil(login("right", 1))
+	assert.False(isBadPassword("right", "right"))
+}
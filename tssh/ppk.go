@@ -0,0 +1,399 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+const kPuttyKeyPrefix = "PuTTY-User-Key-File-"
+
+// the argon2 parameters are taken from the key file, bound them so that a crafted
+// or corrupted key can not make us allocate or compute without limit. puttygen
+// writes 8 MiB and a few dozen passes by default, the bounds are far above that.
+const (
+	kPuttyMaxArgon2Memory      = 1024 * 1024 // KiB, i.e. 1 GiB
+	kPuttyMaxArgon2Passes      = 1000
+	kPuttyMaxArgon2Parallelism = 64
+)
+
+// puttyKey is the PuTTY private key file (.ppk) of version 2 or 3.
+type puttyKey struct {
+	version     int
+	algorithm   string
+	encryption  string
+	comment     string
+	public      []byte
+	private     []byte
+	mac         []byte
+	kdf         string
+	memory      uint32
+	passes      uint32
+	parallelism uint32
+	salt        []byte
+}
+
+func isPuttyKey(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte(kPuttyKeyPrefix))
+}
+
+func parsePuttyKey(data []byte) (*puttyKey, error) {
+	lines := strings.Split(strings.ReplaceAll(string(bytes.TrimSpace(data)), "\r\n", "\n"), "\n")
+	key := &puttyKey{}
+	readBlob := func(idx *int, value string) ([]byte, error) {
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 0 || *idx+count >= len(lines) {
+			return nil, fmt.Errorf("invalid lines count: %s", value)
+		}
+		var buf strings.Builder
+		for i := 0; i < count; i++ {
+			*idx++
+			buf.WriteString(strings.TrimSpace(lines[*idx]))
+		}
+		return base64.StdEncoding.DecodeString(buf.String())
+	}
+	readUint32 := func(value string) (uint32, error) {
+		n, err := strconv.ParseUint(value, 10, 32)
+		return uint32(n), err
+	}
+	for i := 0; i < len(lines); i++ {
+		name, value, ok := strings.Cut(lines[i], ": ")
+		if !ok {
+			return nil, fmt.Errorf("invalid line: %s", lines[i])
+		}
+		value = strings.TrimSpace(value)
+		var err error
+		switch name {
+		case kPuttyKeyPrefix + "2", kPuttyKeyPrefix + "3":
+			key.version = int(name[len(name)-1] - '0')
+			key.algorithm = value
+		case "Encryption":
+			key.encryption = value
+		case "Comment":
+			key.comment = value
+		case "Public-Lines":
+			key.public, err = readBlob(&i, value)
+		case "Private-Lines":
+			key.private, err = readBlob(&i, value)
+		case "Private-MAC":
+			key.mac, err = hex.DecodeString(value)
+		case "Key-Derivation":
+			key.kdf = value
+		case "Argon2-Memory":
+			key.memory, err = readUint32(value)
+		case "Argon2-Passes":
+			key.passes, err = readUint32(value)
+		case "Argon2-Parallelism":
+			key.parallelism, err = readUint32(value)
+		case "Argon2-Salt":
+			key.salt, err = hex.DecodeString(value)
+		default:
+			if strings.HasPrefix(name, kPuttyKeyPrefix) {
+				return nil, fmt.Errorf("unsupported ppk version: %s", name)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+	if key.version == 0 || key.public == nil || key.private == nil || key.mac == nil {
+		return nil, fmt.Errorf("incomplete ppk file")
+	}
+	if key.encryption != "none" && key.encryption != "aes256-cbc" {
+		return nil, fmt.Errorf("unsupported ppk encryption: %s", key.encryption)
+	}
+	return key, nil
+}
+
+func (k *puttyKey) isEncrypted() bool {
+	return k.encryption != "none"
+}
+
+// deriveKeys returns the cipher key, iv and mac key of the passphrase.
+func (k *puttyKey) deriveKeys(passphrase []byte) ([]byte, []byte, []byte, error) {
+	if k.version == 2 {
+		macHash := sha1.New()
+		macHash.Write([]byte("putty-private-key-file-mac-key"))
+		macHash.Write(passphrase)
+		if !k.isEncrypted() {
+			return nil, nil, macHash.Sum(nil), nil
+		}
+		var cipherKey []byte
+		for i := uint32(0); i < 2; i++ {
+			h := sha1.New()
+			_ = binary.Write(h, binary.BigEndian, i)
+			h.Write(passphrase)
+			cipherKey = h.Sum(cipherKey)
+		}
+		return cipherKey[:32], make([]byte, aes.BlockSize), macHash.Sum(nil), nil
+	}
+
+	if !k.isEncrypted() {
+		return nil, nil, []byte{}, nil
+	}
+	if k.parallelism == 0 || k.passes == 0 || k.memory < 8*k.parallelism {
+		return nil, nil, nil, fmt.Errorf("invalid argon2 parameters")
+	}
+	if k.memory > kPuttyMaxArgon2Memory {
+		return nil, nil, nil, fmt.Errorf("argon2 memory %d KiB exceeds the limit of %d KiB", k.memory, kPuttyMaxArgon2Memory)
+	}
+	if k.passes > kPuttyMaxArgon2Passes {
+		return nil, nil, nil, fmt.Errorf("argon2 passes %d exceeds the limit of %d", k.passes, kPuttyMaxArgon2Passes)
+	}
+	if k.parallelism > kPuttyMaxArgon2Parallelism {
+		return nil, nil, nil, fmt.Errorf("argon2 parallelism %d exceeds the limit of %d", k.parallelism, kPuttyMaxArgon2Parallelism)
+	}
+	var derived []byte
+	switch k.kdf {
+	case "Argon2id":
+		derived = argon2.IDKey(passphrase, k.salt, k.passes, k.memory, uint8(k.parallelism), 80)
+	case "Argon2i":
+		derived = argon2.Key(passphrase, k.salt, k.passes, k.memory, uint8(k.parallelism), 80)
+	default:
+		return nil, nil, nil, fmt.Errorf("unsupported ppk key derivation: %s", k.kdf)
+	}
+	return derived[:32], derived[32:48], derived[48:], nil
+}
+
+func (k *puttyKey) decrypt(passphrase []byte) ([]byte, error) {
+	cipherKey, iv, macKey, err := k.deriveKeys(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	private := k.private
+	if k.isEncrypted() {
+		if len(private)%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("invalid private blob length %d", len(private))
+		}
+		block, err := aes.NewCipher(cipherKey)
+		if err != nil {
+			return nil, err
+		}
+		private = make([]byte, len(k.private))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(private, k.private)
+	}
+
+	var mac hash.Hash
+	if k.version == 2 {
+		mac = hmac.New(sha1.New, macKey)
+	} else {
+		mac = hmac.New(sha256.New, macKey)
+	}
+	for _, field := range [][]byte{[]byte(k.algorithm), []byte(k.encryption), []byte(k.comment), k.public, private} {
+		_ = binary.Write(mac, binary.BigEndian, uint32(len(field)))
+		mac.Write(field)
+	}
+	if !hmac.Equal(mac.Sum(nil), k.mac) {
+		if k.isEncrypted() {
+			return nil, x509.IncorrectPasswordError
+		}
+		return nil, fmt.Errorf("ppk mac mismatch")
+	}
+	return private, nil
+}
+
+type sshBlobReader struct {
+	buf []byte
+	err error
+}
+
+func (r *sshBlobReader) readString() []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.buf) < 4 {
+		r.err = fmt.Errorf("blob too short")
+		return nil
+	}
+	length := binary.BigEndian.Uint32(r.buf)
+	if uint32(len(r.buf)-4) < length {
+		r.err = fmt.Errorf("blob length %d out of range", length)
+		return nil
+	}
+	value := r.buf[4 : 4+length]
+	r.buf = r.buf[4+length:]
+	return value
+}
+
+func (r *sshBlobReader) readMPInt() *big.Int {
+	return new(big.Int).SetBytes(r.readString())
+}
+
+func newPuttyRawKey(algorithm string, public, private []byte) (interface{}, error) {
+	pub := &sshBlobReader{buf: public}
+	priv := &sshBlobReader{buf: private}
+	if name := string(pub.readString()); name != algorithm {
+		return nil, fmt.Errorf("public key algorithm %s mismatch %s", name, algorithm)
+	}
+	var key interface{}
+	switch algorithm {
+	case ssh.KeyAlgoRSA:
+		e, n := pub.readMPInt(), pub.readMPInt()
+		d, p, q := priv.readMPInt(), priv.readMPInt(), priv.readMPInt()
+		if pub.err == nil && priv.err == nil {
+			rsaKey := &rsa.PrivateKey{PublicKey: rsa.PublicKey{N: n, E: int(e.Int64())}, D: d, Primes: []*big.Int{p, q}}
+			if err := rsaKey.Validate(); err != nil {
+				return nil, err
+			}
+			rsaKey.Precompute()
+			key = rsaKey
+		}
+	case ssh.KeyAlgoDSA:
+		dsaKey := &dsa.PrivateKey{}
+		dsaKey.P, dsaKey.Q, dsaKey.G, dsaKey.Y = pub.readMPInt(), pub.readMPInt(), pub.readMPInt(), pub.readMPInt()
+		dsaKey.X = priv.readMPInt()
+		key = dsaKey
+	case ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521:
+		curve := map[string]elliptic.Curve{
+			ssh.KeyAlgoECDSA256: elliptic.P256(), ssh.KeyAlgoECDSA384: elliptic.P384(), ssh.KeyAlgoECDSA521: elliptic.P521(),
+		}[algorithm]
+		_ = pub.readString()
+		x, y := elliptic.Unmarshal(curve, pub.readString())
+		d := priv.readMPInt()
+		if pub.err == nil && priv.err == nil {
+			if x == nil {
+				return nil, fmt.Errorf("invalid ecdsa public key")
+			}
+			if px, py := curve.ScalarBaseMult(d.Bytes()); px.Cmp(x) != 0 || py.Cmp(y) != 0 {
+				return nil, fmt.Errorf("ecdsa private key mismatch")
+			}
+			key = &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y}, D: d}
+		}
+	case ssh.KeyAlgoED25519:
+		pubKey := pub.readString()
+		seed := priv.readString()
+		if len(seed) == ed25519.SeedSize+1 && seed[0] == 0 {
+			seed = seed[1:]
+		}
+		if pub.err == nil && priv.err == nil {
+			if len(seed) != ed25519.SeedSize {
+				return nil, fmt.Errorf("invalid ed25519 private key length %d", len(seed))
+			}
+			edKey := ed25519.NewKeyFromSeed(seed)
+			if !bytes.Equal(edKey.Public().(ed25519.PublicKey), pubKey) {
+				// in case of the big-endian integer
+				reversed := make([]byte, len(seed))
+				for i := range seed {
+					reversed[i] = seed[len(seed)-1-i]
+				}
+				edKey = ed25519.NewKeyFromSeed(reversed)
+				if !bytes.Equal(edKey.Public().(ed25519.PublicKey), pubKey) {
+					return nil, fmt.Errorf("ed25519 private key mismatch")
+				}
+			}
+			key = edKey
+		}
+	default:
+		return nil, fmt.Errorf("unsupported ppk key algorithm: %s", algorithm)
+	}
+	if pub.err != nil {
+		return nil, fmt.Errorf("invalid public blob: %v", pub.err)
+	}
+	if priv.err != nil {
+		return nil, fmt.Errorf("invalid private blob: %v", priv.err)
+	}
+	return key, nil
+}
+
+func parsePuttyRawPrivateKey(data, passphrase []byte) (interface{}, error) {
+	key, err := parsePuttyKey(data)
+	if err != nil {
+		return nil, err
+	}
+	if key.isEncrypted() && passphrase == nil {
+		pubKey, err := ssh.ParsePublicKey(key.public)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &ssh.PassphraseMissingError{PublicKey: pubKey}
+	}
+	private, err := key.decrypt(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return newPuttyRawKey(key.algorithm, key.public, private)
+}
+
+func parsePuttyPrivateKey(data, passphrase []byte) (ssh.Signer, error) {
+	rawKey, err := parsePuttyRawPrivateKey(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewSignerFromKey(rawKey)
+}
+
+// parsePrivateKey parses the OpenSSH, PEM or PuTTY private key.
+func parsePrivateKey(data []byte) (ssh.Signer, error) {
+	if isPuttyKey(data) {
+		return parsePuttyPrivateKey(data, nil)
+	}
+	return ssh.ParsePrivateKey(data)
+}
+
+// parsePrivateKeyWithPassphrase parses the encrypted OpenSSH, PEM or PuTTY private key.
+func parsePrivateKeyWithPassphrase(data, passphrase []byte) (ssh.Signer, error) {
+	if isPuttyKey(data) {
+		if passphrase == nil {
+			passphrase = []byte{}
+		}
+		return parsePuttyPrivateKey(data, passphrase)
+	}
+	return ssh.ParsePrivateKeyWithPassphrase(data, passphrase)
+}
+
+// parseRawPrivateKeyWithPassphrase parses the encrypted OpenSSH, PEM or PuTTY private key into the raw key,
+// which could be added to the ssh agent.
+func parseRawPrivateKeyWithPassphrase(data, passphrase []byte) (interface{}, error) {
+	if isPuttyKey(data) {
+		if passphrase == nil {
+			passphrase = []byte{}
+		}
+		return parsePuttyRawPrivateKey(data, passphrase)
+	}
+	return ssh.ParseRawPrivateKeyWithPassphrase(data, passphrase)
+}
@@ -0,0 +1,207 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+func appendSshString(buf, value []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(value)))
+	return append(buf, value...)
+}
+
+func appendSshMPInt(buf []byte, n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return appendSshString(buf, b)
+}
+
+// encodePuttyKey encodes the ppk file in the way of puttygen.
+func encodePuttyKey(version int, algorithm, comment string, public, private []byte, passphrase string) string {
+	encryption := "none"
+	if passphrase != "" {
+		encryption = "aes256-cbc"
+	}
+	for passphrase != "" && len(private)%aes.BlockSize != 0 {
+		private = append(private, 0)
+	}
+
+	var header strings.Builder
+	var cipherKey, iv, macKey []byte
+	var mac hash.Hash
+	if version == 2 {
+		h := sha1.New()
+		h.Write([]byte("putty-private-key-file-mac-key" + passphrase))
+		macKey = h.Sum(nil)
+		for i := uint32(0); i < 2; i++ {
+			h := sha1.New()
+			_ = binary.Write(h, binary.BigEndian, i)
+			h.Write([]byte(passphrase))
+			cipherKey = h.Sum(cipherKey)
+		}
+		cipherKey, iv = cipherKey[:32], make([]byte, 16)
+		mac = hmac.New(sha1.New, macKey)
+	} else {
+		if passphrase != "" {
+			salt := make([]byte, 16)
+			_, _ = rand.Read(salt)
+			derived := argon2.IDKey([]byte(passphrase), salt, 2, 1024, 1, 80)
+			cipherKey, iv, macKey = derived[:32], derived[32:48], derived[48:]
+			header.WriteString(fmt.Sprintf("Key-Derivation: Argon2id\nArgon2-Memory: 1024\nArgon2-Passes: 2\n"+
+				"Argon2-Parallelism: 1\nArgon2-Salt: %x\n", salt))
+		}
+		mac = hmac.New(sha256.New, macKey)
+	}
+	for _, field := range [][]byte{[]byte(algorithm), []byte(encryption), []byte(comment), public, private} {
+		_ = binary.Write(mac, binary.BigEndian, uint32(len(field)))
+		mac.Write(field)
+	}
+	digest := mac.Sum(nil)
+	encrypted := private
+	if passphrase != "" {
+		block, _ := aes.NewCipher(cipherKey)
+		encrypted = make([]byte, len(private))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, private)
+	}
+
+	lines := func(data []byte) string {
+		encoded := base64.StdEncoding.EncodeToString(data)
+		var result []string
+		for len(encoded) > 64 {
+			result = append(result, encoded[:64])
+			encoded = encoded[64:]
+		}
+		result = append(result, encoded)
+		return fmt.Sprintf("%d\r\n%s", len(result), strings.Join(result, "\r\n"))
+	}
+	return fmt.Sprintf("PuTTY-User-Key-File-%d: %s\r\nEncryption: %s\r\nComment: %s\r\nPublic-Lines: %s\r\n%sPrivate-Lines: %s\r\nPrivate-MAC: %s\r\n",
+		version, algorithm, encryption, comment, lines(public),
+		strings.ReplaceAll(header.String(), "\n", "\r\n"), lines(encrypted), hex.EncodeToString(digest))
+}
+
+func TestPuttyPrivateKey(t *testing.T) {
+	assert := assert.New(t)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(err)
+
+	type testKey struct {
+		key     interface{}
+		private []byte
+	}
+	var keys []testKey
+	keys = append(keys, testKey{edKey, appendSshString(nil, edKey.Seed())})
+	keys = append(keys, testKey{rsaKey, appendSshMPInt(appendSshMPInt(appendSshMPInt(appendSshMPInt(nil,
+		rsaKey.D), rsaKey.Primes[0]), rsaKey.Primes[1]), rsaKey.Precomputed.Qinv)})
+	keys = append(keys, testKey{ecKey, appendSshMPInt(nil, ecKey.D)})
+
+	for _, k := range keys {
+		signer, err := ssh.NewSignerFromKey(k.key)
+		assert.Nil(err)
+		pubKey := signer.PublicKey()
+		for _, version := range []int{2, 3} {
+			for _, passphrase := range []string{"", "secret"} {
+				data := []byte(encodePuttyKey(version, pubKey.Type(), "test key", pubKey.Marshal(), k.private, passphrase))
+				assert.True(isPuttyKey(data))
+				name := fmt.Sprintf("%s v%d [%s]", pubKey.Type(), version, passphrase)
+
+				parsed, err := parsePrivateKey(data)
+				if passphrase != "" {
+					var missingErr *ssh.PassphraseMissingError
+					assert.ErrorAs(err, &missingErr, name)
+					assert.Equal(pubKey.Marshal(), missingErr.PublicKey.Marshal(), name)
+					_, err = parsePrivateKeyWithPassphrase(data, []byte("wrong"))
+					assert.Equal(x509.IncorrectPasswordError, err, name)
+					parsed, err = parsePrivateKeyWithPassphrase(data, []byte(passphrase))
+				}
+				if !assert.Nil(err, name) {
+					continue
+				}
+				assert.Equal(pubKey.Marshal(), parsed.PublicKey().Marshal(), name)
+				sig, err := parsed.Sign(rand.Reader, []byte("data"))
+				assert.Nil(err, name)
+				assert.Nil(pubKey.Verify([]byte("data"), sig), name)
+			}
+		}
+	}
+
+	_, err = parsePrivateKey([]byte("PuTTY-User-Key-File-1: ssh-rsa\n"))
+	assert.NotNil(err)
+	tampered := strings.Replace(encodePuttyKey(3, ssh.KeyAlgoED25519, "test key",
+		ssh.Marshal(struct {
+			Name string
+			Key  []byte
+		}{ssh.KeyAlgoED25519, edKey.Public().(ed25519.PublicKey)}), appendSshString(nil, edKey.Seed()), ""),
+		"Comment: test key", "Comment: evil key", 1)
+	_, err = parsePrivateKey([]byte(tampered))
+	assert.NotNil(err)
+
+	encrypted := encodePuttyKey(3, ssh.KeyAlgoED25519, "test key", ssh.Marshal(struct {
+		Name string
+		Key  []byte
+	}{ssh.KeyAlgoED25519, edKey.Public().(ed25519.PublicKey)}), appendSshString(nil, edKey.Seed()), "secret")
+	for _, param := range []struct{ old, new, err string }{
+		{"Argon2-Memory: 1024", "Argon2-Memory: 4294967295", "argon2 memory 4294967295 KiB exceeds the limit"},
+		{"Argon2-Passes: 2", "Argon2-Passes: 4294967295", "argon2 passes 4294967295 exceeds the limit"},
+		{"Argon2-Parallelism: 1", "Argon2-Parallelism: 65", "argon2 parallelism 65 exceeds the limit"},
+		{"Argon2-Parallelism: 1", "Argon2-Parallelism: 0", "invalid argon2 parameters"},
+		{"Argon2-Memory: 1024", "Argon2-Memory: 7", "invalid argon2 parameters"},
+	} {
+		_, err = parsePrivateKeyWithPassphrase([]byte(strings.Replace(encrypted, param.old, param.new, 1)), []byte("secret"))
+		if assert.NotNil(err, param.new) {
+			assert.Contains(err.Error(), param.err)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const kDefaultPortKnockDelay = 200
+
+const kDefaultPreConnectInterval = 3
+
+type wakeOnLanCfg struct {
+	mac       net.HardwareAddr
+	broadcast string
+}
+
+type knockCfg struct {
+	network string
+	port    int
+}
+
+func parseWakeOnLan(s string) (*wakeOnLanCfg, error) {
+	s = strings.TrimSpace(s)
+	broadcast := "255.255.255.255:9"
+	if idx := strings.IndexByte(s, '@'); idx >= 0 {
+		broadcast = s[idx+1:]
+		s = s[:idx]
+		if broadcast == "" {
+			return nil, fmt.Errorf("invalid WakeOnLan broadcast address: %s", s)
+		}
+		if _, _, err := net.SplitHostPort(broadcast); err != nil {
+			broadcast = joinHostPort(broadcast, "9")
+		}
+	}
+	mac, err := net.ParseMAC(s)
+	if err != nil || len(mac) != 6 {
+		return nil, fmt.Errorf("invalid WakeOnLan mac address: %s", s)
+	}
+	return &wakeOnLanCfg{mac, broadcast}, nil
+}
+
+func parsePortKnock(s string) ([]*knockCfg, error) {
+	var knocks []*knockCfg
+	for _, token := range strings.FieldsFunc(s, func(c rune) bool { return c == ',' || c == ' ' || c == '\t' }) {
+		network := "tcp"
+		port := token
+		if idx := strings.IndexAny(token, ":/"); idx >= 0 {
+			port = token[:idx]
+			switch strings.ToLower(token[idx+1:]) {
+			case "tcp":
+				network = "tcp"
+			case "udp":
+				network = "udp"
+			default:
+				return nil, fmt.Errorf("invalid PortKnock protocol: %s", token)
+			}
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 || p > 65535 {
+			return nil, fmt.Errorf("invalid PortKnock port: %s", token)
+		}
+		knocks = append(knocks, &knockCfg{network, p})
+	}
+	if len(knocks) == 0 {
+		return nil, fmt.Errorf("empty PortKnock sequence: %s", s)
+	}
+	return knocks, nil
+}
+
+func getPreConnectValue(args *sshArgs, option string, defaultValue int) int {
+	value := getExOptionConfig(args, option)
+	if value == "" {
+		return defaultValue
+	}
+	v, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		warning("Invalid %s [%s]: %v", option, value, err)
+		return defaultValue
+	}
+	return int(v)
+}
+
+func sendWakeOnLan(cfg *wakeOnLanCfg) error {
+	packet := bytes.Repeat([]byte{0xff}, 6)
+	for i := 0; i < 16; i++ {
+		packet = append(packet, cfg.mac...)
+	}
+	conn, err := net.Dial("udp", cfg.broadcast)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return writeAll(conn, packet)
+}
+
+func knockPort(client *ssh.Client, host string, knock *knockCfg) {
+	addr := joinHostPort(host, strconv.Itoa(knock.port))
+	var conn net.Conn
+	var err error
+	switch {
+	case knock.network == "udp" && client != nil:
+		warning("udp knock [%s] is not supported via the jump host", addr)
+		return
+	case knock.network == "udp":
+		if conn, err = net.Dial("udp", addr); err == nil {
+			_, err = conn.Write([]byte{0})
+		}
+	case client != nil:
+		conn, err = dialWithTimeout(client, "tcp", addr, 100*time.Millisecond)
+	default:
+		conn, err = net.DialTimeout("tcp", addr, 100*time.Millisecond)
+	}
+	if conn != nil {
+		conn.Close()
+	}
+	// knockd ports are usually closed or filtered, so the error is expected.
+	debug("knock %s [%s]: %v", knock.network, addr, err)
+}
+
+func probeAddr(client *ssh.Client, addr string) bool {
+	var conn net.Conn
+	var err error
+	if client != nil {
+		conn, err = dialWithTimeout(client, "tcp", addr, 3*time.Second)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, 3*time.Second)
+	}
+	if err != nil {
+		debug("probe [%s] failed: %v", addr, err)
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// execPreConnect wakes up the host and knocks the ports before dialing.
+//
+// If PreConnectWait is set, the actions are retried every PreConnectInterval seconds,
+// until the ssh port is reachable or the wait time is used up.
+func execPreConnect(args *sshArgs, param *loginParam, client *ssh.Client) {
+	var wol *wakeOnLanCfg
+	if s := getExOptionConfig(args, "WakeOnLan"); s != "" {
+		var err error
+		if wol, err = parseWakeOnLan(s); err != nil {
+			warning("%v", err)
+		}
+	}
+	var knocks []*knockCfg
+	if s := getExOptionConfig(args, "PortKnock"); s != "" {
+		var err error
+		if knocks, err = parsePortKnock(s); err != nil {
+			warning("%v", err)
+		}
+	}
+	if wol == nil && len(knocks) == 0 {
+		return
+	}
+
+	knockDelay := time.Duration(getPreConnectValue(args, "PortKnockDelay", kDefaultPortKnockDelay)) * time.Millisecond
+	wait := time.Duration(getPreConnectValue(args, "PreConnectWait", 0)) * time.Second
+	interval := time.Duration(getPreConnectValue(args, "PreConnectInterval", kDefaultPreConnectInterval)) * time.Second
+	if param.command != "" && wait > 0 {
+		debug("PreConnectWait is ignored when using ProxyCommand")
+		wait = 0
+	}
+
+	beginTime := time.Now()
+	for {
+		if wol != nil {
+			if err := sendWakeOnLan(wol); err != nil {
+				warning("send wake on lan to [%s] failed: %v", wol.broadcast, err)
+			} else {
+				debug("send wake on lan [%s] to [%s] success", wol.mac, wol.broadcast)
+			}
+		}
+		for i, knock := range knocks {
+			if i > 0 {
+				time.Sleep(knockDelay)
+			}
+			knockPort(client, param.host, knock)
+		}
+		if wait <= 0 {
+			if len(knocks) > 0 {
+				time.Sleep(knockDelay)
+			}
+			return
+		}
+		if probeAddr(client, param.addr) {
+			debug("pre connect to [%s] success", param.addr)
+			return
+		}
+		if time.Since(beginTime)+interval > wait {
+			warning("[%s] is still unreachable after waiting %v", param.addr, wait)
+			return
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,88 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWakeOnLan(t *testing.T) {
+	assert := assert.New(t)
+	assertWakeOnLan := func(arg, mac, broadcast string) {
+		t.Helper()
+		cfg, err := parseWakeOnLan(arg)
+		assert.Nil(err)
+		assert.Equal(mac, cfg.mac.String())
+		assert.Equal(broadcast, cfg.broadcast)
+	}
+
+	assertWakeOnLan("00:11:22:33:44:55", "00:11:22:33:44:55", "255.255.255.255:9")
+	assertWakeOnLan("00-11-22-AA-BB-CC", "00:11:22:aa:bb:cc", "255.255.255.255:9")
+	assertWakeOnLan("00:11:22:33:44:55@192.168.1.255", "00:11:22:33:44:55", "192.168.1.255:9")
+	assertWakeOnLan("00:11:22:33:44:55@192.168.1.255:7", "00:11:22:33:44:55", "192.168.1.255:7")
+	assertWakeOnLan("00:11:22:33:44:55@[ff02::1]:9", "00:11:22:33:44:55", "[ff02::1]:9")
+
+	assertWakeOnLanError := func(arg, errMsg string) {
+		t.Helper()
+		_, err := parseWakeOnLan(arg)
+		assert.NotNil(err)
+		assert.Contains(err.Error(), errMsg)
+	}
+
+	assertWakeOnLanError("", "invalid WakeOnLan mac address")
+	assertWakeOnLanError("00:11:22:33:44", "invalid WakeOnLan mac address")
+	assertWakeOnLanError("00:11:22:33:44:55:66:77", "invalid WakeOnLan mac address")
+	assertWakeOnLanError("00:11:22:33:44:55@", "invalid WakeOnLan broadcast address")
+}
+
+func TestParsePortKnock(t *testing.T) {
+	assert := assert.New(t)
+	assertPortKnock := func(arg string, knocks []*knockCfg) {
+		t.Helper()
+		cfgs, err := parsePortKnock(arg)
+		assert.Nil(err)
+		assert.Equal(knocks, cfgs)
+	}
+
+	assertPortKnock("7000", []*knockCfg{{"tcp", 7000}})
+	assertPortKnock("7000,8000,9000", []*knockCfg{{"tcp", 7000}, {"tcp", 8000}, {"tcp", 9000}})
+	assertPortKnock("7000 8000:udp 9000/TCP", []*knockCfg{{"tcp", 7000}, {"udp", 8000}, {"tcp", 9000}})
+	assertPortKnock(" 7000:udp, 8000 ", []*knockCfg{{"udp", 7000}, {"tcp", 8000}})
+
+	assertPortKnockError := func(arg, errMsg string) {
+		t.Helper()
+		_, err := parsePortKnock(arg)
+		assert.NotNil(err)
+		assert.Contains(err.Error(), errMsg)
+	}
+
+	assertPortKnockError("", "empty PortKnock sequence")
+	assertPortKnockError("7000:icmp", "invalid PortKnock protocol: 7000:icmp")
+	assertPortKnockError("A7000", "invalid PortKnock port: A7000")
+	assertPortKnockError("70000", "invalid PortKnock port: 70000")
+}
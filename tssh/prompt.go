@@ -48,6 +48,7 @@ const (
 	keyCtrlD     = '\x04'
 	keyCtrlE     = '\x05'
 	keyCtrlF     = '\x06'
+	keyCtrlG     = '\x07'
 	keyCtrlH     = '\x08'
 	keyCtrlJ     = '\x0a'
 	keyCtrlK     = '\x0b'
@@ -70,6 +71,7 @@ type sshPrompt struct {
 	hosts         []*sshHost
 	termMgr       terminalManager
 	openType      int
+	showActions   bool
 	showShortcuts bool
 	search        bool
 	quit          bool
@@ -115,6 +117,10 @@ var selectShortcuts = []sshShortcuts{
 	{actionName: "TglSelect", globalKeys: []string{"Ctrl+X", "Ctrl+Space", "Alt+Space"}, nonSearchKeys: []string{"Space", "x", "X"}},
 	{actionName: "SelectAll", globalKeys: []string{"Ctrl+A"}, nonSearchKeys: []string{"a", "A"}},
 	{actionName: "SelectOpp", globalKeys: []string{"Ctrl+O"}, nonSearchKeys: []string{"o", "O"}},
+	{actionName: "Actions  ", globalKeys: []string{"Ctrl+G"}, nonSearchKeys: []string{"m", "M"}},
+}
+
+var openShortcuts = []sshShortcuts{
 	{actionName: "Open Wins", globalKeys: []string{"Ctrl+W"}, nonSearchKeys: []string{"w", "W"}},
 	{actionName: "Open Tabs", globalKeys: []string{"Ctrl+T"}, nonSearchKeys: []string{"t", "T"}},
 	{actionName: "Open Pane", globalKeys: []string{"Ctrl+P"}, nonSearchKeys: []string{"p", "P"}},
@@ -126,7 +132,7 @@ func (p *sshPrompt) getShortcuts() []string {
 		return nil
 	}
 	p.selector.HideHelp = true
-	shortcuts := []string{"Shortcuts:"}
+	shortcuts := []string{tr("Shortcuts:")}
 	addShortcuts := func(ss []sshShortcuts) {
 		for _, s := range ss {
 			keys := s.globalKeys
@@ -135,12 +141,13 @@ func (p *sshPrompt) getShortcuts() []string {
 			} else {
 				keys = append(keys, s.nonSearchKeys...)
 			}
-			shortcuts = append(shortcuts, fmt.Sprintf("  %s:  %s", s.actionName, strings.Join(keys, "  ")))
+			shortcuts = append(shortcuts, fmt.Sprintf("  %s:  %s", tr(s.actionName), strings.Join(keys, "  ")))
 		}
 	}
 	addShortcuts(normalShortcuts)
+	addShortcuts(selectShortcuts)
 	if p.termMgr != nil {
-		addShortcuts(selectShortcuts)
+		addShortcuts(openShortcuts)
 	}
 	return shortcuts
 }
@@ -326,9 +333,6 @@ func (p *sshPrompt) gotoEnd(buf []byte) bool {
 }
 
 func (p *sshPrompt) toggleSelect(buf []byte) bool {
-	if p.termMgr == nil {
-		return false
-	}
 	if len(buf) == 2 && buf[0] == '\xc2' {
 		switch buf[1] {
 		case '\xa0': // Alt+Space
@@ -349,9 +353,6 @@ func (p *sshPrompt) toggleSelect(buf []byte) bool {
 }
 
 func (p *sshPrompt) selectAllItems(buf []byte) bool {
-	if p.termMgr == nil {
-		return false
-	}
 	if len(buf) != 1 {
 		return false
 	}
@@ -366,9 +367,6 @@ func (p *sshPrompt) selectAllItems(buf []byte) bool {
 }
 
 func (p *sshPrompt) selectOpposite(buf []byte) bool {
-	if p.termMgr == nil {
-		return false
-	}
 	if len(buf) != 1 {
 		return false
 	}
@@ -440,6 +438,16 @@ func (p *sshPrompt) userConfirm(buf []byte) bool {
 	}
 	if buf[0] == keyEnter {
 		p.openType = openTermDefault
+		// there is no way to open multiple terminals, so let the user choose what to do with the hosts
+		p.showActions = p.termMgr == nil && p.hasSelected()
+		return !p.search
+	}
+	switch buf[0] {
+	case keyCtrlG:
+		p.showActions = true
+		return true
+	case 'm', 'M':
+		p.showActions = true
 		return !p.search
 	}
 	if p.termMgr == nil || !p.hasSelected() {
@@ -557,7 +565,7 @@ func chooseAlias(keywords string) (string, bool, error) {
 	hosts := getAllHosts()
 
 	templates := &promptui.SelectTemplates{
-		Help: `{{ "Use ← ↓ ↑ → h j k l to navigate, / toggles search, ? toggles help" | faint }}`,
+		Help: fmt.Sprintf(`{{ %q | faint }}`, tr("Use ← ↓ ↑ → h j k l to navigate, / toggles search, ? toggles help")),
 		Active: fmt.Sprintf(`%s {{ if .Selected }}{{ "✔ " | green }}{{ end }}{{ .Alias | cyan }} ({{ .Host | red }})`+
 			`	{{ .GroupLabels }}`, promptCursorIcon),
 		Inactive: `   {{ if .Selected }}{{ "✔ " | green }}{{ end }}{{ .Alias | cyan }} ({{ .Host | red }})` +
@@ -574,7 +582,7 @@ func chooseAlias(keywords string) (string, bool, error) {
 	pipeIn, pipeOut := io.Pipe()
 	prompt := sshPrompt{
 		selector: &promptui.Select{
-			Label:        "SSH Alias",
+			Label:        tr("SSH Alias"),
 			Items:        hosts,
 			Templates:    templates,
 			Size:         getPromptPageSize(),
@@ -589,6 +597,7 @@ func chooseAlias(keywords string) (string, bool, error) {
 		termMgr: termMgr,
 	}
 
+	startWarmup(hosts)
 	go prompt.wrapStdin()
 
 	idx, _, err := prompt.selector.Run()
@@ -603,7 +612,11 @@ func chooseAlias(keywords string) (string, bool, error) {
 	for _, h := range selectedHosts {
 		fmt.Fprintf(os.Stderr, "\033[0;32m%s %s\033[0m\r\n", promptSelectedIcon, h.Alias)
 	}
+	if prompt.showActions {
+		return chooseHostsAction(selectedHosts, termMgr)
+	}
 	if len(selectedHosts) > 1 && termMgr != nil {
+		unlockSharedKeys(selectedHosts)
 		termMgr.openTerminals(prompt.openType, selectedHosts)
 	}
 	return selectedHosts[0].Alias, false, nil
@@ -0,0 +1,185 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trzsz/promptui"
+)
+
+const (
+	kHostActionOpen = "Open sessions"
+	kHostActionRun  = "Run a command"
+	kHostActionPush = "Push a file"
+	kHostActionPing = "Test connectivity"
+
+	kHostActionConcurrency = 10
+)
+
+// newTsshCommand runs the current tssh with the same configuration file: tssh [options] alias [command].
+func newTsshCommand(options []string, alias string, command ...string) *exec.Cmd {
+	path, err := os.Executable()
+	if err != nil {
+		path = os.Args[0]
+	}
+	var args []string
+	if userConfig.configPath != "" && userConfig.configPath != filepath.Join(userHomeDir, ".ssh", "config") {
+		args = append(args, "-F", userConfig.configPath)
+	}
+	args = append(args, options...)
+	args = append(args, alias)
+	args = append(args, command...)
+	return exec.Command(path, args...)
+}
+
+// forEachHost runs the action for the hosts concurrently,
+// and the report returned by the action is called one by one in the order of completion.
+func forEachHost(hosts []*sshHost, action func(host *sshHost) (report func())) {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, kHostActionConcurrency)
+	for _, host := range hosts {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(host *sshHost) {
+			defer wg.Done()
+			report := action(host)
+			<-limit
+			mutex.Lock()
+			defer mutex.Unlock()
+			report()
+		}(host)
+	}
+	wg.Wait()
+}
+
+func printHostOutput(output []byte) {
+	text := strings.TrimRight(strings.ReplaceAll(string(output), "\r\n", "\n"), "\n")
+	if text != "" {
+		fmt.Fprintf(os.Stderr, "%s\r\n", strings.ReplaceAll(text, "\n", "\r\n"))
+	}
+}
+
+// runCommandOnHosts runs the command on the hosts concurrently in batch mode, as the prompts can't be answered.
+func runCommandOnHosts(hosts []*sshHost, command string) {
+	forEachHost(hosts, func(host *sshHost) func() {
+		beginTime := time.Now()
+		output, err := newTsshCommand([]string{"-T", "-oBatchMode=yes"}, host.Alias, command).CombinedOutput()
+		cost := time.Since(beginTime).Round(time.Millisecond)
+		return func() {
+			if err != nil {
+				toolsWarn(host.Alias, "failed in %v: %v", cost, err)
+			} else {
+				toolsSucc(host.Alias, "succeeded in %v", cost)
+			}
+			printHostOutput(output)
+		}
+	})
+}
+
+// pushFileToHosts uploads the file to the hosts one by one, so that the progress and the prompts are readable.
+func pushFileToHosts(hosts []*sshHost, local, remote string) {
+	for _, host := range hosts {
+		toolsInfo(host.Alias, "push [%s] to [%s]", local, remote)
+		cmd := newTsshCommand([]string{"--upload-file", local + ":" + remote}, host.Alias)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stderr, os.Stderr
+		if err := cmd.Run(); err != nil {
+			toolsWarn(host.Alias, "push failed: %v", err)
+			continue
+		}
+		toolsSucc(host.Alias, "push succeeded")
+	}
+}
+
+func pingHosts(hosts []*sshHost) {
+	var buf bytes.Buffer
+	writeCheckTable(&buf, checkHosts(hosts, false))
+	printHostOutput(buf.Bytes())
+}
+
+// chooseHostsAction shows the action menu for the selected hosts, and returns the alias to login if any.
+func chooseHostsAction(hosts []*sshHost, termMgr terminalManager) (string, bool, error) {
+	var actions []string
+	if len(hosts) == 1 || termMgr != nil {
+		actions = append(actions, kHostActionOpen)
+	}
+	actions = append(actions, kHostActionRun, kHostActionPush, kHostActionPing)
+
+	selector := &promptui.Select{
+		Label:        fmt.Sprintf("Action for %d hosts", len(hosts)),
+		Items:        actions,
+		Stdout:       &bellFilter{os.Stderr},
+		HideSelected: true,
+	}
+	_, action, err := selector.Run()
+	if err != nil {
+		if err == promptui.ErrInterrupt || err == promptui.ErrEOF {
+			return "", true, nil
+		}
+		return "", true, fmt.Errorf("prompt choose action failed: %v", err)
+	}
+
+	notEmpty := &inputValidator{func(input string) error {
+		if input == "" {
+			return fmt.Errorf("empty input")
+		}
+		return nil
+	}}
+	switch action {
+	case kHostActionOpen:
+		if len(hosts) > 1 {
+			unlockSharedKeys(hosts)
+			termMgr.openTerminals(openTermDefault, hosts)
+		}
+		return hosts[0].Alias, false, nil
+	case kHostActionRun:
+		command := promptTextInput("Command", "", "run on the hosts concurrently in batch mode", notEmpty)
+		unlockSharedKeys(hosts)
+		runCommandOnHosts(hosts, command)
+	case kHostActionPush:
+		local := promptTextInput("Local file", "", "the local file to push", &inputValidator{func(input string) error {
+			if !isFileExist(resolveHomeDir(input)) {
+				return fmt.Errorf("%s does not exist", input)
+			}
+			return nil
+		}})
+		local = resolveHomeDir(local)
+		remote := promptTextInput("Remote path", "~/"+filepath.Base(local), "the remote path to push to", notEmpty)
+		unlockSharedKeys(hosts)
+		pushFileToHosts(hosts, local, remote)
+	case kHostActionPing:
+		pingHosts(hosts)
+	}
+	return "", true, nil
+}
@@ -0,0 +1,177 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+var (
+	pacScriptsMutex sync.Mutex
+	pacScripts      = make(map[string]*pacScript)
+)
+
+func loadPacScript(location string) (*pacScript, error) {
+	pacScriptsMutex.Lock()
+	defer pacScriptsMutex.Unlock()
+	if script, ok := pacScripts[location]; ok {
+		return script, nil
+	}
+
+	var src []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		client := &http.Client{Timeout: 10 * time.Second}
+		var resp *http.Response
+		if resp, err = client.Get(location); err != nil {
+			return nil, fmt.Errorf("download pac file [%s] failed: %v", location, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("download pac file [%s] failed: %s", location, resp.Status)
+		}
+		src, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	} else {
+		src, err = os.ReadFile(resolveHomeDir(strings.TrimPrefix(location, "file://")))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read pac file [%s] failed: %v", location, err)
+	}
+
+	script, err := parsePacScript(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("parse pac file [%s] failed: %v", location, err)
+	}
+	pacScripts[location] = script
+	return script, nil
+}
+
+// getPacProxies evaluates the `ProxyAutoConfig` file for the address,
+// returns nil if not configured, or the proxies like `PROXY host:port` and `DIRECT`.
+func getPacProxies(args *sshArgs, addr string) ([]string, error) {
+	location := getExOptionConfig(args, "ProxyAutoConfig")
+	if location == "" || strings.ToLower(location) == "none" {
+		return nil, nil
+	}
+	script, err := loadPacScript(location)
+	if err != nil {
+		return nil, err
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	result, err := script.findProxy(fmt.Sprintf("ssh://%s/", addr), host)
+	if err != nil {
+		return nil, fmt.Errorf("eval pac file [%s] failed: %v", location, err)
+	}
+	debug("pac file [%s] returns [%s] for [%s]", location, result, addr)
+	var proxies []string
+	for _, p := range strings.Split(result, ";") {
+		if p = strings.Join(strings.Fields(p), " "); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	if len(proxies) == 0 {
+		return []string{"DIRECT"}, nil
+	}
+	return proxies, nil
+}
+
+// dialByProxyAutoConfig dials the address directly, or via the proxies returned by the PAC file in order.
+func dialByProxyAutoConfig(args *sshArgs, network, addr string, timeout time.Duration) (net.Conn, error) {
+	proxies, err := getPacProxies(args, addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(proxies) == 0 {
+		return net.DialTimeout(network, addr, timeout)
+	}
+	var errs []string
+	for _, p := range proxies {
+		conn, err := dialViaPacProxy(p, network, addr, timeout)
+		if err == nil {
+			return conn, nil
+		}
+		debug("dial [%s] via [%s] failed: %v", addr, p, err)
+		errs = append(errs, fmt.Sprintf("%s: %v", p, err))
+	}
+	return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+}
+
+func dialViaPacProxy(pacProxy, network, addr string, timeout time.Duration) (net.Conn, error) {
+	kind, proxyAddr, _ := strings.Cut(pacProxy, " ")
+	switch strings.ToUpper(kind) {
+	case "DIRECT":
+		return net.DialTimeout(network, addr, timeout)
+	case "PROXY", "HTTP":
+		return dialHttpConnect(proxyAddr, addr, timeout)
+	case "SOCKS", "SOCKS5":
+		dialer, err := proxy.SOCKS5("tcp", proxyAddr, nil, &net.Dialer{Timeout: timeout})
+		if err != nil {
+			return nil, err
+		}
+		return dialer.Dial(network, addr)
+	default:
+		return nil, fmt.Errorf("unsupported proxy type: %s", kind)
+	}
+}
+
+func dialHttpConnect(proxyAddr, addr string, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", proxyAddr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	req := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\nUser-Agent: trzsz-ssh/%s\r\n\r\n", addr, addr, kTsshVersion)
+	if err := writeAll(conn, []byte(req)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("read CONNECT response failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("CONNECT %s: %s", addr, resp.Status)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
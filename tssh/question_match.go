@@ -0,0 +1,150 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// questionMatcher answers the keyboard interactive questions matched by the regular expressions.
+type questionMatcher struct {
+	re      *regexp.Regexp
+	answer  string
+	command string
+}
+
+// splitQuestionMatch splits `<regexp> <value>`, the regexp can be quoted by `"` if it contains spaces.
+func splitQuestionMatch(config string) (string, string, error) {
+	config = strings.TrimSpace(config)
+	var pattern, value string
+	if strings.HasPrefix(config, `"`) {
+		end := strings.Index(config[1:], `"`)
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated quote: %s", config)
+		}
+		pattern, value = config[1:end+1], config[end+2:]
+	} else {
+		index := strings.IndexFunc(config, unicode.IsSpace)
+		if index <= 0 {
+			return "", "", fmt.Errorf("invalid question match: %s", config)
+		}
+		pattern, value = config[:index], config[index+1:]
+	}
+	value = strings.TrimSpace(value)
+	if pattern == "" || value == "" {
+		return "", "", fmt.Errorf("invalid question match: %s", config)
+	}
+	return pattern, value, nil
+}
+
+// getQuestionMatchers reads `QuestionMatchAnswer`, `encQuestionMatchAnswer` and `QuestionMatchCommand`.
+func getQuestionMatchers(args *sshArgs) []*questionMatcher {
+	var matchers []*questionMatcher
+	add := func(key string, newMatcher func(re *regexp.Regexp, value string) (*questionMatcher, error)) {
+		for _, config := range getAllExOptionConfig(args, key) {
+			pattern, value, err := splitQuestionMatch(config)
+			if err != nil {
+				warning("%s %v", key, err)
+				continue
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				warning("%s compile [%s] failed: %v", key, pattern, err)
+				continue
+			}
+			matcher, err := newMatcher(re, value)
+			if err != nil {
+				warning("%s %v", key, err)
+				continue
+			}
+			matchers = append(matchers, matcher)
+		}
+	}
+	add("encQuestionMatchAnswer", func(re *regexp.Regexp, value string) (*questionMatcher, error) {
+		answer, err := decodeSecret(value)
+		if err != nil {
+			return nil, fmt.Errorf("decode secret [%s] failed: %v", value, err)
+		}
+		return &questionMatcher{re: re, answer: answer}, nil
+	})
+	add("QuestionMatchAnswer", func(re *regexp.Regexp, value string) (*questionMatcher, error) {
+		return &questionMatcher{re: re, answer: value}, nil
+	})
+	add("QuestionMatchCommand", func(re *regexp.Regexp, value string) (*questionMatcher, error) {
+		return &questionMatcher{re: re, command: value}, nil
+	})
+	return matchers
+}
+
+// runQuestionCommand runs the command with the question in the env `TSSH_QUESTION`, and answers with its output.
+func runQuestionCommand(args *sshArgs, command, question string) (string, error) {
+	param, err := getLoginParam(args)
+	if err != nil {
+		return "", err
+	}
+	command = resolveHomeDir(expandTokens(command, args, param, "%hnpr"))
+	argv, err := splitCommandLine(command)
+	if err != nil || len(argv) == 0 {
+		return "", fmt.Errorf("split question command [%s] failed: %v", command, err)
+	}
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), "TSSH_QUESTION="+question)
+	if err := setupLocalEnv(args, param, cmd); err != nil {
+		return "", err
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("run question command [%s] failed: %v", command, err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// matchQuestionAnswer returns the answer of the first matched question matcher.
+func matchQuestionAnswer(args *sshArgs, matchers []*questionMatcher, question string) (string, bool, error) {
+	question = strings.TrimSpace(question)
+	for _, matcher := range matchers {
+		if !matcher.re.MatchString(question) {
+			continue
+		}
+		debug("question '%s' matches [%s]", question, matcher.re.String())
+		if matcher.command == "" {
+			return matcher.answer, true, nil
+		}
+		answer, err := runQuestionCommand(args, matcher.command, question)
+		if err != nil {
+			return "", false, err
+		}
+		return answer, true, nil
+	}
+	return "", false, nil
+}
@@ -0,0 +1,58 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitQuestionMatch(t *testing.T) {
+	assert := assert.New(t)
+	assertSplit := func(config, pattern, value string) {
+		t.Helper()
+		p, v, err := splitQuestionMatch(config)
+		assert.Nil(err)
+		assert.Equal(pattern, p)
+		assert.Equal(value, v)
+	}
+	assertSplit(`^Token: 123456`, `^Token:`, `123456`)
+	assertSplit(`  ^Token:   abc def `, `^Token:`, `abc def`)
+	assertSplit(`"^Select (project|group):" 2`, `^Select (project|group):`, `2`)
+	assertSplit(`"^OTP code"  oathtool --totp`, `^OTP code`, `oathtool --totp`)
+
+	assertError := func(config string) {
+		t.Helper()
+		_, _, err := splitQuestionMatch(config)
+		assert.NotNil(err)
+	}
+	assertError(``)
+	assertError(`^Token:`)
+	assertError(`"^Token: 123`)
+	assertError(`"" 123`)
+	assertError(`"^Token:"`)
+}
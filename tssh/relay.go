@@ -0,0 +1,98 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const kDefaultForwardBufferSize = 32 * 1024
+
+var forwardBufferSize = kDefaultForwardBufferSize
+
+var forwardBufferPool = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, forwardBufferSize)
+		return &buffer
+	},
+}
+
+// parseBufferSize parses the size like `256K` or `1M`, which must be between 1K and 16M.
+func parseBufferSize(value string) (int, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	unit := 1
+	if strings.HasSuffix(value, "K") {
+		value, unit = value[:len(value)-1], 1024
+	} else if strings.HasSuffix(value, "M") {
+		value, unit = value[:len(value)-1], 1024*1024
+	}
+	size, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	if size*uint64(unit) < 1024 || size*uint64(unit) > 16*1024*1024 {
+		return 0, fmt.Errorf("out of range [1K, 16M]")
+	}
+	return int(size) * unit, nil
+}
+
+// initForwardBuffer sets the buffer size of the relays by `ForwardBufferSize`.
+func initForwardBuffer(args *sshArgs) {
+	value := getExOptionConfig(args, "ForwardBufferSize")
+	if value == "" {
+		return
+	}
+	size, err := parseBufferSize(value)
+	if err != nil {
+		warning("ForwardBufferSize %s is invalid: %v", value, err)
+		return
+	}
+	forwardBufferSize = size
+}
+
+// writerOnly and readerOnly hide the ReadFrom and WriteTo, so that our buffer is used.
+type writerOnly struct {
+	io.Writer
+}
+
+type readerOnly struct {
+	io.Reader
+}
+
+// relayCopy copies with a pooled buffer of `ForwardBufferSize`. One side of the relays is always an ssh channel
+// in userspace, so there is no zero-copy such as splice, and a larger buffer means fewer system calls.
+func relayCopy(dst io.Writer, src io.Reader) (int64, error) {
+	buffer := forwardBufferPool.Get().(*[]byte)
+	defer forwardBufferPool.Put(buffer)
+	if len(*buffer) != forwardBufferSize {
+		*buffer = make([]byte, forwardBufferSize)
+	}
+	return io.CopyBuffer(writerOnly{dst}, readerOnly{src}, *buffer)
+}
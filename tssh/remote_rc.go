@@ -0,0 +1,184 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	kRemoteRCMarkerPrefix = "TSSH_REMOTE_RC"
+	kRemoteRCQuietTime    = 300 * time.Millisecond
+	kRemoteRCStartTimeout = 3 * time.Second
+	kRemoteRCDoneTimeout  = 10 * time.Second
+)
+
+// remoteRCReader reads the remaining output of the server after the RemoteRC commands are sent, or the motd is dropped
+type remoteRCReader struct {
+	ch  <-chan []byte
+	buf []byte
+}
+
+func (r *remoteRCReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		buf, ok := <-r.ch
+		if !ok {
+			return 0, io.EOF
+		}
+		r.buf = buf
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// readServerOutput reads the output of the server into a channel, which is closed on EOF or error.
+func readServerOutput(serverOut io.Reader) <-chan []byte {
+	ch := make(chan []byte, 10)
+	go func() {
+		defer close(ch)
+		for {
+			buf := make([]byte, 32*1024)
+			n, err := serverOut.Read(buf)
+			if n > 0 {
+				ch <- buf[:n]
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// waitOutputQuiet collects the output until there is no output for the quiet time, or until the timeout,
+// and returns false if the channel is closed.
+func waitOutputQuiet(ch <-chan []byte, quiet, timeout time.Duration) ([]byte, bool) {
+	var output []byte
+	quietTimer := time.NewTimer(timeout)
+	defer quietTimer.Stop()
+	timeoutTimer := time.NewTimer(timeout)
+	defer timeoutTimer.Stop()
+	for {
+		select {
+		case buf, ok := <-ch:
+			if !ok {
+				return output, false
+			}
+			output = append(output, buf...)
+			quietTimer.Reset(quiet)
+		case <-quietTimer.C:
+			return output, true
+		case <-timeoutTimer.C:
+			return output, true
+		}
+	}
+}
+
+func getRemoteRC(args *sshArgs) []string {
+	var commands []string
+	for _, command := range getAllExOptionConfig(args, "RemoteRC") {
+		if command = strings.TrimSpace(command); command != "" {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
+
+// buildRemoteRCLine joins the commands behind a printf of the marker, the marker is split in the line,
+// so the echo of the line doesn't contain it, and the leading space keeps the line out of the shell history.
+func buildRemoteRCLine(commands []string, marker string) string {
+	return fmt.Sprintf(" printf '%%s_%%s\\n' %s %s; %s\r", kRemoteRCMarkerPrefix, marker, strings.Join(commands, "; "))
+}
+
+// skipRemoteRCEcho returns the output after the marker line, and whether the marker is found.
+func skipRemoteRCEcho(output []byte, marker string) ([]byte, bool) {
+	idx := bytes.Index(output, []byte(kRemoteRCMarkerPrefix+"_"+marker))
+	if idx < 0 {
+		return nil, false
+	}
+	output = output[idx+len(kRemoteRCMarkerPrefix)+1+len(marker):]
+	if bytes.HasPrefix(output, []byte("\r\n")) {
+		output = output[2:]
+	} else if bytes.HasPrefix(output, []byte("\n")) {
+		output = output[1:]
+	}
+	return output, true
+}
+
+// execRemoteRC sends the RemoteRC commands to the remote shell once its output settles down,
+// and hides the echo of them, so the user sees the shell as if the commands were in the remote rc file.
+func execRemoteRC(args *sshArgs, serverIn io.Writer, serverOut io.Reader) io.Reader {
+	commands := getRemoteRC(args)
+	if len(commands) == 0 {
+		return serverOut
+	}
+
+	ch := readServerOutput(serverOut)
+
+	// keep the output before the commands, such as the motd, and wait for the shell prompt
+	output, ok := waitOutputQuiet(ch, kRemoteRCQuietTime, kRemoteRCStartTimeout)
+	if !ok {
+		return bytes.NewReader(output)
+	}
+
+	randBytes := make([]byte, 8)
+	_, _ = rand.Read(randBytes)
+	marker := hex.EncodeToString(randBytes)
+	if err := writeAll(serverIn, []byte(buildRemoteRCLine(commands, marker))); err != nil {
+		warning("send RemoteRC commands failed: %v", err)
+		return io.MultiReader(bytes.NewReader(output), &remoteRCReader{ch: ch})
+	}
+	debug("RemoteRC commands sent: %s", strings.Join(commands, "; "))
+
+	// drop the echo of the commands until the marker is printed
+	var echo []byte
+	doneTimer := time.NewTimer(kRemoteRCDoneTimeout)
+	defer doneTimer.Stop()
+	for {
+		select {
+		case buf, ok := <-ch:
+			if !ok {
+				return bytes.NewReader(append(output, echo...))
+			}
+			echo = append(echo, buf...)
+			if remaining, found := skipRemoteRCEcho(echo, marker); found {
+				// erase the prompt before the commands, it will be printed again by the shell
+				output = append(append(output, "\r\x1b[K"...), remaining...)
+				return io.MultiReader(bytes.NewReader(output), &remoteRCReader{ch: ch})
+			}
+		case <-doneTimer.C:
+			warning("RemoteRC marker is not received in %v", kRemoteRCDoneTimeout)
+			return io.MultiReader(bytes.NewReader(append(output, echo...)), &remoteRCReader{ch: ch})
+		}
+	}
+}
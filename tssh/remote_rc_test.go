@@ -0,0 +1,87 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildRemoteRCLine(t *testing.T) {
+	assert := assert.New(t)
+	line := buildRemoteRCLine([]string{"source /etc/team_profile", "tmux attach"}, "0123abcd")
+	assert.Equal(" printf '%s_%s\\n' TSSH_REMOTE_RC 0123abcd; source /etc/team_profile; tmux attach\r", line)
+	assert.NotContains(line, "TSSH_REMOTE_RC_0123abcd")
+}
+
+func TestSkipRemoteRCEcho(t *testing.T) {
+	assert := assert.New(t)
+	assertSkip := func(output, expected string, found bool) {
+		t.Helper()
+		remaining, ok := skipRemoteRCEcho([]byte(output), "abcd")
+		assert.Equal(found, ok)
+		assert.Equal(expected, string(remaining))
+	}
+
+	assertSkip("", "", false)
+	assertSkip(" printf '%s_%s\\n' TSSH_REMOTE_RC abcd; cd /data\r\n", "", false)
+	assertSkip(" printf '%s_%s\\n' TSSH_REMOTE_RC abcd; cd /data\r\nTSSH_REMOTE_RC_abcd\r\n", "", true)
+	assertSkip("echo\r\nTSSH_REMOTE_RC_abcd\r\nuser@host:/data$ ", "user@host:/data$ ", true)
+	assertSkip("TSSH_REMOTE_RC_abcd\nprompt", "prompt", true)
+	assertSkip("TSSH_REMOTE_RC_abcdprompt", "prompt", true)
+	assertSkip("TSSH_REMOTE_RC_abce\r\n", "", false)
+}
+
+func TestExecRemoteRC(t *testing.T) {
+	assert := assert.New(t)
+
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	go func() {
+		_, _ = outWriter.Write([]byte("Welcome\r\nuser@host:~$ "))
+		line, err := bufio.NewReader(inReader).ReadString('\r')
+		if err != nil {
+			return
+		}
+		marker := regexp.MustCompile(`TSSH_REMOTE_RC ([0-9a-f]+);`).FindStringSubmatch(line)
+		if marker == nil {
+			return
+		}
+		_, _ = outWriter.Write([]byte(line + "\n"))
+		_, _ = outWriter.Write([]byte("TSSH_REMOTE_RC_" + marker[1] + "\r\nuser@host:/data$ "))
+		outWriter.Close()
+	}()
+
+	args := &sshArgs{Option: sshOption{map[string][]string{"remoterc": {"cd /data", " "}}}}
+	reader := execRemoteRC(args, inWriter, outReader)
+	output, err := io.ReadAll(reader)
+	assert.Nil(err)
+	assert.Equal("Welcome\r\nuser@host:~$ \r\x1b[Kuser@host:/data$ ", string(output))
+}
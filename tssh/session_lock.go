@@ -0,0 +1,268 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const kSessionLockPrompt = "Enter the lock password to unlock: "
+
+// sessionLock blanks and locks the local session UI after a period of no keyboard input,
+// until the lock password is entered. The output of the server is held back while locked.
+type sessionLock struct {
+	mutex     sync.Mutex
+	cond      *sync.Cond
+	serverIn  io.WriteCloser
+	serverOut io.Reader
+	dest      string
+	timeout   time.Duration
+	password  string
+	modes     *terminalModes
+	redraw    func()
+	lastInput time.Time
+	locked    bool
+	closed    bool
+	altScreen bool
+	escape    int
+	failures  int
+	input     []byte
+	display   []byte
+	err       error
+}
+
+func getSessionLockTimeout(args *sshArgs) time.Duration {
+	value := getExOptionConfig(args, "SessionLockTimeout")
+	if value == "" {
+		return 0
+	}
+	minutes, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		warning("SessionLockTimeout %s is invalid: %v", value, err)
+		return 0
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// redrawRemoteScreen makes the full-screen program redraw by changing the window size back and forth.
+func redrawRemoteScreen(session *ssh.Session) func() {
+	return func() {
+		width, height, err := getTerminalSize()
+		if err != nil || height <= 1 {
+			return
+		}
+		_ = session.WindowChange(height-1, width)
+		time.Sleep(100 * time.Millisecond)
+		_ = session.WindowChange(height, width)
+	}
+}
+
+// lockSession wraps the server input and output to lock the session after `SessionLockTimeout` minutes of inactivity.
+func lockSession(args *sshArgs, serverIn io.WriteCloser, serverOut io.Reader,
+	modes *terminalModes, redraw func()) (io.WriteCloser, io.Reader) {
+	timeout := getSessionLockTimeout(args)
+	if timeout <= 0 {
+		return serverIn, serverOut
+	}
+	password := getSecretConfig(args.Destination, "LockPassword")
+	if password == "" {
+		warning("SessionLockTimeout requires LockPassword or encLockPassword to unlock the session")
+		return serverIn, serverOut
+	}
+	l := &sessionLock{
+		serverIn:  serverIn,
+		serverOut: serverOut,
+		dest:      args.Destination,
+		timeout:   timeout,
+		password:  password,
+		modes:     modes,
+		redraw:    redraw,
+		lastInput: time.Now(),
+	}
+	l.cond = sync.NewCond(&l.mutex)
+	go l.pumpOutput()
+	go l.watchIdle()
+	debug("the session will be locked after %v of inactivity", timeout)
+	return l, l
+}
+
+func (l *sessionLock) pumpOutput() {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := l.serverOut.Read(buf)
+		l.mutex.Lock()
+		if err != nil && l.locked {
+			// don't reveal anything when the session ends while locked
+			n = 0
+			l.locked = false
+			l.display = append(l.display, "\x1b[2J\x1b[?1049l\x1b[2J\x1b[H"...)
+		}
+		for l.locked || len(l.display) > 0 && err == nil {
+			l.cond.Wait()
+		}
+		l.display = append(l.display, buf[:n]...)
+		if err != nil {
+			l.err = err
+			l.closed = true
+		}
+		l.cond.Broadcast()
+		l.mutex.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (l *sessionLock) watchIdle() {
+	for {
+		l.mutex.Lock()
+		if l.closed {
+			l.mutex.Unlock()
+			return
+		}
+		wait := l.timeout
+		if !l.locked {
+			if wait = time.Until(l.lastInput.Add(l.timeout)); wait <= 0 {
+				l.lock()
+				wait = l.timeout
+			}
+		}
+		l.mutex.Unlock()
+		time.Sleep(wait)
+	}
+}
+
+func (l *sessionLock) lock() {
+	debug("lock the session after %v of inactivity", l.timeout)
+	l.locked = true
+	l.altScreen = l.modes.isAlternateScreen()
+	l.display = append(l.display, l.modes.resetSequence()...)
+	l.display = append(l.display, fmt.Sprintf("\x1b[?1049h\x1b[2J\x1b[H\x1b[0;36m"+tr("The session to %s is locked after %v of inactivity.")+
+		"\x1b[0m\r\n\r\n%s", l.dest, l.timeout, tr(kSessionLockPrompt))...)
+	l.cond.Broadcast()
+}
+
+func (l *sessionLock) unlock() {
+	debug("unlock the session")
+	l.locked = false
+	l.failures = 0
+	l.lastInput = time.Now()
+	l.display = append(l.display, "\x1b[2J\x1b[?1049l"+l.modes.enableSequence()...)
+	if l.altScreen && l.redraw != nil {
+		go l.redraw()
+	}
+	l.cond.Broadcast()
+}
+
+func (l *sessionLock) Read(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for len(l.display) == 0 && l.err == nil {
+		l.cond.Wait()
+	}
+	if len(l.display) == 0 {
+		return 0, l.err
+	}
+	n := copy(p, l.display)
+	l.display = l.display[n:]
+	if len(l.display) == 0 {
+		l.display = nil
+		l.cond.Broadcast()
+	}
+	return n, nil
+}
+
+func (l *sessionLock) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	if !l.locked {
+		l.lastInput = time.Now()
+		l.mutex.Unlock()
+		return l.serverIn.Write(p)
+	}
+	failures := l.failures
+	for _, c := range p {
+		if l.inputByte(c) {
+			break
+		}
+	}
+	failed := l.failures > failures
+	l.mutex.Unlock()
+	if failed {
+		passwordRetryDelay(failures + 1)
+	}
+	return len(p), nil
+}
+
+// inputByte handles the keyboard input while locked, returns true if the session is unlocked.
+func (l *sessionLock) inputByte(c byte) bool {
+	switch {
+	case l.escape == 1:
+		// skip the escape sequences such as the arrow keys
+		if c == '[' || c == 'O' {
+			l.escape = 2
+		} else {
+			l.escape = 0
+		}
+	case l.escape == 2:
+		if c >= 0x40 && c <= 0x7e {
+			l.escape = 0
+		}
+	case c == 0x1b:
+		l.escape = 1
+	case c == '\r' || c == '\n':
+		matched := subtle.ConstantTimeCompare(l.input, []byte(l.password)) == 1
+		zeroBytes(l.input)
+		l.input = l.input[:0]
+		if matched {
+			l.unlock()
+			return true
+		}
+		l.failures++
+		l.display = append(l.display, "\r\n\x1b[0;31m"+tr("Incorrect lock password.")+"\x1b[0m\r\n"+tr(kSessionLockPrompt)...)
+		l.cond.Broadcast()
+	case c == 0x7f || c == 0x08:
+		if len(l.input) > 0 {
+			l.input = l.input[:len(l.input)-1]
+		}
+	case c == 0x15: // Ctrl+U
+		zeroBytes(l.input)
+		l.input = l.input[:0]
+	case c >= 0x20:
+		l.input = append(l.input, c)
+	}
+	return false
+}
+
+func (l *sessionLock) Close() error {
+	return l.serverIn.Close()
+}
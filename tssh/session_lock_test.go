@@ -0,0 +1,122 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type lockTestWriter struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (w *lockTestWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *lockTestWriter) Close() error {
+	return nil
+}
+
+func (w *lockTestWriter) String() string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.buf.String()
+}
+
+func TestSessionLock(t *testing.T) {
+	assert := assert.New(t)
+	modes := newTerminalModes()
+	_, _ = modes.Write([]byte("\x1b[?1049h\x1b[?1000h"))
+	serverIn := &lockTestWriter{}
+	outReader, outWriter := io.Pipe()
+	redrawn := make(chan struct{}, 1)
+	l := &sessionLock{
+		serverIn:  serverIn,
+		serverOut: outReader,
+		dest:      "server1",
+		timeout:   100 * time.Millisecond,
+		password:  "secret",
+		modes:     modes,
+		redraw:    func() { redrawn <- struct{}{} },
+		lastInput: time.Now(),
+	}
+	l.cond = sync.NewCond(&l.mutex)
+	go l.pumpOutput()
+	go l.watchIdle()
+
+	read := func() string {
+		t.Helper()
+		buf := make([]byte, 1024)
+		n, err := l.Read(buf)
+		assert.Nil(err)
+		return string(buf[:n])
+	}
+
+	go func() { _, _ = outWriter.Write([]byte("hello")) }()
+	assert.Equal("hello", read())
+	_, _ = l.Write([]byte("ls\r"))
+	assert.Equal("ls\r", serverIn.String())
+
+	// locked after the timeout, and the output is held back
+	screen := read()
+	assert.Contains(screen, "\x1b[?1000l")
+	assert.Contains(screen, "\x1b[?1049h\x1b[2J")
+	assert.Contains(screen, "is locked")
+	assert.Contains(screen, kSessionLockPrompt)
+	go func() { _, _ = outWriter.Write([]byte("world")) }()
+
+	// the input while locked is not sent to the server
+	_, _ = l.Write([]byte("secre\x1b[A\x7ft"))
+	_, _ = l.Write([]byte("\r"))
+	assert.Contains(read(), "Incorrect lock password")
+	_, _ = l.Write([]byte("\x15wrong\x15secret\r"))
+	assert.Equal("ls\r", serverIn.String())
+
+	assert.Equal("\x1b[2J\x1b[?1049l"+modes.enableSequence(), read())
+	assert.Equal("world", read())
+	select {
+	case <-redrawn:
+	case <-time.After(time.Second):
+		assert.Fail("the screen is not redrawn")
+	}
+
+	_, _ = l.Write([]byte("pwd\r"))
+	assert.Equal("ls\rpwd\r", serverIn.String())
+
+	outWriter.Close()
+	_, err := l.Read(make([]byte, 10))
+	assert.Equal(io.EOF, err)
+}
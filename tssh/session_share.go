@@ -0,0 +1,306 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	kShareReadOnly  = "ro"
+	kShareReadWrite = "rw"
+
+	// kShareDetachKey is Ctrl+] to detach from the shared session, as telnet does.
+	kShareDetachKey = 0x1d
+
+	kShareHeaderPrefix = "tssh-share "
+)
+
+// getShareSocketPath returns the socket path of the shared session, the pid of the sharing tssh is also accepted.
+func getShareSocketPath(target string) string {
+	if pid, err := strconv.Atoi(target); err == nil {
+		return filepath.Join(userHomeDir, ".ssh", fmt.Sprintf(".tssh_share_%d.sock", pid))
+	}
+	return resolveHomeDir(target)
+}
+
+type shareClient struct {
+	conn net.Conn
+	out  chan []byte
+}
+
+type sessionShare struct {
+	mode     string
+	listener net.Listener
+	serverIn io.WriteCloser
+	inMutex  sync.Mutex
+	mutex    sync.Mutex
+	clients  map[*shareClient]struct{}
+	modes    *terminalModes
+	closed   bool
+}
+
+// Write serializes the local input and the input of the attached read-write clients.
+func (s *sessionShare) Write(p []byte) (int, error) {
+	s.inMutex.Lock()
+	defer s.inMutex.Unlock()
+	return s.serverIn.Write(p)
+}
+
+func (s *sessionShare) Close() error {
+	return s.serverIn.Close()
+}
+
+func (s *sessionShare) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(conn, "%s%s\n", kShareHeaderPrefix, s.mode); err != nil {
+			conn.Close()
+			continue
+		}
+		client := &shareClient{conn: conn, out: make(chan []byte, 100)}
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		// restore the terminal modes set before the client attached, such as the bracketed paste of vim
+		if seq := s.modes.enableSequence(); seq != "" {
+			client.out <- []byte(seq)
+		}
+		s.clients[client] = struct{}{}
+		s.mutex.Unlock()
+		warning("a %s client attached to the shared session", s.mode)
+		audit("a %s client attached to the shared session", s.mode)
+		go s.handleOutput(client)
+		go s.handleInput(client)
+	}
+}
+
+func (s *sessionShare) handleOutput(client *shareClient) {
+	for buf := range client.out {
+		if _, err := client.conn.Write(buf); err != nil {
+			break
+		}
+	}
+	s.removeClient(client)
+}
+
+func (s *sessionShare) handleInput(client *shareClient) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := client.conn.Read(buf)
+		if n > 0 && s.mode == kShareReadWrite {
+			if _, err := s.Write(buf[:n]); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	s.removeClient(client)
+}
+
+func (s *sessionShare) removeClient(client *shareClient) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.clients[client]; !ok {
+		return
+	}
+	delete(s.clients, client)
+	close(client.out)
+	client.conn.Close()
+	debug("a %s client detached from the shared session", s.mode)
+}
+
+// broadcast sends the output to the attached clients, and drops the ones which are too slow to keep up.
+func (s *sessionShare) broadcast(buf []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.clients) == 0 {
+		return
+	}
+	data := append([]byte(nil), buf...)
+	for client := range s.clients {
+		select {
+		case client.out <- data:
+		default:
+			debug("drop the shared session client which is too slow")
+			delete(s.clients, client)
+			close(client.out)
+			client.conn.Close()
+		}
+	}
+}
+
+func (s *sessionShare) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.listener.Close()
+	for client := range s.clients {
+		delete(s.clients, client)
+		close(client.out)
+		client.conn.Close()
+	}
+}
+
+// shareSession listens on a local socket which only the same user could access,
+// and copies the output of the session to the clients attached by `tssh --attach <pid>`.
+func shareSession(args *sshArgs, serverIn io.WriteCloser, serverOut io.Reader,
+	modes *terminalModes) (io.WriteCloser, io.Reader, error) {
+	mode := strings.ToLower(args.Share)
+	if mode != kShareReadOnly && mode != kShareReadWrite {
+		return nil, nil, fmt.Errorf("invalid share mode [%s], should be %s or %s", args.Share, kShareReadOnly, kShareReadWrite)
+	}
+
+	path := getShareSocketPath(strconv.Itoa(os.Getpid()))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, nil, fmt.Errorf("mkdir [%s] failed: %v", filepath.Dir(path), err)
+	}
+	if isFileExist(path) {
+		_ = os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listen on [%s] failed: %v", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, nil, fmt.Errorf("chmod [%s] failed: %v", path, err)
+	}
+
+	share := &sessionShare{
+		mode:     mode,
+		listener: listener,
+		serverIn: serverIn,
+		clients:  make(map[*shareClient]struct{}),
+		modes:    modes,
+	}
+	onExitFuncs = append(onExitFuncs, share.close)
+	go share.serve()
+
+	reader, writer := io.Pipe()
+	go func() {
+		defer share.close()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := serverOut.Read(buf)
+			if n > 0 {
+				share.broadcast(buf[:n])
+				if _, err := writer.Write(buf[:n]); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				_ = writer.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "\033[0;36m"+tr("The session is shared ( %s ), attach to it by: tssh --attach %d")+"\033[0m\r\n", mode, os.Getpid())
+	return share, reader, nil
+}
+
+// execAttachSession attaches to the session shared by another tssh, and detaches by Ctrl+].
+func execAttachSession(args *sshArgs) (int, bool) {
+	path := getShareSocketPath(args.Attach)
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		toolsErrorExit("attach to the shared session [%s] failed: %v", path, err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	header, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(header, kShareHeaderPrefix) {
+		toolsErrorExit("[%s] is not a shared session", path)
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	mode := strings.TrimSpace(strings.TrimPrefix(header, kShareHeaderPrefix))
+
+	if isTerminal {
+		state, err := makeStdinRaw()
+		if err != nil {
+			toolsErrorExit("%v", err)
+		}
+		defer resetStdin(state)
+	}
+	toolsInfo("attach", "attached to the shared session ( %s ), press Ctrl+] to detach", mode)
+
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				idx := bytes.IndexByte(buf[:n], kShareDetachKey)
+				if idx >= 0 {
+					n = idx
+				}
+				if n > 0 && mode == kShareReadWrite {
+					if _, err := conn.Write(buf[:n]); err != nil {
+						break
+					}
+				}
+				if idx >= 0 {
+					break
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		conn.Close()
+	}()
+
+	// reset the terminal modes set by the shared session on detaching
+	modes := newTerminalModes()
+	_, _ = io.Copy(io.MultiWriter(os.Stdout, modes), reader)
+	fmt.Fprint(os.Stdout, modes.resetSequence())
+	fmt.Fprintf(os.Stderr, "\r\n")
+	toolsInfo("attach", "detached from the shared session")
+	return 0, true
+}
@@ -0,0 +1,136 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type shareTestWriter struct {
+	mutex sync.Mutex
+	buf   []byte
+}
+
+func (w *shareTestWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+func (w *shareTestWriter) Close() error {
+	return nil
+}
+
+func (w *shareTestWriter) String() string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return string(w.buf)
+}
+
+func TestShareSocketPath(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(filepath.Join(userHomeDir, ".ssh", ".tssh_share_123.sock"), getShareSocketPath("123"))
+	assert.Equal("/tmp/share.sock", getShareSocketPath("/tmp/share.sock"))
+}
+
+func TestShareSession(t *testing.T) {
+	assert := assert.New(t)
+	originalHomeDir := userHomeDir
+	defer func() {
+		userHomeDir = originalHomeDir
+	}()
+	userHomeDir = t.TempDir()
+	originalWarning := warning
+	defer func() {
+		warning = originalWarning
+	}()
+	warning = func(format string, a ...any) {}
+
+	assertShare := func(mode, expectedInput, previousOutput string) {
+		t.Helper()
+		serverIn := &shareTestWriter{}
+		outReader, outWriter := io.Pipe()
+		modes := newTerminalModes()
+		_, _ = modes.Write([]byte(previousOutput))
+		in, out, err := shareSession(&sshArgs{Share: mode}, serverIn, outReader, modes)
+		if !assert.Nil(err) {
+			return
+		}
+
+		conn, err := net.Dial("unix", getShareSocketPath(strconv.Itoa(os.Getpid())))
+		if !assert.Nil(err) {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		header, err := reader.ReadString('\n')
+		assert.Nil(err)
+		assert.Equal("tssh-share "+mode+"\n", header)
+		if seq := modes.enableSequence(); seq != "" {
+			restored := make([]byte, len(seq))
+			_, err = io.ReadFull(reader, restored)
+			assert.Nil(err)
+			assert.Equal(seq, string(restored))
+		}
+
+		_, _ = in.Write([]byte("local "))
+		_, _ = conn.Write([]byte("attached"))
+		assert.Eventually(func() bool { return serverIn.String() == expectedInput }, time.Second, 10*time.Millisecond)
+
+		go func() { _, _ = outWriter.Write([]byte("output")) }()
+		buf := make([]byte, 6)
+		_, err = io.ReadFull(out, buf)
+		assert.Nil(err)
+		assert.Equal("output", string(buf))
+		_, err = io.ReadFull(reader, buf)
+		assert.Nil(err)
+		assert.Equal("output", string(buf))
+
+		outWriter.Close()
+		_, err = out.Read(buf)
+		assert.Equal(io.EOF, err)
+		_, err = reader.Read(buf)
+		assert.NotNil(err)
+	}
+
+	assertShare("ro", "local ", "")
+	assertShare("rw", "local attached", "")
+	assertShare("ro", "local ", "\x1b[?1049h\x1b[?2004h")
+
+	_, _, err := shareSession(&sshArgs{Share: "yes"}, nil, nil, nil)
+	assert.NotNil(err)
+}
@@ -0,0 +1,186 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// kSignerProtocolVersion is the version of the `SignerCommand` protocol.
+//
+// The command is run once per request, it reads a JSON request from stdin and writes a JSON response to stdout:
+//
+//	{"version":1,"type":"list","host":"...","port":"22","user":"..."}
+//	=> {"keys":["ssh-ed25519 AAAA... comment"]}
+//
+//	{"version":1,"type":"sign","host":"...","port":"22","user":"...",
+//	 "key":"ssh-ed25519 AAAA...","algorithm":"ssh-ed25519","data":"<base64>"}
+//	=> {"signature":{"format":"ssh-ed25519","blob":"<base64>"}}
+//
+// Any response with a non-empty "error" fails the request. The stderr of the command is passed through,
+// while the tty is free for the command to interact with the user, e.g. PIN entry or approval.
+const kSignerProtocolVersion = 1
+
+type signerRequest struct {
+	Version   int    `json:"version"`
+	Type      string `json:"type"`
+	Host      string `json:"host"`
+	Port      string `json:"port"`
+	User      string `json:"user"`
+	Key       string `json:"key,omitempty"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Data      []byte `json:"data,omitempty"`
+}
+
+type signerSignature struct {
+	Format string `json:"format"`
+	Blob   []byte `json:"blob"`
+	Rest   []byte `json:"rest,omitempty"`
+}
+
+type signerResponse struct {
+	Error     string           `json:"error,omitempty"`
+	Keys      []string         `json:"keys,omitempty"`
+	Signature *signerSignature `json:"signature,omitempty"`
+}
+
+type signerCaller func(req *signerRequest) (*signerResponse, error)
+
+// commandSigner is a signer whose private key is held by the `SignerCommand`, e.g. in a HSM.
+type commandSigner struct {
+	pubKey ssh.PublicKey
+	call   signerCaller
+}
+
+func (s *commandSigner) PublicKey() ssh.PublicKey {
+	return s.pubKey
+}
+
+func (s *commandSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.SignWithAlgorithm(rand, data, "")
+}
+
+func (s *commandSigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	resp, err := s.call(&signerRequest{
+		Type:      "sign",
+		Key:       string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(s.pubKey))),
+		Algorithm: algorithm,
+		Data:      data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Signature == nil || resp.Signature.Format == "" || len(resp.Signature.Blob) == 0 {
+		return nil, fmt.Errorf("signer command returns no signature")
+	}
+	if algorithm != "" && resp.Signature.Format != algorithm {
+		return nil, fmt.Errorf("signer command returns signature [%s] but [%s] is requested", resp.Signature.Format, algorithm)
+	}
+	return &ssh.Signature{Format: resp.Signature.Format, Blob: resp.Signature.Blob, Rest: resp.Signature.Rest}, nil
+}
+
+func newSignerCaller(args *sshArgs, param *loginParam, command string) (signerCaller, error) {
+	argv, err := splitCommandLine(command)
+	if err != nil || len(argv) == 0 {
+		return nil, fmt.Errorf("split signer command [%s] failed: %v", command, err)
+	}
+	return func(req *signerRequest) (*signerResponse, error) {
+		req.Version = kSignerProtocolVersion
+		req.Host, req.Port, req.User = param.host, param.port, param.user
+		input, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		cmd := exec.Command(argv[0], argv[1:]...)
+		if err := setupLocalEnv(args, param, cmd); err != nil {
+			return nil, err
+		}
+		cmd.Stdin = bytes.NewReader(append(input, '\n'))
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("run signer command [%s] failed: %v", command, err)
+		}
+		var resp signerResponse
+		if err := json.Unmarshal(out, &resp); err != nil {
+			return nil, fmt.Errorf("parse the output of signer command [%s] failed: %v", command, err)
+		}
+		if resp.Error != "" {
+			return nil, fmt.Errorf("signer command [%s] %s failed: %s", command, req.Type, resp.Error)
+		}
+		return &resp, nil
+	}, nil
+}
+
+func listCommandSigners(call signerCaller) ([]*sshSigner, error) {
+	resp, err := call(&signerRequest{Type: "list"})
+	if err != nil {
+		return nil, err
+	}
+	var signers []*sshSigner
+	for _, key := range resp.Keys {
+		pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+		if err != nil {
+			warning("skip the invalid key [%s] from signer command: %v", key, err)
+			continue
+		}
+		signers = append(signers, &sshSigner{path: "SignerCommand", pubKey: pubKey,
+			signer: &commandSigner{pubKey: pubKey, call: call}})
+	}
+	return signers, nil
+}
+
+// getCommandSigners lists the public keys of the `SignerCommand`,
+// the signatures are delegated to the command as well.
+func getCommandSigners(args *sshArgs, param *loginParam) []*sshSigner {
+	command := getExOptionConfig(args, "SignerCommand")
+	if command == "" {
+		return nil
+	}
+	command = resolveHomeDir(expandTokens(command, args, param, "%hnpr"))
+	debug("exec signer command: %s", command)
+	call, err := newSignerCaller(args, param, command)
+	if err != nil {
+		warning("%v", err)
+		return nil
+	}
+	signers, err := listCommandSigners(call)
+	if err != nil {
+		warning("%v", err)
+		return nil
+	}
+	if len(signers) == 0 {
+		debug("signer command [%s] lists no keys", command)
+	}
+	return signers
+}
@@ -0,0 +1,94 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestCommandSigner(t *testing.T) {
+	assert := assert.New(t)
+	_, priKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	keySigner, err := ssh.NewSignerFromKey(priKey)
+	assert.Nil(err)
+	authorizedKey := string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(keySigner.PublicKey())))
+
+	var requests []*signerRequest
+	call := func(req *signerRequest) (*signerResponse, error) {
+		requests = append(requests, req)
+		switch req.Type {
+		case "list":
+			return &signerResponse{Keys: []string{authorizedKey + " hsm-key", "invalid key"}}, nil
+		case "sign":
+			if req.Key != authorizedKey {
+				return nil, fmt.Errorf("unknown key")
+			}
+			sig, err := keySigner.Sign(rand.Reader, req.Data)
+			if err != nil {
+				return nil, err
+			}
+			return &signerResponse{Signature: &signerSignature{Format: sig.Format, Blob: sig.Blob}}, nil
+		}
+		return nil, fmt.Errorf("unknown type")
+	}
+
+	originalWarning := warning
+	defer func() { warning = originalWarning }()
+	var warnings []string
+	warning = func(format string, a ...any) { warnings = append(warnings, fmt.Sprintf(format, a...)) }
+
+	signers, err := listCommandSigners(call)
+	assert.Nil(err)
+	assert.Equal(1, len(signers))
+	assert.Equal(1, len(warnings))
+	assert.Equal("SignerCommand", signers[0].path)
+	assert.Equal(keySigner.PublicKey().Marshal(), signers[0].PublicKey().Marshal())
+
+	data := []byte("session data")
+	sig, err := signers[0].SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoED25519)
+	assert.Nil(err)
+	assert.Nil(keySigner.PublicKey().Verify(data, sig))
+	assert.Equal("sign", requests[1].Type)
+	assert.Equal(ssh.KeyAlgoED25519, requests[1].Algorithm)
+	assert.Equal(data, requests[1].Data)
+
+	_, err = signers[0].SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+	assert.NotNil(err)
+
+	failed := &commandSigner{pubKey: keySigner.PublicKey(), call: func(req *signerRequest) (*signerResponse, error) {
+		return &signerResponse{}, nil
+	}}
+	_, err = failed.Sign(rand.Reader, data)
+	assert.NotNil(err)
+}
@@ -0,0 +1,145 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/armon/go-socks5"
+)
+
+type dynamicForwarder struct {
+	server   *socks5.Server
+	rules    *dynamicForwardRules
+	resolver socks5.NameResolver
+	dial     func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// bufferedConn reads the bytes peeked from the connection first.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// getDynamicForwardResolver resolves the hostnames on the server by default,
+// or with the local DNS if `DynamicForwardResolve local` is configured.
+func getDynamicForwardResolver(args *sshArgs) (socks5.NameResolver, error) {
+	switch mode := strings.ToLower(getExOptionConfig(args, "DynamicForwardResolve")); mode {
+	case "", "remote":
+		return &sshResolver{}, nil
+	case "local":
+		return &socks5.DNSResolver{}, nil
+	default:
+		return nil, fmt.Errorf("unknown DynamicForwardResolve option: %s", mode)
+	}
+}
+
+// serve handles both SOCKS5 and SOCKS4/4a clients.
+func (d *dynamicForwarder) serve(conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	version, err := reader.Peek(1)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	conn = &bufferedConn{Conn: conn, reader: reader}
+	if version[0] == 4 {
+		return d.serveSocks4(conn, reader)
+	}
+	activeForwards.Add(1)
+	defer activeForwards.Add(-1)
+	touchForwardActivity()
+	defer touchForwardActivity()
+	return d.server.ServeConn(&idleConn{conn})
+}
+
+func (d *dynamicForwarder) serveSocks4(conn net.Conn, reader *bufio.Reader) error {
+	reply := func(granted bool) error {
+		resp := []byte{0, 91, 0, 0, 0, 0, 0, 0}
+		if granted {
+			resp[1] = 90
+		}
+		return writeAll(conn, resp)
+	}
+	fail := func(err error) error {
+		_ = reply(false)
+		conn.Close()
+		return err
+	}
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		conn.Close()
+		return fmt.Errorf("read socks4 request failed: %v", err)
+	}
+	// the user id is ignored
+	if _, err := reader.ReadSlice(0); err != nil {
+		return fail(fmt.Errorf("read socks4 user id failed: %v", err))
+	}
+	if header[1] != socks5.ConnectCommand {
+		return fail(fmt.Errorf("unsupported socks4 command: %d", header[1]))
+	}
+
+	ctx := context.Background()
+	dest := &socks5.AddrSpec{Port: int(binary.BigEndian.Uint16(header[2:4])), IP: net.IP(header[4:8])}
+	// SOCKS4a: the IP 0.0.0.x is followed by the hostname
+	if header[4] == 0 && header[5] == 0 && header[6] == 0 && header[7] != 0 {
+		host, err := reader.ReadSlice(0)
+		if err != nil {
+			return fail(fmt.Errorf("read socks4a hostname failed: %v", err))
+		}
+		dest.FQDN = string(host[:len(host)-1])
+		_, dest.IP, err = d.resolver.Resolve(ctx, dest.FQDN)
+		if err != nil {
+			return fail(fmt.Errorf("resolve [%s] failed: %v", dest.FQDN, err))
+		}
+	}
+
+	if _, ok := d.rules.Allow(ctx, &socks5.Request{Version: 4, Command: socks5.ConnectCommand, DestAddr: dest}); !ok {
+		return fail(fmt.Errorf("connect to %s blocked by rules", dest.Address()))
+	}
+	remote, err := d.dial(ctx, "tcp", dest.Address())
+	if err != nil {
+		return fail(fmt.Errorf("connect to %s failed: %v", dest.Address(), err))
+	}
+	if err := reply(true); err != nil {
+		conn.Close()
+		remote.Close()
+		return err
+	}
+	netForward(conn, remote)
+	return nil
+}
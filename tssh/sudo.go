@@ -0,0 +1,91 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alessio/shellescape"
+)
+
+// kSudoScript runs the command by `sudo -S`, which reads the password from the first line of stdin,
+// and leaves the rest of stdin to the command. `-k` ignores the cached credential, so that sudo always
+// reads the password unless it's not required at all, e.g., NOPASSWD, which is probed by `sudo -n`
+// first, and then the password line is consumed by the shell builtin so the command never reads it.
+const kSudoScript = `if sudo -k -n -- sh -c : 2>/dev/null; then IFS= read -r p; unset p; exec sudo -k -n -- sh -c "$1"; fi; ` +
+	`exec sudo -k -S -p "" -- sh -c "$1"`
+
+// buildSudoCommand wraps the command to be run by sudo with the password from the stdin.
+func buildSudoCommand(command string) string {
+	return fmt.Sprintf("sh -c %s sh %s", shellescape.Quote(kSudoScript), shellescape.Quote(command))
+}
+
+// getSudoPassword returns SudoPassword or encSudoPassword of the destination, or else the login password.
+func getSudoPassword(args *sshArgs) string {
+	if password := getSecretConfig(args.Destination, "SudoPassword"); password != "" {
+		return password
+	}
+	return getSecretConfig(args.Destination, "Password")
+}
+
+// setupSudo returns the command wrapped for --sudo, and the password to be written to the stdin of it.
+func setupSudo(args *sshArgs, command string, tty bool) (string, []byte, error) {
+	if !args.Sudo {
+		return command, nil, nil
+	}
+	if strings.ToLower(getExOptionConfig(args, "EnableSudo")) == "no" {
+		return "", nil, fmt.Errorf("--sudo is disabled for %s by EnableSudo no", args.Destination)
+	}
+	if command == "" {
+		return "", nil, fmt.Errorf("--sudo requires a command to run")
+	}
+	if tty {
+		// the password would be echoed by the remote pseudo-terminal
+		return "", nil, fmt.Errorf("--sudo doesn't work with a pseudo-terminal, remove -t or add -T")
+	}
+
+	var password []byte
+	if secret := getSudoPassword(args); secret != "" {
+		password = []byte(secret)
+	} else {
+		var err error
+		if password, err = readSecret(fmt.Sprintf(tr("[sudo] password for %s: "), args.Destination)); err != nil {
+			return "", nil, fmt.Errorf("read sudo password failed: %v", err)
+		}
+	}
+	debug("run the command with sudo, the password is written to stdin")
+	return buildSudoCommand(command), password, nil
+}
+
+// writeSudoPassword writes the password as the first line of the stdin, and zeros it.
+func writeSudoPassword(serverIn io.Writer, password []byte) error {
+	defer zeroBytes(password)
+	line := append(password, '\n')
+	defer zeroBytes(line)
+	return writeAll(serverIn, line)
+}
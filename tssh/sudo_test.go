@@ -0,0 +1,75 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetupSudo(t *testing.T) {
+	assert := assert.New(t)
+	newArgs := func(sudo bool, options map[string][]string) *sshArgs {
+		return &sshArgs{Destination: "test_setup_sudo", Sudo: sudo, Option: sshOption{options}}
+	}
+
+	command, password, err := setupSudo(newArgs(false, nil), "ls /root", false)
+	assert.Nil(err)
+	assert.Equal("ls /root", command)
+	assert.Nil(password)
+
+	originalBatchMode := batchMode
+	defer func() { batchMode = originalBatchMode }()
+	batchMode = true
+	_, _, err = setupSudo(newArgs(true, nil), "ls /root", false)
+	assert.EqualError(err, "read sudo password failed: prompt [[sudo] password for test_setup_sudo] refused: BatchMode is enabled")
+
+	_, _, err = setupSudo(newArgs(true, map[string][]string{"enablesudo": {"no"}}), "ls", false)
+	assert.EqualError(err, "--sudo is disabled for test_setup_sudo by EnableSudo no")
+	_, _, err = setupSudo(newArgs(true, nil), "", false)
+	assert.EqualError(err, "--sudo requires a command to run")
+	_, _, err = setupSudo(newArgs(true, nil), "ls", true)
+	assert.EqualError(err, "--sudo doesn't work with a pseudo-terminal, remove -t or add -T")
+}
+
+func TestBuildSudoCommand(t *testing.T) {
+	assert := assert.New(t)
+	script := `'if sudo -k -n -- sh -c : 2>/dev/null; then IFS= read -r p; unset p; exec sudo -k -n -- sh -c "$1"; fi; ` +
+		`exec sudo -k -S -p "" -- sh -c "$1"'`
+	assert.Equal(`sh -c `+script+` sh 'ls /root'`, buildSudoCommand("ls /root"))
+	assert.Equal(`sh -c `+script+` sh 'echo "it'"'"'s $HOME"'`, buildSudoCommand(`echo "it's $HOME"`))
+}
+
+func TestWriteSudoPassword(t *testing.T) {
+	assert := assert.New(t)
+	var buf bytes.Buffer
+	password := []byte("secret")
+	assert.Nil(writeSudoPassword(&buf, password))
+	assert.Equal("secret\n", buf.String())
+	assert.Equal(make([]byte, 6), password)
+}
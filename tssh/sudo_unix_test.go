@@ -0,0 +1,111 @@
+//go:build !windows
+
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// kFakeSudo behaves as sudo does for the options used by kSudoScript: it never caches the credential,
+// reads the password from stdin byte by byte for -S, and fails for -n if a password is required.
+const kFakeSudo = `#!/bin/sh
+nonInteractive=false readStdin=false
+while [ $# -gt 0 ]; do
+	case "$1" in
+	-k) ;;
+	-n) nonInteractive=true ;;
+	-S) readStdin=true ;;
+	-p) shift ;;
+	--) shift; break ;;
+	esac
+	shift
+done
+if [ "$FAKE_SUDO_NOPASSWD" != "yes" ]; then
+	if $nonInteractive || ! $readStdin; then
+		echo "sudo: a password is required" >&2
+		exit 1
+	fi
+	IFS= read -r password
+	if [ "$password" != "$FAKE_SUDO_PASSWORD" ]; then
+		echo "sudo: incorrect password attempt" >&2
+		exit 1
+	fi
+fi
+exec "$@"
+`
+
+func runSudoCommand(t *testing.T, env []string, command, stdin string) (string, error) {
+	t.Helper()
+	cmd := exec.Command("sh", "-c", buildSudoCommand(command))
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = strings.NewReader(stdin)
+	output, err := cmd.Output()
+	return string(output), err
+}
+
+func TestRunSudoCommand(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	assert.Nil(os.WriteFile(filepath.Join(dir, "sudo"), []byte(kFakeSudo), 0700))
+	path := "PATH=" + dir + string(os.PathListSeparator) + os.Getenv("PATH")
+
+	for _, nopasswd := range []string{"no", "yes"} {
+		env := []string{path, "FAKE_SUDO_PASSWORD=secret", "FAKE_SUDO_NOPASSWD=" + nopasswd}
+		output, err := runSudoCommand(t, env, `read -r line && echo "got $line"; cat`, "secret\nline 1\nline 2\n")
+		assert.Nil(err, nopasswd)
+		assert.Equal("got line 1\nline 2\n", output, nopasswd)
+	}
+
+	env := []string{path, "FAKE_SUDO_PASSWORD=secret", "FAKE_SUDO_NOPASSWD=no"}
+	output, err := runSudoCommand(t, env, "cat", "wrong\nline 1\n")
+	assert.NotNil(err)
+	assert.Equal("", output)
+}
+
+// TestRunRealSudoCommand runs against the real sudo, which requires the password of the current user
+// in TSSH_TEST_SUDO_PASSWORD, e.g., with `Defaults timestamp_timeout=0` in the sudoers.
+func TestRunRealSudoCommand(t *testing.T) {
+	password := os.Getenv("TSSH_TEST_SUDO_PASSWORD")
+	if _, err := exec.LookPath("sudo"); err != nil || password == "" {
+		t.Skip("sudo or TSSH_TEST_SUDO_PASSWORD is not available")
+	}
+	assert := assert.New(t)
+	for i := 0; i < 2; i++ {
+		output, err := runSudoCommand(t, nil, `id -u && cat`, password+"\nline 1\n")
+		assert.Nil(err)
+		assert.Equal("0\nline 1\n", output)
+	}
+	_, err := runSudoCommand(t, nil, `id -u`, "wrong password\n")
+	assert.NotNil(err)
+}
@@ -0,0 +1,57 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+const kEventLogSource = "tssh"
+
+// eventLogger writes to the Windows Event Log, since there is no syslog on Windows.
+type eventLogger struct {
+	log *eventlog.Log
+}
+
+func (l *eventLogger) Debug(m string) error {
+	return l.log.Info(1, m)
+}
+
+func (l *eventLogger) Info(m string) error {
+	return l.log.Info(2, m)
+}
+
+func (l *eventLogger) Warning(m string) error {
+	return l.log.Warning(3, m)
+}
+
+func openSyslog(facility string) (sysLogger, error) {
+	log, err := eventlog.Open(kEventLogSource)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLogger{log}, nil
+}
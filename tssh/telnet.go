@@ -0,0 +1,293 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetOptEcho = 1
+	telnetOptSGA  = 3
+	telnetOptNAWS = 31
+)
+
+// telnetConn strips the telnet commands from the console server output,
+// and replies the option negotiations so that the login flow can be expect-driven.
+type telnetConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mutex  sync.Mutex
+	naws   bool
+	width  int
+	height int
+}
+
+func newTelnetConn(conn net.Conn) *telnetConn {
+	return &telnetConn{conn: conn, reader: bufio.NewReaderSize(conn, 32*1024)}
+}
+
+func (t *telnetConn) writeRaw(buf []byte) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return writeAll(t.conn, buf)
+}
+
+func (t *telnetConn) negotiate(cmd, opt byte) {
+	var reply byte
+	switch cmd {
+	case telnetDO:
+		if opt == telnetOptNAWS {
+			reply = telnetWILL
+		} else {
+			reply = telnetWONT
+		}
+	case telnetDONT:
+		if opt == telnetOptNAWS {
+			t.mutex.Lock()
+			t.naws = false
+			t.mutex.Unlock()
+		}
+		return
+	case telnetWILL:
+		switch opt {
+		case telnetOptEcho, telnetOptSGA:
+			reply = telnetDO
+		default:
+			reply = telnetDONT
+		}
+	case telnetWONT:
+		return
+	}
+	debug("telnet negotiate: %d %d => %d %d", cmd, opt, reply, opt)
+	if err := t.writeRaw([]byte{telnetIAC, reply, opt}); err != nil {
+		warning("telnet negotiate failed: %v", err)
+		return
+	}
+	if cmd == telnetDO && opt == telnetOptNAWS {
+		t.mutex.Lock()
+		t.naws = true
+		width, height := t.width, t.height
+		t.mutex.Unlock()
+		t.setWindowSize(width, height)
+	}
+}
+
+func (t *telnetConn) skipSubNegotiation() error {
+	for {
+		b, err := t.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != telnetIAC {
+			continue
+		}
+		b, err = t.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == telnetSE {
+			return nil
+		}
+	}
+}
+
+func (t *telnetConn) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && (n == 0 || t.reader.Buffered() > 0) {
+		b, err := t.reader.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		if b != telnetIAC {
+			p[n] = b
+			n++
+			continue
+		}
+		cmd, err := t.reader.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		switch cmd {
+		case telnetIAC:
+			p[n] = telnetIAC
+			n++
+		case telnetDO, telnetDONT, telnetWILL, telnetWONT:
+			opt, err := t.reader.ReadByte()
+			if err != nil {
+				return n, err
+			}
+			t.negotiate(cmd, opt)
+		case telnetSB:
+			if err := t.skipSubNegotiation(); err != nil {
+				return n, err
+			}
+		default:
+			// NOP, GA and other commands are meaningless for us.
+		}
+	}
+	return n, nil
+}
+
+func (t *telnetConn) Write(p []byte) (int, error) {
+	buf := make([]byte, 0, len(p))
+	for _, b := range p {
+		if b == telnetIAC {
+			buf = append(buf, telnetIAC)
+		}
+		buf = append(buf, b)
+	}
+	if err := t.writeRaw(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (t *telnetConn) Close() error {
+	return t.conn.Close()
+}
+
+func (t *telnetConn) setWindowSize(width, height int) {
+	t.mutex.Lock()
+	t.width, t.height = width, height
+	naws := t.naws
+	t.mutex.Unlock()
+	if !naws || width <= 0 || height <= 0 {
+		return
+	}
+	buf := []byte{telnetIAC, telnetSB, telnetOptNAWS}
+	for _, b := range []byte{byte(width >> 8), byte(width), byte(height >> 8), byte(height)} {
+		if b == telnetIAC {
+			buf = append(buf, telnetIAC)
+		}
+		buf = append(buf, b)
+	}
+	buf = append(buf, telnetIAC, telnetSE)
+	if err := t.writeRaw(buf); err != nil {
+		debug("telnet set window size failed: %v", err)
+	}
+}
+
+func dialConsoleServer(args *sshArgs, param *loginParam) (net.Conn, error) {
+	execPreConnect(args, param, nil)
+
+	// proxy command
+	if param.command != "" {
+		conn, cmd, err := execProxyCommand(args, param)
+		if err != nil {
+			return nil, fmt.Errorf("exec proxy command [%s] failed: %v", cmd, err)
+		}
+		return conn, nil
+	}
+
+	// no proxy
+	if len(param.proxy) == 0 {
+		conn, err := net.DialTimeout("tcp", param.addr, 10*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("dial tcp [%s] failed: %v", param.addr, err)
+		}
+		return conn, nil
+	}
+
+	// has proxies
+	client, proxy, err := connectProxies(param.proxy)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialWithTimeout(client, "tcp", param.addr, 10*time.Second)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("proxy [%s] dial tcp [%s] failed: %v", proxy, param.addr, err)
+	}
+	return conn, nil
+}
+
+// telnetStart logs in to the console server configured by ProxyTelnet.
+// There is no ssh on the final hop, so the login flow is driven by ExpectCount etc.
+func telnetStart(args *sshArgs, addr string) error {
+	param, err := getLoginParam(args)
+	if err != nil {
+		return err
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid ProxyTelnet [%s]: %v", addr, err)
+	}
+	param.host, param.port, param.addr = host, port, joinHostPort(host, port)
+
+	resetLogLevel := setupLogLevel(args)
+	debug("login to [%s], console server: %s", args.Destination, param.addr)
+	conn, err := dialConsoleServer(args, param)
+	resetLogLevel()
+	if err != nil {
+		return err
+	}
+	debug("login to [%s] success", args.Destination)
+
+	tconn := newTelnetConn(conn)
+	defer tconn.Close()
+
+	if isTerminal {
+		onTerminalResize(tconn.setWindowSize)
+	}
+
+	serverOut, _ := execExpectInteractions(args, tconn, tconn, nil)
+
+	if isTerminal {
+		state, err := makeStdinRaw()
+		if err != nil {
+			return err
+		}
+		defer resetStdin(state)
+	}
+
+	go func() {
+		_, _ = io.Copy(tconn, os.Stdin)
+	}()
+
+	cleanupForGC()
+	if _, err := io.Copy(os.Stdout, serverOut); err != nil && err != io.EOF {
+		debug("console server output failed: %v", err)
+	}
+	return nil
+}
@@ -34,6 +34,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/mattn/go-isatty"
 	"golang.org/x/sys/windows"
 	"golang.org/x/term"
 )
@@ -41,6 +42,7 @@ import (
 type stdinState struct {
 	state    *term.State
 	settings *string
+	mode     *uint32
 }
 
 const CP_UTF8 uint32 = 65001
@@ -78,7 +80,10 @@ func enableVirtualTerminal() error {
 		windows.SetConsoleMode(windows.Handle(inHandle), inMode)
 	})
 	if err := windows.SetConsoleMode(windows.Handle(inHandle), inMode|windows.ENABLE_VIRTUAL_TERMINAL_INPUT); err != nil {
-		return err
+		// older Windows 10 builds don't support virtual terminal input, stdin will be made raw without it,
+		// and the console only reads the characters, the keys such as arrows and F1-F12 are not sent
+		debug("enable virtual terminal input failed: %v", err)
+		vtInputUnsupported = true
 	}
 
 	outHandle, err := syscall.GetStdHandle(syscall.STD_OUTPUT_HANDLE)
@@ -93,12 +98,22 @@ func enableVirtualTerminal() error {
 	})
 	if err := windows.SetConsoleMode(windows.Handle(outHandle),
 		outMode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING|windows.DISABLE_NEWLINE_AUTO_RETURN); err != nil {
-		return err
+		// older Windows 10 builds reject DISABLE_NEWLINE_AUTO_RETURN
+		if err := windows.SetConsoleMode(windows.Handle(outHandle),
+			outMode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+var vtInputUnsupported bool
+
+// isCygwinPty reports whether running in the pty of Cygwin or MSYS2 ( e.g., mintty of Git Bash ),
+// which is a named pipe rather than a console, so stty is the only way to control it.
+var isCygwinPty = isatty.IsCygwinTerminal(os.Stdin.Fd())
+
 var sttyCommandExists *bool
 
 func sttyExecutable() bool {
@@ -156,6 +171,14 @@ func sttySize() (int, int, error) {
 }
 
 func setupVirtualTerminal() error {
+	if isCygwinPty {
+		if !sttyExecutable() {
+			return fmt.Errorf("stty is required in the cygwin pty but not found in PATH")
+		}
+		debug("running in the cygwin pty")
+		return nil
+	}
+
 	// enable virtual terminal
 	if err := enableVirtualTerminal(); err != nil {
 		if !sttyExecutable() {
@@ -178,15 +201,61 @@ func setupVirtualTerminal() error {
 	return nil
 }
 
+// enableMouseInput passes mouse reporting sequences through to the remote,
+// which requires the quick edit mode to be disabled until the console mode is restored.
+func enableMouseInput() {
+	handle := windows.Handle(os.Stdin.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return
+	}
+	mode = (mode | windows.ENABLE_EXTENDED_FLAGS | windows.ENABLE_MOUSE_INPUT | windows.ENABLE_WINDOW_INPUT) &^
+		windows.ENABLE_QUICK_EDIT_MODE
+	if err := windows.SetConsoleMode(handle, mode); err != nil {
+		debug("enable mouse input failed: %v", err)
+	}
+}
+
+// makeRawWithoutVirtualTerminal makes stdin raw on older Windows 10 builds, which fail to set
+// ENABLE_VIRTUAL_TERMINAL_INPUT in term.MakeRaw. The keys are not translated to the VT sequences,
+// so only the characters and the control keys such as Ctrl+C work.
+func makeRawWithoutVirtualTerminal() (*stdinState, error) {
+	handle := windows.Handle(os.Stdin.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return nil, err
+	}
+	raw := mode &^ (windows.ENABLE_ECHO_INPUT | windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_LINE_INPUT)
+	if err := windows.SetConsoleMode(handle, raw); err != nil {
+		return nil, err
+	}
+	return &stdinState{nil, nil, &mode}, nil
+}
+
 func makeStdinRaw() (*stdinState, error) {
+	if isCygwinPty {
+		return sttyMakeStdinRaw()
+	}
+
 	state, err := term.MakeRaw(int(os.Stdin.Fd()))
 	if err == nil {
-		return &stdinState{state, nil}, nil
+		enableMouseInput()
+		return &stdinState{state, nil, nil}, nil
+	}
+
+	if vtInputUnsupported {
+		if s, e := makeRawWithoutVirtualTerminal(); e == nil {
+			return s, nil
+		}
 	}
 
 	if !sttyExecutable() {
 		return nil, fmt.Errorf("terminal make raw failed: %v", err)
 	}
+	return sttyMakeStdinRaw()
+}
+
+func sttyMakeStdinRaw() (*stdinState, error) {
 	settings, err := sttySettings()
 	if err != nil {
 		return nil, fmt.Errorf("get stty settings failed: %v", err)
@@ -194,7 +263,7 @@ func makeStdinRaw() (*stdinState, error) {
 	if err := sttyMakeRaw(); err != nil {
 		return nil, fmt.Errorf("stty make raw failed: %v", err)
 	}
-	return &stdinState{nil, &settings}, nil
+	return &stdinState{nil, &settings, nil}, nil
 }
 
 func resetStdin(s *stdinState) {
@@ -206,9 +275,16 @@ func resetStdin(s *stdinState) {
 		sttyReset(*s.settings)
 		s.settings = nil
 	}
+	if s.mode != nil {
+		_ = windows.SetConsoleMode(windows.Handle(os.Stdin.Fd()), *s.mode)
+		s.mode = nil
+	}
 }
 
 func getTerminalSize() (int, int, error) {
+	if isCygwinPty {
+		return sttySize()
+	}
 	handle, err := syscall.GetStdHandle(syscall.STD_OUTPUT_HANDLE)
 	if err != nil {
 		if sttyExecutable() {
@@ -216,8 +292,8 @@ func getTerminalSize() (int, int, error) {
 		}
 		return 0, 0, err
 	}
-	var info windows.ConsoleScreenBufferInfo
-	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(handle), &info); err != nil {
+	info, err := getConsoleScreenBufferInfo(windows.Handle(handle))
+	if err != nil {
 		if sttyExecutable() {
 			return sttySize()
 		}
@@ -226,11 +302,29 @@ func getTerminalSize() (int, int, error) {
 	return int(info.Window.Right-info.Window.Left) + 1, int(info.Window.Bottom-info.Window.Top) + 1, nil
 }
 
+func getConsoleScreenBufferInfo(handle windows.Handle) (*windows.ConsoleScreenBufferInfo, error) {
+	var info windows.ConsoleScreenBufferInfo
+	if err := windows.GetConsoleScreenBufferInfo(handle, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
 func onTerminalResize(setTerminalSize func(int, int)) {
+	// querying the console is cheap, so poll frequently to propagate resizing promptly,
+	// but spawning stty is not, so poll it less often.
+	interval := 100 * time.Millisecond
+	if isCygwinPty {
+		interval = time.Second
+	} else if handle, err := syscall.GetStdHandle(syscall.STD_OUTPUT_HANDLE); err != nil {
+		interval = time.Second
+	} else if _, err := getConsoleScreenBufferInfo(windows.Handle(handle)); err != nil {
+		interval = time.Second
+	}
 	go func() {
 		columns, rows, _ := getTerminalSize()
 		for {
-			time.Sleep(time.Second)
+			time.Sleep(interval)
 			width, height, err := getTerminalSize()
 			if err != nil {
 				continue
@@ -0,0 +1,183 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// kTrackedPrivateModes are the DEC private modes which the full-screen programs usually enable,
+// in the order to enable them, and they are reset in the reverse order.
+var kTrackedPrivateModes = []int{
+	1049, // alternate screen buffer
+	1047, // alternate screen buffer
+	47,   // alternate screen buffer
+	1,    // application cursor keys
+	25,   // cursor visible, reset means show the cursor
+	1000, // mouse tracking
+	1002, // mouse tracking of button events
+	1003, // mouse tracking of any events
+	1005, // mouse in utf-8 encoding
+	1006, // mouse in sgr encoding
+	1015, // mouse in urxvt encoding
+	1004, // focus in and out events
+	2004, // bracketed paste
+}
+
+// terminalModes tracks the terminal modes set by the output of the remote programs,
+// so that they can be restored for an attached client, or be reset if the session drops.
+type terminalModes struct {
+	mutex  sync.Mutex
+	modes  map[int]bool
+	keypad bool
+	tail   []byte
+}
+
+func newTerminalModes() *terminalModes {
+	return &terminalModes{modes: make(map[int]bool)}
+}
+
+func (t *terminalModes) Write(p []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	data := p
+	if len(t.tail) > 0 {
+		data = append(t.tail, p...)
+		t.tail = nil
+	}
+	for i := 0; i < len(data); i++ {
+		if data[i] != '\x1b' {
+			continue
+		}
+		if i+1 >= len(data) {
+			t.keepTail(data[i:])
+			break
+		}
+		switch data[i+1] {
+		case '=':
+			t.keypad = true
+			continue
+		case '>':
+			t.keypad = false
+			continue
+		case '[':
+		default:
+			continue
+		}
+		if i+2 >= len(data) {
+			t.keepTail(data[i:])
+			break
+		}
+		if data[i+2] != '?' {
+			continue
+		}
+		j := i + 3
+		for j < len(data) && (data[j] >= '0' && data[j] <= '9' || data[j] == ';') {
+			j++
+		}
+		if j >= len(data) {
+			t.keepTail(data[i:])
+			break
+		}
+		if data[j] == 'h' || data[j] == 'l' {
+			for _, param := range strings.Split(string(data[i+3:j]), ";") {
+				if mode, err := strconv.Atoi(param); err == nil {
+					t.modes[mode] = data[j] == 'h'
+				}
+			}
+		}
+		i = j
+	}
+	return len(p), nil
+}
+
+// keepTail keeps the unfinished escape sequence for the next write, the too long one is a garbage.
+func (t *terminalModes) keepTail(tail []byte) {
+	if len(tail) < 64 {
+		t.tail = append([]byte(nil), tail...)
+	}
+}
+
+func (t *terminalModes) isModeSet(mode int) bool {
+	enabled, ok := t.modes[mode]
+	if mode == 25 {
+		// the cursor is visible by default
+		return ok && !enabled
+	}
+	return enabled
+}
+
+// isAlternateScreen returns whether the remote program is running in the alternate screen buffer.
+func (t *terminalModes) isAlternateScreen() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.isModeSet(1049) || t.isModeSet(1047) || t.isModeSet(47)
+}
+
+// enableSequence returns the escape sequence to enable the current modes in another terminal.
+func (t *terminalModes) enableSequence() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var buf strings.Builder
+	for _, mode := range kTrackedPrivateModes {
+		if !t.isModeSet(mode) {
+			continue
+		}
+		if mode == 25 {
+			buf.WriteString("\x1b[?25l")
+		} else {
+			buf.WriteString("\x1b[?" + strconv.Itoa(mode) + "h")
+		}
+	}
+	if t.keypad {
+		buf.WriteString("\x1b=")
+	}
+	return buf.String()
+}
+
+// resetSequence returns the escape sequence to reset the modes which are left enabled.
+func (t *terminalModes) resetSequence() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var buf strings.Builder
+	if t.keypad {
+		buf.WriteString("\x1b>")
+	}
+	for i := len(kTrackedPrivateModes) - 1; i >= 0; i-- {
+		mode := kTrackedPrivateModes[i]
+		if !t.isModeSet(mode) {
+			continue
+		}
+		if mode == 25 {
+			buf.WriteString("\x1b[?25h")
+		} else {
+			buf.WriteString("\x1b[?" + strconv.Itoa(mode) + "l")
+		}
+	}
+	return buf.String()
+}
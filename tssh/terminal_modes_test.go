@@ -0,0 +1,64 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTerminalModes(t *testing.T) {
+	assert := assert.New(t)
+	assertModes := func(outputs []string, enable, reset string) {
+		t.Helper()
+		modes := newTerminalModes()
+		for _, output := range outputs {
+			n, err := modes.Write([]byte(output))
+			assert.Nil(err)
+			assert.Equal(len(output), n)
+		}
+		assert.Equal(enable, modes.enableSequence())
+		assert.Equal(reset, modes.resetSequence())
+	}
+
+	assertModes(nil, "", "")
+	assertModes([]string{"hello \x1b[31mworld\x1b[0m\r\n"}, "", "")
+	assertModes([]string{"\x1b[?2004h"}, "\x1b[?2004h", "\x1b[?2004l")
+	assertModes([]string{"\x1b[?2004h$ vim\r\n\x1b[?2004l"}, "", "")
+	assertModes([]string{"\x1b[?1049h\x1b[?1h\x1b=\x1b[?25l\x1b[?1006;1000h"},
+		"\x1b[?1049h\x1b[?1h\x1b[?25l\x1b[?1000h\x1b[?1006h\x1b=",
+		"\x1b>\x1b[?1006l\x1b[?1000l\x1b[?25h\x1b[?1l\x1b[?1049l")
+	assertModes([]string{"\x1b[?1049h\x1b[?1h\x1b=", "\x1b[?1l\x1b>\x1b[?1049l"}, "", "")
+	assertModes([]string{"\x1b[?25l\x1b[?25h"}, "", "")
+	assertModes([]string{"\x1b[?1234h\x1b[?12h"}, "", "")
+
+	// the escape sequences split into multiple writes
+	assertModes([]string{"abc\x1b", "[?2004h"}, "\x1b[?2004h", "\x1b[?2004l")
+	assertModes([]string{"abc\x1b[", "?1004h"}, "\x1b[?1004h", "\x1b[?1004l")
+	assertModes([]string{"\x1b[?10", "04;20", "04h"}, "\x1b[?1004h\x1b[?2004h", "\x1b[?2004l\x1b[?1004l")
+	assertModes([]string{"\x1b", "=", "x"}, "\x1b=", "\x1b>")
+}
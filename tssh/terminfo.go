@@ -0,0 +1,171 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const kDefaultTermType = "xterm-256color"
+
+var termNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]*$`)
+
+// getWindowSize returns the initial window size for the pty request, `WindowSize 120x40` overrides
+// the local columns and rows, and `WindowSize 120x0` overrides the columns only.
+func getWindowSize(args *sshArgs, width, height int) (int, int) {
+	size := getExOptionConfig(args, "WindowSize")
+	if size == "" {
+		return width, height
+	}
+	cols, rows, ok := strings.Cut(strings.ToLower(size), "x")
+	c, err1 := strconv.Atoi(strings.TrimSpace(cols))
+	r, err2 := strconv.Atoi(strings.TrimSpace(rows))
+	if !ok || err1 != nil || err2 != nil || c < 0 || r < 0 {
+		warning("invalid WindowSize option: %s", size)
+		return width, height
+	}
+	if c > 0 {
+		width = c
+	}
+	if r > 0 {
+		height = r
+	}
+	return width, height
+}
+
+func isRemoteTermKnown(client *ssh.Client, term string) (bool, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return false, err
+	}
+	defer session.Close()
+	err = session.Run(fmt.Sprintf("infocmp %s >/dev/null 2>&1", term))
+	if err == nil {
+		return true, nil
+	}
+	if e, ok := err.(*ssh.ExitError); ok && e.ExitStatus() != 127 {
+		return false, nil
+	}
+	return false, err
+}
+
+func uploadTerminfo(client *ssh.Client, term string) error {
+	terminfo, err := exec.Command("infocmp", "-x", term).Output()
+	if err != nil {
+		return fmt.Errorf("local infocmp [%s] failed: %v", term, err)
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.Stdin = bytes.NewReader(terminfo)
+	if output, err := session.CombinedOutput("mkdir -p ~/.terminfo && tic -x -o ~/.terminfo /dev/stdin"); err != nil {
+		if msg := string(bytes.TrimSpace(output)); msg != "" {
+			return fmt.Errorf("remote tic failed: %s", msg)
+		}
+		return fmt.Errorf("remote tic failed: %v", err)
+	}
+	return nil
+}
+
+// getTerminalType returns the terminal type for the pty request.
+//
+// Term: the terminal type of the host, which takes precedence over TerminfoProvision.
+// TerminfoProvision no: always xterm-256color, which is the default.
+// TerminfoProvision fallback: the local TERM if the remote knows it, or else TerminfoFallback.
+// TerminfoProvision upload: upload the local terminfo entry if the remote doesn't know it.
+// TerminfoProvision ask: ask the user whether to upload it.
+func getTerminalType(args *sshArgs, client *ssh.Client) string {
+	if term := getExOptionConfig(args, "Term"); term != "" {
+		if termNameRegexp.MatchString(term) {
+			return term
+		}
+		warning("invalid Term option: %s", term)
+	}
+
+	mode := strings.ToLower(getExOptionConfig(args, "TerminfoProvision"))
+	if mode == "" || mode == "no" {
+		return kDefaultTermType
+	}
+
+	fallback := getExOptionConfig(args, "TerminfoFallback")
+	if fallback == "" {
+		fallback = kDefaultTermType
+	}
+	term := os.Getenv("TERM")
+	if term == "" || term == fallback {
+		return fallback
+	}
+	if !termNameRegexp.MatchString(term) {
+		debug("invalid terminal type [%s], fallback to [%s]", term, fallback)
+		return fallback
+	}
+
+	known, err := isRemoteTermKnown(client, term)
+	if err != nil {
+		debug("check terminal type [%s] failed: %v", term, err)
+		return fallback
+	}
+	if known {
+		debug("terminal type [%s] is known on the remote", term)
+		return term
+	}
+
+	switch mode {
+	case "fallback":
+		debug("terminal type [%s] is unknown on the remote, fallback to [%s]", term, fallback)
+		return fallback
+	case "upload":
+	case "ask":
+		if !askYesOrNo(fmt.Sprintf(tr("The terminal type '%s' is unknown on the remote host.\r\n"+
+			"Upload the terminfo entry via tic (yes/no)? "), term)) {
+			return fallback
+		}
+	default:
+		warning("unknown TerminfoProvision option: %s", mode)
+		return fallback
+	}
+
+	if err := uploadTerminfo(client, term); err != nil {
+		warning("upload terminfo [%s] failed: %v", term, err)
+		return fallback
+	}
+	if known, _ := isRemoteTermKnown(client, term); !known {
+		warning("terminal type [%s] is still unknown after uploading, fallback to [%s]", term, fallback)
+		return fallback
+	}
+	debug("upload terminfo [%s] success", term)
+	return term
+}
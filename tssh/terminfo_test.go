@@ -0,0 +1,80 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowSize(t *testing.T) {
+	assert := assert.New(t)
+	originalWarning := warning
+	defer func() {
+		warning = originalWarning
+	}()
+	warning = func(format string, a ...any) {}
+
+	assertSize := func(size string, width, height int) {
+		t.Helper()
+		args := &sshArgs{Option: sshOption{map[string][]string{"windowsize": {size}}}}
+		w, h := getWindowSize(args, 80, 24)
+		assert.Equal(width, w)
+		assert.Equal(height, h)
+	}
+
+	assertSize("120x40", 120, 40)
+	assertSize("120X40", 120, 40)
+	assertSize("120 x 40", 120, 40)
+	assertSize("120x0", 120, 24)
+	assertSize("0x50", 80, 50)
+	assertSize("120", 80, 24)
+	assertSize("axb", 80, 24)
+	assertSize("-1x40", 80, 24)
+}
+
+func TestTermOption(t *testing.T) {
+	assert := assert.New(t)
+	originalWarning := warning
+	defer func() {
+		warning = originalWarning
+	}()
+	warning = func(format string, a ...any) {}
+
+	assertTerm := func(term, expected string) {
+		t.Helper()
+		args := &sshArgs{Option: sshOption{map[string][]string{
+			"term":              {term},
+			"terminfoprovision": {"no"},
+		}}}
+		assert.Equal(expected, getTerminalType(args, nil))
+	}
+
+	assertTerm("vt100", "vt100")
+	assertTerm("screen-256color", "screen-256color")
+	assertTerm("bad term", kDefaultTermType)
+}
@@ -29,6 +29,7 @@ import (
 	"crypto/sha1"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -72,6 +73,20 @@ func expandTokens(str string, args *sshArgs, param *loginParam, tokens string) s
 			buf.WriteString(param.user)
 		case 'n':
 			buf.WriteString(args.Destination)
+		case 'j':
+			buf.WriteString(strings.Join(param.proxy, ","))
+		case 'k':
+			if alias := getOptionConfig(args, "HostKeyAlias"); alias != "" {
+				buf.WriteString(alias)
+			} else {
+				buf.WriteString(args.Destination)
+			}
+		case 'd':
+			buf.WriteString(userHomeDir)
+		case 'u':
+			buf.WriteString(getLocalUsername())
+		case 'i':
+			buf.WriteString(strconv.Itoa(os.Getuid()))
 		case 'l':
 			buf.WriteString(getHostname())
 		case 'L':
@@ -95,3 +110,44 @@ func expandTokens(str string, args *sshArgs, param *loginParam, tokens string) s
 	}
 	return buf.String()
 }
+
+// expandEnvs expands the ${VAR} environment variables, the unset ones are kept as is
+func expandEnvs(str string) string {
+	var buf strings.Builder
+	for {
+		begin := strings.Index(str, "${")
+		if begin < 0 {
+			break
+		}
+		end := strings.IndexByte(str[begin:], '}')
+		if end < 0 {
+			warning("environment variable in [%s] is not closed", str)
+			break
+		}
+		end += begin
+		buf.WriteString(str[:begin])
+		name := str[begin+2 : end]
+		if value, ok := os.LookupEnv(name); ok && name != "" {
+			buf.WriteString(value)
+		} else {
+			warning("environment variable [%s] is not set", name)
+			buf.WriteString(str[begin : end+1])
+		}
+		str = str[end+1:]
+	}
+	buf.WriteString(str)
+	return buf.String()
+}
+
+// expandPath expands the environment variables, the %-tokens and the ~ home dir in a path
+func expandPath(path string, args *sshArgs, param *loginParam, tokens string) string {
+	return resolveHomeDir(expandTokens(expandEnvs(path), args, param, tokens))
+}
+
+// expandHostName expands the %h token in HostName to the original host alias
+func expandHostName(hostName, alias string) string {
+	if !strings.ContainsRune(hostName, '%') {
+		return hostName
+	}
+	return expandTokens(hostName, &sshArgs{Destination: alias}, &loginParam{host: alias}, "%h")
+}
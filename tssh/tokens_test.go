@@ -48,8 +48,15 @@ func TestExpandTokens(t *testing.T) {
 	}()
 	getHostname = func() string { return "myhostname.mydomain.com" }
 
+	originalUserHomeDir := userHomeDir
+	defer func() {
+		userHomeDir = originalUserHomeDir
+	}()
+	userHomeDir = "/home/penny"
+
 	args := &sshArgs{
 		Destination: "dest",
+		Option:      sshOption{map[string][]string{"hostkeyalias": {""}}},
 	}
 	param := &loginParam{
 		host: "127.0.0.1",
@@ -85,9 +92,82 @@ func TestExpandTokens(t *testing.T) {
 	assertControlPath("%L", "myhostname", "")
 	assertControlPath("%l", "myhostname.mydomain.com", "")
 
+	assertControlPath("%d/.ssh/%k", "/home/penny/.ssh/dest", "")
+	args.Option.options["hostkeyalias"] = []string{"alias"}
+	assertControlPath("%k", "alias", "")
+	args.Option.options["hostkeyalias"] = []string{""}
+
 	assertControlPath("/A/%C/B", "/A/07f25c03a322b120bcaa54d2dd0a618f2673cb1c/B", "")
 
 	assertControlPath("%j", "%j", "token [%j] in [%j] is not supported")
-	assertControlPath("p_%h_%d", "p_127.0.0.1_%d", "token [%d] in [p_%h_%d] is not supported yet")
+	assertControlPath("p_%h_%T", "p_127.0.0.1_%T", "token [%T] in [p_%h_%T] is not supported")
 	assertControlPath("h%", "h%", "[h%] ends with % is invalid")
+
+	param.proxy = []string{"jump1", "jump2"}
+	assertSetEnv := func(original, expanded, result string) {
+		t.Helper()
+		output = ""
+		assert.Equal(expanded, expandTokens(original, args, param, "%hnprjlLC"))
+		assert.Equal(result, output)
+	}
+
+	assertSetEnv("%j", "jump1,jump2", "")
+	assertSetEnv("%n@%h:%p via %j", "dest@127.0.0.1:1337 via jump1,jump2", "")
+	param.proxy = nil
+	assertSetEnv("[%j]", "[]", "")
+}
+
+func TestExpandEnvs(t *testing.T) {
+	assert := assert.New(t)
+	originalWarning := warning
+	defer func() {
+		warning = originalWarning
+	}()
+	var output string
+	warning = func(format string, a ...any) {
+		output = fmt.Sprintf(format, a...)
+	}
+	t.Setenv("TSSH_TEST_DIR", "/data/keys")
+	t.Setenv("TSSH_TEST_EMPTY", "")
+
+	assertEnvs := func(original, expanded, result string) {
+		t.Helper()
+		output = ""
+		assert.Equal(expanded, expandEnvs(original))
+		assert.Equal(result, output)
+	}
+
+	assertEnvs("", "", "")
+	assertEnvs("~/.ssh/id_rsa", "~/.ssh/id_rsa", "")
+	assertEnvs("${TSSH_TEST_DIR}/id_rsa", "/data/keys/id_rsa", "")
+	assertEnvs("a${TSSH_TEST_EMPTY}b${TSSH_TEST_DIR}", "ab/data/keys", "")
+	assertEnvs("$TSSH_TEST_DIR", "$TSSH_TEST_DIR", "")
+	assertEnvs("${TSSH_TEST_UNSET}/x", "${TSSH_TEST_UNSET}/x", "environment variable [TSSH_TEST_UNSET] is not set")
+	assertEnvs("${}", "${}", "environment variable [] is not set")
+	assertEnvs("/a/${TSSH_TEST_DIR", "/a/${TSSH_TEST_DIR", "environment variable in [/a/${TSSH_TEST_DIR] is not closed")
+}
+
+func TestExpandHostName(t *testing.T) {
+	assert := assert.New(t)
+	originalWarning := warning
+	defer func() {
+		warning = originalWarning
+	}()
+	var output string
+	warning = func(format string, a ...any) {
+		output = fmt.Sprintf(format, a...)
+	}
+
+	assertHostName := func(hostName, alias, expanded, result string) {
+		t.Helper()
+		output = ""
+		assert.Equal(expanded, expandHostName(hostName, alias))
+		assert.Equal(result, output)
+	}
+
+	assertHostName("", "web1", "", "")
+	assertHostName("10.0.0.1", "web1", "10.0.0.1", "")
+	assertHostName("%h.internal.example.com", "web1", "web1.internal.example.com", "")
+	assertHostName("%h%%", "web1", "web1%", "")
+	assertHostName("%p.example.com", "web1", "%p.example.com", "token [%p] in [%p.example.com] is not supported")
 }
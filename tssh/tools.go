@@ -102,19 +102,19 @@ func (p *toolsProgress) stopProgress() {
 }
 
 func toolsInfo(tool, format string, a ...any) {
-	fmt.Fprintf(os.Stderr, fmt.Sprintf("\033[0;36m[%s] %s\033[0m\r\n", tool, format), a...)
+	fmt.Fprintf(os.Stderr, fmt.Sprintf("\033[0;36m[%s] %s\033[0m\r\n", tool, tr(format)), a...)
 }
 
 func toolsWarn(tool, format string, a ...any) {
-	fmt.Fprintf(os.Stderr, fmt.Sprintf("\033[0;33m[%s] %s\033[0m\r\n", tool, format), a...)
+	fmt.Fprintf(os.Stderr, fmt.Sprintf("\033[0;33m[%s] %s\033[0m\r\n", tool, tr(format)), a...)
 }
 
 func toolsSucc(tool, format string, a ...any) {
-	fmt.Fprintf(os.Stderr, fmt.Sprintf("\033[0;32m[%s] %s\033[0m\r\n", tool, format), a...)
+	fmt.Fprintf(os.Stderr, fmt.Sprintf("\033[0;32m[%s] %s\033[0m\r\n", tool, tr(format)), a...)
 }
 
 func toolsErrorExit(format string, a ...any) {
-	fmt.Fprintf(os.Stderr, fmt.Sprintf("\033[0;31m%s\033[0m\r\n", format), a...)
+	fmt.Fprintf(os.Stderr, fmt.Sprintf("\033[0;31m%s\033[0m\r\n", tr(format)), a...)
 	os.Exit(-1)
 }
 
@@ -375,10 +375,20 @@ func isFileNotExistOrEmpty(path string) bool {
 func execLocalTools(args *sshArgs) (int, bool) {
 	switch {
 	case args.Ver:
+		if gitMode {
+			fmt.Fprintln(os.Stderr, args.Version())
+			return 0, true
+		}
 		fmt.Println(args.Version())
 		return 0, true
 	case args.EncSecret:
 		return execEncodeSecret()
+	case args.PruneKnownHost:
+		return execPruneKnownHosts(args)
+	case args.Attach != "":
+		return execAttachSession(args)
+	case args.Check:
+		return execCheckHosts(args)
 	case args.NewHost || len(os.Args) == 1 && isFileNotExistOrEmpty(userConfig.configPath):
 		return execNewHost(args)
 	default:
@@ -0,0 +1,198 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+type checkResult struct {
+	Alias     string  `json:"alias"`
+	Addr      string  `json:"addr"`
+	Via       string  `json:"via,omitempty"`
+	Reachable bool    `json:"reachable"`
+	LatencyMs float64 `json:"latency_ms,omitempty"`
+	Banner    string  `json:"banner,omitempty"`
+	Auth      string  `json:"auth,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+func (r *checkResult) ok() bool {
+	return r.Reachable && r.Error == ""
+}
+
+// checkJumpMutex serializes the logins of the jump hosts, as the login is not concurrency safe.
+var checkJumpMutex sync.Mutex
+
+// checkHost connects to the host directly or via the configured proxies, and reads the ssh banner.
+// The jump hosts are logged in one by one in the process, and shared by the hosts behind them.
+// The auth is checked by login in batch mode with a separate tssh, as the login is not concurrency safe.
+func checkHost(host *sshHost, auth bool) *checkResult {
+	result := &checkResult{Alias: host.Alias}
+	args := &sshArgs{Destination: host.Alias}
+	param, err := getLoginParam(args)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Addr = param.addr
+	if param.command != "" {
+		result.Via = "ProxyCommand"
+	} else if len(param.proxy) > 0 {
+		result.Via = strings.Join(param.proxy, ",")
+	}
+
+	jump := param.command == "" && len(param.proxy) > 0
+	if jump {
+		checkJumpMutex.Lock()
+	}
+	dial, err := getProbeDialer(args, param)
+	if jump {
+		checkJumpMutex.Unlock()
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	beginTime := time.Now()
+	conn, err := dial()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Reachable = true
+	result.LatencyMs = float64(time.Since(beginTime).Microseconds()) / 1000
+	_ = conn.SetDeadline(time.Now().Add(kProbeTimeout))
+	result.Banner, err = readServerVersion(bufio.NewReader(conn))
+	conn.Close()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	if !auth {
+		return result
+	}
+	cmd := newTsshCommand([]string{"-T", "-oBatchMode=yes", fmt.Sprintf("-oConnectTimeout=%d", kProbeTimeout/time.Second)},
+		host.Alias, "exit")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		result.Auth = "failed"
+		result.Error = strings.TrimSpace(string(output))
+		if result.Error == "" {
+			result.Error = err.Error()
+		}
+		return result
+	}
+	result.Auth = "ok"
+	return result
+}
+
+// checkHosts checks the hosts concurrently, and returns the results in the order of the hosts.
+// The jump host connections are closed after all the hosts are checked.
+func checkHosts(hosts []*sshHost, auth bool) []*checkResult {
+	defer closeJumpClients()
+	results := make([]*checkResult, len(hosts))
+	index := make(map[*sshHost]int, len(hosts))
+	for i, host := range hosts {
+		index[host] = i
+	}
+	forEachHost(hosts, func(host *sshHost) func() {
+		result := checkHost(host, auth)
+		return func() { results[index[host]] = result }
+	})
+	return results
+}
+
+func writeCheckTable(writer io.Writer, results []*checkResult) {
+	w := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "HOST\tADDRESS\tVIA\tSTATUS\tLATENCY\tAUTH\tDETAIL\n")
+	for _, r := range results {
+		status := "up"
+		if !r.Reachable {
+			status = "down"
+		} else if !r.ok() {
+			status = "error"
+		}
+		latency, detail, auth, via := "-", r.Banner, r.Auth, r.Via
+		if r.Reachable {
+			latency = fmt.Sprintf("%.1fms", r.LatencyMs)
+		}
+		if r.Error != "" {
+			detail = strings.Join(strings.Fields(r.Error), " ")
+		}
+		if auth == "" {
+			auth = "-"
+		}
+		if via == "" {
+			via = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Alias, r.Addr, via, status, latency, auth, detail)
+	}
+	_ = w.Flush()
+}
+
+// getCheckHosts returns the configured hosts which match the comma-separated patterns, or all hosts if no pattern.
+func getCheckHosts(pattern string) []*sshHost {
+	var hosts []*sshHost
+	for _, host := range getAllHosts() {
+		if pattern == "" || matchPatternList(host.Alias, pattern) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+func execCheckHosts(args *sshArgs) (int, bool) {
+	hosts := getCheckHosts(args.Destination)
+	if len(hosts) == 0 {
+		toolsErrorExit("no host matches [%s]", args.Destination)
+	}
+	// no prompt could be answered when checking the hosts concurrently
+	batchMode = true
+
+	results := checkHosts(hosts, args.CheckAuth)
+	if args.CheckJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(results)
+	} else {
+		writeCheckTable(os.Stdout, results)
+	}
+	for _, r := range results {
+		if !r.ok() {
+			return 11, true
+		}
+	}
+	return 0, true
+}
@@ -0,0 +1,74 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadServerVersion(t *testing.T) {
+	assert := assert.New(t)
+	assertVersion := func(data, version, errMsg string) {
+		t.Helper()
+		v, err := readServerVersion(bufio.NewReader(strings.NewReader(data)))
+		assert.Equal(version, v)
+		if errMsg == "" {
+			assert.Nil(err)
+		} else if assert.NotNil(err) {
+			assert.Contains(err.Error(), errMsg)
+		}
+	}
+
+	assertVersion("SSH-2.0-OpenSSH_9.6\r\n", "SSH-2.0-OpenSSH_9.6", "")
+	assertVersion("SSH-2.0-dropbear\n", "SSH-2.0-dropbear", "")
+	assertVersion("welcome\r\nSSH-2.0-OpenSSH_9.6\r\n", "SSH-2.0-OpenSSH_9.6", "")
+	assertVersion("HTTP/1.1 400 Bad Request\r\n", "", "read version failed")
+	assertVersion(strings.Repeat("hello\n", 60), "", "no ssh version received")
+}
+
+func TestWriteCheckTable(t *testing.T) {
+	assert := assert.New(t)
+	var buf bytes.Buffer
+	writeCheckTable(&buf, []*checkResult{
+		{Alias: "web", Addr: "10.0.0.1:22", Reachable: true, LatencyMs: 1.25, Banner: "SSH-2.0-OpenSSH_9.6", Auth: "ok"},
+		{Alias: "db", Addr: "10.0.0.2:2022", Via: "jump", Error: "dial tcp 10.0.0.2:2022: i/o timeout"},
+		{Alias: "app", Addr: "10.0.0.3:22", Reachable: true, LatencyMs: 3, Error: "no ssh version received"},
+	})
+	assert.Equal(""+
+		"HOST  ADDRESS        VIA   STATUS  LATENCY  AUTH  DETAIL\n"+
+		"web   10.0.0.1:22    -     up      1.2ms    ok    SSH-2.0-OpenSSH_9.6\n"+
+		"db    10.0.0.2:2022  jump  down    -        -     dial tcp 10.0.0.2:2022: i/o timeout\n"+
+		"app   10.0.0.3:22    -     error   3.0ms    -     no ssh version received\n", buf.String())
+
+	assert.True((&checkResult{Reachable: true}).ok())
+	assert.False((&checkResult{Reachable: true, Error: "auth failed"}).ok())
+	assert.False((&checkResult{}).ok())
+}
@@ -0,0 +1,477 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	kTransferBlockSize       = 1024 * 1024
+	kDefaultTransferChannels = 4
+	kMaxTransferChannels     = 32
+)
+
+type transferRange struct {
+	offset int64
+	length int64
+}
+
+func getTransferChannels(args *sshArgs) int {
+	if value := getExOptionConfig(args, "TransferChannels"); value != "" {
+		channels, err := strconv.Atoi(value)
+		if err == nil && channels > 0 && channels <= kMaxTransferChannels {
+			return channels
+		}
+		warning("TransferChannels %s is invalid, it should be 1 to %d", value, kMaxTransferChannels)
+	}
+	return kDefaultTransferChannels
+}
+
+// splitTransferRanges splits the file into at most channels ranges which are aligned to the dd block size.
+func splitTransferRanges(size int64, channels int) []transferRange {
+	blocks := (size + kTransferBlockSize - 1) / kTransferBlockSize
+	blocksPerRange := (blocks + int64(channels) - 1) / int64(channels)
+	if blocksPerRange == 0 {
+		blocksPerRange = 1
+	}
+	var ranges []transferRange
+	for offset := int64(0); offset < size; offset += blocksPerRange * kTransferBlockSize {
+		length := blocksPerRange * kTransferBlockSize
+		if offset+length > size {
+			length = size - offset
+		}
+		ranges = append(ranges, transferRange{offset, length})
+	}
+	return ranges
+}
+
+// quoteRemotePath quotes the remote path for the shell, but keeps the leading `~/` to be expanded.
+func quoteRemotePath(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		return "~/" + shellescape.Quote(path[2:])
+	}
+	return shellescape.Quote(path)
+}
+
+func runRemoteCommand(client *ssh.Client, cmd string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	output, err := session.CombinedOutput(cmd)
+	if err != nil {
+		if errMsg := string(bytes.TrimSpace(output)); errMsg != "" {
+			return "", fmt.Errorf("%s", errMsg)
+		}
+		return "", err
+	}
+	return string(output), nil
+}
+
+func getRemoteFileSize(client *ssh.Client, path string) (int64, error) {
+	output, err := runRemoteCommand(client, fmt.Sprintf("wc -c < %s", path))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+}
+
+type transferCounter struct {
+	total int64
+	done  atomic.Int64
+}
+
+func (c *transferCounter) Write(p []byte) (int, error) {
+	c.done.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// showTransferProgress prints the progress until the returned function is called.
+func showTransferProgress(tool string, counter *transferCounter) func() {
+	beginTime := time.Now()
+	ticker := time.NewTicker(500 * time.Millisecond)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	show := func(end string) {
+		done := counter.done.Load()
+		speed := int64(float64(done) / time.Since(beginTime).Seconds())
+		fmt.Fprintf(os.Stderr, "\r\033[0;36m[%s] %s / %s ( %s/s )\033[0m\033[K%s",
+			tool, formatBytes(done), formatBytes(counter.total), formatBytes(speed), end)
+	}
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ticker.C:
+				show("")
+			case <-stop:
+				show("\r\n")
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(stop)
+		wg.Wait()
+	}
+}
+
+// transferRanges runs the transfer of each range in its own session concurrently.
+func transferRanges(ranges []transferRange, transfer func(transferRange) error) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(ranges))
+	for i, r := range ranges {
+		wg.Add(1)
+		go func(i int, r transferRange) {
+			defer wg.Done()
+			errs[i] = transfer(r)
+		}(i, r)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uploadRange(client *ssh.Client, file *os.File, path string, r transferRange, counter *transferCounter) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	cmd := fmt.Sprintf("dd of=%s bs=%d seek=%d conv=notrunc 2>/dev/null", path, kTransferBlockSize, r.offset/kTransferBlockSize)
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+	reader := io.TeeReader(io.NewSectionReader(file, r.offset, r.length), counter)
+	if _, err := io.Copy(stdin, reader); err != nil {
+		return fmt.Errorf("upload range at %d failed: %v", r.offset, err)
+	}
+	stdin.Close()
+	if err := session.Wait(); err != nil {
+		return fmt.Errorf("upload range at %d failed: %v %s", r.offset, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+func downloadRange(client *ssh.Client, file *os.File, path string, r transferRange, counter *transferCounter) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	blocks := (r.length + kTransferBlockSize - 1) / kTransferBlockSize
+	cmd := fmt.Sprintf("dd if=%s bs=%d skip=%d count=%d 2>/dev/null", path, kTransferBlockSize, r.offset/kTransferBlockSize, blocks)
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+	writer := io.MultiWriter(io.NewOffsetWriter(file, r.offset), counter)
+	n, err := io.Copy(writer, stdout)
+	if err != nil {
+		return fmt.Errorf("download range at %d failed: %v", r.offset, err)
+	}
+	if err := session.Wait(); err != nil {
+		return fmt.Errorf("download range at %d failed: %v", r.offset, err)
+	}
+	if n != r.length {
+		return fmt.Errorf("download range at %d got %d bytes, expected %d", r.offset, n, r.length)
+	}
+	return nil
+}
+
+// splitTransferPaths splits `src:dst`, the upload source may be a Windows path with the drive letter,
+// so the last colon is used, while the download source is a remote path, so the first colon is used.
+func splitTransferPaths(paths string, upload bool) (string, string, error) {
+	idx := strings.IndexByte(paths, ':')
+	if upload {
+		idx = strings.LastIndexByte(paths, ':')
+	}
+	if idx <= 0 || idx == len(paths)-1 {
+		return "", "", fmt.Errorf("invalid transfer paths [%s], it should be src:dst", paths)
+	}
+	return paths[:idx], paths[idx+1:], nil
+}
+
+func execUploadFile(args *sshArgs, client *ssh.Client) error {
+	localPath, remotePath, err := splitTransferPaths(args.UploadFile, true)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(resolveHomeDir(localPath))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	path := quoteRemotePath(remotePath)
+	if _, err := runRemoteCommand(client, fmt.Sprintf(": > %s", path)); err != nil {
+		return fmt.Errorf("create [%s] failed: %v", remotePath, err)
+	}
+
+	ranges := splitTransferRanges(size, getTransferChannels(args))
+	counter := &transferCounter{total: size}
+	beginTime := time.Now()
+	stopProgress := showTransferProgress("UploadFile", counter)
+	err = transferRanges(ranges, func(r transferRange) error {
+		return uploadRange(client, file, path, r, counter)
+	})
+	stopProgress()
+	if err != nil {
+		return err
+	}
+
+	remoteSize, err := getRemoteFileSize(client, path)
+	if err != nil {
+		return fmt.Errorf("get size of [%s] failed: %v", remotePath, err)
+	}
+	if remoteSize != size {
+		return fmt.Errorf("size of [%s] is %d, expected %d", remotePath, remoteSize, size)
+	}
+	if getTransferVerify(args) {
+		if err := verifyTransferredFile(func(cmd string) (string, error) {
+			return runRemoteCommand(client, cmd)
+		}, resolveHomeDir(localPath), remotePath); err != nil {
+			return err
+		}
+	}
+	toolsSucc("UploadFile", "uploaded %s to [%s] in %v over %d channels", formatBytes(size), remotePath,
+		time.Since(beginTime).Round(time.Millisecond), len(ranges))
+	return nil
+}
+
+func execDownloadFile(args *sshArgs, client *ssh.Client) error {
+	remotePath, localPath, err := splitTransferPaths(args.DownloadFile, false)
+	if err != nil {
+		return err
+	}
+	path := quoteRemotePath(remotePath)
+	size, err := getRemoteFileSize(client, path)
+	if err != nil {
+		return fmt.Errorf("get size of [%s] failed: %v", remotePath, err)
+	}
+	file, err := os.OpenFile(resolveHomeDir(localPath), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := file.Truncate(size); err != nil {
+		return err
+	}
+
+	ranges := splitTransferRanges(size, getTransferChannels(args))
+	counter := &transferCounter{total: size}
+	beginTime := time.Now()
+	stopProgress := showTransferProgress("DownloadFile", counter)
+	err = transferRanges(ranges, func(r transferRange) error {
+		return downloadRange(client, file, path, r, counter)
+	})
+	stopProgress()
+	if err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if getTransferVerify(args) {
+		if err := verifyTransferredFile(func(cmd string) (string, error) {
+			return runRemoteCommand(client, cmd)
+		}, resolveHomeDir(localPath), remotePath); err != nil {
+			return err
+		}
+	}
+	toolsSucc("DownloadFile", "downloaded %s to [%s] in %v over %d channels", formatBytes(size), localPath,
+		time.Since(beginTime).Round(time.Millisecond), len(ranges))
+	return nil
+}
+
+func copyRange(srcClient, dstClient *ssh.Client, srcPath, dstPath string, r transferRange, counter *transferCounter) error {
+	srcSession, err := srcClient.NewSession()
+	if err != nil {
+		return err
+	}
+	defer srcSession.Close()
+	dstSession, err := dstClient.NewSession()
+	if err != nil {
+		return err
+	}
+	defer dstSession.Close()
+	stdout, err := srcSession.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stdin, err := dstSession.StdinPipe()
+	if err != nil {
+		return err
+	}
+	blocks := (r.length + kTransferBlockSize - 1) / kTransferBlockSize
+	srcCmd := fmt.Sprintf("dd if=%s bs=%d skip=%d count=%d 2>/dev/null", srcPath, kTransferBlockSize, r.offset/kTransferBlockSize, blocks)
+	dstCmd := fmt.Sprintf("dd of=%s bs=%d seek=%d conv=notrunc 2>/dev/null", dstPath, kTransferBlockSize, r.offset/kTransferBlockSize)
+	if err := dstSession.Start(dstCmd); err != nil {
+		return err
+	}
+	if err := srcSession.Start(srcCmd); err != nil {
+		return err
+	}
+	n, err := io.Copy(stdin, io.TeeReader(stdout, counter))
+	if err != nil {
+		return fmt.Errorf("copy range at %d failed: %v", r.offset, err)
+	}
+	stdin.Close()
+	if err := srcSession.Wait(); err != nil {
+		return fmt.Errorf("read range at %d failed: %v", r.offset, err)
+	}
+	if err := dstSession.Wait(); err != nil {
+		return fmt.Errorf("write range at %d failed: %v", r.offset, err)
+	}
+	if n != r.length {
+		return fmt.Errorf("copy range at %d got %d bytes, expected %d", r.offset, n, r.length)
+	}
+	return nil
+}
+
+// splitCopySource splits `host:path`, the IPv6 host should be enclosed in square brackets.
+func splitCopySource(source string) (string, string, error) {
+	idx := strings.IndexByte(source, ':')
+	if strings.HasPrefix(source, "[") || strings.Contains(source, "@[") {
+		if end := strings.Index(source, "]:"); end > 0 {
+			idx = end + 1
+		}
+	}
+	if idx <= 0 || idx == len(source)-1 {
+		return "", "", fmt.Errorf("invalid copy source [%s], it should be host:path", source)
+	}
+	host := strings.Replace(strings.Replace(source[:idx], "[", "", 1), "]", "", 1)
+	return host, source[idx+1:], nil
+}
+
+// execRemoteCopy copies the file of another host to the destination, the data is relayed through the client.
+func execRemoteCopy(args *sshArgs, client *ssh.Client) error {
+	srcHost, srcPath, err := splitCopySource(args.CopyFrom)
+	if err != nil {
+		return err
+	}
+	srcArgs := &sshArgs{Destination: srcHost}
+	srcClient, _, err := sshConnect(srcArgs, nil, "")
+	if err != nil {
+		return err
+	}
+	defer srcClient.Close()
+	afterPasswordChanged(srcArgs)
+
+	src := quoteRemotePath(srcPath)
+	size, err := getRemoteFileSize(srcClient, src)
+	if err != nil {
+		return fmt.Errorf("get size of [%s] failed: %v", args.CopyFrom, err)
+	}
+	dstPath := args.CopyTo
+	if dstPath == "" {
+		dstPath = "."
+	}
+	output, err := runRemoteCommand(client, fmt.Sprintf("if [ -d %s ]; then echo dir; fi", quoteRemotePath(dstPath)))
+	if err != nil {
+		return fmt.Errorf("check [%s] failed: %v", dstPath, err)
+	}
+	if strings.TrimSpace(output) == "dir" {
+		dstPath = strings.TrimRight(dstPath, "/") + "/" + path.Base(srcPath)
+	}
+	dst := quoteRemotePath(dstPath)
+	if _, err := runRemoteCommand(client, fmt.Sprintf(": > %s", dst)); err != nil {
+		return fmt.Errorf("create [%s] failed: %v", dstPath, err)
+	}
+
+	ranges := splitTransferRanges(size, getTransferChannels(args))
+	counter := &transferCounter{total: size}
+	beginTime := time.Now()
+	stopProgress := showTransferProgress("CopyFrom", counter)
+	err = transferRanges(ranges, func(r transferRange) error {
+		return copyRange(srcClient, client, src, dst, r, counter)
+	})
+	stopProgress()
+	if err != nil {
+		return err
+	}
+
+	dstSize, err := getRemoteFileSize(client, dst)
+	if err != nil {
+		return fmt.Errorf("get size of [%s] failed: %v", dstPath, err)
+	}
+	if dstSize != size {
+		return fmt.Errorf("size of [%s] is %d, expected %d", dstPath, dstSize, size)
+	}
+	if getTransferVerify(args) {
+		srcDigest, err := getRemoteFileSha256(func(cmd string) (string, error) {
+			return runRemoteCommand(srcClient, cmd)
+		}, srcPath)
+		if err != nil {
+			return fmt.Errorf("sha256 of [%s] failed: %v", args.CopyFrom, err)
+		}
+		dstDigest, err := getRemoteFileSha256(func(cmd string) (string, error) {
+			return runRemoteCommand(client, cmd)
+		}, dstPath)
+		if err != nil {
+			return fmt.Errorf("sha256 of [%s] failed: %v", dstPath, err)
+		}
+		if srcDigest != dstDigest {
+			return fmt.Errorf("sha256 mismatch: [%s] is %s, but [%s] is %s", args.CopyFrom, srcDigest, dstPath, dstDigest)
+		}
+	}
+	toolsSucc("CopyFrom", "copied %s from [%s] to [%s] in %v over %d channels", formatBytes(size), args.CopyFrom,
+		dstPath, time.Since(beginTime).Round(time.Millisecond), len(ranges))
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitTransferRanges(t *testing.T) {
+	assert := assert.New(t)
+	const mb = kTransferBlockSize
+	assert.Empty(splitTransferRanges(0, 4))
+	assert.Equal([]transferRange{{0, 100}}, splitTransferRanges(100, 4))
+	assert.Equal([]transferRange{{0, mb}, {mb, mb}, {2 * mb, 10}}, splitTransferRanges(2*mb+10, 4))
+	assert.Equal([]transferRange{{0, 2 * mb}, {2 * mb, 2 * mb}, {4 * mb, mb + 1}}, splitTransferRanges(5*mb+1, 4))
+	assert.Equal([]transferRange{{0, 8 * mb}}, splitTransferRanges(8*mb, 1))
+}
+
+func TestSplitTransferPaths(t *testing.T) {
+	assert := assert.New(t)
+	assertPaths := func(paths string, upload bool, src, dst string) {
+		t.Helper()
+		s, d, err := splitTransferPaths(paths, upload)
+		assert.Nil(err)
+		assert.Equal(src, s)
+		assert.Equal(dst, d)
+	}
+	assertPaths("a.iso:/tmp/a.iso", true, "a.iso", "/tmp/a.iso")
+	assertPaths(`C:\images\a.iso:/tmp/a.iso`, true, `C:\images\a.iso`, "/tmp/a.iso")
+	assertPaths("/tmp/a.iso:a.iso", false, "/tmp/a.iso", "a.iso")
+	assertPaths(`/tmp/a.iso:C:\images\a.iso`, false, "/tmp/a.iso", `C:\images\a.iso`)
+
+	for _, paths := range []string{"", "a.iso", ":/tmp/a.iso", "a.iso:"} {
+		_, _, err := splitTransferPaths(paths, true)
+		assert.NotNil(err)
+	}
+}
+
+func TestQuoteRemotePath(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("/tmp/a.iso", quoteRemotePath("/tmp/a.iso"))
+	assert.Equal("'/tmp/a b.iso'", quoteRemotePath("/tmp/a b.iso"))
+	assert.Equal("~/'a b.iso'", quoteRemotePath("~/a b.iso"))
+	assert.Equal("'~root/a.iso'", quoteRemotePath("~root/a.iso"))
+}
+
+func TestSplitCopySource(t *testing.T) {
+	assert := assert.New(t)
+	assertSource := func(source, host, path string) {
+		t.Helper()
+		h, p, err := splitCopySource(source)
+		assert.Nil(err)
+		assert.Equal(host, h)
+		assert.Equal(path, p)
+	}
+	assertSource("hostA:/data/a.tar", "hostA", "/data/a.tar")
+	assertSource("root@hostA:a.tar", "root@hostA", "a.tar")
+	assertSource("[::1]:/data/a.tar", "::1", "/data/a.tar")
+	assertSource("root@[fe80::1]:~/a.tar", "root@fe80::1", "~/a.tar")
+
+	for _, source := range []string{"", "hostA", ":/data/a.tar", "hostA:"} {
+		_, _, err := splitCopySource(source)
+		assert.NotNil(err)
+	}
+}
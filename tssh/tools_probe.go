@@ -0,0 +1,357 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const kProbeTimeout = 10 * time.Second
+
+const kMsgKexInit = 20
+
+var errProbeDone = errors.New("probe done")
+
+type kexInitMsg struct {
+	KexAlgos                []string
+	ServerHostKeyAlgos      []string
+	CiphersClientServer     []string
+	CiphersServerClient     []string
+	MACsClientServer        []string
+	MACsServerClient        []string
+	CompressionClientServer []string
+	CompressionServerClient []string
+}
+
+type probeHostKey struct {
+	algo        string
+	fingerprint string
+	err         error
+}
+
+type probeResult struct {
+	version    string
+	kexInit    *kexInitMsg
+	hostKeys   []*probeHostKey
+	authMethod []string
+	banner     string
+}
+
+func parseNameList(buf []byte) ([]string, []byte, error) {
+	if len(buf) < 4 {
+		return nil, nil, fmt.Errorf("name-list too short")
+	}
+	length := binary.BigEndian.Uint32(buf)
+	buf = buf[4:]
+	if uint32(len(buf)) < length {
+		return nil, nil, fmt.Errorf("name-list length %d out of range", length)
+	}
+	if length == 0 {
+		return nil, buf, nil
+	}
+	return strings.Split(string(buf[:length]), ","), buf[length:], nil
+}
+
+// parseKexInit parses the payload of SSH_MSG_KEXINIT, see RFC 4253 section 7.1.
+func parseKexInit(payload []byte) (*kexInitMsg, error) {
+	if len(payload) < 17 || payload[0] != kMsgKexInit {
+		return nil, fmt.Errorf("not a kexinit message")
+	}
+	buf := payload[17:]
+	msg := &kexInitMsg{}
+	for _, list := range []*[]string{
+		&msg.KexAlgos, &msg.ServerHostKeyAlgos,
+		&msg.CiphersClientServer, &msg.CiphersServerClient,
+		&msg.MACsClientServer, &msg.MACsServerClient,
+		&msg.CompressionClientServer, &msg.CompressionServerClient,
+	} {
+		var err error
+		if *list, buf, err = parseNameList(buf); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// readServerVersion skips the lines before the version banner, which are allowed by RFC 4253.
+func readServerVersion(reader *bufio.Reader) (string, error) {
+	for i := 0; i < 50; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("read version failed: %v", err)
+		}
+		if strings.HasPrefix(line, "SSH-") {
+			return strings.TrimRight(line, "\r\n"), nil
+		}
+	}
+	return "", fmt.Errorf("no ssh version received")
+}
+
+// readServerKexInit exchanges the version banners and reads the first plaintext packet of the server.
+func readServerKexInit(conn net.Conn) (string, *kexInitMsg, error) {
+	_ = conn.SetDeadline(time.Now().Add(kProbeTimeout))
+	if _, err := conn.Write([]byte("SSH-2.0-tssh_probe\n")); err != nil {
+		return "", nil, fmt.Errorf("write version failed: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	version, err := readServerVersion(reader)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var header [5]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return version, nil, fmt.Errorf("read packet failed: %v", err)
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	padding := uint32(header[4])
+	if length < padding+1 || length > 256*1024 {
+		return version, nil, fmt.Errorf("invalid packet length %d", length)
+	}
+	packet := make([]byte, length-1)
+	if _, err := io.ReadFull(reader, packet); err != nil {
+		return version, nil, fmt.Errorf("read packet failed: %v", err)
+	}
+	kexInit, err := parseKexInit(packet[:len(packet)-int(padding)])
+	return version, kexInit, err
+}
+
+type probeDialer func() (net.Conn, error)
+
+func getProbeDialer(args *sshArgs, param *loginParam) (probeDialer, error) {
+	if param.command != "" {
+		return func() (net.Conn, error) {
+			conn, cmd, err := execProxyCommand(args, param)
+			if err != nil {
+				return nil, fmt.Errorf("exec proxy command [%s] failed: %v", cmd, err)
+			}
+			return conn, nil
+		}, nil
+	}
+	if len(param.proxy) > 0 {
+		client, proxy, err := connectProxies(param.proxy)
+		if err != nil {
+			return nil, err
+		}
+		return func() (net.Conn, error) {
+			conn, err := dialWithTimeout(client, "tcp", param.addr, kProbeTimeout)
+			if err != nil {
+				return nil, fmt.Errorf("proxy [%s] dial tcp [%s] failed: %v", proxy, param.addr, err)
+			}
+			return conn, nil
+		}, nil
+	}
+	if isWebSocketTransport(args) {
+		return func() (net.Conn, error) {
+			return dialWebSocket(args, param, kProbeTimeout)
+		}, nil
+	}
+	return func() (net.Conn, error) {
+		conn, err := dialByProxyAutoConfig(args, getDialNetwork(args), param.addr, kProbeTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("dial tcp [%s] failed: %v", param.addr, err)
+		}
+		return conn, nil
+	}, nil
+}
+
+// probeHandshake runs an ssh handshake which is expected to be aborted by the callbacks.
+func probeHandshake(dial probeDialer, addr string, config *ssh.ClientConfig) error {
+	conn, err := dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(kProbeTimeout))
+	config.Timeout = kProbeTimeout
+	ncc, _, _, err := ssh.NewClientConn(conn, addr, config)
+	if ncc != nil {
+		_ = ncc.Close()
+	}
+	return err
+}
+
+func probeServerHostKey(dial probeDialer, param *loginParam, algo string) *probeHostKey {
+	result := &probeHostKey{algo: algo}
+	err := probeHandshake(dial, param.addr, &ssh.ClientConfig{
+		User:              param.user,
+		HostKeyAlgorithms: []string{algo},
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			result.fingerprint = ssh.FingerprintSHA256(key)
+			return errProbeDone
+		},
+	})
+	if result.fingerprint == "" {
+		result.err = err
+	}
+	return result
+}
+
+// probeAuthMethod checks whether the server offers the auth method,
+// the callbacks abort the handshake before any credential is sent.
+func probeAuthMethod(dial probeDialer, param *loginParam, method string) (bool, string) {
+	offered := false
+	banner := ""
+	var auth ssh.AuthMethod
+	switch method {
+	case "publickey":
+		auth = ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			offered = true
+			return nil, errProbeDone
+		})
+	case "password":
+		auth = ssh.PasswordCallback(func() (string, error) {
+			offered = true
+			return "", errProbeDone
+		})
+	case "keyboard-interactive":
+		auth = ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			offered = true
+			return nil, errProbeDone
+		})
+	}
+	_ = probeHandshake(dial, param.addr, &ssh.ClientConfig{
+		User:            param.user,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		BannerCallback: func(message string) error {
+			banner = message
+			return nil
+		},
+	})
+	return offered, banner
+}
+
+func probeServer(args *sshArgs, param *loginParam) (*probeResult, error) {
+	dial, err := getProbeDialer(args, param)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	version, kexInit, err := readServerKexInit(conn)
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+	result := &probeResult{version: version, kexInit: kexInit}
+
+	var wg sync.WaitGroup
+	result.hostKeys = make([]*probeHostKey, len(kexInit.ServerHostKeyAlgos))
+	for i, algo := range kexInit.ServerHostKeyAlgos {
+		wg.Add(1)
+		go func(i int, algo string) {
+			defer wg.Done()
+			result.hostKeys[i] = probeServerHostKey(dial, param, algo)
+		}(i, algo)
+	}
+	methods := []string{"publickey", "keyboard-interactive", "password"}
+	offered := make([]bool, len(methods))
+	banners := make([]string, len(methods))
+	for i, method := range methods {
+		wg.Add(1)
+		go func(i int, method string) {
+			defer wg.Done()
+			offered[i], banners[i] = probeAuthMethod(dial, param, method)
+		}(i, method)
+	}
+	wg.Wait()
+
+	for i, method := range methods {
+		if offered[i] {
+			result.authMethod = append(result.authMethod, method)
+		}
+		if banners[i] != "" {
+			result.banner = banners[i]
+		}
+	}
+	return result, nil
+}
+
+func writeProbeList(writer io.Writer, title string, list []string) {
+	fmt.Fprintf(writer, "%s:\n", title)
+	if len(list) == 0 {
+		fmt.Fprintf(writer, "  (none)\n")
+	}
+	for _, name := range list {
+		fmt.Fprintf(writer, "  %s\n", name)
+	}
+}
+
+func writeProbeDirectionalList(writer io.Writer, title string, c2s, s2c []string) {
+	if strings.Join(c2s, ",") == strings.Join(s2c, ",") {
+		writeProbeList(writer, title, c2s)
+		return
+	}
+	writeProbeList(writer, title+" (client to server)", c2s)
+	writeProbeList(writer, title+" (server to client)", s2c)
+}
+
+func (r *probeResult) write(writer io.Writer) {
+	fmt.Fprintf(writer, "server version: %s\n", r.version)
+	writeProbeList(writer, "kex algorithms", r.kexInit.KexAlgos)
+	fmt.Fprintf(writer, "host key algorithms:\n")
+	for _, key := range r.hostKeys {
+		if key.err != nil {
+			fmt.Fprintf(writer, "  %s (%v)\n", key.algo, key.err)
+		} else {
+			fmt.Fprintf(writer, "  %s %s\n", key.algo, key.fingerprint)
+		}
+	}
+	writeProbeDirectionalList(writer, "ciphers", r.kexInit.CiphersClientServer, r.kexInit.CiphersServerClient)
+	writeProbeDirectionalList(writer, "macs", r.kexInit.MACsClientServer, r.kexInit.MACsServerClient)
+	writeProbeDirectionalList(writer, "compression", r.kexInit.CompressionClientServer, r.kexInit.CompressionServerClient)
+	writeProbeList(writer, "auth methods", r.authMethod)
+	if r.banner != "" {
+		fmt.Fprintf(writer, "banner:\n%s", r.banner)
+	}
+}
+
+func execProbe(args *sshArgs, writer io.Writer) error {
+	param, err := getLoginParam(args)
+	if err != nil {
+		return err
+	}
+	debug("probe [%s], addr: %s", args.Destination, param.addr)
+	result, err := probeServer(args, param)
+	if err != nil {
+		return fmt.Errorf("probe [%s] failed: %v", args.Destination, err)
+	}
+	result.write(writer)
+	return nil
+}
@@ -0,0 +1,65 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKexInit(t *testing.T) {
+	assert := assert.New(t)
+	buildPayload := func(lists ...string) []byte {
+		payload := append([]byte{kMsgKexInit}, make([]byte, 16)...)
+		for _, list := range lists {
+			payload = binary.BigEndian.AppendUint32(payload, uint32(len(list)))
+			payload = append(payload, list...)
+		}
+		return append(payload, 0, 0, 0, 0, 0)
+	}
+
+	msg, err := parseKexInit(buildPayload("curve25519-sha256,diffie-hellman-group1-sha1", "ssh-ed25519,ssh-rsa",
+		"aes128-ctr", "aes256-ctr", "hmac-sha2-256", "hmac-sha1", "none", "none,zlib@openssh.com", "", ""))
+	assert.Nil(err)
+	assert.Equal(&kexInitMsg{
+		KexAlgos:                []string{"curve25519-sha256", "diffie-hellman-group1-sha1"},
+		ServerHostKeyAlgos:      []string{"ssh-ed25519", "ssh-rsa"},
+		CiphersClientServer:     []string{"aes128-ctr"},
+		CiphersServerClient:     []string{"aes256-ctr"},
+		MACsClientServer:        []string{"hmac-sha2-256"},
+		MACsServerClient:        []string{"hmac-sha1"},
+		CompressionClientServer: []string{"none"},
+		CompressionServerClient: []string{"none", "zlib@openssh.com"},
+	}, msg)
+
+	_, err = parseKexInit([]byte{21})
+	assert.NotNil(err)
+	payload := buildPayload("curve25519-sha256")
+	_, err = parseKexInit(payload[:len(payload)-8])
+	assert.NotNil(err)
+}
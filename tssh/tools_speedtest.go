@@ -0,0 +1,253 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	kDefaultSpeedTestTime = 3 * time.Second
+	kSpeedTestPingCount   = 10
+)
+
+type speedTestResult struct {
+	bytes    int64
+	duration time.Duration
+}
+
+func (r *speedTestResult) String() string {
+	if r.duration <= 0 {
+		return "0 B/s"
+	}
+	return fmt.Sprintf("%s/s", formatBytes(int64(float64(r.bytes)/r.duration.Seconds())))
+}
+
+func formatChannels(n int) string {
+	if n == 1 {
+		return "1 channel"
+	}
+	return fmt.Sprintf("%d parallel channels", n)
+}
+
+// getSpeedTestDirections returns whether to test the upload and the download by `--speedtest-dir`.
+func getSpeedTestDirections(dir string) (bool, bool, error) {
+	switch strings.ToLower(dir) {
+	case "", "both":
+		return true, true, nil
+	case "up", "upload":
+		return true, false, nil
+	case "down", "download":
+		return false, true, nil
+	}
+	return false, false, fmt.Errorf("invalid speedtest direction [%s], should be up, down or both", dir)
+}
+
+// summarizeLatency returns the min, avg and max of the round trip times.
+func summarizeLatency(rtts []time.Duration) (time.Duration, time.Duration, time.Duration) {
+	if len(rtts) == 0 {
+		return 0, 0, 0
+	}
+	min, max, sum := rtts[0], rtts[0], time.Duration(0)
+	for _, rtt := range rtts {
+		if rtt < min {
+			min = rtt
+		}
+		if rtt > max {
+			max = rtt
+		}
+		sum += rtt
+	}
+	return min, sum / time.Duration(len(rtts)), max
+}
+
+func measureLatency(client *ssh.Client) ([]time.Duration, error) {
+	var rtts []time.Duration
+	for i := 0; i < kSpeedTestPingCount; i++ {
+		beginTime := time.Now()
+		if _, _, err := client.SendRequest("keepalive@trzsz-ssh", true, nil); err != nil {
+			return nil, err
+		}
+		rtts = append(rtts, time.Since(beginTime))
+	}
+	return rtts, nil
+}
+
+func measureNewSession(client *ssh.Client) (time.Duration, error) {
+	beginTime := time.Now()
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(beginTime)
+	session.Close()
+	return elapsed, nil
+}
+
+// speedTestChannel sends the random data to `cat > /dev/null`, or receives from `cat /dev/urandom`, until the deadline.
+func speedTestChannel(client *ssh.Client, upload bool, deadline time.Time, counter *transferCounter) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	if upload {
+		stdin, err := session.StdinPipe()
+		if err != nil {
+			return err
+		}
+		if err := session.Start("cat > /dev/null"); err != nil {
+			return err
+		}
+		buf := make([]byte, kTransferBlockSize)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		writer := io.MultiWriter(stdin, counter)
+		for offset := 0; time.Now().Before(deadline); offset = (offset + 32*1024) % len(buf) {
+			if err := writeAll(writer, buf[offset:offset+32*1024]); err != nil {
+				return err
+			}
+		}
+		stdin.Close()
+		return session.Wait()
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := session.Start("cat /dev/urandom"); err != nil {
+		return err
+	}
+	buf := make([]byte, 32*1024)
+	for time.Now().Before(deadline) {
+		n, err := stdout.Read(buf)
+		counter.done.Add(int64(n))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runSpeedTest(client *ssh.Client, upload bool, channels int, duration time.Duration) (*speedTestResult, error) {
+	counter := &transferCounter{}
+	beginTime := time.Now()
+	deadline := beginTime.Add(duration)
+	var wg sync.WaitGroup
+	errs := make([]error, channels)
+	for i := 0; i < channels; i++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			errs[idx] = speedTestChannel(client, upload, deadline, counter)
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(beginTime)
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &speedTestResult{counter.done.Load(), elapsed}, nil
+}
+
+// execSpeedTest tests the latency and the throughput, over a single channel and over parallel channels of one connection.
+func execSpeedTest(args *sshArgs, client *ssh.Client, loginTime time.Duration) error {
+	upload, download, err := getSpeedTestDirections(args.SpeedTestDir)
+	if err != nil {
+		return err
+	}
+	duration := kDefaultSpeedTestTime
+	if args.SpeedTestTime > 0 {
+		duration = time.Duration(args.SpeedTestTime) * time.Second
+	}
+	channels := getTransferChannels(args)
+
+	// the connection via the control master is a proxy of the master's connection
+	_, control := client.Conn.(*connection)
+	via := "new connection"
+	if control {
+		via = "via control master"
+	}
+	toolsInfo("SpeedTest", "login to [%s] in %v ( %s )", args.Destination, loginTime.Round(time.Millisecond), via)
+
+	rtts, err := measureLatency(client)
+	if err != nil {
+		return fmt.Errorf("measure latency failed: %v", err)
+	}
+	min, avg, max := summarizeLatency(rtts)
+	toolsInfo("SpeedTest", "rtt min/avg/max = %v/%v/%v", min.Round(time.Microsecond),
+		avg.Round(time.Microsecond), max.Round(time.Microsecond))
+
+	sessionTime, err := measureNewSession(client)
+	if err != nil {
+		return fmt.Errorf("open new session failed: %v", err)
+	}
+	toolsInfo("SpeedTest", "open a new session in %v ( the cost of a login via ControlMaster )", sessionTime.Round(time.Microsecond))
+
+	test := func(name string, upload bool) error {
+		for _, n := range []int{1, channels} {
+			result, err := runSpeedTest(client, upload, n, duration)
+			if err != nil {
+				return fmt.Errorf("%s test over %d channels failed: %v", name, n, err)
+			}
+			toolsSucc("SpeedTest", "%s over %s: %s ( %s in %v )", name, formatChannels(n), result,
+				formatBytes(result.bytes), result.duration.Round(time.Millisecond))
+			if channels == 1 {
+				break
+			}
+		}
+		return nil
+	}
+	if upload {
+		if err := test("upload", true); err != nil {
+			return err
+		}
+	}
+	if download {
+		if err := test("download", false); err != nil {
+			return err
+		}
+	}
+
+	if args.Compression || strings.ToLower(getOptionConfig(args, "Compression")) == "yes" {
+		if control {
+			toolsWarn("SpeedTest", "compression is decided by the control master, the test data is incompressible")
+		} else {
+			toolsWarn("SpeedTest", "compression is not supported by tssh, the data is sent uncompressed")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSpeedTestDirections(t *testing.T) {
+	assert := assert.New(t)
+	assertDirections := func(dir string, upload, download bool) {
+		t.Helper()
+		up, down, err := getSpeedTestDirections(dir)
+		assert.Nil(err)
+		assert.Equal(upload, up)
+		assert.Equal(download, down)
+	}
+	assertDirections("", true, true)
+	assertDirections("both", true, true)
+	assertDirections("up", true, false)
+	assertDirections("Download", false, true)
+
+	_, _, err := getSpeedTestDirections("sideways")
+	assert.NotNil(err)
+}
+
+func TestSummarizeLatency(t *testing.T) {
+	assert := assert.New(t)
+	min, avg, max := summarizeLatency(nil)
+	assert.Equal(time.Duration(0), min+avg+max)
+
+	min, avg, max = summarizeLatency([]time.Duration{3 * time.Millisecond, time.Millisecond, 5 * time.Millisecond})
+	assert.Equal(time.Millisecond, min)
+	assert.Equal(3*time.Millisecond, avg)
+	assert.Equal(5*time.Millisecond, max)
+}
+
+func TestSpeedTestResult(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("1.0 MB/s", (&speedTestResult{bytes: 2 * 1024 * 1024, duration: 2 * time.Second}).String())
+	assert.Equal("0 B/s", (&speedTestResult{bytes: 1024}).String())
+	assert.Equal("1 channel", formatChannels(1))
+	assert.Equal("4 parallel channels", formatChannels(4))
+}
@@ -0,0 +1,154 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/trzsz/trzsz-go/trzsz"
+)
+
+// kTransferResultTimeout is how long to wait for the result message after the transfer.
+const kTransferResultTimeout = time.Second
+
+var percentageRegexp = regexp.MustCompile(`\b(\d{1,3})%`)
+
+// lastPercentage returns the last percentage in the progress bar text, or -1 if not found.
+func lastPercentage(buf []byte) int {
+	matches := percentageRegexp.FindAllSubmatch(buf, -1)
+	if len(matches) == 0 {
+		return -1
+	}
+	percent, err := strconv.Atoi(string(matches[len(matches)-1][1]))
+	if err != nil || percent > 100 {
+		return -1
+	}
+	return percent
+}
+
+// transferProgress surfaces the trzsz transfer progress in the terminal title and the OSC 9;4 progress,
+// and emits a desktop notification via OSC 9 on completion or failure.
+type transferProgress struct {
+	writer       io.WriteCloser
+	filter       atomic.Pointer[trzsz.TrzszFilter]
+	mutex        sync.Mutex
+	transferring bool
+	finishing    bool
+	saved        bool
+	percent      int
+	beginTime    time.Time
+	timer        *time.Timer
+}
+
+func newTransferProgress(writer io.WriteCloser) *transferProgress {
+	return &transferProgress{writer: writer}
+}
+
+func (p *transferProgress) setFilter(filter *trzsz.TrzszFilter) {
+	p.filter.Store(filter)
+}
+
+func (p *transferProgress) Write(buf []byte) (int, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	n, err := p.writer.Write(buf)
+	if n > 0 {
+		p.observe(buf[:n])
+	}
+	return n, err
+}
+
+func (p *transferProgress) Close() error {
+	return p.writer.Close()
+}
+
+func (p *transferProgress) writeEscape(format string, a ...any) {
+	_, _ = fmt.Fprintf(p.writer, format, a...)
+}
+
+func (p *transferProgress) observe(buf []byte) {
+	filter := p.filter.Load()
+	if filter == nil {
+		return
+	}
+	if filter.IsTransferringFiles() {
+		if !p.transferring {
+			p.begin()
+		}
+		if percent := lastPercentage(buf); percent >= 0 && percent != p.percent {
+			p.percent = percent
+			p.writeEscape("\033]0;trzsz %d%%\007\033]9;4;1;%d\007", percent, percent)
+		}
+	} else if p.transferring {
+		p.transferring = false
+		p.finishing = true
+		p.timer = time.AfterFunc(kTransferResultTimeout, func() {
+			p.mutex.Lock()
+			defer p.mutex.Unlock()
+			if p.finishing {
+				p.finish()
+			}
+		})
+	}
+	if (p.transferring || p.finishing) && bytes.Contains(buf, []byte("Saved ")) {
+		p.saved = true
+		if p.finishing {
+			p.timer.Stop()
+			p.finish()
+		}
+	}
+}
+
+func (p *transferProgress) begin() {
+	if p.finishing {
+		p.timer.Stop()
+		p.finish()
+	}
+	p.transferring = true
+	p.saved = false
+	p.percent = -1
+	p.beginTime = time.Now()
+	// save the title and show the indeterminate progress
+	p.writeEscape("\033[22;0t\033]9;4;3;0\007")
+}
+
+func (p *transferProgress) finish() {
+	p.finishing = false
+	elapsed := time.Since(p.beginTime).Round(time.Second)
+	result := "failed after"
+	if p.saved {
+		result = "completed in"
+	}
+	// clear the progress, restore the title and notify the result
+	p.writeEscape("\033]9;4;0;0\007\033[23;0t\033]9;trzsz transfer %s %v\007", result, elapsed)
+}
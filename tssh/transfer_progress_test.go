@@ -0,0 +1,42 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLastPercentage(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(-1, lastPercentage([]byte("")))
+	assert.Equal(-1, lastPercentage([]byte("no progress")))
+	assert.Equal(12, lastPercentage([]byte("\rfile.bin [=====>    ] 12% | 1.2 MB | 3 MB/s | 00:01 ETA")))
+	assert.Equal(100, lastPercentage([]byte("\r 99% | 00:01 ETA\r 100% | 00:00 ETA")))
+	assert.Equal(-1, lastPercentage([]byte("\r 120%")))
+	assert.Equal(5, lastPercentage([]byte("\x1b[80D 5% | --- ETA")))
+}
@@ -0,0 +1,412 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// kTransferVerifyProbeTimeout limits how long the trzsz trigger is held while probing the remote tsz.
+const kTransferVerifyProbeTimeout = 3 * time.Second
+
+// kTransferVerifyMaxMessage limits the buffered `Saved ...` message of trzsz.
+const kTransferVerifyMaxMessage = 64 * 1024
+
+// getTransferVerify returns whether `TransferVerify sha256` is configured.
+func getTransferVerify(args *sshArgs) bool {
+	switch value := strings.ToLower(getExOptionConfig(args, "TransferVerify")); value {
+	case "", "no":
+		return false
+	case "sha256":
+		return true
+	default:
+		warning("TransferVerify %s is not supported, it should be sha256 or no", value)
+		return false
+	}
+}
+
+func getLocalFileSha256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+var sha256Regexp = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// getRemoteFileSha256 hashes the remote file by `sha256sum`, or `shasum -a 256` on macOS and BSD.
+func getRemoteFileSha256(runCommand func(cmd string) (string, error), path string) (string, error) {
+	path = quoteRemotePath(path)
+	output, err := runCommand(fmt.Sprintf("sha256sum < %s 2>/dev/null || shasum -a 256 < %s", path, path))
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(output)
+	if len(fields) == 0 || !sha256Regexp.MatchString(fields[0]) {
+		return "", fmt.Errorf("unexpected sha256 output: %s", strings.TrimSpace(output))
+	}
+	return strings.ToLower(fields[0]), nil
+}
+
+// verifyTransferredFile compares the sha256 digests of the local and the remote file.
+func verifyTransferredFile(runCommand func(cmd string) (string, error), localPath, remotePath string) error {
+	localDigest, err := getLocalFileSha256(localPath)
+	if err != nil {
+		return fmt.Errorf("sha256 of [%s] failed: %v", localPath, err)
+	}
+	remoteDigest, err := getRemoteFileSha256(runCommand, remotePath)
+	if err != nil {
+		return fmt.Errorf("sha256 of remote [%s] failed: %v", remotePath, err)
+	}
+	if localDigest != remoteDigest {
+		return fmt.Errorf("sha256 mismatch: local [%s] is %s, but remote [%s] is %s",
+			localPath, localDigest, remotePath, remoteDigest)
+	}
+	debug("sha256 of [%s] and remote [%s] is %s", localPath, remotePath, localDigest)
+	return nil
+}
+
+var trzszSavedRegexp = regexp.MustCompile(`^Saved (\d+) (?:file/directory|files/directories)(?: to (.*))?$`)
+
+// parseTrzszSavedMessage parses the `Saved N files/directories to PATH` message followed by a `- NAME` line
+// for each file, which trzsz prints after the transfer. It returns complete=false if more lines are needed.
+func parseTrzszSavedMessage(buf []byte) (dir string, names []string, complete bool, err error) {
+	lines := strings.Split(string(buf), "\n")
+	if len(lines) < 2 {
+		return "", nil, false, nil
+	}
+	match := trzszSavedRegexp.FindStringSubmatch(strings.TrimRight(lines[0], "\r"))
+	if match == nil {
+		return "", nil, false, fmt.Errorf("unexpected saved message: %q", lines[0])
+	}
+	count, err := strconv.Atoi(match[1])
+	if err != nil {
+		return "", nil, false, err
+	}
+	// the last line is not terminated yet
+	for _, line := range lines[1 : len(lines)-1] {
+		if len(names) == count {
+			break
+		}
+		line = strings.TrimRight(line, "\r")
+		if !strings.HasPrefix(line, "- ") {
+			return "", nil, false, fmt.Errorf("unexpected saved file: %q", line)
+		}
+		names = append(names, line[2:])
+	}
+	if len(names) < count {
+		return "", nil, false, nil
+	}
+	return match[2], names, true, nil
+}
+
+// parseTszSourcePaths returns the paths that the remote tsz sends, from its working directory and arguments.
+func parseTszSourcePaths(cwd string, argv []string) []string {
+	begin := -1
+	for i, arg := range argv {
+		if base := path.Base(arg); base == "tsz" || base == "tsz.py" {
+			begin = i + 1
+			break
+		}
+	}
+	if begin < 0 {
+		return nil
+	}
+	var paths []string
+	for i := begin; i < len(argv); i++ {
+		arg := argv[i]
+		switch {
+		case arg == "--":
+			for _, file := range argv[i+1:] {
+				paths = append(paths, path.Join(cwd, file))
+			}
+			return paths
+		case arg == "-B" || arg == "--bufsize" || arg == "-t" || arg == "--timeout":
+			i++ // skip the value
+		case strings.HasPrefix(arg, "-") && arg != "-":
+		default:
+			if path.IsAbs(arg) {
+				paths = append(paths, path.Clean(arg))
+			} else {
+				paths = append(paths, path.Join(cwd, arg))
+			}
+		}
+	}
+	return paths
+}
+
+// kTszProbeCommand prints the working directory and the arguments of the newest tsz of the current user.
+const kTszProbeCommand = `pid=$(pgrep -n -u "$(id -u)" -f '(^|/)tsz(\.py)?( |$)') && ` +
+	`readlink "/proc/$pid/cwd" && tr '\0' '\n' < "/proc/$pid/cmdline"`
+
+// listOpenFiles returns the regular files opened by the current process, which is only supported on Linux.
+func listOpenFiles() (map[int]string, error) {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[int]string)
+	for _, entry := range entries {
+		fd, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		path, err := os.Readlink(filepath.Join("/proc/self/fd", entry.Name()))
+		if err != nil || !filepath.IsAbs(path) {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			files[fd] = path
+		}
+	}
+	return files, nil
+}
+
+// trzszVerifier implements `TransferVerify sha256` for trzsz. The TrzszFilter doesn't report the paths,
+// so they are collected from the streams around it:
+//   - the receiver's directory and file names are parsed from the `Saved ...` message after the transfer.
+//   - the remote sender's paths are the arguments of tsz, probed before the trigger reaches the filter.
+//   - the local sender's paths are the files the filter keeps open when it sends the MD5 of each file.
+type trzszVerifier struct {
+	runCommand func(cmd string) (string, error)
+	mutex      sync.Mutex
+	tail       []byte
+	uploading  bool
+	active     bool
+	sources    []string
+	openedFds  map[int]string
+	sourceFds  map[int]string
+	sourceErr  error
+	saved      []byte
+	done       chan struct{}
+}
+
+func newTrzszVerifier(runCommand func(cmd string) (string, error)) *trzszVerifier {
+	return &trzszVerifier{runCommand: runCommand}
+}
+
+var trzszTriggerRegexp = regexp.MustCompile(`::TRZSZ:TRANSFER:([SRD]):\d+\.\d+\.\d+`)
+
+// observeServer observes the server output before it reaches the filter.
+func (v *trzszVerifier) observeServer(buf []byte) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	data := append(v.tail, buf...)
+	v.tail = nil
+	if loc := trzszTriggerRegexp.FindSubmatchIndex(data); loc != nil {
+		v.begin(data[loc[2]] != 'S')
+		data = data[loc[1]:]
+	}
+	if v.active {
+		v.observeSaved(data)
+	}
+	if v.saved == nil {
+		if len(data) > 64 {
+			data = data[len(data)-64:]
+		}
+		v.tail = append([]byte(nil), data...)
+	}
+}
+
+func (v *trzszVerifier) begin(uploading bool) {
+	v.active, v.uploading = true, uploading
+	v.sources, v.sourceFds, v.sourceErr, v.saved = nil, nil, nil, nil
+	if uploading {
+		var err error
+		if v.openedFds, err = listOpenFiles(); err != nil {
+			v.sourceErr = fmt.Errorf("the uploaded local files are only known on Linux: %v", err)
+		}
+		v.sourceFds = make(map[int]string)
+		return
+	}
+	// the tsz waits for the reply of the trigger, so it is still running
+	result := make(chan error, 1)
+	go func() {
+		output, err := v.runCommand(kTszProbeCommand)
+		if err == nil {
+			lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+			if v.sources = parseTszSourcePaths(lines[0], lines[1:]); len(v.sources) == 0 {
+				err = fmt.Errorf("no file in the arguments of tsz: %q", output)
+			}
+		}
+		result <- err
+	}()
+	select {
+	case v.sourceErr = <-result:
+	case <-time.After(kTransferVerifyProbeTimeout):
+		v.sourceErr = fmt.Errorf("probe the remote tsz timeout")
+	}
+}
+
+func (v *trzszVerifier) observeSaved(data []byte) {
+	if v.saved == nil {
+		idx := bytes.Index(data, []byte("Saved "))
+		if idx < 0 {
+			return
+		}
+		v.saved = []byte{}
+		data = data[idx:]
+	}
+	v.saved = append(v.saved, data...)
+	dir, names, complete, err := parseTrzszSavedMessage(v.saved)
+	if err != nil {
+		// the `Saved ` in the file data, keep looking for the message after it
+		rest := v.saved[len("Saved "):]
+		v.saved = nil
+		v.observeSaved(rest)
+		return
+	}
+	if len(v.saved) > kTransferVerifyMaxMessage {
+		v.saved = nil
+		return
+	}
+	if !complete {
+		return
+	}
+	v.active, v.saved = false, nil
+	sources, sourceErr := v.sources, v.sourceErr
+	if v.uploading && sourceErr == nil {
+		fds := make([]int, 0, len(v.sourceFds))
+		for fd := range v.sourceFds {
+			fds = append(fds, fd)
+		}
+		sort.Ints(fds)
+		for _, fd := range fds {
+			sources = append(sources, v.sourceFds[fd])
+		}
+	}
+	done := make(chan struct{})
+	v.done = done
+	go func() {
+		defer close(done)
+		v.verify(v.uploading, sources, sourceErr, dir, names)
+	}()
+}
+
+// observeClient observes the output of the filter to the server.
+func (v *trzszVerifier) observeClient(buf []byte) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if !v.active || !v.uploading || v.sourceErr != nil || !bytes.Contains(buf, []byte("#MD5:")) {
+		return
+	}
+	files, err := listOpenFiles()
+	if err != nil {
+		v.sourceErr = err
+		return
+	}
+	for fd, path := range files {
+		if v.openedFds[fd] != path {
+			v.sourceFds[fd] = path
+		}
+	}
+}
+
+func (v *trzszVerifier) verify(uploading bool, sources []string, sourceErr error, dir string, names []string) {
+	if sourceErr != nil {
+		warning("TransferVerify can't get the source paths: %v", sourceErr)
+		return
+	}
+	if len(sources) != len(names) {
+		warning("TransferVerify can't match the %d source files to the %d saved files, directories are not supported",
+			len(sources), len(names))
+		return
+	}
+	for i, name := range names {
+		var err error
+		if uploading {
+			err = verifyTransferredFile(v.runCommand, sources[i], path.Join(dir, name))
+		} else {
+			err = verifyTransferredFile(v.runCommand, filepath.Join(dir, name), sources[i])
+		}
+		if err != nil {
+			warning("TransferVerify %v", err)
+		}
+	}
+}
+
+// wait waits for the last verification, for testing.
+func (v *trzszVerifier) wait() {
+	v.mutex.Lock()
+	done := v.done
+	v.mutex.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+type verifyReader struct {
+	reader   io.Reader
+	verifier *trzszVerifier
+}
+
+func (r *verifyReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.verifier.observeServer(p[:n])
+	}
+	return n, err
+}
+
+type verifyWriter struct {
+	io.WriteCloser
+	verifier *trzszVerifier
+}
+
+func (w *verifyWriter) Write(p []byte) (int, error) {
+	w.verifier.observeClient(p)
+	return w.WriteCloser.Write(p)
+}
+
+type verifyConn struct {
+	net.Conn
+	verifier *trzszVerifier
+}
+
+func (c *verifyConn) Write(p []byte) (int, error) {
+	c.verifier.observeClient(p)
+	return c.Conn.Write(p)
+}
@@ -0,0 +1,135 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTrzszSavedMessage(t *testing.T) {
+	assert := assert.New(t)
+	assertSaved := func(msg, dir string, names []string, complete bool) {
+		t.Helper()
+		d, n, c, err := parseTrzszSavedMessage([]byte(msg))
+		assert.Nil(err)
+		assert.Equal(dir, d)
+		assert.Equal(names, n)
+		assert.Equal(complete, c)
+	}
+	assertSaved("Saved 1 file/directory to /tmp", "", nil, false)
+	assertSaved("Saved 1 file/directory to /tmp\r\n- a.txt", "", nil, false)
+	assertSaved("Saved 1 file/directory to /tmp\r\n- a.txt\r\n", "/tmp", []string{"a.txt"}, true)
+	assertSaved("Saved 2 files/directories to C:\\Users\\test\r\r\n- a b.txt\r\r\n- c.txt\r\r\n$ ",
+		"C:\\Users\\test", []string{"a b.txt", "c.txt"}, true)
+	assertSaved("Saved 1 file/directory\r\n- a.txt\r\n", "", []string{"a.txt"}, true)
+
+	_, _, _, err := parseTrzszSavedMessage([]byte("Saved by the bell\r\n"))
+	assert.NotNil(err)
+	_, _, _, err = parseTrzszSavedMessage([]byte("Saved 2 files/directories to /tmp\r\n- a.txt\r\n$ ls\r\n"))
+	assert.NotNil(err)
+}
+
+func TestParseTszSourcePaths(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{"/home/test/a.txt", "/tmp/b.txt", "/home/c.txt"},
+		parseTszSourcePaths("/home/test", []string{"tsz", "-y", "a.txt", "/tmp/b.txt", "../c.txt"}))
+	assert.Equal([]string{"/home/test/fw.img"},
+		parseTszSourcePaths("/home/test", []string{"/usr/bin/python3", "/usr/local/bin/tsz", "-B", "10M", "-t", "30", "fw.img"}))
+	assert.Equal([]string{"/home/test/-a.txt"},
+		parseTszSourcePaths("/home/test", []string{"/usr/local/bin/tsz", "-q", "--", "-a.txt"}))
+	assert.Empty(parseTszSourcePaths("/home/test", []string{"bash"}))
+}
+
+func TestTrzszVerifier(t *testing.T) {
+	assert := assert.New(t)
+	originalWarning := warning
+	defer func() {
+		warning = originalWarning
+	}()
+	var warnings []string
+	warning = func(format string, a ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, a...))
+	}
+
+	dir := t.TempDir()
+	localPath := filepath.Join(dir, "fw.img")
+	assert.Nil(os.WriteFile(localPath, []byte("firmware"), 0644))
+	digest, err := getLocalFileSha256(localPath)
+	assert.Nil(err)
+	assert.Equal("c3bf47ea1f4a4a605470313cacb3a44f4a461f68c6faeab07e737610cb5ac835", digest)
+
+	remoteDigest := digest
+	var commands []string
+	verifier := newTrzszVerifier(func(cmd string) (string, error) {
+		commands = append(commands, cmd)
+		if cmd == kTszProbeCommand {
+			return "/home/test\n/usr/local/bin/tsz\n-y\nfw.img\n", nil
+		}
+		return remoteDigest + "  -\n", nil
+	})
+
+	// download
+	verifier.observeServer([]byte("$ tsz -y fw.img\r\n::TRZSZ:TRANSFER:S:1.1.6:1234567890123\r\n"))
+	verifier.observeServer([]byte("#DATA:Saved in the file data\n"))
+	verifier.observeServer([]byte("\x1b8\x1b[0JSaved 1 file/directory to " + dir + "\r\n- fw"))
+	verifier.observeServer([]byte(".img"))
+	verifier.observeServer([]byte("\r\n$ "))
+	verifier.wait()
+	assert.Empty(warnings)
+	assert.Equal([]string{kTszProbeCommand, "sha256sum < /home/test/fw.img 2>/dev/null || shasum -a 256 < /home/test/fw.img"},
+		commands)
+
+	// mismatch
+	remoteDigest = strings.Repeat("0", 64)
+	verifier.observeServer([]byte("::TRZSZ:TRANSFER:S:1.1.6:1234567890124\r\n"))
+	verifier.observeServer([]byte("Saved 1 file/directory to " + dir + "\r\n- fw.img\r\n"))
+	verifier.wait()
+	assert.Equal([]string{fmt.Sprintf("TransferVerify sha256 mismatch: local [%s] is %s, but remote [%s] is %s",
+		localPath, digest, "/home/test/fw.img", remoteDigest)}, warnings)
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+
+	// upload
+	warnings, commands, remoteDigest = nil, nil, digest
+	verifier.observeServer([]byte("$ trz\r\n::TRZSZ:TRANSFER:R:1.1.6:1234567890125\r\n"))
+	file, err := os.Open(localPath)
+	assert.Nil(err)
+	defer file.Close()
+	verifier.observeClient([]byte("#MD5:eJwLyczPAwAEPQGO\n"))
+	verifier.observeServer([]byte("Saved 1 file/directory to /tmp/remote\r\n- fw.img.0\r\n"))
+	verifier.wait()
+	assert.Empty(warnings)
+	assert.Equal([]string{"sha256sum < /tmp/remote/fw.img.0 2>/dev/null || shasum -a 256 < /tmp/remote/fw.img.0"}, commands)
+}
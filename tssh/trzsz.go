@@ -27,6 +27,7 @@ package tssh
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -53,7 +54,8 @@ func writeAll(dst io.Writer, data []byte) error {
 }
 
 func wrapStdIO(serverIn io.WriteCloser, serverOut io.Reader, serverErr io.Reader, tty bool) {
-	win := runtime.GOOS == "windows"
+	// the git protocol is binary, don't convert the line endings even on Windows
+	win := runtime.GOOS == "windows" && !gitMode
 	forwardIO := func(reader io.Reader, writer io.WriteCloser, oldVal, newVal []byte) {
 		defer writer.Close()
 		buffer := make([]byte, 32*1024)
@@ -93,7 +95,120 @@ func wrapStdIO(serverIn io.WriteCloser, serverOut io.Reader, serverErr io.Reader
 	}
 }
 
-func enableTrzsz(args *sshArgs, client *ssh.Client, session *ssh.Session,
+// getTrzszPath returns the per-host path of `UploadPath` or `DownloadPath` with tokens expanded.
+func getTrzszPath(args *sshArgs, option string) string {
+	path := getExOptionConfig(args, option)
+	if path == "" {
+		return ""
+	}
+	param, err := getLoginParam(args)
+	if err != nil {
+		warning("get login param for %s failed: %v", option, err)
+		return ""
+	}
+	path = expandTokens(path, args, param, "%hnprlLC")
+	debug("%s = %s", option, path)
+	return path
+}
+
+// trzszUploadPathWriter appends the remote `UploadPath` to the `trz` command,
+// which the filter types to the remote shell for the drag-and-drop upload.
+type trzszUploadPathWriter struct {
+	io.WriteCloser
+	path string
+}
+
+func (w *trzszUploadPathWriter) Write(p []byte) (int, error) {
+	if cmd := string(p); cmd == "trz\r" || cmd == "trz -d\r" {
+		cmd = strings.TrimSuffix(cmd, "\r") + " " + quoteRemotePath(w.path) + "\r"
+		if err := writeAll(w.WriteCloser, []byte(cmd)); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	return w.WriteCloser.Write(p)
+}
+
+// getTrzszDownloadPath creates the per-host download path if it does not exist, as it may be named after the host.
+func getTrzszDownloadPath(args *sshArgs) string {
+	if path := resolveHomeDir(getTrzszPath(args, "DownloadPath")); path != "" {
+		if !isFileExist(path) {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				warning("mkdir DownloadPath [%s] failed: %v", path, err)
+			}
+		}
+		return path
+	}
+	return userConfig.defaultDownloadPath
+}
+
+const kTrzszProbeTimeout = 3 * time.Second
+
+// getTrzszProbeCommand returns the command to find out trz / tsz in the PATH of the non-interactive shell,
+// or in the default install path of `--install-trzsz`, and also rz / sz if zmodem is enabled.
+func getTrzszProbeCommand(zmodem bool) string {
+	command := "command -v trz || command -v tsz || ls ~/.local/bin/trz || ls ~/.local/bin/tsz"
+	if zmodem {
+		command += " || command -v rz || command -v sz"
+	}
+	return command
+}
+
+// hasRemoteTrzsz probes whether trzsz is installed on the remote for `EnableTrzsz auto`. It returns false only
+// if the probe command exits with a non-zero status, and keeps the trzsz support if the probe fails otherwise,
+// e.g., the session is refused by MaxSessions or the probe doesn't finish in time.
+func hasRemoteTrzsz(client *ssh.Client, zmodem bool) bool {
+	done := make(chan bool, 1)
+	go func() {
+		session, err := client.NewSession()
+		if err != nil {
+			debug("probe trzsz on the remote failed: %v", err)
+			done <- true
+			return
+		}
+		defer session.Close()
+		output, err := session.Output(getTrzszProbeCommand(zmodem))
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) && exitErr.Signal() == "" {
+			debug("trzsz is not found on the remote: exit status %d", exitErr.ExitStatus())
+			done <- false
+			return
+		}
+		if err != nil {
+			debug("probe trzsz on the remote failed: %v", err)
+			done <- true
+			return
+		}
+		debug("trzsz is found on the remote: %s", strings.TrimSpace(string(output)))
+		done <- true
+	}()
+	select {
+	case found := <-done:
+		return found
+	case <-time.After(kTrzszProbeTimeout):
+		debug("probe trzsz on the remote timeout")
+		return true
+	}
+}
+
+func isZmodemEnabled(args *sshArgs) bool {
+	return args.Zmodem || strings.ToLower(getExOptionConfig(args, "EnableZmodem")) == "yes"
+}
+
+// startTrzszProbe starts probing trzsz on the remote for `EnableTrzsz auto` in parallel with the shell setup,
+// so that it doesn't hold up the interactive shell. It returns nil if the probe is not needed.
+func startTrzszProbe(args *sshArgs, client *ssh.Client, tty bool) <-chan bool {
+	if !isTerminal || !tty || strings.ToLower(getExOptionConfig(args, "EnableTrzsz")) != "auto" {
+		return nil
+	}
+	found := make(chan bool, 1)
+	go func() {
+		found <- hasRemoteTrzsz(client, isZmodemEnabled(args))
+	}()
+	return found
+}
+
+func enableTrzsz(args *sshArgs, client *ssh.Client, session *ssh.Session, trzszProbe <-chan bool,
 	serverIn io.WriteCloser, serverOut io.Reader, serverErr io.Reader, tty bool) error {
 	// not terminal or not tty
 	if !isTerminal || !tty {
@@ -101,8 +216,13 @@ func enableTrzsz(args *sshArgs, client *ssh.Client, session *ssh.Session,
 		return nil
 	}
 
-	// disable trzsz ( trz / tsz )
-	if strings.ToLower(getExOptionConfig(args, "EnableTrzsz")) == "no" {
+	// disable trzsz ( trz / tsz ), or enable it only if it's installed on the remote
+	mode := strings.ToLower(getExOptionConfig(args, "EnableTrzsz"))
+	zmodem := isZmodemEnabled(args)
+	if mode == "auto" && trzszProbe != nil && !<-trzszProbe {
+		mode = "no"
+	}
+	if mode == "no" {
 		wrapStdIO(serverIn, serverOut, serverErr, tty)
 		onTerminalResize(func(width, height int) { _ = session.WindowChange(height, width) })
 		return nil
@@ -143,12 +263,30 @@ func enableTrzsz(args *sshArgs, client *ssh.Client, session *ssh.Session,
 	//   os.Stdout │        │   os.Stdout  └─────────────┘   ServerOut  │        │
 	// ◄───────────│        │◄──────────────────────────────────────────┤        │
 	//   os.Stderr └────────┘                  stderr                   └────────┘
-	trzszFilter := trzsz.NewTrzszFilter(os.Stdin, os.Stdout, serverIn, serverOut, trzsz.TrzszOptions{
+	if path := getTrzszPath(args, "UploadPath"); path != "" {
+		serverIn = &trzszUploadPathWriter{serverIn, path}
+	}
+	var verifier *trzszVerifier
+	if getTransferVerify(args) {
+		verifier = newTrzszVerifier(func(cmd string) (string, error) { return runRemoteCommand(client, cmd) })
+		serverIn = &verifyWriter{serverIn, verifier}
+		serverOut = &verifyReader{serverOut, verifier}
+	}
+	var clientOut io.WriteCloser = os.Stdout
+	var progress *transferProgress
+	if strings.ToLower(getExOptionConfig(args, "EnableTransferProgress")) == "yes" {
+		progress = newTransferProgress(os.Stdout)
+		clientOut = progress
+	}
+	trzszFilter := trzsz.NewTrzszFilter(os.Stdin, clientOut, serverIn, serverOut, trzsz.TrzszOptions{
 		TerminalColumns: int32(width),
 		DetectDragFile:  args.DragFile || strings.ToLower(getExOptionConfig(args, "EnableDragFile")) == "yes",
 		DetectTraceLog:  args.TraceLog,
-		EnableZmodem:    args.Zmodem || strings.ToLower(getExOptionConfig(args, "EnableZmodem")) == "yes",
+		EnableZmodem:    zmodem,
 	})
+	if progress != nil {
+		progress.setFilter(trzszFilter)
+	}
 
 	// reset terminal size on resize
 	onTerminalResize(func(width, height int) {
@@ -158,11 +296,14 @@ func enableTrzsz(args *sshArgs, client *ssh.Client, session *ssh.Session,
 
 	// setup default paths
 	trzszFilter.SetDefaultUploadPath(userConfig.defaultUploadPath)
-	trzszFilter.SetDefaultDownloadPath(userConfig.defaultDownloadPath)
+	trzszFilter.SetDefaultDownloadPath(getTrzszDownloadPath(args))
 
 	// setup tunnel connect
 	trzszFilter.SetTunnelConnector(func(port int) net.Conn {
 		conn, _ := dialWithTimeout(client, "tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+		if conn != nil && verifier != nil {
+			return &verifyConn{conn, verifier}
+		}
 		return conn
 	})
 
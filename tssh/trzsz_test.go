@@ -0,0 +1,150 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestGetTrzszProbeCommand(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("command -v trz || command -v tsz || ls ~/.local/bin/trz || ls ~/.local/bin/tsz",
+		getTrzszProbeCommand(false))
+	assert.Equal("command -v trz || command -v tsz || ls ~/.local/bin/trz || ls ~/.local/bin/tsz"+
+		" || command -v rz || command -v sz", getTrzszProbeCommand(true))
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestTrzszUploadPathWriter(t *testing.T) {
+	assert := assert.New(t)
+	var buf bytes.Buffer
+	writer := &trzszUploadPathWriter{nopWriteCloser{&buf}, "~/firmware dir"}
+	for _, input := range []string{"\x03", "trz\r", "trz -d\r", "t", "r", "z", "\r", "trz file\r"} {
+		n, err := writer.Write([]byte(input))
+		assert.Nil(err)
+		assert.Equal(len(input), n)
+	}
+	assert.Equal("\x03trz ~/'firmware dir'\rtrz -d ~/'firmware dir'\rtrz\rtrz file\r", buf.String())
+}
+
+func TestHasRemoteTrzsz(t *testing.T) {
+	assert := assert.New(t)
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	assert.Nil(err)
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(hostSigner)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	defer listener.Close()
+
+	// the reply of the probe command
+	var reply string
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					if reply == "refused" {
+						_ = newChannel.Reject(ssh.ResourceShortage, "no more sessions")
+						continue
+					}
+					channel, requests, err := newChannel.Accept()
+					if err != nil {
+						continue
+					}
+					go func() {
+						defer channel.Close()
+						for req := range requests {
+							if req.Type != "exec" {
+								_ = req.Reply(false, nil)
+								continue
+							}
+							_ = req.Reply(true, nil)
+							switch reply {
+							case "found":
+								_, _ = channel.Write([]byte("/usr/local/bin/trz\n"))
+								_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+							case "missing":
+								_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{1}))
+							case "signal":
+								_, _ = channel.SendRequest("exit-signal", false, ssh.Marshal(struct {
+									Signal     string
+									CoreDumped bool
+									Error      string
+									Lang       string
+								}{"KILL", false, "", ""}))
+							}
+							return
+						}
+					}()
+				}
+			}()
+		}
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(err)
+	defer conn.Close()
+	c, chans, reqs, err := ssh.NewClientConn(conn, listener.Addr().String(),
+		&ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	assert.Nil(err)
+	client := ssh.NewClient(c, chans, reqs)
+	defer client.Close()
+
+	reply = "found"
+	assert.True(hasRemoteTrzsz(client, false))
+	reply = "missing"
+	assert.False(hasRemoteTrzsz(client, false))
+	reply = "refused"
+	assert.True(hasRemoteTrzsz(client, false))
+	reply = "signal"
+	assert.True(hasRemoteTrzsz(client, false))
+}
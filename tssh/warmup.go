@@ -0,0 +1,170 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the server closes the unauthenticated connection after LoginGraceTime, which is 120s by default.
+const kWarmupMaxAge = 60 * time.Second
+
+type warmupConn struct {
+	net.Conn
+	reader *bufio.Reader
+	ready  chan struct{}
+	since  time.Time
+}
+
+func (c *warmupConn) Read(p []byte) (int, error) {
+	if c.reader != nil {
+		return c.reader.Read(p)
+	}
+	return c.Conn.Read(p)
+}
+
+var (
+	warmupMutex sync.Mutex
+	warmupConns = make(map[string]*warmupConn)
+)
+
+func getWarmupKey(network, addr string) string {
+	return fmt.Sprintf("%s/%s", network, addr)
+}
+
+// readServerVersion reads the version banner of the server to make sure it's alive,
+// and keeps the buffered data so that the ssh handshake could read it again.
+func (c *warmupConn) readServerVersion() error {
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer func() { _ = c.SetReadDeadline(time.Time{}) }()
+	reader := bufio.NewReader(c.Conn)
+	line, err := reader.Peek(4)
+	if err != nil {
+		return err
+	}
+	if string(line) != "SSH-" {
+		return fmt.Errorf("unexpected server version: %q", line)
+	}
+	c.reader = reader
+	return nil
+}
+
+func warmupHost(alias string) {
+	args := &sshArgs{Destination: alias}
+	param, err := getLoginParam(args)
+	if err != nil || param.command != "" || len(param.proxy) > 0 || isWebSocketTransport(args) {
+		return
+	}
+	network := getDialNetwork(args)
+	key := getWarmupKey(network, param.addr)
+
+	warmupMutex.Lock()
+	if _, ok := warmupConns[key]; ok {
+		warmupMutex.Unlock()
+		return
+	}
+	wc := &warmupConn{ready: make(chan struct{})}
+	warmupConns[key] = wc
+	warmupMutex.Unlock()
+	defer close(wc.ready)
+
+	conn, err := net.DialTimeout(network, param.addr, 10*time.Second)
+	if err != nil {
+		debug("warm up [%s] dial tcp [%s] failed: %v", alias, param.addr, err)
+		return
+	}
+	wc.Conn = conn
+	if userConfig.promptWarmupBanner {
+		if err := wc.readServerVersion(); err != nil {
+			debug("warm up [%s] read server version failed: %v", alias, err)
+			_ = conn.Close()
+			wc.Conn = nil
+			return
+		}
+	}
+	wc.since = time.Now()
+}
+
+// startWarmup pre-dials the top hosts of the picker in the background,
+// the connections are taken by sshConnect or closed after logined.
+func startWarmup(hosts []*sshHost) {
+	count := int(userConfig.promptWarmupHosts)
+	if count <= 0 {
+		return
+	}
+	for i, host := range hosts {
+		if i >= count {
+			break
+		}
+		if strings.ContainsAny(host.Alias, "*?") {
+			continue
+		}
+		go warmupHost(host.Alias)
+	}
+	cleanupAfterLogined = append(cleanupAfterLogined, closeWarmupConns)
+}
+
+// takeWarmupConn returns the warm up connection of the address, or nil if there is none.
+func takeWarmupConn(network, addr string) net.Conn {
+	key := getWarmupKey(network, addr)
+	warmupMutex.Lock()
+	wc, ok := warmupConns[key]
+	delete(warmupConns, key)
+	warmupMutex.Unlock()
+	if !ok {
+		return nil
+	}
+	<-wc.ready
+	if wc.Conn == nil {
+		return nil
+	}
+	if time.Since(wc.since) > kWarmupMaxAge {
+		debug("warm up connection [%s] is too old", addr)
+		_ = wc.Conn.Close()
+		return nil
+	}
+	return wc
+}
+
+func closeWarmupConns() {
+	warmupMutex.Lock()
+	conns := warmupConns
+	warmupConns = make(map[string]*warmupConn)
+	warmupMutex.Unlock()
+	for _, wc := range conns {
+		go func(wc *warmupConn) {
+			<-wc.ready
+			if wc.Conn != nil {
+				_ = wc.Conn.Close()
+			}
+		}(wc)
+	}
+}
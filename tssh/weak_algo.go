@@ -0,0 +1,274 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	kWeakAlgorithmsWarn   = "warn"
+	kWeakAlgorithmsRefuse = "refuse"
+)
+
+var kStrongKexAlgos = []string{
+	"curve25519-sha256", "curve25519-sha256@libssh.org",
+	"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+	"diffie-hellman-group14-sha256", "diffie-hellman-group16-sha512", "diffie-hellman-group-exchange-sha256",
+}
+
+var kWeakKexAlgos = []string{
+	"diffie-hellman-group14-sha1", "diffie-hellman-group-exchange-sha1", "diffie-hellman-group1-sha1",
+}
+
+var kStrongCiphers = []string{
+	"aes128-gcm@openssh.com", "aes256-gcm@openssh.com", "chacha20-poly1305@openssh.com",
+	"aes128-ctr", "aes192-ctr", "aes256-ctr",
+}
+
+var kWeakCiphers = []string{
+	"aes128-cbc", "3des-cbc", "arcfour256", "arcfour128", "arcfour",
+}
+
+var kStrongMACs = []string{
+	"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com", "hmac-sha2-256", "hmac-sha2-512",
+}
+
+var kWeakMACs = []string{
+	"hmac-sha1", "hmac-sha1-96",
+}
+
+var kStrongHostKeyAlgos = []string{
+	ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSASHA512v01,
+	ssh.CertAlgoECDSA256v01, ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01, ssh.CertAlgoED25519v01,
+	ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512,
+	ssh.KeyAlgoED25519,
+}
+
+var kWeakHostKeyAlgos = []string{
+	ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01, ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+}
+
+func getWeakAlgorithmsPolicy(args *sshArgs) string {
+	value := strings.ToLower(getExOptionConfig(args, "WeakAlgorithms"))
+	switch value {
+	case "", kWeakAlgorithmsWarn, kWeakAlgorithmsRefuse:
+		return value
+	default:
+		warning("WeakAlgorithms %s is invalid, it should be %s or %s", value, kWeakAlgorithmsWarn, kWeakAlgorithmsRefuse)
+		return ""
+	}
+}
+
+func isWeakAlgorithm(algo string) bool {
+	for _, list := range [][]string{kWeakKexAlgos, kWeakCiphers, kWeakMACs, kWeakHostKeyAlgos} {
+		for _, weak := range list {
+			if algo == weak {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func filterWeakAlgorithms(algos []string) []string {
+	var result []string
+	for _, algo := range algos {
+		if !isWeakAlgorithm(algo) {
+			result = append(result, algo)
+		}
+	}
+	return result
+}
+
+// expandHostKeyAlgorithms prefers the SHA-2 signatures for the known RSA host keys.
+func expandHostKeyAlgorithms(algos []string) []string {
+	var result []string
+	for _, algo := range algos {
+		switch algo {
+		case ssh.KeyAlgoRSA:
+			result = append(result, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, algo)
+		case ssh.CertAlgoRSAv01:
+			result = append(result, ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01, algo)
+		default:
+			result = append(result, algo)
+		}
+	}
+	return result
+}
+
+// applyWeakAlgorithmsPolicy offers the weak algorithms after the strong ones on `warn`,
+// or does not offer any weak algorithm on `refuse`.
+func applyWeakAlgorithmsPolicy(policy string, config *ssh.ClientConfig) {
+	if policy == "" {
+		return
+	}
+	hostKeyAlgos := config.HostKeyAlgorithms
+	if len(hostKeyAlgos) == 0 {
+		hostKeyAlgos = append(append([]string{}, kStrongHostKeyAlgos...), kWeakHostKeyAlgos...)
+	} else {
+		hostKeyAlgos = expandHostKeyAlgorithms(hostKeyAlgos)
+	}
+	config.HostKeyAlgorithms = hostKeyAlgos
+	config.KeyExchanges = append(append([]string{}, kStrongKexAlgos...), kWeakKexAlgos...)
+	config.Ciphers = append(append([]string{}, kStrongCiphers...), kWeakCiphers...)
+	config.MACs = append(append([]string{}, kStrongMACs...), kWeakMACs...)
+	if policy == kWeakAlgorithmsRefuse {
+		config.HostKeyAlgorithms = filterWeakAlgorithms(config.HostKeyAlgorithms)
+		config.KeyExchanges = filterWeakAlgorithms(config.KeyExchanges)
+		config.Ciphers = filterWeakAlgorithms(config.Ciphers)
+		config.MACs = filterWeakAlgorithms(config.MACs)
+	}
+}
+
+// negotiateAlgorithm chooses the first client algorithm which is supported by the server, see RFC 4253 section 7.1.
+func negotiateAlgorithm(client, server []string) string {
+	for _, c := range client {
+		for _, s := range server {
+			if c == s {
+				return c
+			}
+		}
+	}
+	return ""
+}
+
+func isAEADCipher(cipher string) bool {
+	return strings.HasSuffix(cipher, "-gcm@openssh.com") || cipher == "chacha20-poly1305@openssh.com"
+}
+
+// findWeakAlgorithms returns the weak algorithms which are negotiated with the server.
+func findWeakAlgorithms(config *ssh.ClientConfig, server *kexInitMsg) []string {
+	var weakAlgos []string
+	seen := make(map[string]struct{})
+	check := func(kind string, client, server []string) string {
+		algo := negotiateAlgorithm(client, server)
+		if algo == "" || !isWeakAlgorithm(algo) {
+			return algo
+		}
+		name := fmt.Sprintf("%s %s", kind, algo)
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			weakAlgos = append(weakAlgos, name)
+		}
+		return algo
+	}
+	check("kex", config.KeyExchanges, server.KexAlgos)
+	check("hostkey", config.HostKeyAlgorithms, server.ServerHostKeyAlgos)
+	if cipher := check("cipher", config.Ciphers, server.CiphersClientServer); !isAEADCipher(cipher) {
+		check("mac", config.MACs, server.MACsClientServer)
+	}
+	if cipher := check("cipher", config.Ciphers, server.CiphersServerClient); !isAEADCipher(cipher) {
+		check("mac", config.MACs, server.MACsServerClient)
+	}
+	return weakAlgos
+}
+
+// parseServerKexInit parses the version and the first packet sent by the server,
+// returns false if more data is required.
+func parseServerKexInit(data []byte) (*kexInitMsg, bool) {
+	for i := 0; ; i++ {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			return nil, i >= 50
+		}
+		line := data[:idx]
+		data = data[idx+1:]
+		if bytes.HasPrefix(line, []byte("SSH-")) {
+			break
+		}
+	}
+	if len(data) < 5 {
+		return nil, false
+	}
+	length := binary.BigEndian.Uint32(data[:4])
+	padding := uint32(data[4])
+	if length < padding+1 || length > 256*1024 {
+		return nil, true
+	}
+	if uint32(len(data)) < 4+length {
+		return nil, false
+	}
+	kexInit, err := parseKexInit(data[5 : 4+length-padding])
+	if err != nil {
+		return nil, true
+	}
+	return kexInit, true
+}
+
+// kexInitSniffer records the plaintext kexinit message of the server.
+type kexInitSniffer struct {
+	net.Conn
+	mutex   sync.Mutex
+	buf     []byte
+	done    bool
+	kexInit *kexInitMsg
+}
+
+func (c *kexInitSniffer) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.mutex.Lock()
+		if !c.done {
+			c.buf = append(c.buf, p[:n]...)
+			c.kexInit, c.done = parseServerKexInit(c.buf)
+			if c.done {
+				c.buf = nil
+			}
+		}
+		c.mutex.Unlock()
+	}
+	return n, err
+}
+
+func (c *kexInitSniffer) serverKexInit() *kexInitMsg {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.kexInit
+}
+
+// reportWeakAlgorithms warns and audits the weak algorithms negotiated with the server.
+func reportWeakAlgorithms(args *sshArgs, param *loginParam, config *ssh.ClientConfig, sniffer *kexInitSniffer) {
+	kexInit := sniffer.serverKexInit()
+	if kexInit == nil {
+		debug("no kexinit message of [%s] to check the weak algorithms", param.addr)
+		return
+	}
+	weakAlgos := findWeakAlgorithms(config, kexInit)
+	if len(weakAlgos) == 0 {
+		return
+	}
+	warning("!!! [%s] negotiated WEAK algorithms: %s, please upgrade the server !!!", args.Destination, strings.Join(weakAlgos, ", "))
+	audit("weak algorithms of [%s] at [%s] user [%s]: %s", args.Destination, param.addr, param.user, strings.Join(weakAlgos, ", "))
+}
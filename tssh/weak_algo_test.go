@@ -0,0 +1,109 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestWeakAlgorithms(t *testing.T) {
+	assert := assert.New(t)
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	assert.Nil(err)
+
+	listen := func(kex, ciphers []string) net.Listener {
+		serverConfig := &ssh.ServerConfig{
+			Config:       ssh.Config{KeyExchanges: kex, Ciphers: ciphers, MACs: []string{"hmac-sha2-256", "hmac-sha1"}},
+			NoClientAuth: true,
+		}
+		serverConfig.AddHostKey(hostSigner)
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(err)
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					_, _, _, _ = ssh.NewServerConn(conn, serverConfig)
+				}()
+			}
+		}()
+		return listener
+	}
+
+	login := func(listener net.Listener, policy string) ([]string, error) {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		assert.Nil(err)
+		defer conn.Close()
+		sniffer := &kexInitSniffer{Conn: conn}
+		config := &ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey()}
+		applyWeakAlgorithmsPolicy(policy, config)
+		_, _, _, err = ssh.NewClientConn(sniffer, conn.RemoteAddr().String(), config)
+		if err != nil {
+			return nil, err
+		}
+		kexInit := sniffer.serverKexInit()
+		assert.NotNil(kexInit)
+		return findWeakAlgorithms(config, kexInit), nil
+	}
+
+	// the legacy server only supports the weak key exchange
+	listener := listen([]string{"diffie-hellman-group1-sha1"}, []string{"aes256-ctr", "3des-cbc"})
+	defer listener.Close()
+	weakAlgos, err := login(listener, kWeakAlgorithmsWarn)
+	assert.Nil(err)
+	assert.Equal([]string{"kex diffie-hellman-group1-sha1"}, weakAlgos)
+	_, err = login(listener, kWeakAlgorithmsRefuse)
+	assert.NotNil(err)
+
+	// the legacy server only supports the weak cipher
+	listener = listen([]string{"curve25519-sha256", "diffie-hellman-group1-sha1"}, []string{"3des-cbc"})
+	defer listener.Close()
+	weakAlgos, err = login(listener, kWeakAlgorithmsWarn)
+	assert.Nil(err)
+	assert.Equal([]string{"cipher 3des-cbc"}, weakAlgos)
+	_, err = login(listener, kWeakAlgorithmsRefuse)
+	assert.NotNil(err)
+}
+
+func TestExpandHostKeyAlgorithms(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{ssh.KeyAlgoED25519}, expandHostKeyAlgorithms([]string{ssh.KeyAlgoED25519}))
+	assert.Equal([]string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA},
+		expandHostKeyAlgorithms([]string{ssh.KeyAlgoRSA}))
+	assert.Equal([]string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256},
+		filterWeakAlgorithms(expandHostKeyAlgorithms([]string{ssh.KeyAlgoRSA})))
+}
@@ -0,0 +1,158 @@
+/*
+MIT License
+
+Copyright (c) 2023 Lonny Wong <lonnywong@qq.com>
+Copyright (c) 2023 [Contributors](https://github.com/trzsz/trzsz-ssh/graphs/contributors)
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*/
+
+package tssh
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsConn tunnels the ssh stream in binary websocket messages.
+type wsConn struct {
+	*websocket.Conn
+	reader  io.Reader
+	writeMu sync.Mutex
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			msgType, reader, err := c.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			if msgType != websocket.BinaryMessage && msgType != websocket.TextMessage {
+				continue
+			}
+			c.reader = reader
+		}
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func getWebSocketTLSConfig(args *sshArgs) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: getExOptionConfig(args, "WebSocketServerName"),
+	}
+	if strings.ToLower(getExOptionConfig(args, "WebSocketInsecure")) == "yes" {
+		config.InsecureSkipVerify = true
+	}
+	if caFile := getExOptionConfig(args, "WebSocketCAFile"); caFile != "" {
+		caFile = resolveHomeDir(caFile)
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read WebSocketCAFile [%s] failed: %v", caFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in WebSocketCAFile [%s]", caFile)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+func getWebSocketHeader(args *sshArgs) (http.Header, error) {
+	header := http.Header{}
+	for _, cfg := range getAllExOptionConfig(args, "WebSocketHeader") {
+		name, value, ok := strings.Cut(cfg, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid WebSocketHeader: %s", cfg)
+		}
+		header.Add(strings.TrimSpace(name), os.ExpandEnv(strings.TrimSpace(value)))
+	}
+	return header, nil
+}
+
+func isWebSocketTransport(args *sshArgs) bool {
+	return strings.ToLower(getExOptionConfig(args, "Transport")) == "websocket"
+}
+
+// dialWebSocket dials the `WebSocketURL` for `Transport websocket`,
+// and the `HTTPS_PROXY` environment variable is honored.
+func dialWebSocket(args *sshArgs, param *loginParam, timeout time.Duration) (net.Conn, error) {
+	url := getExOptionConfig(args, "WebSocketURL")
+	if url == "" {
+		return nil, fmt.Errorf("WebSocketURL is required for Transport websocket")
+	}
+	url = expandTokens(url, args, param, "%hnpr")
+	tlsConfig, err := getWebSocketTLSConfig(args)
+	if err != nil {
+		return nil, err
+	}
+	header, err := getWebSocketHeader(args)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: timeout,
+		TLSClientConfig:  tlsConfig,
+	}
+	debug("dial websocket [%s]", url)
+	conn, resp, err := dialer.Dial(url, header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("dial websocket [%s] failed: %v: %s", url, err, resp.Status)
+		}
+		return nil, fmt.Errorf("dial websocket [%s] failed: %v", url, err)
+	}
+	return &wsConn{Conn: conn}, nil
+}